@@ -1,13 +1,24 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 	"yuqueppbackend/service-base/config"
+	"yuqueppbackend/service-base/dao"
 	"yuqueppbackend/service-base/db"
 	"yuqueppbackend/service-base/routes"
 	"yuqueppbackend/service-base/util"
 )
 
+// shutdownTimeout 退出时等待进行中请求结束的最长时间
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	// 初始化配置
 
@@ -17,8 +28,38 @@ func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	// 初始化数据库单例对象
 	db.GetDB()
+	// 将配置中的邮箱设为管理员
+	if promoted, err := dao.NewUserDAO().PromoteAdmins(config.GetAdminEmails()); err != nil {
+		log.Println(err)
+	} else if promoted > 0 {
+		log.Printf("已将 %d 个用户设为管理员", promoted)
+	}
 	util.GetRedisClient()
 	util.GetElasticSearchClient()
+	// 启动时加载 JWT 密钥，配置错误时立即退出
+	util.GetJWTKeySet()
 	r := routes.SetupRouter()
-	r.Run(config.GetServerPort())
+	// 后台任务在 HTTP 服务停止后才取消，保证最后一批请求产生的审计日志也能写入
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	jobs := routes.StartBackgroundJobs(jobsCtx)
+
+	srv := &http.Server{Addr: config.GetServerPort(), Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	// 收到退出信号后停止接收新请求，等待进行中的请求结束
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("正在关闭服务...")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Println(err)
+	}
+	stopJobs()
+	jobs.Wait()
 }
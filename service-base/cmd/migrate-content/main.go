@@ -0,0 +1,73 @@
+// migrate-content 将文档内容从一个存储后端复制到另一个存储后端，例如：
+//
+//	go run ./service-base/cmd/migrate-content -from local -to s3
+//
+// 需要在项目根目录下运行，以便读取 service-base/config/config.yaml。
+// 复制完成后将配置中的 content_store.backend 切换为目标后端即可。
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"log"
+	"yuqueppbackend/service-base/config"
+	"yuqueppbackend/service-base/util"
+)
+
+func main() {
+	from := flag.String("from", "local", "源存储后端（local 或 s3）")
+	to := flag.String("to", "s3", "目标存储后端（local 或 s3）")
+	prefix := flag.String("prefix", "", "只迁移以该前缀开头的 key")
+	overwrite := flag.Bool("overwrite", false, "目标中已存在且内容不同时是否覆盖")
+	dryRun := flag.Bool("dry-run", false, "只列出需要复制的内容，不实际写入")
+	flag.Parse()
+
+	if *from == *to {
+		log.Fatalf("源与目标存储后端相同: %s", *from)
+	}
+	if err := config.InitConfig(); err != nil {
+		panic(err)
+	}
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	source, err := util.NewContentStore(*from)
+	if err != nil {
+		log.Fatalf("创建源存储失败: %v", err)
+	}
+	target, err := util.NewContentStore(*to)
+	if err != nil {
+		log.Fatalf("创建目标存储失败: %v", err)
+	}
+
+	var copied, skipped, conflicts int
+	err = source.List(*prefix, func(key string) error {
+		data, err := source.Get(key)
+		if err != nil {
+			return err
+		}
+		existing, err := target.Get(key)
+		switch {
+		case err == nil && bytes.Equal(existing, data):
+			skipped++
+			return nil
+		case err == nil && !*overwrite:
+			log.Printf("目标中已存在不同的内容，跳过: %s", key)
+			conflicts++
+			return nil
+		case err != nil && !errors.Is(err, util.ErrContentNotFound):
+			return err
+		}
+		if *dryRun {
+			log.Printf("将复制: %s (%d 字节)", key, len(data))
+		} else if err := target.Put(key, data); err != nil {
+			return err
+		}
+		copied++
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("迁移失败: %v", err)
+	}
+	log.Printf("迁移完成：复制 %d 个，已存在相同内容 %d 个，冲突跳过 %d 个", copied, skipped, conflicts)
+}
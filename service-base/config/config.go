@@ -5,6 +5,7 @@ import (
 	"github.com/spf13/viper"
 	"log"
 	"os"
+	"time"
 )
 
 func InitConfig() error {
@@ -46,3 +47,439 @@ func GetRedisConfig() map[string]interface{} {
 func GetElasticSearchAddress() string {
 	return viper.GetString("elasticsearch.address")
 }
+
+// GetCollabAllowedOrigins 允许建立协同编辑 WebSocket 连接的跨站来源，与服务同源的连接始终允许
+func GetCollabAllowedOrigins() []string {
+	return viper.GetStringSlice("collab.allowed_origins")
+}
+
+// GetTrashRetention 回收站中条目的保留时长，默认 30 天
+func GetTrashRetention() time.Duration {
+	days := viper.GetInt("trash.retention_days")
+	if days <= 0 {
+		days = 30
+	}
+	return time.Hour * 24 * time.Duration(days)
+}
+
+// GetTrashSweepInterval 后台清理过期回收站条目的间隔，默认 1 小时
+func GetTrashSweepInterval() time.Duration {
+	minutes := viper.GetInt("trash.sweep_interval_minutes")
+	if minutes <= 0 {
+		minutes = 60
+	}
+	return time.Minute * time.Duration(minutes)
+}
+
+// GetAccountDeletionGracePeriod 申请注销账号后的宽限期，宽限期内可以撤销，默认 14 天
+func GetAccountDeletionGracePeriod() time.Duration {
+	days := viper.GetInt("account.deletion_grace_days")
+	if days <= 0 {
+		days = 14
+	}
+	return time.Hour * 24 * time.Duration(days)
+}
+
+// GetDataExportTTL 个人数据导出文件的保留时长，默认 72 小时
+func GetDataExportTTL() time.Duration {
+	hours := viper.GetInt("account.export_ttl_hours")
+	if hours <= 0 {
+		hours = 72
+	}
+	return time.Hour * time.Duration(hours)
+}
+
+// GetAccountSweepInterval 后台注销到期账号、清理过期导出文件的间隔，默认 1 小时
+func GetAccountSweepInterval() time.Duration {
+	minutes := viper.GetInt("account.sweep_interval_minutes")
+	if minutes <= 0 {
+		minutes = 60
+	}
+	return time.Minute * time.Duration(minutes)
+}
+
+// GetContentStoreBackend 文档内容存储后端：local（默认，保存在 document_store_path 下）或 s3
+func GetContentStoreBackend() string {
+	return viper.GetString("content_store.backend")
+}
+
+// S3Config 兼容 S3 协议的对象存储配置
+type S3Config struct {
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	Region    string
+	Prefix    string // 对象 key 的统一前缀，可为空
+	UseSSL    bool
+}
+
+func GetS3Config() S3Config {
+	return S3Config{
+		Endpoint:  viper.GetString("content_store.s3.endpoint"),
+		AccessKey: viper.GetString("content_store.s3.access_key"),
+		SecretKey: viper.GetString("content_store.s3.secret_key"),
+		Bucket:    viper.GetString("content_store.s3.bucket"),
+		Region:    viper.GetString("content_store.s3.region"),
+		Prefix:    viper.GetString("content_store.s3.prefix"),
+		UseSSL:    viper.GetBool("content_store.s3.use_ssl"),
+	}
+}
+
+// GetBcryptCost 密码哈希使用的 bcrypt cost，默认 12，超出 bcrypt 允许的范围时使用默认值
+func GetBcryptCost() int {
+	cost := viper.GetInt("security.bcrypt_cost")
+	if cost < 4 || cost > 31 {
+		cost = 12
+	}
+	return cost
+}
+
+// GetAccessTokenTTL 访问令牌的有效期，默认 15 分钟
+func GetAccessTokenTTL() time.Duration {
+	minutes := viper.GetInt("auth.access_token_ttl_minutes")
+	if minutes <= 0 {
+		minutes = 15
+	}
+	return time.Minute * time.Duration(minutes)
+}
+
+// GetRefreshTokenTTL 刷新令牌（登录会话）的有效期，默认 30 天，每次刷新后重新计算
+func GetRefreshTokenTTL() time.Duration {
+	days := viper.GetInt("auth.refresh_token_ttl_days")
+	if days <= 0 {
+		days = 30
+	}
+	return time.Hour * 24 * time.Duration(days)
+}
+
+// JWTKeyConfig 一把 JWT 签名密钥。密钥材料可以直接写在配置中，也可以通过环境变量或文件提供；
+// 只配置了公钥的密钥只用于校验，适合轮换后暂时保留的旧密钥
+type JWTKeyConfig struct {
+	Kid            string `mapstructure:"kid"`
+	Alg            string `mapstructure:"alg"`              // HS256、RS256 或 EdDSA
+	Secret         string `mapstructure:"secret"`           // HS256 密钥
+	SecretEnv      string `mapstructure:"secret_env"`       // 从该环境变量读取 HS256 密钥
+	PrivateKeyFile string `mapstructure:"private_key_file"` // PEM 格式私钥
+	PrivateKeyEnv  string `mapstructure:"private_key_env"`  // 从该环境变量读取 PEM 格式私钥
+	PublicKeyFile  string `mapstructure:"public_key_file"`  // PEM 格式公钥，配置了私钥时可省略
+}
+
+// JWTConfig JWT 签发配置
+type JWTConfig struct {
+	Issuer     string
+	SigningKid string // 签发新 token 使用的密钥
+	Keys       []JWTKeyConfig
+}
+
+// GetJWTConfig 读取 JWT 配置，环境变量 JWT_ISSUER、JWT_SIGNING_KID 优先于配置文件
+func GetJWTConfig() (JWTConfig, error) {
+	cfg := JWTConfig{
+		Issuer:     viper.GetString("jwt.issuer"),
+		SigningKid: viper.GetString("jwt.signing_kid"),
+	}
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		cfg.Issuer = issuer
+	}
+	if kid := os.Getenv("JWT_SIGNING_KID"); kid != "" {
+		cfg.SigningKid = kid
+	}
+	if cfg.Issuer == "" {
+		cfg.Issuer = "yuquepp"
+	}
+	if err := viper.UnmarshalKey("jwt.keys", &cfg.Keys); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// MailConfig 邮件发送配置
+type MailConfig struct {
+	Driver      string // smtp 或 log（默认，只打印到日志，用于本地开发）
+	From        string
+	LinkBaseURL string // 邮件中链接指向的前端地址
+	SMTPHost    string
+	SMTPPort    int
+	SMTPUser    string
+	SMTPPass    string
+}
+
+// GetMailConfig 读取邮件配置，SMTP 密码可以通过环境变量 SMTP_PASSWORD 提供
+func GetMailConfig() MailConfig {
+	cfg := MailConfig{
+		Driver:      viper.GetString("mail.driver"),
+		From:        viper.GetString("mail.from"),
+		LinkBaseURL: viper.GetString("mail.link_base_url"),
+		SMTPHost:    viper.GetString("mail.smtp.host"),
+		SMTPPort:    viper.GetInt("mail.smtp.port"),
+		SMTPUser:    viper.GetString("mail.smtp.username"),
+		SMTPPass:    viper.GetString("mail.smtp.password"),
+	}
+	if password := os.Getenv("SMTP_PASSWORD"); password != "" {
+		cfg.SMTPPass = password
+	}
+	if cfg.SMTPPort == 0 {
+		cfg.SMTPPort = 25
+	}
+	return cfg
+}
+
+// GetEmailVerifyTokenTTL 邮箱验证链接的有效期，默认 24 小时
+func GetEmailVerifyTokenTTL() time.Duration {
+	hours := viper.GetInt("auth.email_verify_ttl_hours")
+	if hours <= 0 {
+		hours = 24
+	}
+	return time.Hour * time.Duration(hours)
+}
+
+// GetPasswordResetTokenTTL 重置密码链接的有效期，默认 30 分钟
+func GetPasswordResetTokenTTL() time.Duration {
+	minutes := viper.GetInt("auth.password_reset_ttl_minutes")
+	if minutes <= 0 {
+		minutes = 30
+	}
+	return time.Minute * time.Duration(minutes)
+}
+
+// RequireEmailVerification 是否要求邮箱验证后才能登录，默认关闭以兼容已有用户
+func RequireEmailVerification() bool {
+	return viper.GetBool("auth.require_email_verification")
+}
+
+// GetTOTPIssuer 验证器应用中显示的服务名称
+func GetTOTPIssuer() string {
+	issuer := viper.GetString("auth.totp_issuer")
+	if issuer == "" {
+		issuer = "yuquepp"
+	}
+	return issuer
+}
+
+// LoginGuardConfig 登录防暴力破解配置
+type LoginGuardConfig struct {
+	IPMaxPerMinute     int           // 每个 IP 每分钟允许的登录请求数
+	EmailMaxPerMinute  int           // 每个邮箱每分钟允许的登录请求数，无论成功与否
+	DelayAfterFailures int           // 同一邮箱连续失败多少次后开始要求等待
+	MaxDelay           time.Duration // 等待时间按失败次数翻倍，最长不超过该值
+	MaxFailures        int           // 统计窗口内失败达到该次数后锁定账号
+	FailureWindow      time.Duration // 失败次数的统计窗口
+	LockoutDuration    time.Duration // 账号锁定时长
+}
+
+// GetLoginGuardConfig 读取登录防暴力破解配置，未配置的项使用默认值
+func GetLoginGuardConfig() LoginGuardConfig {
+	cfg := LoginGuardConfig{
+		IPMaxPerMinute:     viper.GetInt("security.login.ip_max_per_minute"),
+		EmailMaxPerMinute:  viper.GetInt("security.login.email_max_per_minute"),
+		DelayAfterFailures: viper.GetInt("security.login.delay_after_failures"),
+		MaxDelay:           time.Second * time.Duration(viper.GetInt("security.login.max_delay_seconds")),
+		MaxFailures:        viper.GetInt("security.login.max_failures"),
+		FailureWindow:      time.Minute * time.Duration(viper.GetInt("security.login.failure_window_minutes")),
+		LockoutDuration:    time.Minute * time.Duration(viper.GetInt("security.login.lockout_minutes")),
+	}
+	if cfg.IPMaxPerMinute <= 0 {
+		cfg.IPMaxPerMinute = 20
+	}
+	if cfg.EmailMaxPerMinute <= 0 {
+		cfg.EmailMaxPerMinute = 5
+	}
+	if cfg.DelayAfterFailures <= 0 {
+		cfg.DelayAfterFailures = 3
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = time.Minute
+	}
+	if cfg.MaxFailures <= 0 {
+		cfg.MaxFailures = 10
+	}
+	if cfg.FailureWindow <= 0 {
+		cfg.FailureWindow = 15 * time.Minute
+	}
+	if cfg.LockoutDuration <= 0 {
+		cfg.LockoutDuration = 30 * time.Minute
+	}
+	return cfg
+}
+
+// ShareGuardConfig 分享链接匿名访问的频率限制配置
+type ShareGuardConfig struct {
+	PasswordMaxAttempts int           // 同一 IP 在窗口内对同一分享链接最多尝试访问密码的次数
+	PasswordWindow      time.Duration // 访问密码尝试次数的统计窗口
+	CommentMaxPerHour   int           // 同一 IP 每小时通过同一分享链接最多发表的匿名评论数
+}
+
+// GetShareGuardConfig 读取分享链接的频率限制配置，未配置的项使用默认值
+func GetShareGuardConfig() ShareGuardConfig {
+	cfg := ShareGuardConfig{
+		PasswordMaxAttempts: viper.GetInt("share.password_max_attempts"),
+		PasswordWindow:      time.Minute * time.Duration(viper.GetInt("share.password_window_minutes")),
+		CommentMaxPerHour:   viper.GetInt("share.comment_max_per_hour"),
+	}
+	if cfg.PasswordMaxAttempts <= 0 {
+		cfg.PasswordMaxAttempts = 10
+	}
+	if cfg.PasswordWindow <= 0 {
+		cfg.PasswordWindow = 15 * time.Minute
+	}
+	if cfg.CommentMaxPerHour <= 0 {
+		cfg.CommentMaxPerHour = 20
+	}
+	return cfg
+}
+
+// GetAdminEmails 启动时自动设为管理员的用户邮箱
+func GetAdminEmails() []string {
+	return viper.GetStringSlice("security.admin_emails")
+}
+
+// CaptchaConfig 图形验证码配置
+type CaptchaConfig struct {
+	Store           string        // redis（默认，多实例共享）或 memory（仅单实例）
+	TTL             time.Duration // 验证码有效期
+	Driver          string        // digit（默认）、string 或 math
+	Height          int
+	Width           int
+	Length          int     // 字符个数，math 驱动忽略
+	MaxSkew         float64 // digit 驱动的字符倾斜程度
+	DotCount        int     // digit 驱动的干扰点数量
+	NoiseCount      int     // string、math 驱动的干扰字符数量
+	ShowLineOptions int     // string、math 驱动的干扰线选项
+	Source          string  // string 驱动的候选字符
+}
+
+// GetCaptchaConfig 读取验证码配置，未配置的项使用与原有验证码一致的默认值
+func GetCaptchaConfig() CaptchaConfig {
+	cfg := CaptchaConfig{
+		Store:           viper.GetString("captcha.store"),
+		TTL:             time.Second * time.Duration(viper.GetInt("captcha.ttl_seconds")),
+		Driver:          viper.GetString("captcha.driver"),
+		Height:          viper.GetInt("captcha.height"),
+		Width:           viper.GetInt("captcha.width"),
+		Length:          viper.GetInt("captcha.length"),
+		MaxSkew:         viper.GetFloat64("captcha.max_skew"),
+		DotCount:        viper.GetInt("captcha.dot_count"),
+		NoiseCount:      viper.GetInt("captcha.noise_count"),
+		ShowLineOptions: viper.GetInt("captcha.show_line_options"),
+		Source:          viper.GetString("captcha.source"),
+	}
+	if cfg.Store == "" {
+		cfg.Store = "redis"
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 5 * time.Minute
+	}
+	if cfg.Driver == "" {
+		cfg.Driver = "digit"
+	}
+	if cfg.Height <= 0 {
+		cfg.Height = 80
+	}
+	if cfg.Width <= 0 {
+		cfg.Width = 240
+	}
+	if cfg.Length <= 0 {
+		cfg.Length = 5
+	}
+	if cfg.MaxSkew <= 0 {
+		cfg.MaxSkew = 0.7
+	}
+	if cfg.DotCount <= 0 {
+		cfg.DotCount = 80
+	}
+	if cfg.Source == "" {
+		cfg.Source = "23456789abcdefghjkmnpqrstuvwxyz"
+	}
+	return cfg
+}
+
+// OIDCProviderConfig 一个 OpenID Connect 身份提供方
+type OIDCProviderConfig struct {
+	Name            string   `mapstructure:"name"`         // 出现在登录地址中的标识，如 /api/auth/oidc/<name>/login
+	DisplayName     string   `mapstructure:"display_name"` // 登录页按钮上显示的名称
+	Issuer          string   `mapstructure:"issuer"`       // 签发者地址，通过 <issuer>/.well-known/openid-configuration 自动发现端点
+	ClientID        string   `mapstructure:"client_id"`
+	ClientSecret    string   `mapstructure:"client_secret"`     // 公共客户端（只使用 PKCE）可以留空
+	ClientSecretEnv string   `mapstructure:"client_secret_env"` // 从该环境变量读取 client_secret
+	RedirectURL     string   `mapstructure:"redirect_url"`      // 在身份提供方登记的回调地址，指向 /api/auth/oidc/<name>/callback
+	Scopes          []string `mapstructure:"scopes"`            // 额外申请的 scope，openid 会自动加入
+	TrustEmail      bool     `mapstructure:"trust_email"`       // 身份提供方不返回 email_verified 时，是否视邮箱为已验证
+	DisableSignup   bool     `mapstructure:"disable_signup"`    // 禁止为没有对应账号的用户自动注册
+}
+
+// OIDCConfig 单点登录配置
+type OIDCConfig struct {
+	FrontendCallbackURL string // 登录完成后重定向回的前端页面，携带一次性登录码或错误码
+	Providers           []OIDCProviderConfig
+}
+
+// GetOIDCConfig 读取单点登录配置
+func GetOIDCConfig() (OIDCConfig, error) {
+	cfg := OIDCConfig{FrontendCallbackURL: viper.GetString("oidc.frontend_callback_url")}
+	if err := viper.UnmarshalKey("oidc.providers", &cfg.Providers); err != nil {
+		return cfg, err
+	}
+	for i := range cfg.Providers {
+		if cfg.Providers[i].ClientSecretEnv != "" {
+			if secret := os.Getenv(cfg.Providers[i].ClientSecretEnv); secret != "" {
+				cfg.Providers[i].ClientSecret = secret
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// PlanQuota 会员套餐的配额，0 表示不限制
+type PlanQuota struct {
+	MaxKnowledgeBases  int64 `json:"max_knowledge_bases"`  // 可创建的知识库数量
+	MaxDocumentsPerKB  int64 `json:"max_documents_per_kb"` // 每个知识库的文档数量
+	MaxStorageBytes    int64 `json:"max_storage_bytes"`    // 全部知识库（含历史版本）占用的存储空间
+	MaxAttachmentBytes int64 `json:"max_attachment_bytes"` // 单次上传文件的大小
+	MaxCollaborators   int64 `json:"max_collaborators"`    // 每个知识库的协作者数量（不含所有者）
+}
+
+// StorageAllowance 已使用 used 字节时最多还能写入的字节数，即单次上传上限与剩余存储空间中较小的一个，
+// 两者都不限制时返回 -1
+func (quota PlanQuota) StorageAllowance(used int64) int64 {
+	allowance := int64(-1)
+	if quota.MaxAttachmentBytes > 0 {
+		allowance = quota.MaxAttachmentBytes
+	}
+	if quota.MaxStorageBytes > 0 {
+		remaining := max(quota.MaxStorageBytes-used, 0)
+		if allowance < 0 || remaining < allowance {
+			allowance = remaining
+		}
+	}
+	return allowance
+}
+
+// 各套餐的默认配额，可以通过配置文件 plans.<套餐>.<配额> 覆盖
+var defaultPlanQuotas = map[string]PlanQuota{
+	"free": {MaxKnowledgeBases: 3, MaxDocumentsPerKB: 100, MaxStorageBytes: 100 << 20, MaxAttachmentBytes: 5 << 20, MaxCollaborators: 3},
+	"pro":  {MaxKnowledgeBases: 50, MaxDocumentsPerKB: 2000, MaxStorageBytes: 10 << 30, MaxAttachmentBytes: 50 << 20, MaxCollaborators: 20},
+	"team": {MaxKnowledgeBases: 0, MaxDocumentsPerKB: 10000, MaxStorageBytes: 100 << 30, MaxAttachmentBytes: 200 << 20, MaxCollaborators: 200},
+}
+
+// GetPlanQuota 读取套餐配额，未知套餐按 free 处理
+func GetPlanQuota(plan string) PlanQuota {
+	quota, ok := defaultPlanQuotas[plan]
+	if !ok {
+		plan = "free"
+		quota = defaultPlanQuotas[plan]
+	}
+	overrides := map[string]*int64{
+		"max_knowledge_bases":  &quota.MaxKnowledgeBases,
+		"max_documents_per_kb": &quota.MaxDocumentsPerKB,
+		"max_storage_bytes":    &quota.MaxStorageBytes,
+		"max_attachment_bytes": &quota.MaxAttachmentBytes,
+		"max_collaborators":    &quota.MaxCollaborators,
+	}
+	for name, value := range overrides {
+		key := "plans." + plan + "." + name
+		if viper.IsSet(key) {
+			*value = viper.GetInt64(key)
+		}
+	}
+	return quota
+}
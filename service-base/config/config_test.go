@@ -0,0 +1,47 @@
+package config
+
+import (
+	"github.com/spf13/viper"
+	"testing"
+)
+
+func TestGetPlanQuota(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	if got := GetPlanQuota("pro"); got != defaultPlanQuotas["pro"] {
+		t.Fatalf("pro = %+v, want defaults", got)
+	}
+	// 未知套餐按 free 处理
+	if got := GetPlanQuota("gold"); got != defaultPlanQuotas["free"] {
+		t.Fatalf("unknown plan = %+v, want free defaults", got)
+	}
+	viper.Set("plans.free.max_documents_per_kb", 5)
+	viper.Set("plans.free.max_knowledge_bases", 0)
+	got := GetPlanQuota("free")
+	if got.MaxDocumentsPerKB != 5 || got.MaxKnowledgeBases != 0 {
+		t.Fatalf("overrides not applied: %+v", got)
+	}
+	if got.MaxCollaborators != defaultPlanQuotas["free"].MaxCollaborators {
+		t.Fatalf("unset quota changed: %+v", got)
+	}
+}
+
+func TestPlanQuotaStorageAllowance(t *testing.T) {
+	cases := []struct {
+		name  string
+		quota PlanQuota
+		used  int64
+		want  int64
+	}{
+		{"unlimited", PlanQuota{}, 1 << 40, -1},
+		{"attachment only", PlanQuota{MaxAttachmentBytes: 100}, 1 << 40, 100},
+		{"storage only", PlanQuota{MaxStorageBytes: 1000}, 300, 700},
+		{"attachment smaller", PlanQuota{MaxStorageBytes: 1000, MaxAttachmentBytes: 100}, 300, 100},
+		{"remaining smaller", PlanQuota{MaxStorageBytes: 1000, MaxAttachmentBytes: 100}, 950, 50},
+		{"storage used up", PlanQuota{MaxStorageBytes: 1000, MaxAttachmentBytes: 100}, 1200, 0},
+	}
+	for _, tc := range cases {
+		if got := tc.quota.StorageAllowance(tc.used); got != tc.want {
+			t.Errorf("%s: StorageAllowance(%d) = %d, want %d", tc.name, tc.used, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,583 @@
+package controllers
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"yuqueppbackend/service-base/config"
+	"yuqueppbackend/service-base/dao"
+	"yuqueppbackend/service-base/models"
+	"yuqueppbackend/service-base/util"
+)
+
+// accountPurgeBatch 每轮注销的账号数
+const accountPurgeBatch = 50
+
+// dataExportQueueSize 等待生成的数据导出任务数上限
+const dataExportQueueSize = 64
+
+// dataExportJob 等待后台生成的数据导出任务
+type dataExportJob struct {
+	user   *models.User
+	export *util.DataExport
+}
+
+// dataExportQueue 由 RunDataExportWorker 消费，导出在后台任务中生成，服务关闭时等待当前导出完成
+var dataExportQueue = make(chan dataExportJob, dataExportQueueSize)
+
+type AccountController struct {
+	accountDao  *dao.AccountDAO
+	kbDao       *dao.KBDAO
+	docDao      *dao.DocDao
+	commentDao  *dao.CommentDAO
+	identityDao *dao.UserIdentityDAO
+}
+
+func NewAccountController(accountDao *dao.AccountDAO, kbDao *dao.KBDAO, docDao *dao.DocDao, commentDao *dao.CommentDAO, identityDao *dao.UserIdentityDAO) *AccountController {
+	return &AccountController{accountDao: accountDao, kbDao: kbDao, docDao: docDao, commentDao: commentDao, identityDao: identityDao}
+}
+
+func dataExportToMap(export *util.DataExport) map[string]interface{} {
+	return map[string]interface{}{
+		"export_id":   export.ID,
+		"status":      export.Status,
+		"size":        export.Size,
+		"created_at":  export.CreatedAt,
+		"finished_at": export.FinishedAt,
+		"expires_at":  export.ExpiresAt,
+	}
+}
+
+// buildDataExport 生成个人数据导出文件：profile.json 为个人资料与关联的外部身份，
+// knowledge_bases.json 与 knowledge_bases/ 目录为拥有的知识库及其中的文档（Markdown），comments.json 为发表的评论。
+// 文档逐篇写入 w，不在内存中保留整个压缩包
+func (ac *AccountController) buildDataExport(user *models.User, w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	identities, err := ac.identityDao.GetIdentitiesByUserID(user.ID)
+	if err != nil {
+		return err
+	}
+	identityList := make([]map[string]interface{}, 0, len(identities))
+	for _, identity := range identities {
+		identityList = append(identityList, identityToMap(identity))
+	}
+	// 不包含密码哈希、两步验证密钥等凭据
+	profile := map[string]interface{}{
+		"id":                strconv.FormatInt(user.ID, 10),
+		"email":             user.Email,
+		"nickname":          user.Nickname,
+		"bio":               user.Bio,
+		"role":              user.Role,
+		"plan":              user.EffectivePlan(time.Now()),
+		"expiry_at":         user.ExpiryAt,
+		"registered_at":     user.RegisteredAt,
+		"last_login_at":     user.LastLoginAt,
+		"email_verified":    user.EmailVerified,
+		"email_verified_at": user.EmailVerifiedAt,
+		"totp_enabled":      user.TOTPEnabled,
+		"identities":        identityList,
+	}
+	if err := writeZipJSON(zw, "profile.json", profile); err != nil {
+		return err
+	}
+	if user.AvatarUpdatedAt != nil {
+		size := util.AvatarSizes[len(util.AvatarSizes)-1]
+		avatar, err := util.GetContentStore().Get(util.AvatarKey(user.ID, size))
+		if err == nil {
+			fw, err := zw.Create("avatar.png")
+			if err != nil {
+				return err
+			}
+			if _, err := fw.Write(avatar); err != nil {
+				return err
+			}
+		} else if !errors.Is(err, util.ErrContentNotFound) {
+			return err
+		}
+	}
+
+	kbs, err := ac.kbDao.GetKBListByOwnerId(user.ID)
+	if err != nil {
+		return err
+	}
+	kbList := make([]map[string]interface{}, 0, len(kbs))
+	for _, kb := range kbs {
+		docs, err := ac.docDao.GetDocumentsByKnowledgeBaseID(kb.ID)
+		if err != nil {
+			return err
+		}
+		dir := "knowledge_bases/" + util.ArchiveName(kb.Name) + "_" + strconv.FormatInt(kb.ID, 10) + "/"
+		for _, item := range util.PlanArchive(docs) {
+			if err := writeArchiveDocument(zw, dir, item); err != nil {
+				return err
+			}
+		}
+		kbList = append(kbList, map[string]interface{}{
+			"kb_id":          strconv.FormatInt(kb.ID, 10),
+			"kb_name":        kb.Name,
+			"kb_description": kb.Description,
+			"kb_is_public":   kb.IsPublic,
+			"kb_created_at":  kb.CreatedAt,
+			"kb_updated_at":  kb.UpdatedAt,
+			"document_count": len(docs),
+			"path":           dir,
+		})
+	}
+	if err := writeZipJSON(zw, "knowledge_bases.json", kbList); err != nil {
+		return err
+	}
+
+	comments, err := ac.accountDao.GetCommentsByUserID(user.ID)
+	if err != nil {
+		return err
+	}
+	commentList := make([]map[string]interface{}, 0, len(comments))
+	for _, comment := range comments {
+		if comment.IsDeleted {
+			continue
+		}
+		commentList = append(commentList, map[string]interface{}{
+			"comment_id":         strconv.FormatInt(comment.ID, 10),
+			"document_id":        strconv.FormatInt(comment.DocumentID, 10),
+			"root_id":            formatParentId(comment.RootID),
+			"parent_id":          formatParentId(comment.ParentID),
+			"comment_content":    comment.Content,
+			"status":             comment.Status,
+			"comment_created_at": comment.CreatedAt,
+			"comment_updated_at": comment.UpdatedAt,
+		})
+	}
+	if err := writeZipJSON(zw, "comments.json", commentList); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// writeDataExport 先将导出文件生成到本地临时文件，再流式写入内容存储，返回文件大小
+func (ac *AccountController) writeDataExport(user *models.User, export *util.DataExport) (int64, error) {
+	tmp, err := os.CreateTemp("", "yuque-export-*.zip")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	if err := ac.buildDataExport(user, tmp); err != nil {
+		return 0, err
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return size, util.GetContentStore().PutStream(util.DataExportFileKey(user.ID, export.ID), tmp, size)
+}
+
+// failDataExport 将导出任务标记为失败，用户可以立即重新申请
+func failDataExport(user *models.User, export *util.DataExport) {
+	now := time.Now()
+	export.FinishedAt = &now
+	export.Status = util.DataExportFailed
+	if err := util.SaveDataExport(user.ID, export); err != nil {
+		log.Println(err)
+	}
+}
+
+// runDataExport 在后台生成导出文件，完成后更新任务状态并邮件通知用户
+func (ac *AccountController) runDataExport(user *models.User, export *util.DataExport) {
+	size, err := ac.writeDataExport(user, export)
+	if err != nil {
+		log.Printf("生成用户 %d 的数据导出失败: %v", user.ID, err)
+		failDataExport(user, export)
+		return
+	}
+	now := time.Now()
+	export.FinishedAt = &now
+	export.Status = util.DataExportReady
+	export.Size = size
+	if err := util.SaveDataExport(user.ID, export); err != nil {
+		log.Println(err)
+		return
+	}
+	if err := util.GetMailer().Send(util.MailMessage{
+		To:      user.Email,
+		Subject: "你的数据导出已完成",
+		Body: fmt.Sprintf("%s，你好：\n\n你申请的个人数据导出已经生成，请登录后在账号设置中下载，文件将于 %s 过期删除。\n\n如果这不是你本人的操作，请尽快修改密码。\n",
+			user.Nickname, export.ExpiresAt.Format("2006-01-02 15:04")),
+	}); err != nil {
+		log.Println(err)
+	}
+}
+
+// RequestDataExport 申请导出个人数据，导出文件在后台生成，同一时间只能有一个进行中的导出任务；
+// 重新申请会替换上一次的导出文件
+func (ac *AccountController) RequestDataExport(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	existing, err := util.GetDataExport(user.ID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if existing != nil && existing.Status == util.DataExportPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "数据导出正在生成中，请稍后再试"})
+		return
+	}
+	if err := util.GetContentStore().DeletePrefix(util.DataExportPrefix(user.ID)); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	exportId, err := util.GenerateRandomToken(16)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	now := time.Now()
+	export := &util.DataExport{
+		ID:        exportId,
+		Status:    util.DataExportPending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(config.GetDataExportTTL()),
+	}
+	if err := util.SaveDataExport(user.ID, export); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	select {
+	case dataExportQueue <- dataExportJob{user: user, export: export}:
+	default:
+		failDataExport(user, export)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "当前申请导出的用户较多，请稍后再试"})
+		return
+	}
+	recordAudit(c, models.AuditAccountExport, models.AuditTargetUser, user.ID, models.AuditResultSuccess, "")
+	c.JSON(http.StatusAccepted, gin.H{"message": "数据导出已开始生成，完成后会发送邮件通知", "export": dataExportToMap(export)})
+}
+
+// GetDataExport 获取最近一次数据导出的状态
+func (ac *AccountController) GetDataExport(c *gin.Context) {
+	export, err := util.GetDataExport(c.GetInt64("userid"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if export == nil {
+		c.JSON(http.StatusOK, gin.H{"export": nil})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"export": dataExportToMap(export)})
+}
+
+// DownloadDataExport 下载已生成的数据导出文件
+func (ac *AccountController) DownloadDataExport(c *gin.Context) {
+	userId := c.GetInt64("userid")
+	export, err := util.GetDataExport(userId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if export == nil || export.Status != util.DataExportReady {
+		c.JSON(http.StatusNotFound, gin.H{"error": "没有可以下载的数据导出"})
+		return
+	}
+	file, size, err := util.GetContentStore().Open(util.DataExportFileKey(userId, export.ID))
+	if errors.Is(err, util.ErrContentNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "没有可以下载的数据导出"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	defer file.Close()
+	filename := "yuque-export-" + export.CreatedAt.Format("20060102150405") + ".zip"
+	c.DataFromReader(http.StatusOK, size, "application/zip", file, map[string]string{
+		"Content-Disposition": `attachment; filename="` + filename + `"`,
+		"Cache-Control":       "no-store",
+	})
+}
+
+// SendAccountDeletionEmail 发送确认注销账号的邮件，通过单点登录注册、不知道密码的用户使用邮件中的令牌申请注销
+func (ac *AccountController) SendAccountDeletionEmail(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if user.IsPendingDeletion() {
+		c.JSON(http.StatusConflict, gin.H{"error": "已申请注销账号", "deletion_scheduled_at": user.DeletionScheduledAt})
+		return
+	}
+	allowed, err := util.AllowEmailSend(util.EmailTokenAccountDelete, user.ID, emailSendCooldown)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "发送过于频繁，请稍后再试"})
+		return
+	}
+	if err := sendAccountDeletionEmail(user); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "邮件发送失败，请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "确认邮件已发送，请通过邮件中的链接完成注销申请"})
+}
+
+// DeleteAccount 申请注销账号，需要提供当前密码，或确认注销邮件中的令牌；宽限期结束后账号被注销，宽限期内可以撤销
+func (ac *AccountController) DeleteAccount(c *gin.Context) {
+	var contextData struct {
+		Password string `json:"password"`
+		Token    string `json:"token"` // 确认注销邮件中的令牌，没有设置密码的用户使用
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil || (contextData.Password == "" && contextData.Token == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入当前密码，未设置密码时请通过确认邮件申请注销"})
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if user.IsPendingDeletion() {
+		c.JSON(http.StatusConflict, gin.H{"error": "已申请注销账号", "deletion_scheduled_at": user.DeletionScheduledAt})
+		return
+	}
+	if contextData.Token != "" {
+		userId, err := util.ConsumeEmailToken(util.EmailTokenAccountDelete, contextData.Token)
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+			return
+		}
+		if userId != user.ID {
+			recordAudit(c, models.AuditAccountDelete, models.AuditTargetUser, user.ID, models.AuditResultFailure, "invalid_token")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "确认链接无效或已过期"})
+			return
+		}
+	} else if ok, _ := util.VerifyStoredPassword(user.Password, contextData.Password); !ok {
+		recordAudit(c, models.AuditAccountDelete, models.AuditTargetUser, user.ID, models.AuditResultFailure, "bad_password")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "密码错误"})
+		return
+	}
+	scheduledAt := time.Now().Add(config.GetAccountDeletionGracePeriod())
+	if err := ac.accountDao.SetDeletionScheduledAt(user.ID, &scheduledAt); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if err := util.GetMailer().Send(util.MailMessage{
+		To:      user.Email,
+		Subject: "账号注销申请",
+		Body: fmt.Sprintf("%s，你好：\n\n我们收到了注销账号的申请，你的账号及其中的知识库、文档与评论将于 %s 被永久删除。\n\n在此之前登录并撤销注销申请即可保留账号。如果这不是你本人的操作，请立即登录撤销并修改密码。\n",
+			user.Nickname, scheduledAt.Format("2006-01-02 15:04")),
+	}); err != nil {
+		log.Println(err)
+	}
+	recordAudit(c, models.AuditAccountDelete, models.AuditTargetUser, user.ID, models.AuditResultSuccess,
+		"scheduled_at="+scheduledAt.Format(time.RFC3339))
+	c.JSON(http.StatusOK, gin.H{"message": "已申请注销账号，宽限期内可以撤销", "deletion_scheduled_at": scheduledAt})
+}
+
+// CancelAccountDeletion 在宽限期内撤销注销申请
+func (ac *AccountController) CancelAccountDeletion(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.IsPendingDeletion() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "没有待处理的注销申请"})
+		return
+	}
+	if err := ac.accountDao.SetDeletionScheduledAt(user.ID, nil); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	recordAudit(c, models.AuditAccountCancel, models.AuditTargetUser, user.ID, models.AuditResultSuccess, "")
+	c.JSON(http.StatusOK, gin.H{"message": "已撤销注销申请"})
+}
+
+// purgeAccount 注销账号：先在数据库中删除或匿名化用户的数据，再清理内容文件、搜索索引与 Redis 缓存。
+// 数据库之外的清理失败只记录日志，不影响注销结果
+func (ac *AccountController) purgeAccount(user *models.User) error {
+	kbIds, err := ac.accountDao.GetOwnedKnowledgeBaseIDs(user.ID)
+	if err != nil {
+		return err
+	}
+	docIds, err := ac.accountDao.GetDocumentIDsByKnowledgeBaseIDs(kbIds)
+	if err != nil {
+		return err
+	}
+	rootCommentIds, err := ac.accountDao.GetRootCommentIDsByDocumentIDs(docIds)
+	if err != nil {
+		return err
+	}
+	comments, err := ac.accountDao.GetCommentsByUserID(user.ID)
+	if err != nil {
+		return err
+	}
+	if err := ac.accountDao.PurgeAccount(user, kbIds, docIds, time.Now()); err != nil {
+		return err
+	}
+
+	purgeDocumentFiles(docIds)
+	removeDocumentsFromES(ac.docDao, docIds)
+	for _, kbId := range kbIds {
+		if err := ac.kbDao.DeleteKBFromES(kbId); err != nil {
+			log.Println(err)
+		}
+	}
+	if err := ac.commentDao.DeleteCommentCache(docIds, rootCommentIds); err != nil {
+		log.Println(err)
+	}
+	for _, comment := range comments {
+		if err := ac.commentDao.RemoveCommentFromRedis(comment); err != nil {
+			log.Println(err)
+		}
+	}
+	if err := ac.docDao.DeleteDocumentContentHashes(docIds); err != nil {
+		log.Println(err)
+	}
+	if err := ac.docDao.DeleteRecentDocumentsOfUser(strconv.FormatInt(user.ID, 10)); err != nil {
+		log.Println(err)
+	}
+	store := util.GetContentStore()
+	for _, prefix := range []string{util.AvatarPrefix(user.ID), util.DataExportPrefix(user.ID)} {
+		if err := store.DeletePrefix(prefix); err != nil {
+			log.Println(err)
+		}
+	}
+	if err := util.PurgeUserRedisKeys(user.ID, user.Email); err != nil {
+		log.Println(err)
+	}
+
+	enqueueAuditLog(models.AuditLog{
+		ActorID:    user.ID,
+		Action:     models.AuditAccountPurge,
+		TargetType: models.AuditTargetUser,
+		TargetID:   strconv.FormatInt(user.ID, 10),
+		Result:     models.AuditResultSuccess,
+		Detail:     fmt.Sprintf("knowledge_bases=%d documents=%d comments=%d", len(kbIds), len(docIds), len(comments)),
+		CreatedAt:  time.Now(),
+	})
+	return nil
+}
+
+// PurgeDueAccounts 注销所有宽限期已满的账号
+func (ac *AccountController) PurgeDueAccounts() {
+	// 本轮跳过失败的账号，下一轮再试，既不阻塞其他账号也不会死循环
+	var failed []int64
+	for {
+		users, err := ac.accountDao.GetUsersDueForDeletion(time.Now(), accountPurgeBatch, failed)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if len(users) == 0 {
+			return
+		}
+		purged := 0
+		for i := range users {
+			if err := ac.purgeAccount(&users[i]); err != nil {
+				log.Printf("注销账号 %d 失败: %v", users[i].ID, err)
+				failed = append(failed, users[i].ID)
+				continue
+			}
+			purged++
+		}
+		log.Printf("已注销 %d 个到期的账号", purged)
+	}
+}
+
+// purgeExpiredDataExports 删除任务记录已过期的导出文件
+func (ac *AccountController) purgeExpiredDataExports() {
+	store := util.GetContentStore()
+	var expired []string
+	err := store.List("exports/", func(key string) error {
+		// key 的格式为 exports/<user_id>/<export_id>.zip
+		parts := strings.Split(key, "/")
+		if len(parts) != 3 {
+			return nil
+		}
+		userId, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil
+		}
+		export, err := util.GetDataExport(userId)
+		if err != nil {
+			return err
+		}
+		if export == nil || util.DataExportFileKey(userId, export.ID) != key {
+			expired = append(expired, key)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for _, key := range expired {
+		if err := store.Delete(key); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// RunAccountSweeper 后台定期注销到期的账号、删除过期的导出文件，ctx 取消后在当前一轮结束后返回
+func (ac *AccountController) RunAccountSweeper(ctx context.Context) {
+	ticker := time.NewTicker(config.GetAccountSweepInterval())
+	defer ticker.Stop()
+	for {
+		ac.PurgeDueAccounts()
+		ac.purgeExpiredDataExports()
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RunDataExportWorker 逐个生成队列中的数据导出。ctx 取消后等待当前导出完成，
+// 仍在排队的任务标记为失败，以便用户在服务重启后重新申请，而不必等待 util.DataExportTimeout
+func (ac *AccountController) RunDataExportWorker(ctx context.Context) {
+	for {
+		select {
+		case job := <-dataExportQueue:
+			ac.runDataExport(job.user, job.export)
+		case <-ctx.Done():
+			for {
+				select {
+				case job := <-dataExportQueue:
+					failDataExport(job.user, job.export)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"yuqueppbackend/service-base/dao"
+	"yuqueppbackend/service-base/models"
+	"yuqueppbackend/service-base/util"
+)
+
+// AdminController 管理后台：用户管理、内容查看与评论审核、全站统计
+type AdminController struct {
+	adminDao   *dao.AdminDAO
+	kbDao      *dao.KBDAO
+	docDao     *dao.DocDao
+	memberDao  *dao.KBMemberDAO
+	commentDao *dao.CommentDAO
+}
+
+func NewAdminController(adminDao *dao.AdminDAO, kbDao *dao.KBDAO, docDao *dao.DocDao, memberDao *dao.KBMemberDAO, commentDao *dao.CommentDAO) *AdminController {
+	return &AdminController{adminDao: adminDao, kbDao: kbDao, docDao: docDao, memberDao: memberDao, commentDao: commentDao}
+}
+
+// RequireAdmin 只允许管理员访问，需要在 AuthMiddleware 之后使用
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := userDao.GetUserByID(c.GetInt64("userid"))
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+			c.Abort()
+			return
+		}
+		if user == nil || !user.IsAdmin() {
+			recordAudit(c, models.AuditAccessDenied, "", 0, models.AuditResultDenied, "admin_required "+c.Request.Method+" "+c.FullPath())
+			c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// rejectDisabledUser 账号已被停用时写入 403 响应并返回 true，登录相关接口在签发令牌前调用
+func rejectDisabledUser(c *gin.Context, user *models.User) bool {
+	if !user.IsDisabled() {
+		return false
+	}
+	recordAuditAs(c, user.ID, user.Email, models.AuditLogin, models.AuditTargetUser, user.ID, models.AuditResultFailure, "account_disabled")
+	c.JSON(http.StatusForbidden, gin.H{"error": "账号已被停用，如有疑问请联系管理员", "account_disabled": true})
+	return true
+}
+
+func adminUserToMap(user models.User) map[string]interface{} {
+	return map[string]interface{}{
+		"user_id":         strconv.FormatInt(user.ID, 10),
+		"email":           user.Email,
+		"nickname":        user.Nickname,
+		"role":            user.Role,
+		"plan":            user.EffectivePlan(time.Now()),
+		"expiry_at":       user.ExpiryAt,
+		"email_verified":  user.EmailVerified,
+		"totp_enabled":    user.TOTPEnabled,
+		"disabled_at":     user.DisabledAt,
+		"disabled_reason": user.DisabledReason,
+		"registered_at":   user.RegisteredAt,
+		"last_login_at":   user.LastLoginAt,
+	}
+}
+
+// parseIdQuery 解析可选的 ID 查询参数，未传时返回 0
+func parseIdQuery(c *gin.Context, name string) (int64, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的参数：" + name})
+		return 0, false
+	}
+	return id, true
+}
+
+// getTargetUser 解析请求中的目标用户，失败时已写入响应
+func getTargetUser(c *gin.Context, strUserId string) (*models.User, bool) {
+	userId, err := strconv.ParseInt(strUserId, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的用户ID"})
+		return nil, false
+	}
+	user, err := userDao.GetUserByID(userId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return nil, false
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return nil, false
+	}
+	return user, true
+}
+
+// GetUserList 检索用户，支持 keyword（邮箱或昵称）、role、status（active 或 disabled）过滤
+func (ac *AdminController) GetUserList(c *gin.Context) {
+	page, pageSize := parsePage(c, 20)
+	filter := dao.UserFilter{
+		Keyword: strings.TrimSpace(c.Query("keyword")),
+		Role:    c.Query("role"),
+		Status:  c.Query("status"),
+	}
+	users, total, err := ac.adminDao.SearchUsers(filter, page, pageSize)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	var userList []map[string]interface{}
+	for _, user := range users {
+		userList = append(userList, adminUserToMap(user))
+	}
+	c.JSON(http.StatusOK, gin.H{"user_list": userList, "total": total})
+}
+
+// GetUserDetail 查看用户详情与当前登录的设备
+func (ac *AdminController) GetUserDetail(c *gin.Context) {
+	user, ok := getTargetUser(c, c.Param("user_id"))
+	if !ok {
+		return
+	}
+	sessions, err := util.ListSessions(user.ID)
+	if err != nil {
+		log.Println(err)
+	}
+	result := adminUserToMap(*user)
+	result["bio"] = user.Bio
+	result["session_count"] = len(sessions)
+	c.JSON(http.StatusOK, result)
+}
+
+// DisableUser 停用账号，立即撤销该用户在所有设备上的登录会话；个人访问令牌在停用期间同样无法使用
+func (ac *AdminController) DisableUser(c *gin.Context) {
+	var contextData struct {
+		UserId string `json:"user_id" binding:"required"`
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+		return
+	}
+	user, ok := getTargetUser(c, contextData.UserId)
+	if !ok {
+		return
+	}
+	if user.ID == c.GetInt64("userid") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能停用自己的账号"})
+		return
+	}
+	reason := strings.TrimSpace(contextData.Reason)
+	if len([]rune(reason)) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "停用原因不能超过 255 个字符"})
+		return
+	}
+	now := time.Now()
+	if err := userDao.SetDisabled(user.ID, &now, reason); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if err := util.RevokeAllSessions(user.ID); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "账号已停用，但撤销登录会话失败，请重试"})
+		return
+	}
+	recordAudit(c, models.AuditAdminDisableUser, models.AuditTargetUser, user.ID, models.AuditResultSuccess, reason)
+	c.JSON(http.StatusOK, gin.H{"message": "账号已停用"})
+}
+
+// EnableUser 重新启用账号，用户需要重新登录
+func (ac *AdminController) EnableUser(c *gin.Context) {
+	var contextData struct {
+		UserId string `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+		return
+	}
+	user, ok := getTargetUser(c, contextData.UserId)
+	if !ok {
+		return
+	}
+	if err := userDao.SetDisabled(user.ID, nil, ""); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	recordAudit(c, models.AuditAdminEnableUser, models.AuditTargetUser, user.ID, models.AuditResultSuccess, "")
+	c.JSON(http.StatusOK, gin.H{"message": "账号已启用"})
+}
+
+// ForcePasswordReset 强制用户重置密码：原密码立即失效，撤销全部登录会话，并向用户发送重置密码邮件
+func (ac *AdminController) ForcePasswordReset(c *gin.Context) {
+	var contextData struct {
+		UserId string `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+		return
+	}
+	user, ok := getTargetUser(c, contextData.UserId)
+	if !ok {
+		return
+	}
+	// 用无人知晓的随机密码替换原密码
+	password, err := util.GenerateRandomToken(32)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	hash, err := util.HashPassword(password)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if err := userDao.UpdatePassword(user.ID, hash); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if err := util.RevokeAllSessions(user.ID); err != nil {
+		log.Println(err)
+	}
+	recordAudit(c, models.AuditAdminResetPassword, models.AuditTargetUser, user.ID, models.AuditResultSuccess, "")
+	if err := sendPasswordResetEmail(user); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusOK, gin.H{"message": "原密码已失效，但重置邮件发送失败，用户可以通过忘记密码重新获取", "email_sent": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "原密码已失效，重置密码邮件已发送", "email_sent": true})
+}
+
+// SetUserRole 修改用户的系统角色，不能修改自己的角色
+func (ac *AdminController) SetUserRole(c *gin.Context) {
+	var contextData struct {
+		UserId string `json:"user_id" binding:"required"`
+		Role   string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+		return
+	}
+	if contextData.Role != models.UserRoleUser && contextData.Role != models.UserRoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色"})
+		return
+	}
+	user, ok := getTargetUser(c, contextData.UserId)
+	if !ok {
+		return
+	}
+	if user.ID == c.GetInt64("userid") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能修改自己的角色"})
+		return
+	}
+	if err := userDao.SetRole(user.ID, contextData.Role); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	recordAudit(c, models.AuditAdminSetRole, models.AuditTargetUser, user.ID, models.AuditResultSuccess, "role="+contextData.Role)
+	c.JSON(http.StatusOK, gin.H{"message": "角色已更新"})
+}
+
+// GetKnowledgeBaseList 检索全站的知识库（包括私有知识库），支持 keyword 与 owner_id 过滤
+func (ac *AdminController) GetKnowledgeBaseList(c *gin.Context) {
+	page, pageSize := parsePage(c, 20)
+	ownerId, ok := parseIdQuery(c, "owner_id")
+	if !ok {
+		return
+	}
+	kbs, total, err := ac.adminDao.SearchKnowledgeBases(strings.TrimSpace(c.Query("keyword")), ownerId, page, pageSize)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	var kbList []map[string]interface{}
+	for _, kb := range kbs {
+		kbList = append(kbList, map[string]interface{}{
+			"kb_id":          strconv.FormatInt(kb.ID, 10),
+			"kb_name":        kb.Name,
+			"kb_description": kb.Description,
+			"kb_is_public":   kb.IsPublic,
+			"kb_owner_id":    strconv.FormatInt(kb.OwnerID, 10),
+			"kb_owner_email": kb.User.Email,
+			"kb_created_at":  kb.CreatedAt,
+			"kb_updated_at":  kb.UpdatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"kb_list": kbList, "total": total})
+}
+
+// GetKnowledgeBase 查看任意知识库的详情、目录树与成员
+func (ac *AdminController) GetKnowledgeBase(c *gin.Context) {
+	kbId, err := strconv.ParseInt(c.Param("kb_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的知识库ID"})
+		return
+	}
+	kb, err := ac.memberDao.GetKBByID(kbId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if kb == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "知识库不存在"})
+		return
+	}
+	docs, err := ac.docDao.GetDocumentsByKnowledgeBaseID(kbId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	members, err := ac.memberDao.GetMembersByKBID(kbId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	var memberList []map[string]interface{}
+	for _, member := range members {
+		memberList = append(memberList, memberToMap(member))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"kb_id":          strconv.FormatInt(kb.ID, 10),
+		"kb_name":        kb.Name,
+		"kb_description": kb.Description,
+		"kb_is_public":   kb.IsPublic,
+		"kb_owner_id":    strconv.FormatInt(kb.OwnerID, 10),
+		"kb_created_at":  kb.CreatedAt,
+		"kb_updated_at":  kb.UpdatedAt,
+		"doc_tree":       buildDocumentTree(docs),
+		"member_list":    memberList,
+	})
+}
+
+// GetDocument 查看任意文档的内容
+func (ac *AdminController) GetDocument(c *gin.Context) {
+	strDocId := c.Param("doc_id")
+	docId, err := strconv.ParseInt(strDocId, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的文档ID"})
+		return
+	}
+	doc, err := ac.docDao.GetDocumentByID(docId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if doc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文档不存在"})
+		return
+	}
+	content, err := getDocumentContentById(strDocId)
+	if err != nil && !errors.Is(err, util.ErrContentNotFound) {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"doc_id":         strconv.FormatInt(doc.ID, 10),
+		"kb_id":          strconv.FormatInt(doc.KnowledgeBaseID, 10),
+		"kb_name":        doc.KnowledgeBase.Name,
+		"doc_title":      doc.Title,
+		"doc_owner_id":   strconv.FormatInt(doc.OwnerId, 10),
+		"doc_content":    content,
+		"doc_parent_id":  formatParentId(doc.ParentID),
+		"doc_created_at": doc.CreatedAt,
+		"doc_updated_at": doc.UpdatedAt,
+	})
+}
+
+// GetCommentList 检索评论（包括已删除与已下架的评论），支持 doc_id 与 user_id 过滤
+func (ac *AdminController) GetCommentList(c *gin.Context) {
+	page, pageSize := parsePage(c, 20)
+	docId, ok := parseIdQuery(c, "doc_id")
+	if !ok {
+		return
+	}
+	userId, ok := parseIdQuery(c, "user_id")
+	if !ok {
+		return
+	}
+	comments, total, err := ac.adminDao.SearchComments(docId, userId, page, pageSize)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	var commentList []map[string]interface{}
+	for _, comment := range comments {
+		commentList = append(commentList, map[string]interface{}{
+			"comment_id":         strconv.FormatInt(comment.ID, 10),
+			"comment_content":    comment.Content,
+			"doc_id":             strconv.FormatInt(comment.DocumentID, 10),
+			"user_id":            strconv.FormatInt(comment.UserID, 10),
+			"nickname":           comment.User.Nickname,
+			"status":             comment.Status,
+			"is_deleted":         comment.IsDeleted,
+			"comment_created_at": comment.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"comment_list": commentList, "total": total})
+}
+
+// TakeDownComment 下架评论，下架后在所有接口中都不再显示
+func (ac *AdminController) TakeDownComment(c *gin.Context) {
+	commentId, err := strconv.ParseInt(c.Param("comment_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的评论ID"})
+		return
+	}
+	comment, err := ac.commentDao.GetCommentByID(commentId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if comment == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "评论不存在"})
+		return
+	}
+	if comment.Status == models.CommentStatusTakenDown {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "评论已下架"})
+		return
+	}
+	if err := ac.commentDao.TakeDownComment(comment.ID, fmt.Sprintf("admin:%d", c.GetInt64("userid"))); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if err := ac.commentDao.RemoveCommentFromRedis(*comment); err != nil {
+		log.Println(err)
+	}
+	recordAudit(c, models.AuditAdminTakeDown, models.AuditTargetComment, comment.ID, models.AuditResultSuccess, "doc_id="+strconv.FormatInt(comment.DocumentID, 10))
+	c.JSON(http.StatusOK, gin.H{"message": "评论已下架"})
+}
+
+// GetStats 全站统计数据
+func (ac *AdminController) GetStats(c *gin.Context) {
+	stats, err := ac.adminDao.GetSystemStats()
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
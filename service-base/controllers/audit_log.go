@@ -0,0 +1,297 @@
+package controllers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"yuqueppbackend/service-base/dao"
+	"yuqueppbackend/service-base/db"
+	"yuqueppbackend/service-base/models"
+)
+
+// 审计日志异步写入的参数
+const (
+	auditQueueSize      = 4096
+	auditEnqueueTimeout = 100 * time.Millisecond // 队列满时最多等待的时间，超时后由请求自己同步写入
+	auditBatchSize      = 100
+	auditFlushInterval  = time.Second
+	auditExportBatch    = 500
+)
+
+var auditLogDao = dao.NewAuditLogDAO(db.GetDB())
+var auditQueue = make(chan models.AuditLog, auditQueueSize)
+
+// recordAudit 记录当前登录用户的一次操作，targetId 为 0 时不记录目标 ID
+func recordAudit(c *gin.Context, action, targetType string, targetId int64, result, detail string) {
+	recordAuditAs(c, c.GetInt64("userid"), c.GetString("email"), action, targetType, targetId, result, detail)
+}
+
+// recordAuditAs 以指定的操作者记录一次操作，用于登录等尚未通过认证的请求
+func recordAuditAs(c *gin.Context, actorId int64, actorEmail, action, targetType string, targetId int64, result, detail string) {
+	entry := models.AuditLog{
+		ActorID:    actorId,
+		ActorEmail: actorEmail,
+		Action:     action,
+		TargetType: targetType,
+		IP:         c.ClientIP(),
+		UserAgent:  truncate(c.Request.UserAgent(), 512),
+		Result:     result,
+		Detail:     truncate(detail, 512),
+		CreatedAt:  time.Now(),
+	}
+	if targetId != 0 {
+		entry.TargetID = strconv.FormatInt(targetId, 10)
+	}
+	enqueueAuditLog(entry)
+}
+
+// enqueueAuditLog 将审计事件放入写入队列，也用于后台任务等没有请求上下文的场景。
+// 队列持续满载时不丢弃事件，等待超时后直接同步写入数据库
+func enqueueAuditLog(entry models.AuditLog) {
+	select {
+	case auditQueue <- entry:
+		return
+	default:
+	}
+	timer := time.NewTimer(auditEnqueueTimeout)
+	defer timer.Stop()
+	select {
+	case auditQueue <- entry:
+	case <-timer.C:
+		writeAuditLogs([]models.AuditLog{entry})
+	}
+}
+
+// writeAuditLogs 写入一批审计日志，失败时输出到日志，避免事件完全丢失
+func writeAuditLogs(batch []models.AuditLog) {
+	if err := auditLogDao.CreateAuditLogs(batch); err != nil {
+		log.Printf("写入审计日志失败：%v", err)
+		for _, entry := range batch {
+			log.Printf("审计事件：%s", formatAuditLog(entry))
+		}
+	}
+}
+
+// truncate 按字符截断字符串
+func truncate(s string, maxLength int) string {
+	runes := []rune(s)
+	if len(runes) <= maxLength {
+		return s
+	}
+	return string(runes[:maxLength])
+}
+
+func formatAuditLog(entry models.AuditLog) string {
+	return entry.CreatedAt.Format(time.RFC3339) + " actor=" + strconv.FormatInt(entry.ActorID, 10) +
+		" action=" + entry.Action + " target=" + entry.TargetType + ":" + entry.TargetID +
+		" result=" + entry.Result + " ip=" + entry.IP + " detail=" + entry.Detail
+}
+
+// RunAuditLogWriter 后台批量写入审计日志，攒满一批或每隔一秒写入一次。
+// ctx 取消后写完队列中剩余的事件再返回，服务退出前应等待其返回
+func RunAuditLogWriter(ctx context.Context) {
+	ticker := time.NewTicker(auditFlushInterval)
+	defer ticker.Stop()
+	batch := make([]models.AuditLog, 0, auditBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		writeAuditLogs(batch)
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case entry := <-auditQueue:
+			batch = append(batch, entry)
+			if len(batch) >= auditBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			for {
+				select {
+				case entry := <-auditQueue:
+					batch = append(batch, entry)
+					if len(batch) >= auditBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func auditLogToMap(entry models.AuditLog) map[string]interface{} {
+	return map[string]interface{}{
+		"audit_id":    strconv.FormatInt(entry.ID, 10),
+		"actor_id":    strconv.FormatInt(entry.ActorID, 10),
+		"actor_email": entry.ActorEmail,
+		"action":      entry.Action,
+		"target_type": entry.TargetType,
+		"target_id":   entry.TargetID,
+		"ip":          entry.IP,
+		"user_agent":  entry.UserAgent,
+		"result":      entry.Result,
+		"detail":      entry.Detail,
+		"created_at":  entry.CreatedAt,
+	}
+}
+
+// parseAuditTime 解析 RFC3339 时间或 2006-01-02 格式的日期；endOfDay 为 true 时日期取当天结束
+func parseAuditTime(value string, endOfDay bool) (*time.Time, bool) {
+	if value == "" {
+		return nil, true
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, true
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, false
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, true
+}
+
+// parseAuditLogFilter 解析审计日志的检索条件，失败时已写入响应
+func parseAuditLogFilter(c *gin.Context) (dao.AuditLogFilter, bool) {
+	filter := dao.AuditLogFilter{
+		Action:     strings.TrimSpace(c.Query("action")),
+		TargetType: strings.TrimSpace(c.Query("target_type")),
+		TargetID:   strings.TrimSpace(c.Query("target_id")),
+		Result:     strings.TrimSpace(c.Query("result")),
+		IP:         strings.TrimSpace(c.Query("ip")),
+	}
+	if actorId := c.Query("actor_id"); actorId != "" {
+		id, err := strconv.ParseInt(actorId, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "错误的用户ID"})
+			return filter, false
+		}
+		filter.ActorID = id
+	}
+	var ok bool
+	if filter.Start, ok = parseAuditTime(c.Query("start"), false); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "开始时间格式错误，请使用 RFC3339 时间或 YYYY-MM-DD 日期"})
+		return filter, false
+	}
+	if filter.End, ok = parseAuditTime(c.Query("end"), true); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "结束时间格式错误，请使用 RFC3339 时间或 YYYY-MM-DD 日期"})
+		return filter, false
+	}
+	return filter, true
+}
+
+// GetAuditLogList 管理员检索审计日志，可按 actor_id、action、target_type、target_id、result、ip、start、end 过滤
+func GetAuditLogList(c *gin.Context) {
+	filter, ok := parseAuditLogFilter(c)
+	if !ok {
+		return
+	}
+	page, pageSize := parsePage(c, 50)
+	logs, total, err := auditLogDao.GetAuditLogs(filter, page, pageSize)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	var auditList []map[string]interface{}
+	for _, entry := range logs {
+		auditList = append(auditList, auditLogToMap(entry))
+	}
+	c.JSON(http.StatusOK, gin.H{"audit_list": auditList, "total": total})
+}
+
+// csvSafe 避免以公式字符开头的单元格在表格软件中被当作公式执行
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// ExportAuditLogs 管理员按检索条件导出审计日志，format 为 csv（默认）或 jsonl，按时间正序分批流式输出
+func ExportAuditLogs(c *gin.Context) {
+	filter, ok := parseAuditLogFilter(c)
+	if !ok {
+		return
+	}
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "jsonl" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "仅支持 csv 与 jsonl 格式"})
+		return
+	}
+	filename := "audit-log-" + time.Now().Format("20060102150405") + "." + format
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+	}
+	c.Status(http.StatusOK)
+
+	var writeBatch func([]models.AuditLog) error
+	if format == "csv" {
+		writer := csv.NewWriter(c.Writer)
+		if err := writer.Write([]string{"audit_id", "created_at", "actor_id", "actor_email", "action",
+			"target_type", "target_id", "result", "ip", "user_agent", "detail"}); err != nil {
+			log.Println(err)
+			return
+		}
+		writeBatch = func(logs []models.AuditLog) error {
+			for _, entry := range logs {
+				if err := writer.Write([]string{
+					strconv.FormatInt(entry.ID, 10),
+					entry.CreatedAt.Format(time.RFC3339),
+					strconv.FormatInt(entry.ActorID, 10),
+					csvSafe(entry.ActorEmail),
+					entry.Action,
+					entry.TargetType,
+					entry.TargetID,
+					entry.Result,
+					entry.IP,
+					csvSafe(entry.UserAgent),
+					csvSafe(entry.Detail),
+				}); err != nil {
+					return err
+				}
+			}
+			writer.Flush()
+			return writer.Error()
+		}
+	} else {
+		encoder := json.NewEncoder(c.Writer)
+		writeBatch = func(logs []models.AuditLog) error {
+			for _, entry := range logs {
+				if err := encoder.Encode(auditLogToMap(entry)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	err := auditLogDao.EachAuditLogs(filter, auditExportBatch, func(logs []models.AuditLog) error {
+		if err := writeBatch(logs); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		// 响应头已经发出，只能中断输出
+		log.Println(err)
+	}
+}
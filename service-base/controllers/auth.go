@@ -4,12 +4,16 @@ import (
 	"github.com/gin-gonic/gin"
 	"log"
 	"net/http"
+	"time"
+	"yuqueppbackend/service-base/config"
 	"yuqueppbackend/service-base/dao"
+	"yuqueppbackend/service-base/db"
 	"yuqueppbackend/service-base/models"
 	"yuqueppbackend/service-base/util"
 )
 
 var userDao = dao.NewUserDAO()
+var loginAttemptDao = dao.NewLoginAttemptDAO(db.GetDB())
 
 // 用户注册
 func Register(c *gin.Context) {
@@ -25,7 +29,6 @@ func Register(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	log.Println(registerData)
 	// 确认验证码是否正确
 	right, err := VerifyCaptcha(registerData.CaptchaId, registerData.CaptchaValue)
 	if err != nil {
@@ -38,6 +41,10 @@ func Register(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "验证码错误"})
 		return
 	}
+	if len(registerData.Password) > 72 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "密码长度不能超过 72 个字节"})
+		return
+	}
 	user := models.User{
 		Email:    registerData.Email,
 		Nickname: registerData.Nickname,
@@ -63,7 +70,13 @@ func Register(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "用户注册失败"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "用户注册成功"})
+	// 发送邮箱验证邮件，发送失败时用户可以稍后重新发送
+	if newUser, err := userDao.GetUserByEmail(user.Email); err != nil || newUser == nil {
+		log.Println(err)
+	} else if err := sendVerificationEmail(newUser); err != nil {
+		log.Println(err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "用户注册成功，请前往邮箱完成验证"})
 }
 
 // 用户登录
@@ -81,8 +94,14 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// 检查 IP 请求频率、账号锁定与失败后的等待时间
+	if !checkLoginAllowed(c, loginData.Email) {
+		return
+	}
+
 	// 验证验证码
-	if !store.Verify(loginData.CaptchaId, loginData.CaptchaValue, true) {
+	if right, _ := VerifyCaptcha(loginData.CaptchaId, loginData.CaptchaValue); !right {
+		recordLoginFailure(c, loginData.Email, loginFailureCaptcha, false)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "验证码错误"})
 		return
 	}
@@ -93,25 +112,56 @@ func Login(c *gin.Context) {
 	if err != nil {
 		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
-	} else {
-		if pass {
-			tmp_user, err := userDao.GetUserByEmail(loginData.Email)
-			if err != nil {
-				log.Println(err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍候再试"})
-			}
-			// 生成JWT
-			if jwt, err := util.GenerateJWT(tmp_user.ID, tmp_user.Email); err != nil {
-				log.Println(err)
-				c.JSON(http.StatusBadRequest, gin.H{"error": "系统错误请稍后再试"})
-			} else {
-				c.JSON(http.StatusOK, gin.H{
-					"access_token": jwt,
-					"expires_in":   util.TokenExpireDuration,
-				})
-			}
-		} else {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "邮箱或密码错误"})
+		return
+	}
+	if !pass {
+		if recordLoginFailure(c, loginData.Email, loginFailureBadPassword, true) {
+			c.JSON(http.StatusLocked, gin.H{"error": "失败次数过多，账号已被临时锁定，请稍后再试"})
+			return
 		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "邮箱或密码错误"})
+		return
+	}
+
+	tmp_user, err := userDao.GetUserByEmail(loginData.Email)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍候再试"})
+		return
+	}
+	if config.RequireEmailVerification() && !tmp_user.EmailVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "请先完成邮箱验证", "email_verified": false})
+		return
+	}
+	if rejectDisabledUser(c, tmp_user) {
+		return
+	}
+	// 启用了两步验证时先签发挑战令牌，通过 login2fa 校验验证码后才签发访问令牌；
+	// 失败计数在两步验证通过后才清除
+	if tmp_user.TOTPEnabled {
+		challenge, err := util.CreateLoginChallenge(tmp_user.ID)
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+			"expires_in":          int64(util.LoginChallengeTTL / time.Second),
+		})
+		return
+	}
+	if err := util.ResetLoginFailures(tmp_user.Email); err != nil {
+		log.Println(err)
+	}
+	// 为当前设备创建登录会话，签发访问令牌与刷新令牌
+	tokens, err := util.CreateSession(tmp_user.ID, tmp_user.Email, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "系统错误请稍后再试"})
+		return
 	}
+	recordAuditAs(c, tmp_user.ID, tmp_user.Email, models.AuditLogin, models.AuditTargetUser, tmp_user.ID, models.AuditResultSuccess, "password")
+	c.JSON(http.StatusOK, tokens)
 }
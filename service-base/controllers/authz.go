@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"yuqueppbackend/service-base/dao"
+	"yuqueppbackend/service-base/models"
+)
+
+// Authorizer 统一的知识库权限校验，文档、评论、搜索等接口都通过它判断当前用户能否访问。
+// 知识库所有者拥有全部权限，其他用户的权限由知识库成员表中的角色决定。
+type Authorizer struct {
+	memberDao *dao.KBMemberDAO
+	docDao    *dao.DocDao
+}
+
+func NewAuthorizer(memberDao *dao.KBMemberDAO, docDao *dao.DocDao) *Authorizer {
+	return &Authorizer{memberDao: memberDao, docDao: docDao}
+}
+
+// GetKBRole 获取用户在知识库中的角色，没有任何权限时返回空字符串
+func (az *Authorizer) GetKBRole(userId int64, kb *models.KnowledgeBase) (string, error) {
+	if kb.OwnerID == userId {
+		return models.RoleOwner, nil
+	}
+	member, err := az.memberDao.GetMember(kb.ID, userId)
+	if err != nil {
+		return "", err
+	}
+	if member == nil {
+		return "", nil
+	}
+	return member.Role, nil
+}
+
+// GetDocumentRole 获取用户对文档所属知识库的角色，文档或知识库已删除、没有任何权限时返回空字符串
+func (az *Authorizer) GetDocumentRole(userId, docId int64) (string, error) {
+	doc, err := az.docDao.GetDocumentByID(docId)
+	if err != nil {
+		return "", err
+	}
+	if doc == nil || doc.KnowledgeBase.ID == 0 {
+		return "", nil
+	}
+	return az.GetKBRole(userId, &doc.KnowledgeBase)
+}
+
+// GetAccessibleKBRoles 获取用户可以访问的全部知识库及对应角色，用于过滤搜索等列表结果
+func (az *Authorizer) GetAccessibleKBRoles(userId int64) (map[int64]string, error) {
+	return az.memberDao.GetAccessibleKBRoles(userId)
+}
+
+// checkRole 校验角色，无任何权限时返回 404 以免泄露资源是否存在，权限不足时返回 403
+func checkRole(c *gin.Context, role, minRole, notFoundMsg string) bool {
+	if role == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": notFoundMsg})
+		return false
+	}
+	if models.RoleRank(role) < models.RoleRank(minRole) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "权限不足，无法执行该操作"})
+		return false
+	}
+	return true
+}
+
+// deniedDetail 权限校验失败时记录到审计日志的说明
+func deniedDetail(role, minRole string) string {
+	if role == "" {
+		role = "none"
+	}
+	return "role=" + role + " required=" + minRole
+}
+
+// AuthorizeKB 校验当前用户对知识库至少拥有 minRole 角色，失败时已写入响应
+func (az *Authorizer) AuthorizeKB(c *gin.Context, kbId int64, minRole string) (*models.KnowledgeBase, string, bool) {
+	userId, exists := c.Get("userid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未授权"})
+		return nil, "", false
+	}
+	kb, err := az.memberDao.GetKBByID(kbId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return nil, "", false
+	}
+	if kb == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "知识库不存在"})
+		return nil, "", false
+	}
+	role, err := az.GetKBRole(userId.(int64), kb)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return nil, "", false
+	}
+	if !checkRole(c, role, minRole, "知识库不存在") {
+		recordAudit(c, models.AuditAccessDenied, models.AuditTargetKB, kb.ID, models.AuditResultDenied, deniedDetail(role, minRole))
+		return nil, "", false
+	}
+	return kb, role, true
+}
+
+// AuthorizeDocument 校验当前用户对文档所属知识库至少拥有 minRole 角色，失败时已写入响应
+func (az *Authorizer) AuthorizeDocument(c *gin.Context, docId int64, minRole string) (*models.Document, string, bool) {
+	userId, exists := c.Get("userid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未授权"})
+		return nil, "", false
+	}
+	doc, err := az.docDao.GetDocumentByID(docId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return nil, "", false
+	}
+	// 知识库已被删除时 KnowledgeBase 不会被预加载
+	if doc == nil || doc.KnowledgeBase.ID == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "当前文档不见了，快去新建吧"})
+		return nil, "", false
+	}
+	role, err := az.GetKBRole(userId.(int64), &doc.KnowledgeBase)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return nil, "", false
+	}
+	if !checkRole(c, role, minRole, "当前文档不见了，快去新建吧") {
+		recordAudit(c, models.AuditAccessDenied, models.AuditTargetDocument, doc.ID, models.AuditResultDenied, deniedDetail(role, minRole))
+		return nil, "", false
+	}
+	return doc, role, true
+}
+
+// AuthorizePublicKB 校验知识库是否公开，供无需登录的公开接口使用；私有知识库一律返回 404
+func (az *Authorizer) AuthorizePublicKB(c *gin.Context, kbId int64) (*models.KnowledgeBase, bool) {
+	kb, err := az.memberDao.GetKBByID(kbId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return nil, false
+	}
+	if kb == nil || !kb.IsPublic {
+		c.JSON(http.StatusNotFound, gin.H{"error": "知识库不存在"})
+		return nil, false
+	}
+	return kb, true
+}
+
+// AuthorizePublicDocument 校验文档是否属于公开知识库，私有知识库中的文档一律返回 404
+func (az *Authorizer) AuthorizePublicDocument(c *gin.Context, docId int64) (*models.Document, bool) {
+	doc, err := az.docDao.GetDocumentByID(docId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return nil, false
+	}
+	if doc == nil || doc.KnowledgeBase.ID == 0 || !doc.KnowledgeBase.IsPublic {
+		c.JSON(http.StatusNotFound, gin.H{"error": "当前文档不见了"})
+		return nil, false
+	}
+	return doc, true
+}
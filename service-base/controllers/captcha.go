@@ -4,20 +4,20 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/mojocn/base64Captcha"
 	"net/http"
+	"yuqueppbackend/service-base/util"
 )
 
-var store = base64Captcha.DefaultMemStore
-
 func GetCaptcha(c *gin.Context) {
 	id, b64s, err := GenerateCaptcha()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 	c.JSON(http.StatusOK, gin.H{"captchaId": id, "captcha": b64s})
 }
 
 func GenerateCaptcha() (string, string, error) {
-	driver := base64Captcha.NewDriverDigit(80, 240, 5, 0.7, 80) // 图形验证码配置
+	store, driver := util.GetCaptcha() // 图形验证码配置见 config.yaml 中的 captcha
 	captcha := base64Captcha.NewCaptcha(driver, store)
 
 	id, b64s, _, err := captcha.Generate()
@@ -28,6 +28,7 @@ func GenerateCaptcha() (string, string, error) {
 }
 
 func VerifyCaptcha(captchaId string, value string) (bool, error) {
+	store, _ := util.GetCaptcha()
 	if store.Verify(captchaId, value, true) {
 		return true, nil
 	} else {
@@ -0,0 +1,730 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"yuqueppbackend/service-base/config"
+	"yuqueppbackend/service-base/dao"
+	"yuqueppbackend/service-base/models"
+	"yuqueppbackend/service-base/util"
+)
+
+const (
+	collabWriteWait      = 10 * time.Second // 单条消息写入超时
+	collabPongWait       = 60 * time.Second // 等待客户端 pong 的超时
+	collabPingPeriod     = 50 * time.Second // 心跳间隔，必须小于 collabPongWait
+	collabPersistPeriod  = 5 * time.Second  // 协同内容定期落盘的间隔
+	collabMaxMessageSize = 4 * 1024 * 1024  // 单条消息的最大字节数
+	collabSendBufferSize = 256              // 每个连接的发送缓冲区大小
+	collabLockRetryDelay = 200 * time.Millisecond
+	collabMaxHistory     = 5000             // 操作历史的最大长度，落后更多的客户端提交操作时需要重置
+	collabQuotaPeriod    = 10 * time.Second // 重新查询知识库所有者存储空间配额的最小间隔
+)
+
+// WebSocket 不受 CORS 限制，且令牌通过查询参数传递，必须校验来源，防止跨站 WebSocket 劫持
+var collabUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     checkCollabOrigin,
+}
+
+// checkCollabOrigin 允许没有 Origin 头的非浏览器客户端、与服务同源的页面以及配置中列出的前端来源
+func checkCollabOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range config.GetCollabAllowedOrigins() {
+		if strings.EqualFold(strings.TrimRight(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+var collabClientSeq int64
+
+// collabStorageExceededMessage 协同编辑中的修改因超出存储空间配额被拒绝时的提示
+const collabStorageExceededMessage = "存储空间已达到知识库所有者的套餐上限，本次修改未保存"
+
+// CollabController 文档实时协同编辑，每个打开的文档对应一个 collabHub
+type CollabController struct {
+	docController *DocumentController
+	mu            sync.Mutex
+	hubs          map[int64]*collabHub
+	closing       map[int64]chan struct{} // 最后一个连接离开、正在最终落盘的文档，落盘完成后关闭
+}
+
+func NewCollabController(docController *DocumentController) *CollabController {
+	cc := &CollabController{docController: docController, hubs: make(map[int64]*collabHub), closing: make(map[int64]chan struct{})}
+	docController.collab = cc
+	return cc
+}
+
+// refreshMovedDocuments 文档被移动到其他知识库后，更新正在协同编辑的 hub 中缓存的知识库，
+// 使配额按新的所有者计算，并断开在新知识库中已无权访问的连接
+func (cc *CollabController) refreshMovedDocuments(ids []int64, kb models.KnowledgeBase) {
+	var hubs []*collabHub
+	cc.mu.Lock()
+	for _, id := range ids {
+		if hub, ok := cc.hubs[id]; ok {
+			hubs = append(hubs, hub)
+		}
+	}
+	cc.mu.Unlock()
+	for _, hub := range hubs {
+		hub.moveTo(kb)
+	}
+}
+
+// collabMessage 客户端与服务端之间传递的消息
+type collabMessage struct {
+	Type         string              `json:"type"`                // init / op / ack / cursor / presence / reset / error / ping / pong
+	ClientID     string              `json:"client_id,omitempty"` // 消息来源的连接 ID
+	UserID       string              `json:"user_id,omitempty"`   // 消息来源的用户 ID
+	Revision     int                 `json:"revision"`            // op 消息中为操作所基于的版本，ack 中为操作应用后的版本
+	Operation    *util.TextOperation `json:"op,omitempty"`        // ot.js 格式的文本操作
+	Content      *string             `json:"content,omitempty"`   // init 消息中的完整文档内容
+	Position     int                 `json:"position"`            // 光标位置（Unicode 码点）
+	SelectionEnd int                 `json:"selection_end"`       // 选区结束位置（Unicode 码点）
+	CanEdit      bool                `json:"can_edit,omitempty"`  // 当前连接是否有编辑权限
+	Clients      []collabPresence    `json:"clients,omitempty"`   // 当前在线的协作者
+	Message      string              `json:"message,omitempty"`   // 错误信息
+	ContentHash  string              `json:"doc_content_hash,omitempty"`
+}
+
+type collabPresence struct {
+	ClientID     string `json:"client_id"`
+	UserID       string `json:"user_id"`
+	Nickname     string `json:"nickname"`
+	CanEdit      bool   `json:"can_edit"`
+	Position     int    `json:"position"`
+	SelectionEnd int    `json:"selection_end"`
+}
+
+type collabClient struct {
+	id           string
+	userId       int64
+	nickname     string
+	canEdit      bool
+	writeScope   bool // 令牌是否允许修改文档，连接期间不变
+	revision     int  // 客户端后续提交操作可能基于的最旧版本
+	position     int
+	selectionEnd int
+	conn         *websocket.Conn
+	send         chan []byte
+}
+
+func (cl *collabClient) presence() collabPresence {
+	return collabPresence{
+		ClientID:     cl.id,
+		UserID:       strconv.FormatInt(cl.userId, 10),
+		Nickname:     cl.nickname,
+		CanEdit:      cl.canEdit,
+		Position:     cl.position,
+		SelectionEnd: cl.selectionEnd,
+	}
+}
+
+// collabHub 维护单个文档的协同状态：当前内容、操作历史与在线连接
+type collabHub struct {
+	cc      *CollabController
+	doc     models.Document
+	mu      sync.Mutex
+	clients map[string]*collabClient
+
+	content     string
+	revision    int
+	history     []*util.TextOperation // history[i] 将版本 historyBase+i 变换为版本 historyBase+i+1
+	historyBase int                   // 更早的历史已经没有客户端需要，被丢弃
+
+	dirty       bool  // 内存内容是否有尚未落盘的修改
+	unversioned bool  // 是否有尚未生成历史版本的修改
+	lastEditor  int64 // 最后一次修改文档的用户
+
+	persistedContent  string // 最近一次落盘（或加载）时的内容
+	persistedHash     string
+	persistedRevision int
+
+	storageAllowance int64     // 知识库所有者最多还能写入的字节数，-1 表示不限制或尚未查询到
+	storageCheckedAt time.Time // 最近一次查询配额的时间
+
+	stop chan struct{}
+}
+
+// CollabDocumentHandler 建立文档协同编辑的 WebSocket 连接
+func (cc *CollabController) CollabDocumentHandler(c *gin.Context) {
+	docId, err := strconv.ParseInt(c.Param("doc_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的文档ID"})
+		return
+	}
+	userId, exists := c.Get("userid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未授权"})
+		return
+	}
+	// 阅读者可以加入查看实时内容，编辑者及以上角色才能提交修改
+	doc, role, ok := cc.docController.authz.AuthorizeDocument(c, docId, models.RoleViewer)
+	if !ok {
+		return
+	}
+	user, err := userDao.GetUserByID(userId.(int64))
+	if err != nil || user == nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return
+	}
+
+	conn, err := collabUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade 失败时已经向客户端写回了错误响应
+		log.Println(err)
+		return
+	}
+	writeScope := util.HasScope(c, models.ScopeWriteDocs)
+	client := &collabClient{
+		id:         strconv.FormatInt(user.ID, 10) + "-" + strconv.FormatInt(atomic.AddInt64(&collabClientSeq, 1), 10),
+		userId:     user.ID,
+		nickname:   user.Nickname,
+		canEdit:    models.RoleRank(role) >= models.RoleRank(models.RoleEditor) && writeScope,
+		writeScope: writeScope,
+		conn:       conn,
+		send:       make(chan []byte, collabSendBufferSize),
+	}
+
+	hub, err := cc.joinHub(*doc, client)
+	if err != nil {
+		log.Println(err)
+		_ = conn.WriteJSON(collabMessage{Type: "error", Message: "系统错误，无法打开协同文档"})
+		conn.Close()
+		return
+	}
+	go client.writePump()
+	hub.readPump(client)
+}
+
+// joinHub 获取（必要时创建）文档对应的 hub，并登记新的连接。
+// 文档正在最终落盘时先等待落盘完成，避免加载到旧内容
+func (cc *CollabController) joinHub(doc models.Document, client *collabClient) (*collabHub, error) {
+	for {
+		cc.mu.Lock()
+		done, closing := cc.closing[doc.ID]
+		if !closing {
+			break
+		}
+		cc.mu.Unlock()
+		<-done
+	}
+	defer cc.mu.Unlock()
+
+	hub, ok := cc.hubs[doc.ID]
+	if !ok {
+		content, err := getDocumentContentById(strconv.FormatInt(doc.ID, 10))
+		if err != nil {
+			return nil, err
+		}
+		hub = &collabHub{
+			cc:               cc,
+			doc:              doc,
+			clients:          make(map[string]*collabClient),
+			content:          content,
+			persistedContent: content,
+			persistedHash:    util.HashContent([]byte(content)),
+			storageAllowance: -1,
+			stop:             make(chan struct{}),
+		}
+		cc.hubs[doc.ID] = hub
+		go hub.run()
+	}
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	client.revision = hub.revision
+	hub.clients[client.id] = client
+	content := hub.content
+	hub.sendTo(client, collabMessage{
+		Type:        "init",
+		ClientID:    client.id,
+		UserID:      strconv.FormatInt(client.userId, 10),
+		Revision:    hub.revision,
+		Content:     &content,
+		CanEdit:     client.canEdit,
+		Clients:     hub.presenceList(),
+		ContentHash: hub.persistedHash,
+	})
+	hub.broadcast(collabMessage{Type: "presence", Clients: hub.presenceList()}, client.id)
+	return hub, nil
+}
+
+// leaveHub 注销连接，最后一个连接离开时落盘并生成历史版本
+func (cc *CollabController) leaveHub(hub *collabHub, client *collabClient) {
+	cc.mu.Lock()
+	hub.mu.Lock()
+	if _, ok := hub.clients[client.id]; ok {
+		delete(hub.clients, client.id)
+		close(client.send)
+	}
+	remaining := len(hub.clients)
+	if remaining > 0 {
+		hub.broadcast(collabMessage{Type: "presence", Clients: hub.presenceList()}, "")
+		hub.trimHistory()
+	}
+	hub.mu.Unlock()
+	if remaining > 0 {
+		cc.mu.Unlock()
+		return
+	}
+
+	// 最终落盘可能需要等待文档保存锁，在 cc.mu 之外进行，不阻塞其他文档的连接；
+	// 同一文档的新连接在 joinHub 中等待落盘完成
+	delete(cc.hubs, hub.doc.ID)
+	done := make(chan struct{})
+	cc.closing[hub.doc.ID] = done
+	close(hub.stop)
+	cc.mu.Unlock()
+
+	hub.persist(true)
+
+	cc.mu.Lock()
+	delete(cc.closing, hub.doc.ID)
+	cc.mu.Unlock()
+	close(done)
+}
+
+// run 定期将协同内容落盘
+func (hub *collabHub) run() {
+	ticker := time.NewTicker(collabPersistPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			hub.persist(false)
+		case <-hub.stop:
+			return
+		}
+	}
+}
+
+// readPump 读取客户端消息，直到连接断开
+func (hub *collabHub) readPump(client *collabClient) {
+	defer func() {
+		hub.cc.leaveHub(hub, client)
+		client.conn.Close()
+	}()
+	client.conn.SetReadLimit(collabMaxMessageSize)
+	_ = client.conn.SetReadDeadline(time.Now().Add(collabPongWait))
+	client.conn.SetPongHandler(func(string) error {
+		return client.conn.SetReadDeadline(time.Now().Add(collabPongWait))
+	})
+
+	for {
+		var msg collabMessage
+		if err := client.conn.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Println(err)
+			}
+			return
+		}
+		if msg.Type == "op" {
+			if !hub.refreshPermission(client) {
+				return
+			}
+			hub.refreshStorageAllowance()
+		}
+		hub.handleMessage(client, msg)
+	}
+}
+
+// refreshPermission 每次提交操作前重新校验权限，成员被移除或降级后立即生效；
+// 失去全部权限时返回 false 并断开连接
+func (hub *collabHub) refreshPermission(client *collabClient) bool {
+	role, err := hub.cc.docController.authz.GetDocumentRole(client.userId, hub.doc.ID)
+	if err != nil {
+		log.Println(err)
+		role = ""
+	}
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if role == "" {
+		message := "已无权访问该文档"
+		if err != nil {
+			message = "系统错误，请稍后再试"
+		}
+		hub.sendTo(client, collabMessage{Type: "error", Message: message})
+		return false
+	}
+	canEdit := models.RoleRank(role) >= models.RoleRank(models.RoleEditor) && client.writeScope
+	if canEdit != client.canEdit {
+		client.canEdit = canEdit
+		hub.broadcast(collabMessage{Type: "presence", Clients: hub.presenceList()}, "")
+	}
+	return true
+}
+
+// moveTo 替换 hub 缓存的知识库并重新校验所有连接的权限
+func (hub *collabHub) moveTo(kb models.KnowledgeBase) {
+	hub.mu.Lock()
+	hub.doc.KnowledgeBaseID = kb.ID
+	hub.doc.KnowledgeBase = kb
+	// 所有者可能已经变化，下一次提交操作前重新查询配额
+	hub.storageCheckedAt = time.Time{}
+	clients := make([]*collabClient, 0, len(hub.clients))
+	for _, cl := range hub.clients {
+		clients = append(clients, cl)
+	}
+	hub.mu.Unlock()
+
+	for _, client := range clients {
+		if hub.refreshPermission(client) {
+			continue
+		}
+		// 关闭发送通道后 writePump 会发出错误信息并断开连接，readPump 随之退出
+		hub.mu.Lock()
+		if _, ok := hub.clients[client.id]; ok {
+			delete(hub.clients, client.id)
+			close(client.send)
+			hub.broadcast(collabMessage{Type: "presence", Clients: hub.presenceList()}, "")
+		}
+		hub.mu.Unlock()
+	}
+}
+
+// refreshStorageAllowance 按 collabQuotaPeriod 的间隔重新查询知识库所有者的存储空间配额，
+// 查询在 hub.mu 之外进行，失败时沿用上一次的结果
+func (hub *collabHub) refreshStorageAllowance() {
+	hub.mu.Lock()
+	fresh := time.Since(hub.storageCheckedAt) < collabQuotaPeriod
+	ownerId := hub.doc.KnowledgeBase.OwnerID
+	hub.mu.Unlock()
+	if fresh {
+		return
+	}
+	allowance, err := hub.cc.docController.quota.StorageAllowance(ownerId)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	hub.mu.Lock()
+	hub.storageAllowance = allowance
+	hub.storageCheckedAt = time.Now()
+	hub.mu.Unlock()
+}
+
+// exceedsStorage 内容从 oldContent 变为 newContent 后是否超出存储空间配额，不增加内容的修改总是允许，以便用户删减内容
+func exceedsStorage(allowance int64, oldContent, newContent string) bool {
+	return allowance >= 0 && len(newContent) > len(oldContent) && int64(len(newContent)) > allowance
+}
+
+// writePump 串行地向客户端写消息并维持心跳，gorilla/websocket 不支持并发写
+func (cl *collabClient) writePump() {
+	ticker := time.NewTicker(collabPingPeriod)
+	defer func() {
+		ticker.Stop()
+		cl.conn.Close()
+	}()
+	for {
+		select {
+		case message, ok := <-cl.send:
+			_ = cl.conn.SetWriteDeadline(time.Now().Add(collabWriteWait))
+			if !ok {
+				_ = cl.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := cl.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			_ = cl.conn.SetWriteDeadline(time.Now().Add(collabWriteWait))
+			if err := cl.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (hub *collabHub) handleMessage(client *collabClient, msg collabMessage) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	switch msg.Type {
+	case "op":
+		if !client.canEdit {
+			hub.sendTo(client, collabMessage{Type: "error", Message: "无修改权限"})
+			return
+		}
+		if msg.Operation == nil {
+			hub.sendTo(client, collabMessage{Type: "error", Message: "缺少操作内容"})
+			return
+		}
+		op, content, err := hub.transformOperation(msg.Operation, msg.Revision)
+		if err != nil {
+			log.Println(err)
+			// 客户端状态已与服务端不一致，下发完整内容让客户端重置
+			current := hub.content
+			hub.sendTo(client, collabMessage{Type: "reset", Revision: hub.revision, Content: &current, Message: err.Error()})
+			return
+		}
+		if exceedsStorage(hub.storageAllowance, hub.content, content) {
+			// 拒绝超出配额的操作，下发完整内容让客户端撤销本地修改
+			current := hub.content
+			hub.sendTo(client, collabMessage{Type: "reset", Revision: hub.revision, Content: &current, Message: collabStorageExceededMessage})
+			return
+		}
+		revision := hub.commitOperation(op, content, client)
+		if msg.Revision > client.revision {
+			client.revision = msg.Revision
+			hub.trimHistory()
+		}
+		hub.sendTo(client, collabMessage{Type: "ack", Revision: revision})
+	case "cursor":
+		position, selectionEnd := msg.Position, msg.SelectionEnd
+		if msg.Revision >= hub.historyBase && msg.Revision <= hub.revision {
+			for _, op := range hub.history[msg.Revision-hub.historyBase:] {
+				position = op.TransformIndex(position)
+				selectionEnd = op.TransformIndex(selectionEnd)
+			}
+		}
+		client.position, client.selectionEnd = position, selectionEnd
+		hub.broadcast(collabMessage{
+			Type:         "cursor",
+			ClientID:     client.id,
+			UserID:       strconv.FormatInt(client.userId, 10),
+			Revision:     hub.revision,
+			Position:     position,
+			SelectionEnd: selectionEnd,
+		}, client.id)
+	case "ping":
+		hub.sendTo(client, collabMessage{Type: "pong", Revision: hub.revision})
+	default:
+		hub.sendTo(client, collabMessage{Type: "error", Message: "未知的消息类型"})
+	}
+}
+
+// applyOperation 将基于 baseRevision 的操作与其后的并发操作做变换后应用到文档，调用方需持有 hub.mu。
+// client 为 nil 时表示操作来自服务端（例如通过 HTTP 接口保存的内容）。
+func (hub *collabHub) applyOperation(op *util.TextOperation, baseRevision int, client *collabClient) (int, error) {
+	op, content, err := hub.transformOperation(op, baseRevision)
+	if err != nil {
+		return 0, err
+	}
+	return hub.commitOperation(op, content, client), nil
+}
+
+// transformOperation 将基于 baseRevision 的操作变换到当前版本，返回变换后的操作与应用后的内容，不修改文档。调用方需持有 hub.mu
+func (hub *collabHub) transformOperation(op *util.TextOperation, baseRevision int) (*util.TextOperation, string, error) {
+	if baseRevision < hub.historyBase || baseRevision > hub.revision {
+		return nil, "", errors.New("operation revision not in history")
+	}
+	for _, concurrent := range hub.history[baseRevision-hub.historyBase:] {
+		transformed, _, err := util.TransformOperation(op, concurrent)
+		if err != nil {
+			return nil, "", err
+		}
+		op = transformed
+	}
+	content, err := op.Apply(hub.content)
+	if err != nil {
+		return nil, "", err
+	}
+	return op, content, nil
+}
+
+// commitOperation 应用已变换到当前版本的操作并广播给其他连接，返回新的版本号。调用方需持有 hub.mu
+func (hub *collabHub) commitOperation(op *util.TextOperation, content string, client *collabClient) int {
+	hub.content = content
+	hub.history = append(hub.history, op)
+	hub.revision++
+	hub.dirty = true
+	hub.unversioned = true
+	for _, cl := range hub.clients {
+		cl.position = op.TransformIndex(cl.position)
+		cl.selectionEnd = op.TransformIndex(cl.selectionEnd)
+	}
+
+	msg := collabMessage{Type: "op", Revision: hub.revision - 1, Operation: op}
+	exclude := ""
+	if client != nil {
+		hub.lastEditor = client.userId
+		msg.ClientID = client.id
+		msg.UserID = strconv.FormatInt(client.userId, 10)
+		exclude = client.id
+	}
+	hub.broadcast(msg, exclude)
+	return hub.revision
+}
+
+// persist 将内存中的内容写回文档存储与 ES；snapshot 为 true 时同时生成历史版本。
+// 如果文档在协同期间被 HTTP 接口修改过，先把外部修改作为一次操作合并进来，避免互相覆盖。
+func (hub *collabHub) persist(snapshot bool) {
+	dc := hub.cc.docController
+	lockToken, err := dc.docDao.LockDocument(hub.doc.ID)
+	for attempt := 0; snapshot && err == nil && lockToken == "" && attempt < 10; attempt++ {
+		time.Sleep(collabLockRetryDelay)
+		lockToken, err = dc.docDao.LockDocument(hub.doc.ID)
+	}
+	if err != nil || lockToken == "" {
+		// 有其他请求正在保存文档，等待下一轮
+		return
+	}
+	defer dc.docDao.UnlockDocument(hub.doc.ID, lockToken)
+	// 写入前重新查询存储空间配额，查询失败时本轮不落盘；文档可能被移动到其他知识库，所有者需在锁内读取
+	hub.mu.Lock()
+	ownerId := hub.doc.KnowledgeBase.OwnerID
+	hub.mu.Unlock()
+	allowance, err := dc.quota.StorageAllowance(ownerId)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	hub.storageAllowance = allowance
+	hub.storageCheckedAt = time.Now()
+
+	strDocId := strconv.FormatInt(hub.doc.ID, 10)
+	diskContent, err := getDocumentContentById(strDocId)
+	if err != nil {
+		return
+	}
+	if util.HashContent([]byte(diskContent)) != hub.persistedHash {
+		external := util.NewTextOperationFromDiff(hub.persistedContent, diskContent)
+		if _, err := hub.applyOperation(external, hub.persistedRevision, nil); err != nil {
+			log.Println(err)
+			return
+		}
+	}
+	if !hub.dirty {
+		return
+	}
+	if exceedsStorage(allowance, diskContent, hub.content) {
+		// 配额在两次查询之间已经用完：撤销尚未落盘的修改并通知所有连接
+		revert := util.NewTextOperationFromDiff(hub.content, diskContent)
+		if _, err := hub.applyOperation(revert, hub.revision, nil); err != nil {
+			log.Println(err)
+			return
+		}
+		hub.broadcast(collabMessage{Type: "error", Message: collabStorageExceededMessage}, "")
+		hub.persistedContent = diskContent
+		hub.persistedHash = util.HashContent([]byte(diskContent))
+		hub.persistedRevision = hub.revision
+		hub.dirty = false
+		return
+	}
+
+	content := []byte(hub.content)
+	if err := dc.ensureInitialVersion(hub.doc); err != nil {
+		log.Println(err)
+		return
+	}
+	if err := saveDocumentContent(strDocId, content); err != nil {
+		log.Println(err)
+		return
+	}
+	hash := util.HashContent(content)
+	if err := dc.docDao.UpdateDocToES(hub.doc.ID, hub.doc.Title, hub.content); err != nil {
+		log.Println(err)
+	}
+	if err := dc.docDao.SetDocumentContentHash(hub.doc.ID, hash); err != nil {
+		log.Println(err)
+	}
+	hub.persistedContent = hub.content
+	hub.persistedHash = hash
+	hub.persistedRevision = hub.revision
+	hub.dirty = false
+
+	if snapshot && hub.unversioned && hub.lastEditor != 0 {
+		if _, err := dc.saveDocumentVersion(hub.doc, hub.lastEditor, content, nil, 0); err != nil {
+			log.Println(err)
+			return
+		}
+		hub.unversioned = false
+		if err := dc.docDao.UpdateRecentDocumentInRedis(dao.Edit, hub.doc, hub.doc.KnowledgeBase.Name, strconv.FormatInt(hub.lastEditor, 10)); err != nil {
+			log.Println("插入最近编辑记录到redis中失败")
+		}
+	}
+}
+
+// trimHistory 丢弃所有可编辑连接与落盘合并都不再需要的操作历史，调用方需持有 hub.mu。
+// 历史超过 collabMaxHistory 时强制丢弃，长期未提交操作的客户端下次提交时会收到 reset
+func (hub *collabHub) trimHistory() {
+	keep := hub.persistedRevision
+	for _, cl := range hub.clients {
+		if cl.canEdit && cl.revision < keep {
+			keep = cl.revision
+		}
+	}
+	if limit := hub.revision - collabMaxHistory; keep < limit && limit <= hub.persistedRevision {
+		keep = limit
+	}
+	drop := keep - hub.historyBase
+	if drop <= 0 {
+		return
+	}
+	for i := 0; i < drop; i++ {
+		hub.history[i] = nil
+	}
+	hub.history = hub.history[drop:]
+	hub.historyBase = keep
+}
+
+// presenceList 返回当前在线协作者，调用方需持有 hub.mu
+func (hub *collabHub) presenceList() []collabPresence {
+	list := make([]collabPresence, 0, len(hub.clients))
+	for _, cl := range hub.clients {
+		list = append(list, cl.presence())
+	}
+	return list
+}
+
+// broadcast 向除 exclude 外的所有连接发送消息，调用方需持有 hub.mu
+func (hub *collabHub) broadcast(msg collabMessage, exclude string) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for id, cl := range hub.clients {
+		if id != exclude {
+			hub.enqueue(cl, data)
+		}
+	}
+}
+
+// sendTo 向单个连接发送消息，调用方需持有 hub.mu
+func (hub *collabHub) sendTo(client *collabClient, msg collabMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	hub.enqueue(client, data)
+}
+
+// enqueue 发送缓冲区已满说明客户端消费过慢，直接断开，由客户端重连后重新同步
+func (hub *collabHub) enqueue(client *collabClient, data []byte) {
+	select {
+	case client.send <- data:
+	default:
+		delete(hub.clients, client.id)
+		close(client.send)
+	}
+}
@@ -13,24 +13,36 @@ import (
 
 type CommentController struct {
 	commentDao *dao.CommentDAO
+	authz      *Authorizer
 }
 
-func NewCommentController(commentDao *dao.CommentDAO) *CommentController {
-	return &CommentController{commentDao: commentDao}
+func NewCommentController(commentDao *dao.CommentDAO, authz *Authorizer) *CommentController {
+	return &CommentController{commentDao: commentDao, authz: authz}
+}
+
+// commentNickname 评论者昵称，通过分享链接发表的匿名评论不显示关联用户
+func commentNickname(comment models.DocumentComment) string {
+	if comment.IsAnonymous {
+		return "匿名用户"
+	}
+	return comment.User.Nickname
+}
+
+// commentUserId 评论者 ID，匿名评论关联的是分享链接创建者，不对外暴露
+func commentUserId(comment models.DocumentComment) string {
+	if comment.IsAnonymous {
+		return ""
+	}
+	return strconv.FormatInt(comment.UserID, 10)
 }
 
 func (cc *CommentController) ReplyDocumentComment(c *gin.Context) {
 	var contextData struct {
-		UserId         int64  `json:"userid"`
 		DocId          string `json:"doc_id" binding:"required"`
 		RootId         string `json:"root_id" binding:"required"`
-		ParentId       string `json:"parent_id"`
+		ParentId       string `json:"parent_id"` // 可选，为空时直接回复顶级评论
 		CommentContent string `json:"comment_content"`
 	}
-
-	if id, exists := c.Get("userid"); exists {
-		contextData.UserId = id.(int64)
-	}
 	if err := c.ShouldBindJSON(&contextData); err != nil {
 		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，评论创建失败"})
@@ -42,28 +54,33 @@ func (cc *CommentController) ReplyDocumentComment(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，评论创建失败"})
 		return
 	}
-	var rootId *int64 = nil
-	if contextData.ParentId != "" {
-		parsedId, err := strconv.ParseInt(contextData.RootId, 10, 64)
-		if err == nil {
-			rootId = &parsedId // 将 parsedId 的地址赋给 parentId
-		}
+	// 评论者及以上角色才能发表评论
+	if _, _, ok := cc.authz.AuthorizeDocument(c, docId, models.RoleCommenter); !ok {
+		return
 	}
-	var parentId *int64 = nil
+	rootId, err := strconv.ParseInt(contextData.RootId, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的评论ID"})
+		return
+	}
+	parentId := rootId
 	if contextData.ParentId != "" {
-		parsedId, err := strconv.ParseInt(contextData.ParentId, 10, 64)
-		if err == nil {
-			parentId = &parsedId // 将 parsedId 的地址赋给 parentId
+		if parentId, err = strconv.ParseInt(contextData.ParentId, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "错误的评论ID"})
+			return
 		}
 	}
+	if !cc.checkReplyTarget(c, docId, rootId, parentId) {
+		return
+	}
 
 	dc := models.DocumentComment{
 		DocumentID:   docId,
-		ParentID:     parentId,
-		RootID:       rootId,
-		UserID:       contextData.UserId,
+		ParentID:     &parentId,
+		RootID:       &rootId,
+		UserID:       c.GetInt64("userid"),
 		Content:      contextData.CommentContent,
-		Status:       "已发布",
+		Status:       models.CommentStatusPublished,
 		LikeCount:    0,
 		DislikeCount: 0,
 		CreatedAt:    time.Now(),
@@ -77,25 +94,51 @@ func (cc *CommentController) ReplyDocumentComment(c *gin.Context) {
 	if err != nil {
 		log.Println(err)
 		c.JSON(http.StatusOK, gin.H{"error": "系统错误，评论回复失败"})
+		return
 	}
 	err = cc.commentDao.InsertReplyCommentToRedis(dc)
 	if err != nil {
 		log.Println(err)
 		c.JSON(http.StatusOK, gin.H{"error": "系统错误，评论回复失败"})
+		return
 	}
 	c.JSON(http.StatusOK, gin.H{})
 
 }
 
+// checkReplyTarget 校验回复的顶级评论与被回复的评论都属于 docId 且在同一楼层中，失败时已写入响应
+func (cc *CommentController) checkReplyTarget(c *gin.Context, docId, rootId, parentId int64) bool {
+	root, err := cc.commentDao.GetCommentByID(rootId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，评论回复失败"})
+		return false
+	}
+	if root == nil || root.DocumentID != docId || root.RootID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "回复的评论不存在或不属于该文档"})
+		return false
+	}
+	if parentId == rootId {
+		return true
+	}
+	parent, err := cc.commentDao.GetCommentByID(parentId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，评论回复失败"})
+		return false
+	}
+	if parent == nil || parent.DocumentID != docId || parent.RootID == nil || *parent.RootID != rootId {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "回复的评论不存在或不属于该文档"})
+		return false
+	}
+	return true
+}
+
 func (cc *CommentController) CreateDocumentComment(c *gin.Context) {
 	var contextData struct {
-		UserId         int64  `json:"userid"`
 		DocId          string `json:"doc_id" binding:"required"`
 		CommentContent string `json:"comment_content"`
 	}
-	if id, exists := c.Get("userid"); exists {
-		contextData.UserId = id.(int64)
-	}
 	if err := c.ShouldBindJSON(&contextData); err != nil {
 		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，评论创建失败"})
@@ -107,14 +150,18 @@ func (cc *CommentController) CreateDocumentComment(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，评论创建失败"})
 		return
 	}
+	// 评论者及以上角色才能发表评论
+	if _, _, ok := cc.authz.AuthorizeDocument(c, docId, models.RoleCommenter); !ok {
+		return
+	}
 
 	dc := models.DocumentComment{
 		DocumentID:   docId,
 		ParentID:     nil,
 		RootID:       nil,
-		UserID:       contextData.UserId,
+		UserID:       c.GetInt64("userid"),
 		Content:      contextData.CommentContent,
-		Status:       "已发布",
+		Status:       models.CommentStatusPublished,
 		LikeCount:    0,
 		DislikeCount: 0,
 		CreatedAt:    time.Now(),
@@ -164,6 +211,9 @@ func (cc *CommentController) GetDocumentRootComment(c *gin.Context) {
 		c.JSON(http.StatusInsufficientStorage, gin.H{"error": "系统错误，评论信息拉取失败"})
 		return
 	}
+	if _, _, ok := cc.authz.AuthorizeDocument(c, docId, models.RoleViewer); !ok {
+		return
+	}
 	commentList, total, err := cc.commentDao.GetRootCommentsByDocumentID(docId, page, pageSize)
 	if err != nil {
 		log.Println(err)
@@ -182,8 +232,8 @@ func (cc *CommentController) GetDocumentRootComment(c *gin.Context) {
 			"comment_id":            strconv.FormatInt(comment.ID, 10),
 			"comment_content":       comment.Content,
 			"doc_id":                strconv.FormatInt(comment.DocumentID, 10),
-			"user_id":               strconv.FormatInt(comment.UserID, 10),
-			"nickname":              comment.User.Nickname,
+			"user_id":               commentUserId(comment),
+			"nickname":              commentNickname(comment),
 			"last_updated_at":       comment.UpdatedAt,
 			"comment_like_count":    comment.LikeCount,
 			"have_children_comment": have_children_comment,
@@ -217,6 +267,21 @@ func (cc *CommentController) GetDocumentChildComment(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "评论回复获取失败，请稍后再试"})
 		return
 	}
+	// 根据顶级评论所属文档校验阅读权限
+	rootComment, err := cc.commentDao.GetCommentByID(rootId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "评论回复获取失败，请稍后再试"})
+		return
+	}
+	// 被管理员下架的评论连同其回复一起隐藏
+	if rootComment == nil || rootComment.Status == models.CommentStatusTakenDown {
+		c.JSON(http.StatusNotFound, gin.H{"error": "评论不存在"})
+		return
+	}
+	if _, _, ok := cc.authz.AuthorizeDocument(c, rootComment.DocumentID, models.RoleViewer); !ok {
+		return
+	}
 	var childrenComments []map[string]interface{}
 	childrenComments, err = cc.commentDao.GetChildrenCommentsByRootIdFromRedis(rootId, int64(page), int64(pageSize))
 	for _, childComment := range childrenComments {
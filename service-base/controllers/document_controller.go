@@ -3,10 +3,11 @@ package controllers
 import (
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"io"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 	"yuqueppbackend/service-base/config"
 	"yuqueppbackend/service-base/dao"
 	"yuqueppbackend/service-base/models"
@@ -14,23 +15,49 @@ import (
 )
 
 type DocumentController struct {
-	docDao *dao.DocDao
+	docDao     *dao.DocDao
+	versionDao *dao.DocVersionDao
+	trashDao   *dao.TrashDAO
+	authz      *Authorizer
+	quota      *QuotaController
+	collab     *CollabController // 由 NewCollabController 设置，文档移动后刷新正在协同编辑的文档
 }
 
-func getDocumentStoragePath(docId string) string {
-	return config.GetDocumentStoragePath() + "/" + docId + ".txt"
+// getDocumentContentKey 文档内容在内容存储中的 key
+func getDocumentContentKey(docId string) string {
+	return docId + ".txt"
 }
 
 func getDocumentContentById(docId string) (string, error) {
-	content, err := os.ReadFile(config.GetDocumentStoragePath() + "/" + docId + ".txt")
+	content, err := util.GetContentStore().Get(getDocumentContentKey(docId))
 	if err != nil {
 		log.Println(err)
 		return "", err
 	}
 	return string(content), nil
 }
+
+// saveDocumentContent 覆盖写入文档内容
+func saveDocumentContent(docId string, content []byte) error {
+	return util.GetContentStore().Put(getDocumentContentKey(docId), content)
+}
+
+// getDocumentVersionKey 历史版本内容保存在 versions/<doc_id>/<version_id>.txt
+func getDocumentVersionKey(docId, versionId string) string {
+	return "versions/" + docId + "/" + versionId + ".txt"
+}
+
 func deleteDocumentFile(docId string) error {
-	err := os.Remove(config.GetDocumentStoragePath() + "/" + docId + ".txt")
+	err := util.GetContentStore().Delete(getDocumentContentKey(docId))
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func deleteDocumentVersionFiles(docId string) error {
+	err := util.GetContentStore().DeletePrefix("versions/" + docId + "/")
 	if err != nil {
 		log.Println(err)
 		return err
@@ -38,23 +65,32 @@ func deleteDocumentFile(docId string) error {
 	return nil
 }
 
+// formatETag 将内容哈希格式化为强校验 ETag
+func formatETag(hash string) string {
+	return "\"" + hash + "\""
+}
+
+// parseETag 从 If-Match / If-None-Match 头中取出内容哈希，兼容弱校验前缀与无引号写法
+func parseETag(header string) string {
+	header = strings.TrimSpace(header)
+	header = strings.TrimPrefix(header, "W/")
+	return strings.Trim(header, "\"")
+}
+
 // NewDocumentController 创建新的 DocumentController
-func NewDocumentController(docDao *dao.DocDao) *DocumentController {
-	return &DocumentController{docDao: docDao}
+func NewDocumentController(docDao *dao.DocDao, versionDao *dao.DocVersionDao, trashDao *dao.TrashDAO, authz *Authorizer, quota *QuotaController) *DocumentController {
+	return &DocumentController{docDao: docDao, versionDao: versionDao, trashDao: trashDao, authz: authz, quota: quota}
 }
 
 // CreateDocumentHandler 创建文档
 func (dc *DocumentController) CreateDocumentHandler(c *gin.Context) {
 
 	var contextData struct {
-		UserId int64  `json:"userid"`
-		KbId   string `json:"kb_id" binding:"required"`
-		Title  string `json:"doc_title"`
+		KbId     string `json:"kb_id" binding:"required"`
+		Title    string `json:"doc_title"`
+		ParentId string `json:"parent_id"` // 可选，父文档 ID，为空时创建在知识库根目录
 	}
-	if id, exists := c.Get("userid"); exists {
-		contextData.UserId = id.(int64)
-	}
-
+	userId := c.GetInt64("userid")
 	if err := c.ShouldBindJSON(&contextData); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
 		return
@@ -67,54 +103,82 @@ func (dc *DocumentController) CreateDocumentHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "系统错误，请稍后再试"})
 		return
 	}
-	var doc models.Document = models.Document{
-		KnowledgeBaseID: kbId64,
-		Title:           contextData.Title,
-		OwnerId:         contextData.UserId,
+	// 编辑者及以上角色才能在知识库中创建文档
+	kb, _, ok := dc.authz.AuthorizeKB(c, kbId64, models.RoleEditor)
+	if !ok {
+		return
 	}
-
-	if err := dc.docDao.CreateDocument(&doc); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create document"})
+	// 检查知识库所有者套餐的存储空间配额，文档数量配额在创建时检查
+	if !dc.quota.CheckStorageQuota(c, kb, int64(len("# "+contextData.Title))) {
 		return
 	}
-	str_doc_id := strconv.FormatInt(doc.ID, 10)
-	doc_file, err := os.Create(config.GetDocumentStoragePath() + "/" + str_doc_id + ".txt")
+	// 校验父文档存在且属于同一知识库
+	var parentId *int64 = nil
+	if contextData.ParentId != "" {
+		parsedId, err := strconv.ParseInt(contextData.ParentId, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "错误的父文档ID"})
+			return
+		}
+		parent, err := dc.docDao.GetDocumentByID(parsedId)
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+			return
+		}
+		if parent == nil || parent.KnowledgeBaseID != kbId64 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "父文档不存在或不属于该知识库"})
+			return
+		}
+		parentId = &parsedId
+	}
+	sortOrder, err := dc.docDao.GetNextSortOrder(kbId64, parentId)
 	if err != nil {
+		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
 		return
 	}
-	// 确保文件内容为空
-	err = doc_file.Truncate(0)
-	doc_content := "# " + doc.Title
-	if _, err := doc_file.Write([]byte(doc_content)); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+	var doc models.Document = models.Document{
+		KnowledgeBaseID: kbId64,
+		Title:           contextData.Title,
+		OwnerId:         userId,
+		ParentID:        parentId,
+		SortOrder:       sortOrder,
+	}
+	// 在知识库所有者套餐的文档数量配额内创建文档
+	if !dc.quota.CreateDocument(c, kb, &doc) {
 		return
 	}
-	if err != nil {
+	recordAudit(c, models.AuditDocCreate, models.AuditTargetDocument, doc.ID, models.AuditResultSuccess, "kb_id="+contextData.KbId)
+	str_doc_id := strconv.FormatInt(doc.ID, 10)
+	doc_content := "# " + doc.Title
+	if err := saveDocumentContent(str_doc_id, []byte(doc_content)); err != nil {
+		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
 		return
 	}
 
 	_ = dc.docDao.InsertDocToES(doc, doc_content)
 
-	hashValue, err := util.HashDocumentContent(config.GetDocumentStoragePath() + "/" + str_doc_id + ".txt")
+	hashValue := util.HashContent([]byte(doc_content))
+	err = dc.docDao.SetDocumentContentHash(doc.ID, hashValue)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
 		return
 	}
-	err = dc.docDao.SetDocumentContentHash(doc.ID, hashValue)
-	if err != nil {
+	// 记录文档的初始版本
+	if _, err := dc.saveDocumentVersion(doc, userId, []byte(doc_content), nil, 0); err != nil {
+		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
 		return
 	}
-	// 关闭文件
-	defer doc_file.Close()
-
 	c.JSON(http.StatusOK, gin.H{
-		"doc_id":      str_doc_id,
-		"kb_id":       doc.KnowledgeBaseID,
-		"doc_title":   doc.Title,
-		"doc_content": doc.Content,
+		"doc_id":         str_doc_id,
+		"kb_id":          doc.KnowledgeBaseID,
+		"doc_title":      doc.Title,
+		"doc_content":    doc.Content,
+		"doc_parent_id":  contextData.ParentId,
+		"doc_sort_order": doc.SortOrder,
 	})
 }
 
@@ -127,15 +191,9 @@ func (dc *DocumentController) GetDocumentByIDHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "系统错误请稍后重试"})
 		return
 	}
-	// 判断用户请求文档是否存在
-	doc, err := dc.docDao.GetDocumentByID(int64(docId))
-	if err != nil {
-		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve document"})
-		return
-	}
-	if doc == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "当前文档不见了，快去新建吧"})
+	// 判断用户请求文档是否存在以及是否有阅读权限
+	doc, _, ok := dc.authz.AuthorizeDocument(c, int64(docId), models.RoleViewer)
+	if !ok {
 		return
 	}
 
@@ -154,13 +212,7 @@ func (dc *DocumentController) GetDocumentByIDHandler(c *gin.Context) {
 	}
 
 	// 获取知识库名称
-	kb, err := dc.docDao.FindKB(doc.OwnerId, doc.KnowledgeBaseID)
-	if err != nil {
-		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve knowledge base"})
-		return
-	}
-	kbName := kb.Name
+	kbName := doc.KnowledgeBase.Name
 
 	//将最近浏览记录写入到redis中
 	err = dc.docDao.UpdateRecentDocumentInRedis(dao.View, *doc, kbName, strUserId)
@@ -169,22 +221,25 @@ func (dc *DocumentController) GetDocumentByIDHandler(c *gin.Context) {
 		return
 	}
 	// 在redis中写入文档内容哈希值
-	hashValue, err := util.HashDocumentContent(config.GetDocumentStoragePath() + "/" + strDocId + ".txt")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
-		return
-	}
+	hashValue := util.HashContent([]byte(docContent))
 	err = dc.docDao.SetDocumentContentHash(doc.ID, hashValue)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
 		return
 	}
 
+	// 以内容哈希作为 ETag，客户端保存时通过 If-Match 回传
+	c.Header("ETag", formatETag(hashValue))
+	if parseETag(c.GetHeader("If-None-Match")) == hashValue {
+		c.Status(http.StatusNotModified)
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"doc_id":      strDocId,
-		"kb_id":       strKbId,
-		"doc_title":   doc.Title,
-		"doc_content": docContent,
+		"doc_content_hash": hashValue,
+		"doc_id":           strDocId,
+		"kb_id":            strKbId,
+		"doc_title":        doc.Title,
+		"doc_content":      docContent,
 	})
 	return
 }
@@ -197,6 +252,9 @@ func (dc *DocumentController) GetDocumentsByKnowledgeBaseIDHandler(c *gin.Contex
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid knowledge base ID"})
 		return
 	}
+	if _, _, ok := dc.authz.AuthorizeKB(c, int64(kbID), models.RoleViewer); !ok {
+		return
+	}
 
 	docs, err := dc.docDao.GetDocumentsByKnowledgeBaseID(int64(kbID))
 	if err != nil {
@@ -209,11 +267,42 @@ func (dc *DocumentController) GetDocumentsByKnowledgeBaseIDHandler(c *gin.Contex
 		tmpMap["kb_id"] = strconv.FormatInt(doc.KnowledgeBaseID, 10)
 		tmpMap["doc_id"] = strconv.FormatInt(doc.ID, 10)
 		tmpMap["doc_title"] = doc.Title
+		tmpMap["doc_parent_id"] = formatParentId(doc.ParentID)
+		tmpMap["doc_sort_order"] = doc.SortOrder
 		docList = append(docList, tmpMap)
 	}
 	c.JSON(http.StatusOK, gin.H{"doc_list": docList})
 }
 
+// checkEditBase 乐观并发控制：客户端必须通过 If-Match 头或 base_hash 表单字段提交编辑时所基于的内容哈希，
+// 与当前内容不一致时返回 409 并附带最新内容。调用方需要先持有文档锁
+func checkEditBase(c *gin.Context, docIdStr string) bool {
+	baseHash := parseETag(c.GetHeader("If-Match"))
+	if baseHash == "" {
+		baseHash = c.PostForm("base_hash")
+	}
+	if baseHash == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"message": "缺少编辑基准，请通过 If-Match 头或 base_hash 字段提交文档内容哈希"})
+		return false
+	}
+	currentContent, err := getDocumentContentById(docIdStr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return false
+	}
+	currentHash := util.HashContent([]byte(currentContent))
+	if currentHash != baseHash {
+		c.Header("ETag", formatETag(currentHash))
+		c.JSON(http.StatusConflict, gin.H{
+			"message":          "文档已被他人修改，请合并最新内容后再保存",
+			"doc_content_hash": currentHash,
+			"doc_content":      currentContent,
+		})
+		return false
+	}
+	return true
+}
+
 // UpdateDocumentHandler 更新文档
 func (dc *DocumentController) UpdateDocumentHandler(c *gin.Context) {
 	// 获取 doc_id 参数
@@ -224,44 +313,67 @@ func (dc *DocumentController) UpdateDocumentHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "文档不存在或已经删除，请重试"})
 		return
 	}
-	doc, err := dc.docDao.GetDocumentByID(docId)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "系统错误，请稍候再试"})
+	doc, _, ok := dc.authz.AuthorizeDocument(c, docId, models.RoleEditor)
+	if !ok {
 		return
 	}
-	if doc == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "系统错误，请稍候再试"})
+
+	// 获取知识库名称
+	kbName := doc.KnowledgeBase.Name
+	// 获取上传的文件
+	docFile, err := c.FormFile("file") // 注意字段名称是 'file'
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "系统错误，文件保存失败，请稍后再试"})
 		return
 	}
-	if doc.OwnerId != userId {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "无修改权限，修改失败"})
+	// 每次保存都会生成新版本，先检查单次上传大小，存储空间在记录版本时检查
+	if !dc.quota.CheckAttachmentSize(c, &doc.KnowledgeBase, docFile.Size) {
 		return
 	}
-
-	// 获取知识库名称
-	kb, err := dc.docDao.FindKB(doc.OwnerId, doc.KnowledgeBaseID)
+	// 加锁，保证"校验基准哈希 + 写入文件"的原子性
+	lockToken, err := dc.docDao.LockDocument(docId)
 	if err != nil {
 		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve knowledge base"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
 		return
 	}
-	kbName := kb.Name
-	// 获取上传的文件
-	docFile, err := c.FormFile("file") // 注意字段名称是 'file'
+	if lockToken == "" {
+		c.JSON(http.StatusConflict, gin.H{"message": "文档正在被其他请求保存，请稍后再试"})
+		return
+	}
+	defer dc.docDao.UnlockDocument(docId, lockToken)
+
+	if !checkEditBase(c, docIdStr) {
+		return
+	}
+
+	// 保存文件到内容存储
+	uploaded, err := docFile.Open()
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "系统错误，文件保存失败，请稍后再试"})
 		return
 	}
-	// 保存文件到服务器
-	err = c.SaveUploadedFile(docFile, getDocumentStoragePath(docIdStr))
+	content, err := io.ReadAll(uploaded)
+	uploaded.Close()
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "系统错误，文件保存失败，请稍后再试"})
 		return
 	}
-	content, err := os.ReadFile(getDocumentStoragePath(docIdStr))
-	if err != nil {
+	if err := dc.ensureInitialVersion(*doc); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，版本记录失败"})
+		return
+	}
+	// 先在配额内记录新版本，超出配额时不会覆盖当前内容
+	if _, ok := dc.saveDocumentVersionWithinQuota(c, *doc, userId.(int64), content, nil); !ok {
+		return
+	}
+	if err := saveDocumentContent(docIdStr, content); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "系统错误，文件保存失败，请稍后再试"})
 		return
 	}
+	recordAudit(c, models.AuditDocUpdate, models.AuditTargetDocument, docId, models.AuditResultSuccess, "size="+strconv.Itoa(len(content)))
 	strContent := string(content)
 	err = dc.docDao.UpdateDocToES(docId, doc.Title, strContent)
 	if err != nil {
@@ -269,11 +381,7 @@ func (dc *DocumentController) UpdateDocumentHandler(c *gin.Context) {
 		return
 	}
 	// 在redis中写入文档内容哈希值
-	hashValue, err := util.HashDocumentContent(config.GetDocumentStoragePath() + "/" + docIdStr + ".txt")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
-		return
-	}
+	hashValue := util.HashContent(content)
 	err = dc.docDao.SetDocumentContentHash(doc.ID, hashValue)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
@@ -284,8 +392,9 @@ func (dc *DocumentController) UpdateDocumentHandler(c *gin.Context) {
 		log.Println("插入最近编辑记录到redis中失败")
 		return
 	}
-	// 返回成功响应
-	c.JSON(http.StatusOK, gin.H{"message": "文件更新成功"})
+	// 返回成功响应，附带新的内容哈希供客户端作为下一次保存的基准
+	c.Header("ETag", formatETag(hashValue))
+	c.JSON(http.StatusOK, gin.H{"message": "文件更新成功", "doc_content_hash": hashValue})
 }
 
 // DeleteDocumentByIDHandler 删除文档
@@ -298,48 +407,36 @@ func (dc *DocumentController) DeleteDocumentByIDHandler(c *gin.Context) {
 		return
 	}
 
-	userID, exists := c.Get("userid") // 从上下文中获取当前用户的ID
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户没有权限"})
+	// 编辑者及以上角色才能删除文档
+	document, _, ok := dc.authz.AuthorizeDocument(c, docId, models.RoleEditor)
+	if !ok {
 		return
 	}
 
-	// 查询文档的所有者
-	document, err := dc.docDao.GetDocumentByID(int64(docId))
+	// 将文档及其子文档移入知识库所有者的回收站，内容文件与历史版本保留到彻底删除时再清理
+	item, trashedIds, err := dc.trashDao.TrashDocument(document, config.GetTrashRetention())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve document"})
-		return
-	}
-
-	// 判断当前用户是否为文档的所有者
-	if document.OwnerId != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to delete this document"})
-		return
-	}
-
-	// 执行删除操作
-	if err := dc.docDao.DeleteDocumentByID(int64(docId)); err != nil {
+		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete document"})
 		return
 	}
-	deleteDocumentFile(docIdStr)
+	recordAudit(c, models.AuditDocDelete, models.AuditTargetDocument, document.ID, models.AuditResultSuccess, "trash_id="+strconv.FormatInt(item.ID, 10))
+	removeDocumentsFromES(dc.docDao, trashedIds)
 
-	err = dc.docDao.DeleteDocFromES(docId)
-	if err != nil {
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Document deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Document deleted successfully", "trash_id": strconv.FormatInt(item.ID, 10)})
 }
 
 // IncrementViewCountHandler 增加浏览次数
 func (dc *DocumentController) IncrementViewCountHandler(c *gin.Context) {
-	idParam := c.Param("id")
+	idParam := c.Param("doc_id")
 	id, err := strconv.Atoi(idParam)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
 		return
 	}
+	if _, _, ok := dc.authz.AuthorizeDocument(c, int64(id), models.RoleViewer); !ok {
+		return
+	}
 
 	if err := dc.docDao.IncrementViewCount(uint(id)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to increment view count"})
@@ -497,6 +594,9 @@ func (dc *DocumentController) GetDocumenHashByIdHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的文档ID"})
 		return
 	}
+	if _, _, ok := dc.authz.AuthorizeDocument(c, docId, models.RoleViewer); !ok {
+		return
+	}
 
 	hash, err := dc.docDao.GetDocumentContentHashByDocumentId(docId)
 	if err != nil {
@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+	"yuqueppbackend/service-base/config"
+	"yuqueppbackend/service-base/dao"
+	"yuqueppbackend/service-base/models"
+)
+
+// documentTreeNode 知识库目录树中的一个节点
+type documentTreeNode struct {
+	DocId     string              `json:"doc_id"`
+	KbId      string              `json:"kb_id"`
+	Title     string              `json:"doc_title"`
+	ParentId  string              `json:"doc_parent_id"`
+	SortOrder int                 `json:"doc_sort_order"`
+	CreatedAt interface{}         `json:"doc_created_at"`
+	UpdatedAt interface{}         `json:"doc_updated_at"`
+	Children  []*documentTreeNode `json:"children"`
+}
+
+func formatParentId(parentId *int64) string {
+	if parentId == nil {
+		return ""
+	}
+	return strconv.FormatInt(*parentId, 10)
+}
+
+// buildDocumentTree 将知识库下的扁平文档列表组装为目录树，docs 需已按 sort_order 排序。
+// 父文档不在列表中的文档（例如父文档已被删除）挂在根目录下。
+func buildDocumentTree(docs []models.Document) []*documentTreeNode {
+	nodes := make(map[int64]*documentTreeNode, len(docs))
+	for _, doc := range docs {
+		nodes[doc.ID] = &documentTreeNode{
+			DocId:     strconv.FormatInt(doc.ID, 10),
+			KbId:      strconv.FormatInt(doc.KnowledgeBaseID, 10),
+			Title:     doc.Title,
+			ParentId:  formatParentId(doc.ParentID),
+			SortOrder: doc.SortOrder,
+			CreatedAt: doc.CreatedAt,
+			UpdatedAt: doc.UpdatedAt,
+			Children:  []*documentTreeNode{},
+		}
+	}
+	roots := []*documentTreeNode{}
+	for _, doc := range docs {
+		node := nodes[doc.ID]
+		if doc.ParentID != nil {
+			if parent, ok := nodes[*doc.ParentID]; ok && *doc.ParentID != doc.ID {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+	return roots
+}
+
+// GetDocumentTreeHandler 获取知识库的完整目录树
+func (dc *DocumentController) GetDocumentTreeHandler(c *gin.Context) {
+	kbId, err := strconv.ParseInt(c.Param("kb_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid knowledge base ID"})
+		return
+	}
+	if _, _, ok := dc.authz.AuthorizeKB(c, kbId, models.RoleViewer); !ok {
+		return
+	}
+	docs, err := dc.docDao.GetDocumentsByKnowledgeBaseID(kbId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve documents"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"kb_id": strconv.FormatInt(kbId, 10), "doc_tree": buildDocumentTree(docs)})
+}
+
+// MoveDocumentHandler 将文档（连同其子文档）移动到新的父文档或知识库下，并调整同级排序
+func (dc *DocumentController) MoveDocumentHandler(c *gin.Context) {
+	var contextData struct {
+		DocId          string `json:"doc_id" binding:"required"`
+		TargetParentId string `json:"target_parent_id"` // 为空表示移动到知识库根目录
+		TargetKbId     string `json:"target_kb_id"`     // 为空表示不跨知识库
+		SortOrder      *int   `json:"sort_order"`       // 在新的同级文档中的位置，为空表示放在最后
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+		return
+	}
+	docId, err := strconv.ParseInt(contextData.DocId, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的文档ID"})
+		return
+	}
+	doc, _, ok := dc.authz.AuthorizeDocument(c, docId, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	targetKbId := doc.KnowledgeBaseID
+	if contextData.TargetKbId != "" {
+		targetKbId, err = strconv.ParseInt(contextData.TargetKbId, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "错误的知识库ID"})
+			return
+		}
+	}
+	// 跨知识库移动时子文档一同移动，按目标知识库所有者的套餐在移动的事务中检查文档数量与存储空间配额
+	var targetOwnerId int64
+	var plan string
+	var quota config.PlanQuota
+	var targetKb *models.KnowledgeBase
+	if targetKbId != doc.KnowledgeBaseID {
+		// 跨知识库移动相当于从源知识库删除文档，需要源知识库的管理员权限
+		if _, _, ok := dc.authz.AuthorizeKB(c, doc.KnowledgeBaseID, models.RoleAdmin); !ok {
+			return
+		}
+		// 在目标知识库中同样需要编辑权限
+		if targetKb, _, ok = dc.authz.AuthorizeKB(c, targetKbId, models.RoleEditor); !ok {
+			return
+		}
+		targetOwnerId = targetKb.OwnerID
+		if plan, quota, ok = dc.quota.ownerQuota(c, targetOwnerId); !ok {
+			return
+		}
+	}
+
+	var targetParentId *int64 = nil
+	if contextData.TargetParentId != "" {
+		parsedId, err := strconv.ParseInt(contextData.TargetParentId, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "错误的父文档ID"})
+			return
+		}
+		parent, err := dc.docDao.GetDocumentByID(parsedId)
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+			return
+		}
+		if parent == nil || parent.KnowledgeBaseID != targetKbId {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "目标父文档不存在或不属于目标知识库"})
+			return
+		}
+		// 环检测：不能移动到自身或自身的子孙文档下
+		if parsedId == doc.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不能将文档移动到自身下"})
+			return
+		}
+		descendants, err := dc.docDao.GetDescendantIDs(doc.ID)
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+			return
+		}
+		for _, id := range descendants {
+			if id == parsedId {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "不能将文档移动到自己的子文档下"})
+				return
+			}
+		}
+		targetParentId = &parsedId
+	}
+
+	position := -1
+	if contextData.SortOrder != nil {
+		position = *contextData.SortOrder
+	}
+	err = dc.docDao.MoveDocument(doc, targetKbId, targetParentId, position, quota.MaxDocumentsPerKB, quota.MaxStorageBytes)
+	var quotaErr *dao.QuotaExceededError
+	var storageErr *dao.StorageQuotaExceededError
+	switch {
+	case errors.As(err, &quotaErr):
+		documentQuotaExceeded(c, targetOwnerId, plan, quota, quotaErr.Used)
+		return
+	case errors.As(err, &storageErr):
+		storageQuotaExceeded(c, targetOwnerId, plan, quota, storageErr.Used)
+		return
+	case err != nil:
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，移动失败"})
+		return
+	}
+	recordAudit(c, models.AuditDocMove, models.AuditTargetDocument, doc.ID, models.AuditResultSuccess,
+		"from_kb="+strconv.FormatInt(doc.KnowledgeBaseID, 10)+" to_kb="+strconv.FormatInt(targetKbId, 10))
+	if targetKb != nil && dc.collab != nil {
+		// 正在协同编辑的文档需要改用新知识库的所有者与成员
+		descendants, err := dc.docDao.GetDescendantIDs(doc.ID)
+		if err != nil {
+			log.Println(err)
+		}
+		dc.collab.refreshMovedDocuments(append([]int64{doc.ID}, descendants...), *targetKb)
+	}
+
+	docs, err := dc.docDao.GetDocumentsByKnowledgeBaseID(targetKbId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve documents"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "文档移动成功",
+		"kb_id":    strconv.FormatInt(targetKbId, 10),
+		"doc_tree": buildDocumentTree(docs),
+	})
+}
@@ -0,0 +1,320 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+	"yuqueppbackend/service-base/dao"
+	"yuqueppbackend/service-base/models"
+	"yuqueppbackend/service-base/util"
+)
+
+// saveDocumentVersion 将文档内容保存为一个不可变的历史版本
+// storageLimit 大于 0 时在同一个事务中检查知识库所有者的存储空间，doc 需要预加载 KnowledgeBase
+func (dc *DocumentController) saveDocumentVersion(doc models.Document, authorId int64, content []byte, restoredFrom *int64, storageLimit int64) (*models.DocumentVersion, error) {
+	version := models.DocumentVersion{
+		DocumentID:  doc.ID,
+		AuthorID:    authorId,
+		ContentHash: util.HashContent(content),
+		ContentSize: int64(len(content)),
+		Title:       doc.Title,
+		RestoredID:  restoredFrom,
+	}
+	strDocId := strconv.FormatInt(doc.ID, 10)
+	// 版本内容只写入一次，之后不再修改；先写内容再提交版本记录
+	err := dc.versionDao.CreateVersion(&version, doc.KnowledgeBase.OwnerID, storageLimit, func(v *models.DocumentVersion) error {
+		return util.GetContentStore().Put(getDocumentVersionKey(strDocId, strconv.FormatInt(v.ID, 10)), content)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// ensureInitialVersion 为引入历史版本之前创建、还没有任何版本的文档补录一个初始版本，
+// 在覆盖文档内容之前调用，保证旧内容可以恢复
+func (dc *DocumentController) ensureInitialVersion(doc models.Document) error {
+	latest, err := dc.versionDao.GetLatestVersion(doc.ID)
+	if err != nil || latest != nil {
+		return err
+	}
+	content, err := util.GetContentStore().Get(getDocumentContentKey(strconv.FormatInt(doc.ID, 10)))
+	if errors.Is(err, util.ErrContentNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = dc.saveDocumentVersion(doc, doc.OwnerId, content, nil, 0)
+	return err
+}
+
+// saveDocumentVersionWithinQuota 在知识库所有者的存储空间配额内记录新版本，统计与写入在同一个事务中完成，失败时已写入响应
+func (dc *DocumentController) saveDocumentVersionWithinQuota(c *gin.Context, doc models.Document, authorId int64, content []byte, restoredFrom *int64) (*models.DocumentVersion, bool) {
+	ownerId := doc.KnowledgeBase.OwnerID
+	plan, quota, ok := dc.quota.ownerQuota(c, ownerId)
+	if !ok {
+		return nil, false
+	}
+	version, err := dc.saveDocumentVersion(doc, authorId, content, restoredFrom, quota.MaxStorageBytes)
+	var storageErr *dao.StorageQuotaExceededError
+	if errors.As(err, &storageErr) {
+		storageQuotaExceeded(c, ownerId, plan, quota, storageErr.Used)
+		return nil, false
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，版本记录失败"})
+		return nil, false
+	}
+	return version, true
+}
+
+// getVersionOfDocument 解析路由中的 doc_id 与 version_id，校验用户至少拥有 minRole 角色并确认版本属于该文档
+func (dc *DocumentController) getVersionOfDocument(c *gin.Context, minRole string) (*models.Document, *models.DocumentVersion, bool) {
+	docId, err := strconv.ParseInt(c.Param("doc_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的文档ID"})
+		return nil, nil, false
+	}
+	versionId, err := strconv.ParseInt(c.Param("version_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的版本ID"})
+		return nil, nil, false
+	}
+	doc, _, ok := dc.authz.AuthorizeDocument(c, docId, minRole)
+	if !ok {
+		return nil, nil, false
+	}
+	version, err := dc.versionDao.GetVersionByID(versionId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return nil, nil, false
+	}
+	if version == nil || version.DocumentID != doc.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "历史版本不存在"})
+		return nil, nil, false
+	}
+	return doc, version, true
+}
+
+func versionToMap(version models.DocumentVersion) map[string]interface{} {
+	var restoredFrom string
+	if version.RestoredID != nil {
+		restoredFrom = strconv.FormatInt(*version.RestoredID, 10)
+	}
+	return map[string]interface{}{
+		"version_id":      strconv.FormatInt(version.ID, 10),
+		"doc_id":          strconv.FormatInt(version.DocumentID, 10),
+		"version":         version.Version,
+		"author_id":       strconv.FormatInt(version.AuthorID, 10),
+		"author_nickname": version.Author.Nickname,
+		"content_hash":    version.ContentHash,
+		"content_size":    version.ContentSize,
+		"doc_title":       version.Title,
+		"restored_from":   restoredFrom,
+		"created_at":      version.CreatedAt,
+	}
+}
+
+// GetDocumentVersionListHandler 获取文档的历史版本列表
+func (dc *DocumentController) GetDocumentVersionListHandler(c *gin.Context) {
+	docId, err := strconv.ParseInt(c.Param("doc_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的文档ID"})
+		return
+	}
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if err != nil || pageSize <= 0 {
+		pageSize = 20
+	}
+
+	if _, _, ok := dc.authz.AuthorizeDocument(c, docId, models.RoleViewer); !ok {
+		return
+	}
+
+	versions, total, err := dc.versionDao.GetVersionsByDocumentID(docId, page, pageSize)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，获取历史版本失败"})
+		return
+	}
+	var versionList []map[string]interface{}
+	for _, version := range versions {
+		versionList = append(versionList, versionToMap(version))
+	}
+	c.JSON(http.StatusOK, gin.H{"version_list": versionList, "total": total})
+}
+
+// GetDocumentVersionHandler 获取某个历史版本的内容
+func (dc *DocumentController) GetDocumentVersionHandler(c *gin.Context) {
+	_, version, ok := dc.getVersionOfDocument(c, models.RoleViewer)
+	if !ok {
+		return
+	}
+	content, err := util.GetContentStore().Get(getDocumentVersionKey(c.Param("doc_id"), strconv.FormatInt(version.ID, 10)))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return
+	}
+	result := versionToMap(*version)
+	result["doc_content"] = string(content)
+	c.JSON(http.StatusOK, result)
+}
+
+// RestoreDocumentVersionHandler 将某个历史版本恢复为文档的最新内容，恢复操作本身也会生成一个新版本
+func (dc *DocumentController) RestoreDocumentVersionHandler(c *gin.Context) {
+	userId, exists := c.Get("userid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未授权"})
+		return
+	}
+	doc, version, ok := dc.getVersionOfDocument(c, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	strDocId := strconv.FormatInt(doc.ID, 10)
+	content, err := util.GetContentStore().Get(getDocumentVersionKey(strDocId, strconv.FormatInt(version.ID, 10)))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return
+	}
+	// 恢复同样会生成新版本，先检查单次大小，存储空间在记录版本时检查
+	if !dc.quota.CheckAttachmentSize(c, &doc.KnowledgeBase, int64(len(content))) {
+		return
+	}
+	// 与普通保存共用文档锁和编辑基准校验，避免覆盖他人刚保存的内容，也避免并发生成相同的版本号
+	lockToken, err := dc.docDao.LockDocument(doc.ID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return
+	}
+	if lockToken == "" {
+		c.JSON(http.StatusConflict, gin.H{"message": "文档正在被其他请求保存，请稍后再试"})
+		return
+	}
+	defer dc.docDao.UnlockDocument(doc.ID, lockToken)
+	if !checkEditBase(c, strDocId) {
+		return
+	}
+	// 先在配额内记录新版本，超出配额时不会覆盖当前内容
+	newVersion, ok := dc.saveDocumentVersionWithinQuota(c, *doc, userId.(int64), content, &version.ID)
+	if !ok {
+		return
+	}
+	// 覆盖当前文档内容
+	if err := saveDocumentContent(strDocId, content); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，恢复失败"})
+		return
+	}
+	recordAudit(c, models.AuditDocUpdate, models.AuditTargetDocument, doc.ID, models.AuditResultSuccess, "restored_from="+strconv.FormatInt(version.ID, 10))
+	if err := dc.docDao.UpdateDocToES(doc.ID, doc.Title, string(content)); err != nil {
+		log.Println(err)
+	}
+	if err := dc.docDao.SetDocumentContentHash(doc.ID, util.HashContent(content)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return
+	}
+	if err := dc.docDao.UpdateRecentDocumentInRedis(dao.Edit, *doc, doc.KnowledgeBase.Name, strconv.FormatInt(userId.(int64), 10)); err != nil {
+		log.Println("插入最近编辑记录到redis中失败")
+	}
+
+	c.Header("ETag", formatETag(newVersion.ContentHash))
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "历史版本恢复成功",
+		"version_id":       strconv.FormatInt(newVersion.ID, 10),
+		"version":          newVersion.Version,
+		"doc_content_hash": newVersion.ContentHash,
+	})
+}
+
+// loadRevisionContent 根据版本标识读取内容，"current" 表示文档当前内容，否则为版本 ID
+func (dc *DocumentController) loadRevisionContent(doc *models.Document, ref string) (string, *models.DocumentVersion, int, error) {
+	strDocId := strconv.FormatInt(doc.ID, 10)
+	if ref == "current" {
+		content, err := getDocumentContentById(strDocId)
+		if err != nil {
+			return "", nil, http.StatusInternalServerError, err
+		}
+		return content, nil, http.StatusOK, nil
+	}
+	versionId, err := strconv.ParseInt(ref, 10, 64)
+	if err != nil {
+		return "", nil, http.StatusBadRequest, err
+	}
+	version, err := dc.versionDao.GetVersionByID(versionId)
+	if err != nil {
+		return "", nil, http.StatusInternalServerError, err
+	}
+	if version == nil || version.DocumentID != doc.ID {
+		return "", nil, http.StatusNotFound, fmt.Errorf("version %d not found for document %d", versionId, doc.ID)
+	}
+	content, err := util.GetContentStore().Get(getDocumentVersionKey(strDocId, strconv.FormatInt(version.ID, 10)))
+	if err != nil {
+		return "", nil, http.StatusInternalServerError, err
+	}
+	return string(content), version, http.StatusOK, nil
+}
+
+// DiffDocumentVersionHandler 比较文档的两个版本（或某版本与当前内容），返回结构化的统一差异
+func (dc *DocumentController) DiffDocumentVersionHandler(c *gin.Context) {
+	docId, err := strconv.ParseInt(c.Param("doc_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的文档ID"})
+		return
+	}
+	fromRef := c.Query("from")
+	toRef := c.DefaultQuery("to", "current")
+	if fromRef == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请指定需要比较的版本"})
+		return
+	}
+	contextLines, err := strconv.Atoi(c.DefaultQuery("context", "3"))
+	if err != nil || contextLines < 0 {
+		contextLines = 3
+	}
+
+	doc, _, ok := dc.authz.AuthorizeDocument(c, docId, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	fromContent, fromVersion, status, err := dc.loadRevisionContent(doc, fromRef)
+	if err != nil {
+		log.Println(err)
+		c.JSON(status, gin.H{"error": "无法读取版本 " + fromRef})
+		return
+	}
+	toContent, toVersion, status, err := dc.loadRevisionContent(doc, toRef)
+	if err != nil {
+		log.Println(err)
+		c.JSON(status, gin.H{"error": "无法读取版本 " + toRef})
+		return
+	}
+
+	revisionInfo := func(ref string, version *models.DocumentVersion) map[string]interface{} {
+		if version == nil {
+			return map[string]interface{}{"version_id": ref}
+		}
+		return versionToMap(*version)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"doc_id": strconv.FormatInt(doc.ID, 10),
+		"from":   revisionInfo(fromRef, fromVersion),
+		"to":     revisionInfo(toRef, toVersion),
+		"diff":   util.DiffText(fromContent, toContent, contextLines),
+	})
+}
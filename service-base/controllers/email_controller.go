@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"yuqueppbackend/service-base/config"
+	"yuqueppbackend/service-base/models"
+	"yuqueppbackend/service-base/util"
+)
+
+// 同一用户重复发送验证或重置邮件的最小间隔
+const emailSendCooldown = time.Minute
+
+// emailLink 拼接邮件中指向前端页面的链接
+func emailLink(path, token string) string {
+	base := strings.TrimRight(config.GetMailConfig().LinkBaseURL, "/")
+	return base + path + "?token=" + url.QueryEscape(token)
+}
+
+// sendVerificationEmail 向用户发送邮箱验证邮件
+func sendVerificationEmail(user *models.User) error {
+	ttl := config.GetEmailVerifyTokenTTL()
+	token, err := util.IssueEmailToken(util.EmailTokenVerify, user.ID, ttl)
+	if err != nil {
+		return err
+	}
+	return util.GetMailer().Send(util.MailMessage{
+		To:      user.Email,
+		Subject: "请验证你的邮箱",
+		Body: fmt.Sprintf("%s，你好：\n\n请点击下面的链接完成邮箱验证，链接 %d 小时内有效：\n\n%s\n\n如果这不是你本人的操作，请忽略这封邮件。\n",
+			user.Nickname, int(ttl/time.Hour), emailLink("/verify-email", token)),
+	})
+}
+
+// sendPasswordResetEmail 向用户发送重置密码邮件
+func sendPasswordResetEmail(user *models.User) error {
+	ttl := config.GetPasswordResetTokenTTL()
+	token, err := util.IssueEmailToken(util.EmailTokenPasswordReset, user.ID, ttl)
+	if err != nil {
+		return err
+	}
+	return util.GetMailer().Send(util.MailMessage{
+		To:      user.Email,
+		Subject: "重置你的密码",
+		Body: fmt.Sprintf("%s，你好：\n\n我们收到了重置密码的请求，请点击下面的链接设置新密码，链接 %d 分钟内有效且只能使用一次：\n\n%s\n\n如果这不是你本人的操作，请忽略这封邮件，你的密码不会被修改。\n",
+			user.Nickname, int(ttl/time.Minute), emailLink("/reset-password", token)),
+	})
+}
+
+// sendAccountDeletionEmail 向用户发送确认注销账号的邮件，用于没有设置密码（通过单点登录注册）的用户确认身份。
+// 链接有效期与重置密码链接相同
+func sendAccountDeletionEmail(user *models.User) error {
+	ttl := config.GetPasswordResetTokenTTL()
+	token, err := util.IssueEmailToken(util.EmailTokenAccountDelete, user.ID, ttl)
+	if err != nil {
+		return err
+	}
+	return util.GetMailer().Send(util.MailMessage{
+		To:      user.Email,
+		Subject: "确认注销账号",
+		Body: fmt.Sprintf("%s，你好：\n\n我们收到了注销账号的请求，请点击下面的链接确认，链接 %d 分钟内有效且只能使用一次：\n\n%s\n\n如果这不是你本人的操作，请忽略这封邮件并尽快检查账号安全。\n",
+			user.Nickname, int(ttl/time.Minute), emailLink("/confirm-account-deletion", token)),
+	})
+}
+
+// sendDisableTOTPEmail 向用户发送确认关闭两步验证的邮件，用于没有设置密码（通过单点登录注册）的用户确认身份
+func sendDisableTOTPEmail(user *models.User) error {
+	ttl := config.GetPasswordResetTokenTTL()
+	token, err := util.IssueEmailToken(util.EmailTokenDisableTOTP, user.ID, ttl)
+	if err != nil {
+		return err
+	}
+	return util.GetMailer().Send(util.MailMessage{
+		To:      user.Email,
+		Subject: "确认关闭两步验证",
+		Body: fmt.Sprintf("%s，你好：\n\n我们收到了关闭两步验证的请求，请点击下面的链接确认，链接 %d 分钟内有效且只能使用一次：\n\n%s\n\n如果这不是你本人的操作，请忽略这封邮件并尽快检查账号安全。\n",
+			user.Nickname, int(ttl/time.Minute), emailLink("/confirm-disable-totp", token)),
+	})
+}
+
+// SendVerificationEmail 重新发送邮箱验证邮件
+func SendVerificationEmail(c *gin.Context) {
+	user, err := userDao.GetUserByID(c.GetInt64("userid"))
+	if err != nil || user == nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if user.EmailVerified {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "邮箱已验证"})
+		return
+	}
+	allowed, err := util.AllowEmailSend(util.EmailTokenVerify, user.ID, emailSendCooldown)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "发送过于频繁，请稍后再试"})
+		return
+	}
+	if err := sendVerificationEmail(user); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "邮件发送失败，请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "验证邮件已发送"})
+}
+
+// VerifyEmail 使用邮件中的令牌完成邮箱验证
+func VerifyEmail(c *gin.Context) {
+	var contextData struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少验证令牌"})
+		return
+	}
+	userId, err := util.ConsumeEmailToken(util.EmailTokenVerify, contextData.Token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if userId == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "验证链接无效或已过期"})
+		return
+	}
+	if err := userDao.MarkEmailVerified(userId); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "邮箱验证成功"})
+}
+
+// ForgotPassword 发送重置密码邮件。无论邮箱是否注册都返回相同结果，避免泄露注册信息
+func ForgotPassword(c *gin.Context) {
+	var contextData struct {
+		Email        string `json:"email" binding:"required"`
+		CaptchaId    string `json:"captchaId" binding:"required"`
+		CaptchaValue string `json:"captchaValue" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+		return
+	}
+	right, err := VerifyCaptcha(contextData.CaptchaId, contextData.CaptchaValue)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if !right {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "验证码错误"})
+		return
+	}
+	user, err := userDao.GetUserByEmail(contextData.Email)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if user != nil {
+		allowed, err := util.AllowEmailSend(util.EmailTokenPasswordReset, user.ID, emailSendCooldown)
+		if err != nil {
+			log.Println(err)
+		} else if allowed {
+			if err := sendPasswordResetEmail(user); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "如果该邮箱已注册，重置密码邮件已发送，请注意查收"})
+}
+
+// ResetPassword 使用邮件中的令牌设置新密码，成功后所有设备需要重新登录
+func ResetPassword(c *gin.Context) {
+	var contextData struct {
+		Token       string `json:"token" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入新密码"})
+		return
+	}
+	// 先校验密码再消费令牌，避免密码不合规时令牌被浪费
+	if len(contextData.NewPassword) < 8 || len(contextData.NewPassword) > 72 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "新密码长度需要在 8 到 72 个字节之间"})
+		return
+	}
+	hash, err := util.HashPassword(contextData.NewPassword)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	userId, err := util.ConsumeEmailToken(util.EmailTokenPasswordReset, contextData.Token)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if userId == 0 {
+		recordAuditAs(c, 0, "", models.AuditResetPassword, models.AuditTargetUser, 0, models.AuditResultFailure, "invalid_token")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "重置链接无效或已过期"})
+		return
+	}
+	if err := userDao.UpdatePassword(userId, hash); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	// 能收到重置邮件说明用户拥有该邮箱
+	if err := userDao.MarkEmailVerified(userId); err != nil {
+		log.Println(err)
+	}
+	if err := util.RevokeAllSessions(userId); err != nil {
+		log.Println(err)
+	}
+	recordAuditAs(c, userId, "", models.AuditResetPassword, models.AuditTargetUser, userId, models.AuditResultSuccess, "")
+	c.JSON(http.StatusOK, gin.H{"message": "密码已重置，请重新登录"})
+}
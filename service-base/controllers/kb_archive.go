@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"yuqueppbackend/service-base/util"
+)
+
+// writeArchiveDocument 从内容存储中逐篇读取文档内容写入 ZIP，路径为 prefix + 归档路径；内容文件缺失时写入空文件
+func writeArchiveDocument(zw *zip.Writer, prefix string, item util.ArchiveDocument) error {
+	content, err := util.GetContentStore().Get(getDocumentContentKey(strconv.FormatInt(item.Doc.ID, 10)))
+	if err != nil && !errors.Is(err, util.ErrContentNotFound) {
+		return err
+	}
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     prefix + item.Path,
+		Method:   zip.Deflate,
+		Modified: item.Doc.UpdatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+// writeZipJSON 将 v 以缩进的 JSON 写入 ZIP 中的 name 文件
+func writeZipJSON(zw *zip.Writer, name string, v interface{}) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// splitTags 将逗号分隔的标签拆分为列表，忽略空标签
+func splitTags(tags string) []string {
+	list := make([]string, 0)
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			list = append(list, tag)
+		}
+	}
+	return list
+}
+
+// archiveManifestEntry manifest.json 中一篇文档的描述，authors 为文档作者的 ID 到昵称的映射
+func archiveManifestEntry(item util.ArchiveDocument, authors map[int64]string) map[string]interface{} {
+	return map[string]interface{}{
+		"doc_id":          strconv.FormatInt(item.Doc.ID, 10),
+		"doc_title":       item.Doc.Title,
+		"doc_parent_id":   formatParentId(item.Doc.ParentID),
+		"doc_sort_order":  item.Doc.SortOrder,
+		"doc_tags":        splitTags(item.Doc.Tags),
+		"doc_created_at":  item.Doc.CreatedAt,
+		"doc_updated_at":  item.Doc.UpdatedAt,
+		"author_id":       strconv.FormatInt(item.Doc.OwnerId, 10),
+		"author_nickname": authors[item.Doc.OwnerId],
+		"path":            item.Path,
+	}
+}
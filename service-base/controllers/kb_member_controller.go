@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+	"yuqueppbackend/service-base/models"
+)
+
+func memberToMap(member models.KnowledgeBaseMember) map[string]interface{} {
+	return map[string]interface{}{
+		"member_id":  strconv.FormatInt(member.ID, 10),
+		"kb_id":      strconv.FormatInt(member.KnowledgeBaseID, 10),
+		"user_id":    strconv.FormatInt(member.UserID, 10),
+		"nickname":   member.User.Nickname,
+		"email":      member.User.Email,
+		"role":       member.Role,
+		"invited_by": strconv.FormatInt(member.InvitedBy, 10),
+		"created_at": member.CreatedAt,
+		"updated_at": member.UpdatedAt,
+	}
+}
+
+// canManageMember 管理员只能管理比自己权限低的成员，所有者可以管理全部成员
+func canManageMember(operatorRole, targetRole string) bool {
+	return models.RoleRank(operatorRole) > models.RoleRank(targetRole)
+}
+
+// GetKnowledgeBaseMemberList 获取知识库的成员列表，所有者排在最前面
+func (kc *KnowledgeBaseController) GetKnowledgeBaseMemberList(c *gin.Context) {
+	kbId, err := strconv.ParseInt(c.Param("kb_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的知识库ID"})
+		return
+	}
+	kb, _, ok := kc.authz.AuthorizeKB(c, kbId, models.RoleViewer)
+	if !ok {
+		return
+	}
+	members, err := kc.memberDao.GetMembersByKBID(kbId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，获取成员列表失败"})
+		return
+	}
+	owner, err := userDao.GetUserByID(kb.OwnerID)
+	if err != nil || owner == nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，获取成员列表失败"})
+		return
+	}
+	memberList := []map[string]interface{}{{
+		"member_id":  "",
+		"kb_id":      strconv.FormatInt(kb.ID, 10),
+		"user_id":    strconv.FormatInt(owner.ID, 10),
+		"nickname":   owner.Nickname,
+		"email":      owner.Email,
+		"role":       models.RoleOwner,
+		"invited_by": "",
+		"created_at": kb.CreatedAt,
+		"updated_at": kb.CreatedAt,
+	}}
+	for _, member := range members {
+		memberList = append(memberList, memberToMap(member))
+	}
+	c.JSON(http.StatusOK, gin.H{"member_list": memberList})
+}
+
+// InviteKnowledgeBaseMember 通过邮箱邀请用户加入知识库，已是成员时更新其角色
+func (kc *KnowledgeBaseController) InviteKnowledgeBaseMember(c *gin.Context) {
+	var contextData struct {
+		KbId  string `json:"kb_id" binding:"required"`
+		Email string `json:"email" binding:"required"`
+		Role  string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+		return
+	}
+	kbId, err := strconv.ParseInt(contextData.KbId, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的知识库ID"})
+		return
+	}
+	if !models.IsAssignableRole(contextData.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的成员角色"})
+		return
+	}
+	kb, operatorRole, ok := kc.authz.AuthorizeKB(c, kbId, models.RoleAdmin)
+	if !ok {
+		return
+	}
+	if !canManageMember(operatorRole, contextData.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "权限不足，无法授予该角色"})
+		return
+	}
+
+	user, err := userDao.GetUserByEmail(contextData.Email)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "该邮箱尚未注册"})
+		return
+	}
+	if user.ID == kb.OwnerID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该用户是知识库的所有者"})
+		return
+	}
+	existing, err := kc.memberDao.GetMember(kbId, user.ID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return
+	}
+	if existing != nil && !canManageMember(operatorRole, existing.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "权限不足，无法修改该成员"})
+		return
+	}
+	// 新增成员时检查所有者套餐的协作者数量配额，修改已有成员的角色不受限制
+	if existing == nil && !kc.quota.CheckCollaboratorQuota(c, kb) {
+		return
+	}
+
+	member := models.KnowledgeBaseMember{
+		KnowledgeBaseID: kbId,
+		UserID:          user.ID,
+		Role:            contextData.Role,
+		InvitedBy:       c.GetInt64("userid"),
+	}
+	if existing != nil {
+		member.InvitedBy = existing.InvitedBy
+	}
+	if err := kc.memberDao.SaveMember(&member); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，邀请失败"})
+		return
+	}
+	member.User = *user
+	c.JSON(http.StatusOK, gin.H{"message": "邀请成功", "member": memberToMap(member)})
+}
+
+// getManagedMember 解析请求中的知识库与成员，并确认当前用户有权管理该成员
+func (kc *KnowledgeBaseController) getManagedMember(c *gin.Context, strKbId, strUserId string, allowSelf bool) (*models.KnowledgeBaseMember, string, bool) {
+	kbId, err := strconv.ParseInt(strKbId, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的知识库ID"})
+		return nil, "", false
+	}
+	userId, err := strconv.ParseInt(strUserId, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的用户ID"})
+		return nil, "", false
+	}
+	// 成员可以主动退出知识库
+	minRole := models.RoleAdmin
+	if allowSelf && userId == c.GetInt64("userid") {
+		minRole = models.RoleViewer
+	}
+	_, operatorRole, ok := kc.authz.AuthorizeKB(c, kbId, minRole)
+	if !ok {
+		return nil, "", false
+	}
+	member, err := kc.memberDao.GetMember(kbId, userId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return nil, "", false
+	}
+	if member == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "该用户不是知识库成员"})
+		return nil, "", false
+	}
+	if minRole == models.RoleAdmin && !canManageMember(operatorRole, member.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "权限不足，无法修改该成员"})
+		return nil, "", false
+	}
+	return member, operatorRole, true
+}
+
+// UpdateKnowledgeBaseMemberRole 修改知识库成员的角色
+func (kc *KnowledgeBaseController) UpdateKnowledgeBaseMemberRole(c *gin.Context) {
+	var contextData struct {
+		KbId   string `json:"kb_id" binding:"required"`
+		UserId string `json:"user_id" binding:"required"`
+		Role   string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+		return
+	}
+	if !models.IsAssignableRole(contextData.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的成员角色"})
+		return
+	}
+	member, operatorRole, ok := kc.getManagedMember(c, contextData.KbId, contextData.UserId, false)
+	if !ok {
+		return
+	}
+	if !canManageMember(operatorRole, contextData.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "权限不足，无法授予该角色"})
+		return
+	}
+	member.Role = contextData.Role
+	if err := kc.memberDao.SaveMember(member); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，修改失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "成员角色已更新", "role": member.Role})
+}
+
+// RemoveKnowledgeBaseMember 将成员移出知识库，成员也可以通过该接口主动退出
+func (kc *KnowledgeBaseController) RemoveKnowledgeBaseMember(c *gin.Context) {
+	var contextData struct {
+		KbId   string `json:"kb_id" binding:"required"`
+		UserId string `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+		return
+	}
+	member, _, ok := kc.getManagedMember(c, contextData.KbId, contextData.UserId, true)
+	if !ok {
+		return
+	}
+	if err := kc.memberDao.RemoveMember(member.KnowledgeBaseID, member.UserID); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，移除失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "成员已移出知识库"})
+}
@@ -1,35 +1,39 @@
 package controllers
 
 import (
+	"archive/zip"
 	"github.com/gin-gonic/gin"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
+	"yuqueppbackend/service-base/config"
 	"yuqueppbackend/service-base/dao"
 	"yuqueppbackend/service-base/models"
+	"yuqueppbackend/service-base/util"
 )
 
 type KnowledgeBaseController struct {
-	kbDao *dao.KBDAO
+	kbDao     *dao.KBDAO
+	docDao    *dao.DocDao
+	trashDao  *dao.TrashDAO
+	memberDao *dao.KBMemberDAO
+	authz     *Authorizer
+	quota     *QuotaController
 }
 
-func NewKnowledgeBaseController(dao *dao.KBDAO) *KnowledgeBaseController {
-	return &KnowledgeBaseController{kbDao: dao}
+func NewKnowledgeBaseController(kbDao *dao.KBDAO, docDao *dao.DocDao, trashDao *dao.TrashDAO, memberDao *dao.KBMemberDAO, authz *Authorizer, quota *QuotaController) *KnowledgeBaseController {
+	return &KnowledgeBaseController{kbDao: kbDao, docDao: docDao, trashDao: trashDao, memberDao: memberDao, authz: authz, quota: quota}
 }
 
 // CreateKnowledgeBase 创建知识库
 func (kc *KnowledgeBaseController) CreateKnowledgeBase(c *gin.Context) {
 	var contextData struct {
-		Id          int64  `json:"userid"`
 		Name        string `json:"kb_name" binding:"required"`
 		Description string `json:"kb_description"`
 		IsPublic    bool   `json:"kb_is_public"`
 	}
-	if id, exists := c.Get("userid"); exists {
-		contextData.Id = id.(int64)
-	}
-
 	if err := c.ShouldBindJSON(&contextData); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -40,13 +44,13 @@ func (kc *KnowledgeBaseController) CreateKnowledgeBase(c *gin.Context) {
 		IsPublic:    contextData.IsPublic,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
-		OwnerID:     contextData.Id,
+		OwnerID:     c.GetInt64("userid"),
 	}
-	// 使用 KBDAO 来创建知识库
-	if err := kc.kbDao.CreateKB(&knowledgeBase); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create knowledge base"})
+	// 在套餐的知识库数量配额内创建知识库
+	if !kc.quota.CreateKnowledgeBase(c, &knowledgeBase) {
 		return
 	}
+	recordAudit(c, models.AuditKBCreate, models.AuditTargetKB, knowledgeBase.ID, models.AuditResultSuccess, "")
 	err := kc.kbDao.InsertKBToEs(knowledgeBase)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍候再试"})
@@ -62,7 +66,7 @@ func (kc *KnowledgeBaseController) CreateKnowledgeBase(c *gin.Context) {
 	})
 }
 
-// 获取用户创建的所有知识库
+// 获取用户创建的以及以成员身份加入的所有知识库
 func (kc *KnowledgeBaseController) GetKnowledgeBaseList(c *gin.Context) {
 	userId, exists := c.Get("userid")
 	if !exists {
@@ -80,8 +84,26 @@ func (kc *KnowledgeBaseController) GetKnowledgeBaseList(c *gin.Context) {
 			tmpMap["kb_is_public"] = kb.IsPublic
 			tmpMap["kb_created_at"] = kb.CreatedAt
 			tmpMap["kb_updated_at"] = kb.UpdatedAt
+			tmpMap["kb_role"] = models.RoleOwner
 			kbListData = append(kbListData, tmpMap)
 		}
+		memberKBs, roles, err := kc.memberDao.GetMemberKBs(userId.(int64))
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误"})
+			return
+		}
+		for _, kb := range memberKBs {
+			kbListData = append(kbListData, map[string]interface{}{
+				"kb_id":          strconv.FormatInt(kb.ID, 10),
+				"kb_name":        kb.Name,
+				"kb_description": kb.Description,
+				"kb_is_public":   kb.IsPublic,
+				"kb_created_at":  kb.CreatedAt,
+				"kb_updated_at":  kb.UpdatedAt,
+				"kb_role":        roles[kb.ID],
+			})
+		}
 
 		c.JSON(http.StatusOK, gin.H{"knowledge_bases": kbListData})
 		return
@@ -95,21 +117,19 @@ func (kc *KnowledgeBaseController) GetKnowledgeBaseList(c *gin.Context) {
 // GetKnowledgeBaseDetail 根据用户ID和知识库ID获取知识库详情
 func (kc *KnowledgeBaseController) GetKnowledgeBaseDetail(c *gin.Context) {
 	kbId := c.Param("kb_id")
-	id, exists := c.Get("userid")
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "系统错误请稍后再试"})
+	kbId64, err := strconv.ParseInt(kbId, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的知识库ID"})
 		return
 	}
-	kbId64, _ := strconv.ParseInt(kbId, 10, 64)
-	userId64, _ := id.(int64)
 
-	// 使用 KBDAO 查找知识库
-	knowledgeBase, err := kc.kbDao.FindKB(userId64, kbId64)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Knowledge base not found"})
+	// 成员及所有者都可以查看知识库详情
+	knowledgeBase, role, ok := kc.authz.AuthorizeKB(c, kbId64, models.RoleViewer)
+	if !ok {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
+		"kb_role":        role,
 		"kb_id":          strconv.FormatInt(kbId64, 10),
 		"kb_owner_id":    strconv.FormatInt(knowledgeBase.OwnerID, 10),
 		"kb_name":        knowledgeBase.Name,
@@ -123,38 +143,46 @@ func (kc *KnowledgeBaseController) GetKnowledgeBaseDetail(c *gin.Context) {
 // UpdateKnowledgeBase 更新知识库,可以更新的字段：Name,Description,IsPublic
 func (kc *KnowledgeBaseController) UpdateKnowledgeBase(c *gin.Context) {
 	var contextData struct {
-		Id          int64     `json:"userid"`
-		KBId        int64     `json:"kb_id" binding:"required"`
-		Name        string    `json:"kb_name" binding:"required"`
-		Description string    `json:"kb_description" binding:"required"`
-		IsPublic    bool      `json:"kb_is_public" binding:"required"`
-		updated_at  time.Time `json:"kb_updated_at"`
-	}
-	if id, exists := c.Get("userid"); exists {
-		contextData.Id = id.(int64)
+		KBId        string `json:"kb_id" binding:"required"`
+		Name        string `json:"kb_name" binding:"required"`
+		Description string `json:"kb_description"`
+		IsPublic    *bool  `json:"kb_is_public" binding:"required"` // 使用指针，false 同样是有效的取值
 	}
 	if err := c.ShouldBindJSON(&contextData); err != nil {
 		log.Println("结构绑定失败")
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	contextData.updated_at = time.Now()
-	var updatedKB models.KnowledgeBase
-
-	if err := c.ShouldBindJSON(&updatedKB); err != nil {
-		log.Println("结构绑定失败")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	kbId64, err := strconv.ParseInt(contextData.KBId, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的知识库ID"})
 		return
 	}
 
-	knowledgeBase, err := kc.kbDao.UpdateKB(contextData.Id, contextData.KBId, updatedKB)
+	// 知识库管理员及以上角色才能修改知识库信息
+	kb, _, ok := kc.authz.AuthorizeKB(c, kbId64, models.RoleAdmin)
+	if !ok {
+		return
+	}
+	// 只允许修改名称、简介与是否公开，所有者等其他列不受请求内容影响
+	knowledgeBase, err := kc.kbDao.UpdateKB(kb.OwnerID, kbId64, map[string]interface{}{
+		"name":        contextData.Name,
+		"description": contextData.Description,
+		"is_public":   *contextData.IsPublic,
+		"updated_at":  time.Now(),
+	})
 	if err != nil {
+		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update knowledge base"})
 		return
 	}
+	recordAudit(c, models.AuditKBUpdate, models.AuditTargetKB, kb.ID, models.AuditResultSuccess, "")
+	if err := kc.kbDao.UpdateKBToES(knowledgeBase); err != nil {
+		log.Println(err)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"kb_id":          knowledgeBase.ID,
+		"kb_id":          strconv.FormatInt(knowledgeBase.ID, 10),
 		"kb_name":        knowledgeBase.Name,
 		"kb_description": knowledgeBase.Description,
 		"kb_is_public":   knowledgeBase.IsPublic,
@@ -185,20 +213,115 @@ func (kc *KnowledgeBaseController) DeleteKnowledgeBase(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "系统错误"})
 		return
 	}
-	knowledgeBase, err := kc.kbDao.FindKB(contextData.Id, kbId64)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Knowledge base not found"})
+	// 只有所有者可以删除知识库
+	knowledgeBase, _, ok := kc.authz.AuthorizeKB(c, kbId64, models.RoleOwner)
+	if !ok {
+		return
 	}
-	// 使用 KBDAO 删除知识库
-	if err := kc.kbDao.DeleteKB(knowledgeBase); err != nil {
+	// 将知识库及其文档移入回收站
+	item, trashedDocIds, err := kc.trashDao.TrashKnowledgeBase(knowledgeBase, config.GetTrashRetention())
+	if err != nil {
+		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete knowledge base"})
 		return
 	}
+	recordAudit(c, models.AuditKBDelete, models.AuditTargetKB, knowledgeBase.ID, models.AuditResultSuccess, "trash_id="+strconv.FormatInt(item.ID, 10))
 
 	if err := kc.kbDao.DeleteKBFromES(knowledgeBase.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete knowledge base"})
 		return
 	}
+	removeDocumentsFromES(kc.docDao, trashedDocIds)
 
-	c.JSON(http.StatusOK, gin.H{})
+	c.JSON(http.StatusOK, gin.H{"trash_id": strconv.FormatInt(item.ID, 10)})
+}
+
+// ExportKnowledgeBase 将知识库导出为 ZIP：每篇文档是一个 Markdown 文件，目录结构与文档层级一致，
+// manifest.json 记录知识库与文档的标题、ID、标签、时间与作者。文档内容逐篇读取并流式写出，不在内存中生成整个压缩包
+func (kc *KnowledgeBaseController) ExportKnowledgeBase(c *gin.Context) {
+	kbId, err := strconv.ParseInt(c.Param("kb_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的知识库ID"})
+		return
+	}
+	kb, _, ok := kc.authz.AuthorizeKB(c, kbId, models.RoleViewer)
+	if !ok {
+		return
+	}
+	docs, err := kc.docDao.GetDocumentsByKnowledgeBaseID(kb.ID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	var authorIds []int64
+	seen := make(map[int64]bool)
+	for _, doc := range docs {
+		if !seen[doc.OwnerId] {
+			seen[doc.OwnerId] = true
+			authorIds = append(authorIds, doc.OwnerId)
+		}
+	}
+	users, err := userDao.GetUsersByIDs(authorIds)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	authors := make(map[int64]string, len(users))
+	for _, user := range users {
+		authors[user.ID] = user.Nickname
+	}
+
+	planned := util.PlanArchive(docs)
+	documentList := make([]map[string]interface{}, 0, len(planned))
+	for _, item := range planned {
+		documentList = append(documentList, archiveManifestEntry(item, authors))
+	}
+	now := time.Now()
+	manifest := map[string]interface{}{
+		"kb_id":          strconv.FormatInt(kb.ID, 10),
+		"kb_name":        kb.Name,
+		"kb_description": kb.Description,
+		"kb_created_at":  kb.CreatedAt,
+		"kb_updated_at":  kb.UpdatedAt,
+		"exported_at":    now,
+		"documents":      documentList,
+	}
+
+	filename := util.ArchiveName(kb.Name) + ".zip"
+	c.Header("Content-Disposition", `attachment; filename="knowledge-base-`+strconv.FormatInt(kb.ID, 10)+
+		`.zip"; filename*=UTF-8''`+url.PathEscape(filename))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	written := 0
+	err = func() error {
+		if err := writeZipJSON(zw, "manifest.json", manifest); err != nil {
+			return err
+		}
+		for _, item := range planned {
+			if err := writeArchiveDocument(zw, "", item); err != nil {
+				return err
+			}
+			// 每写完一篇文档就发送给客户端，避免压缩数据堆积在内存中
+			if err := zw.Flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+			written++
+		}
+		return zw.Close()
+	}()
+	// 归档写完后才记录审计日志，客户端中途断开或读取失败时记为失败
+	detail := "documents=" + strconv.Itoa(len(planned))
+	if err != nil {
+		// 响应头已经发出，只能中断输出
+		log.Println(err)
+		recordAudit(c, models.AuditKBExport, models.AuditTargetKB, kb.ID, models.AuditResultFailure,
+			detail+" written="+strconv.Itoa(written))
+		return
+	}
+	recordAudit(c, models.AuditKBExport, models.AuditTargetKB, kb.ID, models.AuditResultSuccess, detail)
 }
@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"yuqueppbackend/service-base/models"
+	"yuqueppbackend/service-base/util"
+)
+
+// 登录失败记录中的失败原因，被拦截的请求使用 util.LoginBlocked* 中的原因
+const (
+	loginFailureCaptcha     = "captcha"
+	loginFailureBadPassword = "bad_password"
+	loginFailureBad2FA      = "bad_2fa"
+)
+
+// checkLoginAllowed 登录前检查是否被频率限制或锁定，被拦截时已写入响应并记录
+func checkLoginAllowed(c *gin.Context, email string) bool {
+	block, err := util.CheckLoginAllowed(c.ClientIP(), email)
+	if err != nil {
+		// Redis 故障时改用更严格的进程内限流，不放开暴力破解
+		log.Println(err)
+		block = util.CheckLoginAllowedLocally(c.ClientIP(), email, time.Now())
+	}
+	if block == nil {
+		return true
+	}
+	recordLoginFailure(c, email, block.Reason, false)
+	retryAfter := int64(block.RetryAfter.Seconds() + 0.5)
+	c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+	message := "登录尝试过于频繁，请稍后再试"
+	if block.Reason == util.LoginBlockedLocked {
+		message = "失败次数过多，账号已被临时锁定，请稍后再试"
+	}
+	c.JSON(block.Status, gin.H{"error": message, "retry_after": retryAfter})
+	return false
+}
+
+// recordLoginFailure 记录一次失败的登录尝试；countTowardsLock 为 true 时计入账号的连续失败次数，
+// 返回账号是否因此被锁定
+func recordLoginFailure(c *gin.Context, email, reason string, countTowardsLock bool) bool {
+	email = strings.TrimSpace(email)
+	attempt := models.LoginAttempt{
+		Email:     email,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Reason:    reason,
+	}
+	var userId int64
+	if user, err := userDao.GetUserByEmail(email); err == nil && user != nil {
+		attempt.UserID = &user.ID
+		userId = user.ID
+	}
+	if err := loginAttemptDao.CreateLoginAttempt(&attempt); err != nil {
+		log.Println(err)
+	}
+	recordAuditAs(c, userId, email, models.AuditLogin, models.AuditTargetUser, userId, models.AuditResultFailure, reason)
+	if !countTowardsLock {
+		return false
+	}
+	locked, err := util.RecordLoginFailure(email)
+	if err != nil {
+		log.Println(err)
+	}
+	return locked
+}
+
+// GetLoginAttemptList 管理员查看失败的登录尝试，可按 email、ip 过滤
+func GetLoginAttemptList(c *gin.Context) {
+	page, pageSize := parsePage(c, 20)
+	attempts, total, err := loginAttemptDao.GetLoginAttempts(strings.TrimSpace(c.Query("email")), c.Query("ip"), page, pageSize)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	var attemptList []map[string]interface{}
+	for _, attempt := range attempts {
+		item := map[string]interface{}{
+			"attempt_id": strconv.FormatInt(attempt.ID, 10),
+			"email":      attempt.Email,
+			"user_id":    "",
+			"ip":         attempt.IP,
+			"user_agent": attempt.UserAgent,
+			"reason":     attempt.Reason,
+			"created_at": attempt.CreatedAt,
+		}
+		if attempt.UserID != nil {
+			item["user_id"] = strconv.FormatInt(*attempt.UserID, 10)
+		}
+		attemptList = append(attemptList, item)
+	}
+	c.JSON(http.StatusOK, gin.H{"attempt_list": attemptList, "total": total})
+}
+
+// GetLockedAccountList 管理员查看当前被临时锁定的账号
+func GetLockedAccountList(c *gin.Context) {
+	accounts, err := util.ListLockedAccounts()
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	var accountList []map[string]interface{}
+	for _, account := range accounts {
+		accountList = append(accountList, map[string]interface{}{
+			"email":             account.Email,
+			"remaining_seconds": int64(account.Remaining.Seconds()),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"locked_account_list": accountList})
+}
+
+// UnlockAccount 管理员提前解除账号锁定
+func UnlockAccount(c *gin.Context) {
+	var contextData struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入邮箱"})
+		return
+	}
+	unlocked, err := util.UnlockAccount(contextData.Email)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	recordAudit(c, models.AuditAdminUnlock, models.AuditTargetUser, 0, models.AuditResultSuccess, "email="+contextData.Email)
+	if !unlocked {
+		c.JSON(http.StatusOK, gin.H{"message": "该账号未被锁定，已清除失败计数"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "账号已解锁"})
+}
@@ -0,0 +1,368 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"yuqueppbackend/service-base/config"
+	"yuqueppbackend/service-base/dao"
+	"yuqueppbackend/service-base/models"
+	"yuqueppbackend/service-base/util"
+)
+
+// 单点登录回调失败时返回给前端的错误码
+const (
+	oidcErrorInvalidState    = "invalid_state"
+	oidcErrorProvider        = "provider_error"
+	oidcErrorExchange        = "exchange_failed"
+	oidcErrorEmailRequired   = "verified_email_required"
+	oidcErrorSignupDisabled  = "signup_disabled"
+	oidcErrorEmailUnverified = "email_unverified"
+	oidcErrorServer          = "server_error"
+)
+
+// oidcStateCookie 保存 state 哈希的 Cookie，回调时要求与 state 匹配，
+// 防止攻击者把自己发起的登录回调链接发给受害者，使其登录到攻击者的账号
+const oidcStateCookie = "oidc_state"
+
+// setOIDCStateCookie 设置或清除（state 为空时）绑定浏览器的 state Cookie
+func setOIDCStateCookie(c *gin.Context, state string) {
+	value, maxAge := "", -1
+	if state != "" {
+		value, maxAge = util.HashContent([]byte(state)), int(util.OIDCStateTTL/time.Second)
+	}
+	secure := c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")
+	// 身份提供方通过顶层跳转回调，SameSite=Lax 的 Cookie 会随之携带
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, value, maxAge, "/api/auth/oidc/", "", secure, true)
+}
+
+type OIDCController struct {
+	identityDao *dao.UserIdentityDAO
+}
+
+func NewOIDCController(identityDao *dao.UserIdentityDAO) *OIDCController {
+	return &OIDCController{identityDao: identityDao}
+}
+
+func identityToMap(identity models.UserIdentity) map[string]interface{} {
+	return map[string]interface{}{
+		"identity_id":   strconv.FormatInt(identity.ID, 10),
+		"provider":      identity.Provider,
+		"email":         identity.Email,
+		"last_login_at": identity.LastLoginAt,
+		"created_at":    identity.CreatedAt,
+	}
+}
+
+// finishOIDCCallback 回调结束后重定向回前端页面，携带一次性登录码或错误码；
+// 未配置前端地址时直接返回 JSON，便于在没有前端的情况下调试
+func finishOIDCCallback(c *gin.Context, loginCode, errorCode string) {
+	cfg, err := config.GetOIDCConfig()
+	if err != nil || cfg.FrontendCallbackURL == "" {
+		if errorCode != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "单点登录失败", "error_code": errorCode})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"login_code": loginCode})
+		return
+	}
+	values := url.Values{}
+	if errorCode != "" {
+		values.Set("error", errorCode)
+	} else {
+		values.Set("code", loginCode)
+	}
+	separator := "?"
+	if strings.Contains(cfg.FrontendCallbackURL, "?") {
+		separator = "&"
+	}
+	c.Redirect(http.StatusFound, cfg.FrontendCallbackURL+separator+values.Encode())
+}
+
+// oidcNickname 根据身份提供方返回的信息生成昵称
+func oidcNickname(identity *util.OIDCIdentity) string {
+	if identity.Name != "" {
+		return identity.Name
+	}
+	if at := strings.Index(identity.Email, "@"); at > 0 {
+		return identity.Email[:at]
+	}
+	return identity.Email
+}
+
+// GetOIDCProviderList 获取可用的单点登录方式，供登录页展示
+func (oc *OIDCController) GetOIDCProviderList(c *gin.Context) {
+	var providerList []map[string]interface{}
+	for _, provider := range util.ListOIDCProviders() {
+		providerList = append(providerList, map[string]interface{}{
+			"name":         provider.Name(),
+			"display_name": provider.DisplayName(),
+			"login_url":    "/api/auth/oidc/" + provider.Name() + "/login",
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"provider_list": providerList})
+}
+
+// OIDCLogin 发起单点登录，生成 state、nonce 与 PKCE 参数后重定向到身份提供方
+func (oc *OIDCController) OIDCLogin(c *gin.Context) {
+	provider, err := util.GetOIDCProvider(c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "不支持该登录方式"})
+		return
+	}
+	state, loginState, err := util.CreateOIDCLoginState(provider.Name())
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), state, loginState.Nonce, loginState.Verifier)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "无法连接身份提供方，请稍后再试"})
+		return
+	}
+	setOIDCStateCookie(c, state)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback 身份提供方回调：校验 state 及其与浏览器的绑定，用授权码换取并校验 ID Token，
+// 再按已关联身份、已验证邮箱的顺序找到用户，都没有时自动注册
+func (oc *OIDCController) OIDCCallback(c *gin.Context) {
+	state := c.Query("state")
+	cookie, _ := c.Cookie(oidcStateCookie)
+	setOIDCStateCookie(c, "")
+	// 先校验 Cookie 再作废 state，其他浏览器提交的回调不会消耗发起者的 state
+	if state == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(util.HashContent([]byte(state)))) != 1 {
+		finishOIDCCallback(c, "", oidcErrorInvalidState)
+		return
+	}
+	loginState, err := util.ConsumeOIDCLoginState(state)
+	if err != nil {
+		log.Println(err)
+		finishOIDCCallback(c, "", oidcErrorServer)
+		return
+	}
+	if loginState == nil || loginState.Provider != c.Param("provider") {
+		finishOIDCCallback(c, "", oidcErrorInvalidState)
+		return
+	}
+	if errorCode := c.Query("error"); errorCode != "" {
+		log.Printf("身份提供方 %s 返回错误: %s %s", loginState.Provider, errorCode, c.Query("error_description"))
+		finishOIDCCallback(c, "", oidcErrorProvider)
+		return
+	}
+	provider, err := util.GetOIDCProvider(loginState.Provider)
+	if err != nil {
+		finishOIDCCallback(c, "", oidcErrorInvalidState)
+		return
+	}
+	identity, err := provider.Exchange(c.Request.Context(), c.Query("code"), loginState.Verifier, loginState.Nonce)
+	if err != nil {
+		log.Println(err)
+		finishOIDCCallback(c, "", oidcErrorExchange)
+		return
+	}
+
+	user, errorCode := oc.resolveUser(provider, identity)
+	if errorCode != "" {
+		finishOIDCCallback(c, "", errorCode)
+		return
+	}
+	if config.RequireEmailVerification() && !user.EmailVerified {
+		finishOIDCCallback(c, "", oidcErrorEmailUnverified)
+		return
+	}
+	loginCode, err := util.IssueOIDCLoginCode(user.ID)
+	if err != nil {
+		log.Println(err)
+		finishOIDCCallback(c, "", oidcErrorServer)
+		return
+	}
+	finishOIDCCallback(c, loginCode, "")
+}
+
+// resolveUser 找到外部身份对应的用户，必要时关联或注册，失败时返回错误码
+func (oc *OIDCController) resolveUser(provider *util.OIDCProvider, identity *util.OIDCIdentity) (*models.User, string) {
+	linked, err := oc.identityDao.GetIdentity(provider.Name(), identity.Subject)
+	if err != nil {
+		log.Println(err)
+		return nil, oidcErrorServer
+	}
+	if linked != nil {
+		user, err := userDao.GetUserByID(linked.UserID)
+		if err != nil {
+			log.Println(err)
+			return nil, oidcErrorServer
+		}
+		if user != nil {
+			if err := oc.identityDao.TouchIdentity(linked.ID, identity.Email); err != nil {
+				log.Println(err)
+			}
+			return user, ""
+		}
+		// 关联的用户已不存在，删除失效的关联后按新身份处理
+		if _, err := oc.identityDao.DeleteIdentity(linked.UserID, linked.ID); err != nil {
+			log.Println(err)
+			return nil, oidcErrorServer
+		}
+	}
+
+	// 只有身份提供方确认过的邮箱才能关联到已有账号，避免通过伪造邮箱接管他人账号
+	if !identity.EmailVerified {
+		return nil, oidcErrorEmailRequired
+	}
+	user, err := userDao.GetUserByEmail(identity.Email)
+	if err != nil {
+		log.Println(err)
+		return nil, oidcErrorServer
+	}
+	if user == nil {
+		if !provider.AllowSignup() {
+			return nil, oidcErrorSignupDisabled
+		}
+		if user, err = oc.createOIDCUser(identity); err != nil {
+			log.Println(err)
+			return nil, oidcErrorServer
+		}
+	} else if !user.EmailVerified {
+		if err := userDao.MarkEmailVerified(user.ID); err != nil {
+			log.Println(err)
+		}
+		user.EmailVerified = true
+	}
+
+	now := time.Now()
+	if err := oc.identityDao.CreateIdentity(&models.UserIdentity{
+		UserID:      user.ID,
+		Provider:    provider.Name(),
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		LastLoginAt: &now,
+	}); err != nil {
+		log.Println(err)
+		return nil, oidcErrorServer
+	}
+	return user, ""
+}
+
+// createOIDCUser 为单点登录的新用户注册账号。密码随机生成且不告知用户，需要密码登录时可以通过忘记密码设置
+func (oc *OIDCController) createOIDCUser(identity *util.OIDCIdentity) (*models.User, error) {
+	password, err := util.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	if err := userDao.CreateUser(models.User{
+		Email:    identity.Email,
+		Nickname: oidcNickname(identity),
+		Password: password,
+	}); err != nil {
+		return nil, err
+	}
+	user, err := userDao.GetUserByEmail(identity.Email)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.New("oidc: created user not found")
+	}
+	if err := userDao.MarkEmailVerified(user.ID); err != nil {
+		return nil, err
+	}
+	user.EmailVerified = true
+	return user, nil
+}
+
+// OIDCExchange 前端使用回调得到的一次性登录码换取访问令牌；启用了两步验证时与密码登录一样返回挑战令牌
+func (oc *OIDCController) OIDCExchange(c *gin.Context) {
+	var contextData struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少登录码"})
+		return
+	}
+	userId, err := util.ConsumeOIDCLoginCode(contextData.Code)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if userId == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "登录码无效或已过期，请重新登录"})
+		return
+	}
+	user, err := userDao.GetUserByID(userId)
+	if err != nil || user == nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if rejectDisabledUser(c, user) {
+		return
+	}
+	if user.TOTPEnabled {
+		challenge, err := util.CreateLoginChallenge(user.ID)
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+			"expires_in":          int64(util.LoginChallengeTTL / time.Second),
+		})
+		return
+	}
+	tokens, err := util.CreateSession(user.ID, user.Email, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	recordAuditAs(c, user.ID, user.Email, models.AuditLogin, models.AuditTargetUser, user.ID, models.AuditResultSuccess, "oidc")
+	c.JSON(http.StatusOK, tokens)
+}
+
+// GetIdentityList 获取当前用户关联的外部登录身份
+func (oc *OIDCController) GetIdentityList(c *gin.Context) {
+	identities, err := oc.identityDao.GetIdentitiesByUserID(c.GetInt64("userid"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	var identityList []map[string]interface{}
+	for _, identity := range identities {
+		identityList = append(identityList, identityToMap(identity))
+	}
+	c.JSON(http.StatusOK, gin.H{"identity_list": identityList})
+}
+
+// UnlinkIdentity 解除外部登录身份的关联，之后使用该身份登录会按邮箱重新关联或注册
+func (oc *OIDCController) UnlinkIdentity(c *gin.Context) {
+	identityId, err := strconv.ParseInt(c.Param("identity_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的身份ID"})
+		return
+	}
+	deleted, err := oc.identityDao.DeleteIdentity(c.GetInt64("userid"), identityId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，解除关联失败"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "关联的身份不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已解除关联"})
+}
@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"yuqueppbackend/service-base/dao"
+	"yuqueppbackend/service-base/models"
+	"yuqueppbackend/service-base/util"
+)
+
+// 最近使用时间的最小写入间隔，避免每个请求都写数据库
+const personalTokenTouchInterval = time.Minute
+
+type PersonalTokenController struct {
+	tokenDao *dao.PersonalTokenDAO
+}
+
+func NewPersonalTokenController(tokenDao *dao.PersonalTokenDAO) *PersonalTokenController {
+	return &PersonalTokenController{tokenDao: tokenDao}
+}
+
+func personalTokenToMap(token models.PersonalAccessToken) map[string]interface{} {
+	return map[string]interface{}{
+		"token_id":     strconv.FormatInt(token.ID, 10),
+		"name":         token.Name,
+		"token_prefix": token.TokenPrefix,
+		"scopes":       token.ScopeList(),
+		"expire_at":    token.ExpireAt,
+		"last_used_at": token.LastUsedAt,
+		"last_used_ip": token.LastUsedIP,
+		"revoked_at":   token.RevokedAt,
+		"is_active":    token.IsActive(time.Now()),
+		"created_at":   token.CreatedAt,
+	}
+}
+
+// ValidatePersonalToken 校验个人访问令牌，注册到 AuthMiddleware 中使用
+func (pc *PersonalTokenController) ValidatePersonalToken(tokenString, ip string) (*util.PersonalTokenAuth, error) {
+	token, err := pc.tokenDao.GetTokenByHash(util.HashContent([]byte(tokenString)))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	// 账号停用期间个人访问令牌同样无法使用
+	if token == nil || !token.IsActive(now) || token.User.ID == 0 || token.User.IsDisabled() {
+		return nil, nil
+	}
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= personalTokenTouchInterval || token.LastUsedIP != ip {
+		if err := pc.tokenDao.TouchToken(token.ID, ip); err != nil {
+			log.Println(err)
+		}
+	}
+	return &util.PersonalTokenAuth{
+		TokenID: token.ID,
+		UserID:  token.UserID,
+		Email:   token.User.Email,
+		Scopes:  token.ScopeList(),
+	}, nil
+}
+
+// GetPersonalTokenList 获取当前用户的个人访问令牌
+func (pc *PersonalTokenController) GetPersonalTokenList(c *gin.Context) {
+	tokens, err := pc.tokenDao.GetTokensByUserID(c.GetInt64("userid"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	var tokenList []map[string]interface{}
+	for _, token := range tokens {
+		tokenList = append(tokenList, personalTokenToMap(token))
+	}
+	c.JSON(http.StatusOK, gin.H{"token_list": tokenList})
+}
+
+// CreatePersonalToken 创建个人访问令牌，令牌明文只在创建时返回一次
+func (pc *PersonalTokenController) CreatePersonalToken(c *gin.Context) {
+	var contextData struct {
+		Name         string   `json:"name" binding:"required"`
+		Scopes       []string `json:"scopes" binding:"required"`
+		ExpireInDays int      `json:"expire_in_days"` // 有效期（天），为 0 表示永不过期
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+		return
+	}
+	contextData.Name = strings.TrimSpace(contextData.Name)
+	if contextData.Name == "" || len([]rune(contextData.Name)) > 64 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "令牌名称长度需要在 1 到 64 个字符之间"})
+		return
+	}
+	if len(contextData.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请至少选择一个权限范围"})
+		return
+	}
+	var scopes []string
+	seen := make(map[string]bool)
+	for _, scope := range contextData.Scopes {
+		if !models.IsValidScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的权限范围：" + scope})
+			return
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	if contextData.ExpireInDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的有效期"})
+		return
+	}
+
+	plainToken, err := util.GeneratePersonalToken()
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	token := models.PersonalAccessToken{
+		UserID:      c.GetInt64("userid"),
+		Name:        contextData.Name,
+		TokenPrefix: plainToken[:len(util.PersonalTokenPrefix)+6],
+		TokenHash:   util.HashContent([]byte(plainToken)),
+		Scopes:      strings.Join(scopes, ","),
+	}
+	if contextData.ExpireInDays > 0 {
+		expireAt := time.Now().AddDate(0, 0, contextData.ExpireInDays)
+		token.ExpireAt = &expireAt
+	}
+	if err := pc.tokenDao.CreateToken(&token); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，创建令牌失败"})
+		return
+	}
+	result := personalTokenToMap(token)
+	result["token"] = plainToken
+	c.JSON(http.StatusOK, result)
+}
+
+// RevokePersonalToken 撤销个人访问令牌，撤销后立即失效
+func (pc *PersonalTokenController) RevokePersonalToken(c *gin.Context) {
+	tokenId, err := strconv.ParseInt(c.Param("token_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的令牌ID"})
+		return
+	}
+	revoked, err := pc.tokenDao.RevokeToken(c.GetInt64("userid"), tokenId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，撤销失败"})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "令牌不存在或已撤销"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "令牌已撤销"})
+}
@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"yuqueppbackend/service-base/dao"
+	"yuqueppbackend/service-base/models"
+	"yuqueppbackend/service-base/util"
+)
+
+// 个人资料字段的长度限制（按字符计）
+const (
+	nicknameMaxLength = 32
+	bioMaxLength      = 200
+)
+
+// ProfileController 个人资料、头像与公开主页
+type ProfileController struct {
+	kbDao *dao.KBDAO
+}
+
+func NewProfileController(kbDao *dao.KBDAO) *ProfileController {
+	return &ProfileController{kbDao: kbDao}
+}
+
+// avatarURL 用户头像的访问地址，未上传头像时返回空字符串。地址中带有更新时间，头像更新后浏览器缓存自动失效
+func avatarURL(user *models.User) string {
+	if user.AvatarUpdatedAt == nil {
+		return ""
+	}
+	return "/api/public/user/" + strconv.FormatInt(user.ID, 10) + "/avatar?v=" + strconv.FormatInt(user.AvatarUpdatedAt.Unix(), 10)
+}
+
+// UpdateProfile 修改昵称与个人简介，未传的字段保持不变
+func (pc *ProfileController) UpdateProfile(c *gin.Context) {
+	var contextData struct {
+		Nickname *string `json:"nickname"`
+		Bio      *string `json:"bio"`
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+		return
+	}
+	updates := make(map[string]interface{})
+	if contextData.Nickname != nil {
+		nickname := strings.TrimSpace(*contextData.Nickname)
+		if nickname == "" || len([]rune(nickname)) > nicknameMaxLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "昵称长度需要在 1 到 32 个字符之间"})
+			return
+		}
+		updates["nickname"] = nickname
+	}
+	if contextData.Bio != nil {
+		bio := strings.TrimSpace(*contextData.Bio)
+		if len([]rune(bio)) > bioMaxLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "个人简介不能超过 200 个字符"})
+			return
+		}
+		updates["bio"] = bio
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "没有需要修改的内容"})
+		return
+	}
+	if err := userDao.UpdateProfile(c.GetInt64("userid"), updates); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，修改失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "个人资料已更新"})
+}
+
+// UploadAvatar 上传头像（multipart 字段 avatar），支持 JPEG、PNG、GIF、WebP，
+// 裁剪为正方形并缩放到标准尺寸后保存
+func (pc *ProfileController) UploadAvatar(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, util.AvatarMaxUploadSize+1<<20)
+	file, header, err := c.Request.FormFile("avatar")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择不超过 5MB 的图片"})
+		return
+	}
+	defer file.Close()
+	if header.Size > util.AvatarMaxUploadSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "图片不能超过 5MB"})
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(file, util.AvatarMaxUploadSize+1))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取图片失败"})
+		return
+	}
+	if len(data) > util.AvatarMaxUploadSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "图片不能超过 5MB"})
+		return
+	}
+	images, err := util.ProcessAvatar(data)
+	if errors.Is(err, util.ErrAvatarFormat) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "仅支持 JPEG、PNG、GIF、WebP 格式的图片"})
+		return
+	}
+	if errors.Is(err, util.ErrAvatarDimension) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "图片的宽高需要在 32 到 4096 像素之间"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，上传失败"})
+		return
+	}
+
+	userId := c.GetInt64("userid")
+	store := util.GetContentStore()
+	for size, image := range images {
+		if err := store.Put(util.AvatarKey(userId, size), image); err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，上传失败"})
+			return
+		}
+	}
+	now := time.Now()
+	if err := userDao.SetAvatarUpdatedAt(userId, &now); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，上传失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "头像已更新", "avatar_url": avatarURL(&models.User{ID: userId, AvatarUpdatedAt: &now})})
+}
+
+// DeleteAvatar 删除头像，恢复为默认头像
+func (pc *ProfileController) DeleteAvatar(c *gin.Context) {
+	userId := c.GetInt64("userid")
+	if err := userDao.SetAvatarUpdatedAt(userId, nil); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，删除失败"})
+		return
+	}
+	if err := util.GetContentStore().DeletePrefix(util.AvatarPrefix(userId)); err != nil {
+		log.Println(err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "头像已删除"})
+}
+
+// GetUserAvatar 获取用户头像图片，size 为标准尺寸之一，默认使用最大尺寸
+func (pc *ProfileController) GetUserAvatar(c *gin.Context) {
+	userId, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "头像不存在"})
+		return
+	}
+	size := util.AvatarSizes[len(util.AvatarSizes)-1]
+	if sizeParam := c.Query("size"); sizeParam != "" {
+		if size, err = strconv.Atoi(sizeParam); err != nil || !util.IsAvatarSize(size) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的头像尺寸"})
+			return
+		}
+	}
+	user, err := userDao.GetUserByID(userId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if user == nil || user.AvatarUpdatedAt == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "头像不存在"})
+		return
+	}
+	data, err := util.GetContentStore().Get(util.AvatarKey(userId, size))
+	if errors.Is(err, util.ErrContentNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "头像不存在"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	// 头像地址带有版本号，可以长期缓存
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, "image/png", data)
+}
+
+// GetPublicProfile 获取用户的公开主页：昵称、简介、头像与公开的知识库，不包含邮箱等隐私信息
+func (pc *ProfileController) GetPublicProfile(c *gin.Context) {
+	userId, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	user, err := userDao.GetUserByID(userId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	kbs, err := pc.kbDao.GetPublicKBListByOwnerId(user.ID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	var kbList []map[string]interface{}
+	for _, kb := range kbs {
+		kbList = append(kbList, map[string]interface{}{
+			"kb_id":          strconv.FormatInt(kb.ID, 10),
+			"kb_name":        kb.Name,
+			"kb_description": kb.Description,
+			"kb_created_at":  kb.CreatedAt,
+			"kb_updated_at":  kb.UpdatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":       strconv.FormatInt(user.ID, 10),
+		"nickname":      user.Nickname,
+		"bio":           user.Bio,
+		"avatar_url":    avatarURL(user),
+		"registered_at": user.RegisteredAt,
+		"kb_list":       kbList,
+	})
+}
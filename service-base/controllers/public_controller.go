@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+	"yuqueppbackend/service-base/dao"
+	"yuqueppbackend/service-base/models"
+)
+
+// PublicController 无需登录即可访问的公开知识库接口，只读，私有知识库一律返回 404
+type PublicController struct {
+	authz      *Authorizer
+	docDao     *dao.DocDao
+	commentDao *dao.CommentDAO
+}
+
+func NewPublicController(authz *Authorizer, docDao *dao.DocDao, commentDao *dao.CommentDAO) *PublicController {
+	return &PublicController{authz: authz, docDao: docDao, commentDao: commentDao}
+}
+
+// parsePage 解析分页参数，page 从 1 开始
+func parsePage(c *gin.Context, defaultPageSize int) (int, int) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(defaultPageSize)))
+	if err != nil || pageSize <= 0 || pageSize > 100 {
+		pageSize = defaultPageSize
+	}
+	return page, pageSize
+}
+
+func publicCommentToMap(comment models.DocumentComment) map[string]interface{} {
+	result := map[string]interface{}{
+		"comment_id":         strconv.FormatInt(comment.ID, 10),
+		"comment_content":    comment.Content,
+		"doc_id":             strconv.FormatInt(comment.DocumentID, 10),
+		"user_id":            commentUserId(comment),
+		"nickname":           commentNickname(comment),
+		"comment_created_at": comment.CreatedAt,
+		"last_updated_at":    comment.UpdatedAt,
+		"comment_like_count": comment.LikeCount,
+	}
+	if comment.ParentID != nil {
+		result["parent_comment_id"] = strconv.FormatInt(*comment.ParentID, 10)
+	}
+	return result
+}
+
+// GetPublicKnowledgeBaseDetail 获取公开知识库的详情
+func (pc *PublicController) GetPublicKnowledgeBaseDetail(c *gin.Context) {
+	kbId, err := strconv.ParseInt(c.Param("kb_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "知识库不存在"})
+		return
+	}
+	kb, ok := pc.authz.AuthorizePublicKB(c, kbId)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"kb_id":          strconv.FormatInt(kb.ID, 10),
+		"kb_owner_id":    strconv.FormatInt(kb.OwnerID, 10),
+		"kb_name":        kb.Name,
+		"kb_description": kb.Description,
+		"kb_is_public":   kb.IsPublic,
+		"kb_created_at":  kb.CreatedAt,
+		"kb_updated_at":  kb.UpdatedAt,
+	})
+}
+
+// GetPublicDocumentTree 获取公开知识库的目录树
+func (pc *PublicController) GetPublicDocumentTree(c *gin.Context) {
+	kbId, err := strconv.ParseInt(c.Param("kb_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "知识库不存在"})
+		return
+	}
+	if _, ok := pc.authz.AuthorizePublicKB(c, kbId); !ok {
+		return
+	}
+	docs, err := pc.docDao.GetDocumentsByKnowledgeBaseID(kbId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve documents"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"kb_id": strconv.FormatInt(kbId, 10), "doc_tree": buildDocumentTree(docs)})
+}
+
+// GetPublicDocument 获取公开知识库中文档的内容
+func (pc *PublicController) GetPublicDocument(c *gin.Context) {
+	strDocId := c.Param("doc_id")
+	docId, err := strconv.ParseInt(strDocId, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "当前文档不见了"})
+		return
+	}
+	doc, ok := pc.authz.AuthorizePublicDocument(c, docId)
+	if !ok {
+		return
+	}
+	docContent, err := getDocumentContentById(strDocId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"doc_id":         strconv.FormatInt(doc.ID, 10),
+		"kb_id":          strconv.FormatInt(doc.KnowledgeBaseID, 10),
+		"kb_name":        doc.KnowledgeBase.Name,
+		"doc_title":      doc.Title,
+		"doc_content":    docContent,
+		"doc_parent_id":  formatParentId(doc.ParentID),
+		"doc_created_at": doc.CreatedAt,
+		"doc_updated_at": doc.UpdatedAt,
+	})
+}
+
+// GetPublicDocumentRootComment 获取公开文档已发布的顶级评论
+func (pc *PublicController) GetPublicDocumentRootComment(c *gin.Context) {
+	docId, err := strconv.ParseInt(c.Param("doc_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "当前文档不见了"})
+		return
+	}
+	if _, ok := pc.authz.AuthorizePublicDocument(c, docId); !ok {
+		return
+	}
+	page, pageSize := parsePage(c, 10)
+	comments, total, err := pc.commentDao.GetPublishedRootComments(docId, page, pageSize)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，评论信息拉取失败"})
+		return
+	}
+	var commentList []map[string]interface{}
+	for _, comment := range comments {
+		tmp := publicCommentToMap(comment)
+		hasChildren, err := pc.commentDao.HasRepliesByCommentID(comment.ID)
+		tmp["have_children_comment"] = err == nil && hasChildren
+		commentList = append(commentList, tmp)
+	}
+	c.JSON(http.StatusOK, gin.H{"comment_list": commentList, "total": total})
+}
+
+// GetPublicChildrenComment 获取公开文档中某条顶级评论下已发布的回复
+func (pc *PublicController) GetPublicChildrenComment(c *gin.Context) {
+	rootId, err := strconv.ParseInt(c.Param("root_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "评论不存在"})
+		return
+	}
+	rootComment, err := pc.commentDao.GetCommentByID(rootId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "评论回复获取失败，请稍后再试"})
+		return
+	}
+	if rootComment == nil || rootComment.IsDeleted || rootComment.Status != models.CommentStatusPublished {
+		c.JSON(http.StatusNotFound, gin.H{"error": "评论不存在"})
+		return
+	}
+	if _, ok := pc.authz.AuthorizePublicDocument(c, rootComment.DocumentID); !ok {
+		return
+	}
+	page, pageSize := parsePage(c, 10)
+	replies, total, err := pc.commentDao.GetPublishedRepliesByRootID(rootId, page, pageSize)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "评论回复获取失败，请稍后再试"})
+		return
+	}
+	var replyList []map[string]interface{}
+	for _, reply := range replies {
+		replyList = append(replyList, publicCommentToMap(reply))
+	}
+	c.JSON(http.StatusOK, gin.H{"children_comments": replyList, "total": total})
+}
@@ -0,0 +1,353 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"yuqueppbackend/service-base/config"
+	"yuqueppbackend/service-base/dao"
+	"yuqueppbackend/service-base/models"
+)
+
+// 配额名称，超出配额时返回给前端
+const (
+	quotaKnowledgeBases = "knowledge_bases"
+	quotaDocuments      = "documents_per_kb"
+	quotaStorage        = "storage_bytes"
+	quotaAttachment     = "attachment_bytes"
+	quotaCollaborators  = "collaborators"
+)
+
+// QuotaController 会员套餐配额的校验与用量查询。知识库内的配额都按知识库所有者的套餐计算
+type QuotaController struct {
+	quotaDao *dao.QuotaDAO
+}
+
+func NewQuotaController(quotaDao *dao.QuotaDAO) *QuotaController {
+	return &QuotaController{quotaDao: quotaDao}
+}
+
+// ownerQuota 获取知识库所有者当前生效的套餐与配额，失败时已写入响应
+func (qc *QuotaController) ownerQuota(c *gin.Context, ownerId int64) (string, config.PlanQuota, bool) {
+	owner, err := userDao.GetUserByID(ownerId)
+	if err != nil || owner == nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return "", config.PlanQuota{}, false
+	}
+	plan := owner.EffectivePlan(time.Now())
+	return plan, config.GetPlanQuota(plan), true
+}
+
+// quotaExceeded 写入超出配额的响应。操作者就是所有者时返回 402，提示升级套餐；
+// 协作者无法为所有者升级，返回 403
+func quotaExceeded(c *gin.Context, ownerId int64, plan, quota string, limit, used int64, message string) {
+	status := http.StatusPaymentRequired
+	hint := "，请升级套餐"
+	if c.GetInt64("userid") != ownerId {
+		status = http.StatusForbidden
+		hint = "，请联系知识库所有者升级套餐"
+	}
+	c.JSON(status, gin.H{
+		"error": message + hint,
+		"quota": quota,
+		"plan":  plan,
+		"limit": limit,
+		"used":  used,
+	})
+}
+
+// knowledgeBaseQuotaExceeded 写入知识库数量超出配额的响应
+func knowledgeBaseQuotaExceeded(c *gin.Context, ownerId int64, plan string, quota config.PlanQuota, used int64) {
+	quotaExceeded(c, ownerId, plan, quotaKnowledgeBases, quota.MaxKnowledgeBases, used,
+		fmt.Sprintf("知识库数量已达到当前套餐上限（%d 个）", quota.MaxKnowledgeBases))
+}
+
+// documentQuotaExceeded 写入文档数量超出配额的响应
+func documentQuotaExceeded(c *gin.Context, ownerId int64, plan string, quota config.PlanQuota, used int64) {
+	quotaExceeded(c, ownerId, plan, quotaDocuments, quota.MaxDocumentsPerKB, used,
+		fmt.Sprintf("该知识库的文档数量已达到当前套餐上限（%d 篇）", quota.MaxDocumentsPerKB))
+}
+
+// CreateKnowledgeBase 在知识库数量配额内创建知识库，统计与创建在同一个事务中完成，失败时已写入响应
+func (qc *QuotaController) CreateKnowledgeBase(c *gin.Context, kb *models.KnowledgeBase) bool {
+	plan, quota, ok := qc.ownerQuota(c, kb.OwnerID)
+	if !ok {
+		return false
+	}
+	err := qc.quotaDao.CreateKBWithinQuota(kb, quota.MaxKnowledgeBases)
+	var quotaErr *dao.QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		knowledgeBaseQuotaExceeded(c, kb.OwnerID, plan, quota, quotaErr.Used)
+		return false
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，创建知识库失败"})
+		return false
+	}
+	return true
+}
+
+// CreateDocument 在知识库的文档数量配额内创建文档，统计与创建在同一个事务中完成，失败时已写入响应
+func (qc *QuotaController) CreateDocument(c *gin.Context, kb *models.KnowledgeBase, doc *models.Document) bool {
+	plan, quota, ok := qc.ownerQuota(c, kb.OwnerID)
+	if !ok {
+		return false
+	}
+	err := qc.quotaDao.CreateDocumentWithinQuota(doc, quota.MaxDocumentsPerKB)
+	var quotaErr *dao.QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		documentQuotaExceeded(c, kb.OwnerID, plan, quota, quotaErr.Used)
+		return false
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，创建文档失败"})
+		return false
+	}
+	return true
+}
+
+// storageQuotaExceeded 写入存储空间超出配额的响应
+func storageQuotaExceeded(c *gin.Context, ownerId int64, plan string, quota config.PlanQuota, used int64) {
+	quotaExceeded(c, ownerId, plan, quotaStorage, quota.MaxStorageBytes, used,
+		fmt.Sprintf("存储空间已达到当前套餐上限（%s），可以清空回收站或删除不需要的文档释放空间", formatBytes(quota.MaxStorageBytes)))
+}
+
+// CheckAttachmentSize 向知识库写入 size 字节的内容前检查单次上传大小。
+// 存储空间需要在写入版本的事务中统计，见 DocumentController.saveDocumentVersionWithinQuota
+func (qc *QuotaController) CheckAttachmentSize(c *gin.Context, kb *models.KnowledgeBase, size int64) bool {
+	plan, quota, ok := qc.ownerQuota(c, kb.OwnerID)
+	return ok && checkAttachmentSize(c, kb.OwnerID, plan, quota, size)
+}
+
+// checkAttachmentSize 单次上传超过套餐上限时写入响应并返回 false
+func checkAttachmentSize(c *gin.Context, ownerId int64, plan string, quota config.PlanQuota, size int64) bool {
+	if quota.MaxAttachmentBytes > 0 && size > quota.MaxAttachmentBytes {
+		quotaExceeded(c, ownerId, plan, quotaAttachment, quota.MaxAttachmentBytes, size,
+			fmt.Sprintf("文件大小超过当前套餐的上限（%s）", formatBytes(quota.MaxAttachmentBytes)))
+		return false
+	}
+	return true
+}
+
+// CheckStorageQuota 向知识库写入 size 字节的内容前检查单次上传大小与存储空间配额
+func (qc *QuotaController) CheckStorageQuota(c *gin.Context, kb *models.KnowledgeBase, size int64) bool {
+	plan, quota, ok := qc.ownerQuota(c, kb.OwnerID)
+	if !ok || !checkAttachmentSize(c, kb.OwnerID, plan, quota, size) {
+		return false
+	}
+	if quota.MaxStorageBytes <= 0 {
+		return true
+	}
+	used, err := qc.quotaDao.GetStorageBytesByOwner(kb.OwnerID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return false
+	}
+	if used+size > quota.MaxStorageBytes {
+		storageQuotaExceeded(c, kb.OwnerID, plan, quota, used)
+		return false
+	}
+	return true
+}
+
+// StorageAllowance 返回知识库所有者当前最多还能写入多少字节的内容，即单次上传上限与剩余存储空间中较小的一个，
+// 两者都不限制时返回 -1。用于无法直接写入 HTTP 响应的协同编辑
+func (qc *QuotaController) StorageAllowance(ownerId int64) (int64, error) {
+	owner, err := userDao.GetUserByID(ownerId)
+	if err != nil {
+		return 0, err
+	}
+	if owner == nil {
+		return 0, fmt.Errorf("owner %d of knowledge base not found", ownerId)
+	}
+	quota := config.GetPlanQuota(owner.EffectivePlan(time.Now()))
+	var used int64
+	if quota.MaxStorageBytes > 0 {
+		if used, err = qc.quotaDao.GetStorageBytesByOwner(ownerId); err != nil {
+			return 0, err
+		}
+	}
+	return quota.StorageAllowance(used), nil
+}
+
+// CheckCollaboratorQuota 邀请新成员前检查协作者数量配额
+func (qc *QuotaController) CheckCollaboratorQuota(c *gin.Context, kb *models.KnowledgeBase) bool {
+	plan, quota, ok := qc.ownerQuota(c, kb.OwnerID)
+	if !ok {
+		return false
+	}
+	if quota.MaxCollaborators <= 0 {
+		return true
+	}
+	count, err := qc.quotaDao.CountCollaboratorsByKB(kb.ID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return false
+	}
+	if count >= quota.MaxCollaborators {
+		quotaExceeded(c, kb.OwnerID, plan, quotaCollaborators, quota.MaxCollaborators, count,
+			fmt.Sprintf("该知识库的协作者数量已达到当前套餐上限（%d 人）", quota.MaxCollaborators))
+		return false
+	}
+	return true
+}
+
+// formatBytes 将字节数格式化为便于阅读的形式
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// usageOf 汇总用户的套餐、配额与当前用量
+func (qc *QuotaController) usageOf(user *models.User) (gin.H, error) {
+	kbUsages, err := qc.quotaDao.GetKBUsagesByOwner(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	storage, err := qc.quotaDao.GetStorageBytesByOwner(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	var kbList []map[string]interface{}
+	for _, usage := range kbUsages {
+		kbList = append(kbList, map[string]interface{}{
+			"kb_id":         strconv.FormatInt(usage.KnowledgeBaseID, 10),
+			"kb_name":       usage.Name,
+			"documents":     usage.Documents,
+			"collaborators": usage.Collaborators,
+		})
+	}
+	plan := user.EffectivePlan(time.Now())
+	result := gin.H{
+		"user_id": strconv.FormatInt(user.ID, 10),
+		"plan":    plan,
+		"quota":   config.GetPlanQuota(plan),
+		"usage": gin.H{
+			"knowledge_bases": len(kbUsages),
+			"storage_bytes":   storage,
+			"kb_list":         kbList,
+		},
+	}
+	if plan != models.PlanFree {
+		result["expiry_at"] = user.ExpiryAt
+	}
+	return result, nil
+}
+
+// GetUsage 获取当前用户的套餐、配额与用量
+func (qc *QuotaController) GetUsage(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	result, err := qc.usageOf(user)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// GetUserUsage 管理员查看指定用户的套餐与用量
+func (qc *QuotaController) GetUserUsage(c *gin.Context) {
+	userId, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的用户ID"})
+		return
+	}
+	user, err := userDao.GetUserByID(userId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	result, err := qc.usageOf(user)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// GrantMembership 管理员为用户开通或延长会员。套餐未变且尚未到期时在原到期时间上延长，
+// 否则从现在开始计算；plan 为 free 时立即取消会员
+func (qc *QuotaController) GrantMembership(c *gin.Context) {
+	var contextData struct {
+		UserId string `json:"user_id" binding:"required"`
+		Plan   string `json:"plan" binding:"required"`
+		Days   int    `json:"days"`
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+		return
+	}
+	userId, err := strconv.ParseInt(contextData.UserId, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的用户ID"})
+		return
+	}
+	if !models.IsValidPlan(contextData.Plan) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的套餐"})
+		return
+	}
+	if contextData.Plan != models.PlanFree && (contextData.Days <= 0 || contextData.Days > 3660) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "开通天数需要在 1 到 3660 之间"})
+		return
+	}
+	user, err := userDao.GetUserByID(userId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	now := time.Now()
+	expiryAt := now
+	if contextData.Plan != models.PlanFree {
+		start := now
+		if user.EffectivePlan(now) == contextData.Plan {
+			start = user.ExpiryAt
+		}
+		expiryAt = start.AddDate(0, 0, contextData.Days)
+	}
+	if err := userDao.SetMembership(user.ID, contextData.Plan, expiryAt); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	recordAudit(c, models.AuditAdminGrantPlan, models.AuditTargetUser, user.ID, models.AuditResultSuccess,
+		"plan="+contextData.Plan+" expiry_at="+expiryAt.Format(time.RFC3339))
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "会员已更新",
+		"user_id":   strconv.FormatInt(user.ID, 10),
+		"plan":      contextData.Plan,
+		"expiry_at": expiryAt,
+	})
+}
@@ -10,11 +10,28 @@ import (
 )
 
 type SearchController struct {
-	dao *dao.SearchDao
+	dao   *dao.SearchDao
+	authz *Authorizer
 }
 
-func NewSearchController(dao *dao.SearchDao) *SearchController {
-	return &SearchController{dao: dao}
+func NewSearchController(dao *dao.SearchDao, authz *Authorizer) *SearchController {
+	return &SearchController{dao: dao, authz: authz}
+}
+
+// getAccessibleKBRoles 获取当前用户可以访问的知识库，用于过滤搜索结果
+func (sc *SearchController) getAccessibleKBRoles(c *gin.Context) (map[int64]string, bool) {
+	userId, exists := c.Get("userid")
+	if !exists {
+		c.JSON(401, gin.H{"error": "用户未授权"})
+		return nil, false
+	}
+	roles, err := sc.authz.GetAccessibleKBRoles(userId.(int64))
+	if err != nil {
+		log.Println(err)
+		c.JSON(500, gin.H{"error": "系统错误，请稍后再试"})
+		return nil, false
+	}
+	return roles, true
 }
 
 func (sc *SearchController) PersonalSearchKnowledgeBaseHandler(c *gin.Context) {
@@ -27,6 +44,10 @@ func (sc *SearchController) PersonalSearchKnowledgeBaseHandler(c *gin.Context) {
 		return
 	}
 	log.Println(strKBIds)
+	roles, ok := sc.getAccessibleKBRoles(c)
+	if !ok {
+		return
+	}
 	kbDao := dao.NewKBDAO(db.GetDB(), util.GetElasticSearchClient())
 
 	var kbInfo []map[string]interface{}
@@ -35,6 +56,10 @@ func (sc *SearchController) PersonalSearchKnowledgeBaseHandler(c *gin.Context) {
 		if err != nil {
 			continue
 		}
+		// 只返回有权限访问的知识库
+		if _, ok := roles[kbId]; !ok {
+			continue
+		}
 		kb, err := kbDao.GetKnowledgeBaseById(kbId)
 		if err != nil {
 			c.JSON(500, gin.H{"error": "系统错误，请稍后再试"})
@@ -46,6 +71,7 @@ func (sc *SearchController) PersonalSearchKnowledgeBaseHandler(c *gin.Context) {
 			"kb_description": kb.Description,
 			"kb_updated_at":  kb.UpdatedAt,
 			"kb_created_at":  kb.CreatedAt,
+			"kb_role":        roles[kbId],
 		})
 	}
 	c.JSON(200, gin.H{"knowledgeBases": kbInfo})
@@ -61,6 +87,10 @@ func (sc *SearchController) PersonalSearchDocumentTitleHandler(c *gin.Context) {
 		return
 	}
 	log.Println(strDocIds)
+	roles, ok := sc.getAccessibleKBRoles(c)
+	if !ok {
+		return
+	}
 
 	docDao := dao.NewDocDao(db.GetDB(), util.GetElasticSearchClient())
 	var docInfo []map[string]interface{}
@@ -74,6 +104,13 @@ func (sc *SearchController) PersonalSearchDocumentTitleHandler(c *gin.Context) {
 			c.JSON(500, gin.H{"error": "系统错误，请稍后再试"})
 			return
 		}
+		// 只返回有权限访问的知识库中的文档
+		if doc == nil {
+			continue
+		}
+		if _, ok := roles[doc.KnowledgeBaseID]; !ok {
+			continue
+		}
 		docInfo = append(docInfo, map[string]interface{}{
 			"doc_id":         strDocId,
 			"doc_title":      doc.Title,
@@ -94,6 +131,25 @@ func (sc *SearchController) PersonalSearchDocumentContentHandler(c *gin.Context)
 		return
 	}
 	log.Println(strDocIds)
+	roles, ok := sc.getAccessibleKBRoles(c)
+	if !ok {
+		return
+	}
+	docDao := dao.NewDocDao(db.GetDB(), util.GetElasticSearchClient())
+	var accessibleDocIds []string
+	for _, strDocId := range strDocIds {
+		docId, err := strconv.ParseInt(strDocId, 10, 64)
+		if err != nil {
+			continue
+		}
+		doc, err := docDao.GetDocumentByID(docId)
+		if err != nil || doc == nil {
+			continue
+		}
+		if _, ok := roles[doc.KnowledgeBaseID]; ok {
+			accessibleDocIds = append(accessibleDocIds, strDocId)
+		}
+	}
 
-	c.JSON(200, gin.H{"data": strDocIds})
+	c.JSON(200, gin.H{"data": accessibleDocIds})
 }
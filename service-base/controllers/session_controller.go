@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"yuqueppbackend/service-base/models"
+	"yuqueppbackend/service-base/util"
+)
+
+// RefreshToken 使用刷新令牌换取新的访问令牌与刷新令牌，旧刷新令牌随即失效
+func RefreshToken(c *gin.Context) {
+	var contextData struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少刷新令牌"})
+		return
+	}
+	tokens, err := util.RefreshSession(contextData.RefreshToken, c.ClientIP(), c.Request.UserAgent())
+	if errors.Is(err, util.ErrRefreshTokenReused) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "登录状态异常，该设备已被强制下线，请重新登录"})
+		return
+	}
+	if errors.Is(err, util.ErrRefreshTokenInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "登录已过期，请重新登录"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// GetSessionList 获取当前用户所有已登录的设备
+func GetSessionList(c *gin.Context) {
+	sessions, err := util.ListSessions(c.GetInt64("userid"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	currentSessionId := c.GetString("session_id")
+	var sessionList []map[string]interface{}
+	for _, session := range sessions {
+		sessionList = append(sessionList, map[string]interface{}{
+			"session_id": session.ID,
+			"ip":         session.IP,
+			"user_agent": session.UserAgent,
+			"created_at": session.CreatedAt,
+			"last_seen":  session.LastSeen,
+			"current":    session.ID == currentSessionId,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"session_list": sessionList})
+}
+
+// RevokeSession 让指定设备下线
+func RevokeSession(c *gin.Context) {
+	revoked, err := util.RevokeSession(c.GetInt64("userid"), c.Param("session_id"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在或已失效"})
+		return
+	}
+	recordAudit(c, models.AuditRevokeSession, models.AuditTargetUser, c.GetInt64("userid"), models.AuditResultSuccess, "session="+c.Param("session_id"))
+	c.JSON(http.StatusOK, gin.H{"message": "设备已下线"})
+}
+
+// RevokeAllSessions 让当前用户的所有设备下线，包括当前设备
+func RevokeAllSessions(c *gin.Context) {
+	if err := util.RevokeAllSessions(c.GetInt64("userid")); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	recordAudit(c, models.AuditRevokeAllSessions, models.AuditTargetUser, c.GetInt64("userid"), models.AuditResultSuccess, "")
+	c.JSON(http.StatusOK, gin.H{"message": "所有设备已下线，请重新登录"})
+}
+
+// GetJWKS 发布 JWT 校验公钥，其他服务可以据此校验本服务签发的 token
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, util.GetJWTKeySet().JWKS())
+}
@@ -0,0 +1,347 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"yuqueppbackend/service-base/config"
+	"yuqueppbackend/service-base/dao"
+	"yuqueppbackend/service-base/models"
+	"yuqueppbackend/service-base/util"
+)
+
+// 分享链接访问密码通过该请求头传递，避免出现在 URL 与访问日志中
+const sharePasswordHeader = "X-Share-Password"
+
+type ShareLinkController struct {
+	shareDao   *dao.ShareLinkDAO
+	commentDao *dao.CommentDAO
+	authz      *Authorizer
+}
+
+func NewShareLinkController(shareDao *dao.ShareLinkDAO, commentDao *dao.CommentDAO, authz *Authorizer) *ShareLinkController {
+	return &ShareLinkController{shareDao: shareDao, commentDao: commentDao, authz: authz}
+}
+
+func shareLinkToMap(link models.DocumentShareLink) map[string]interface{} {
+	return map[string]interface{}{
+		"share_id":          strconv.FormatInt(link.ID, 10),
+		"token":             link.Token,
+		"doc_id":            strconv.FormatInt(link.DocumentID, 10),
+		"doc_title":         link.Document.Title,
+		"permission":        link.Permission,
+		"password_required": link.PasswordHash != "",
+		"expire_at":         link.ExpireAt,
+		"revoked_at":        link.RevokedAt,
+		"is_active":         link.IsActive(time.Now()),
+		"access_count":      link.AccessCount,
+		"created_at":        link.CreatedAt,
+	}
+}
+
+// CreateShareLinkHandler 为文档创建分享链接，编辑者及以上角色可以分享文档
+func (sc *ShareLinkController) CreateShareLinkHandler(c *gin.Context) {
+	var contextData struct {
+		DocId         string `json:"doc_id" binding:"required"`
+		Permission    string `json:"permission"`      // read 或 comment，默认 read
+		Password      string `json:"password"`        // 可选，访问密码
+		ExpireInHours int    `json:"expire_in_hours"` // 可选，有效期（小时），为 0 表示永不过期
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+		return
+	}
+	if contextData.Permission == "" {
+		contextData.Permission = models.SharePermissionRead
+	}
+	if contextData.Permission != models.SharePermissionRead && contextData.Permission != models.SharePermissionComment {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分享权限"})
+		return
+	}
+	if contextData.ExpireInHours < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的有效期"})
+		return
+	}
+	docId, err := strconv.ParseInt(contextData.DocId, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的文档ID"})
+		return
+	}
+	doc, _, ok := sc.authz.AuthorizeDocument(c, docId, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	token, err := util.GenerateRandomToken(24)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return
+	}
+	link := models.DocumentShareLink{
+		Token:      token,
+		DocumentID: doc.ID,
+		OwnerID:    c.GetInt64("userid"),
+		Permission: contextData.Permission,
+	}
+	if contextData.Password != "" {
+		link.PasswordHash, err = util.HashPassword(contextData.Password)
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+			return
+		}
+	}
+	if contextData.ExpireInHours > 0 {
+		expireAt := time.Now().Add(time.Duration(contextData.ExpireInHours) * time.Hour)
+		link.ExpireAt = &expireAt
+	}
+	if err := sc.shareDao.CreateShareLink(&link); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，创建分享链接失败"})
+		return
+	}
+	recordAudit(c, models.AuditShareLinkCreate, models.AuditTargetShareLink, link.ID, models.AuditResultSuccess,
+		"doc_id="+contextData.DocId+" permission="+link.Permission)
+	link.Document = *doc
+	c.JSON(http.StatusOK, shareLinkToMap(link))
+}
+
+// GetShareLinkListHandler 获取当前用户创建的分享链接，可通过 doc_id 过滤
+func (sc *ShareLinkController) GetShareLinkListHandler(c *gin.Context) {
+	userId, exists := c.Get("userid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未授权"})
+		return
+	}
+	var docId int64
+	if strDocId := c.Query("doc_id"); strDocId != "" {
+		var err error
+		docId, err = strconv.ParseInt(strDocId, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "错误的文档ID"})
+			return
+		}
+	}
+	links, err := sc.shareDao.GetShareLinksByOwner(userId.(int64), docId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，获取分享链接失败"})
+		return
+	}
+	var linkList []map[string]interface{}
+	for _, link := range links {
+		linkList = append(linkList, shareLinkToMap(link))
+	}
+	c.JSON(http.StatusOK, gin.H{"share_links": linkList})
+}
+
+// RevokeShareLinkHandler 撤销分享链接，创建者与知识库管理员可以撤销
+func (sc *ShareLinkController) RevokeShareLinkHandler(c *gin.Context) {
+	userId, exists := c.Get("userid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未授权"})
+		return
+	}
+	shareId, err := strconv.ParseInt(c.Param("share_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的分享链接ID"})
+		return
+	}
+	link, err := sc.shareDao.GetShareLinkByID(shareId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return
+	}
+	if link == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "分享链接不存在"})
+		return
+	}
+	if link.OwnerID != userId.(int64) {
+		if _, _, ok := sc.authz.AuthorizeDocument(c, link.DocumentID, models.RoleAdmin); !ok {
+			return
+		}
+	}
+	if link.RevokedAt == nil {
+		if err := sc.shareDao.RevokeShareLink(link); err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，撤销失败"})
+			return
+		}
+		recordAudit(c, models.AuditShareLinkRevoke, models.AuditTargetShareLink, link.ID, models.AuditResultSuccess, "")
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "分享链接已撤销"})
+}
+
+// checkShareRateLimit 按分享链接与访客 IP 限制频率，超过限制或 Redis 故障时拒绝请求并已写入响应
+func checkShareRateLimit(c *gin.Context, scene string, link *models.DocumentShareLink, limit int, window time.Duration, message string) bool {
+	allowed, retryAfter, err := util.CheckRateLimit(scene+":"+strconv.FormatInt(link.ID, 10)+":"+c.ClientIP(), limit, window)
+	if err != nil {
+		// 无法计数时拒绝，避免匿名接口在 Redis 故障期间失去保护
+		log.Println(err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "系统繁忙，请稍后再试"})
+		return false
+	}
+	if !allowed {
+		seconds := int64(retryAfter.Seconds() + 0.5)
+		c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": message, "retry_after": seconds})
+		return false
+	}
+	return true
+}
+
+// resolveShareLink 解析分享 token 并校验有效期与访问密码，返回链接与文档；失败时已写入响应。
+// 链接创建者失去文档的编辑权限后，其创建的链接随之失效
+func (sc *ShareLinkController) resolveShareLink(c *gin.Context) (*models.DocumentShareLink, *models.Document, bool) {
+	link, err := sc.shareDao.GetShareLinkByToken(c.Param("token"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return nil, nil, false
+	}
+	// 过期与撤销的链接与不存在的链接返回相同结果
+	if link == nil || !link.IsActive(time.Now()) {
+		var linkId int64
+		if link != nil {
+			linkId = link.ID
+		}
+		recordAuditAs(c, 0, "", models.AuditShareLinkAccess, models.AuditTargetShareLink, linkId, models.AuditResultFailure, "invalid_or_expired")
+		c.JSON(http.StatusNotFound, gin.H{"error": "分享链接不存在或已失效"})
+		return nil, nil, false
+	}
+	if link.PasswordHash != "" {
+		password := c.GetHeader(sharePasswordHeader)
+		if password == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "请输入访问密码", "password_required": true})
+			return nil, nil, false
+		}
+		guard := config.GetShareGuardConfig()
+		if !checkShareRateLimit(c, "sharePassword", link, guard.PasswordMaxAttempts, guard.PasswordWindow, "密码尝试次数过多，请稍后再试") {
+			return nil, nil, false
+		}
+		if !util.CheckPassword(link.PasswordHash, password) {
+			recordAuditAs(c, 0, "", models.AuditShareLinkAccess, models.AuditTargetShareLink, link.ID, models.AuditResultFailure, "bad_password")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "访问密码错误", "password_required": true})
+			return nil, nil, false
+		}
+	}
+	doc, err := sc.authz.docDao.GetDocumentByID(link.DocumentID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return nil, nil, false
+	}
+	// 文档或知识库已被删除
+	if doc == nil || doc.KnowledgeBase.ID == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "分享链接不存在或已失效"})
+		return nil, nil, false
+	}
+	creatorRole, err := sc.authz.GetKBRole(link.OwnerID, &doc.KnowledgeBase)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return nil, nil, false
+	}
+	if models.RoleRank(creatorRole) < models.RoleRank(models.RoleEditor) {
+		recordAuditAs(c, 0, "", models.AuditShareLinkAccess, models.AuditTargetShareLink, link.ID, models.AuditResultFailure, "creator_access_revoked")
+		c.JSON(http.StatusNotFound, gin.H{"error": "分享链接不存在或已失效"})
+		return nil, nil, false
+	}
+	// 访客没有账号，按匿名记录
+	recordAuditAs(c, 0, "", models.AuditShareLinkAccess, models.AuditTargetShareLink, link.ID, models.AuditResultSuccess,
+		"doc_id="+strconv.FormatInt(doc.ID, 10)+" "+c.Request.Method+" "+c.FullPath())
+	return link, doc, true
+}
+
+// GetSharedDocumentHandler 通过分享链接获取文档内容，无需登录
+func (sc *ShareLinkController) GetSharedDocumentHandler(c *gin.Context) {
+	link, doc, ok := sc.resolveShareLink(c)
+	if !ok {
+		return
+	}
+	strDocId := strconv.FormatInt(doc.ID, 10)
+	docContent, err := getDocumentContentById(strDocId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return
+	}
+	if err := sc.shareDao.IncrementAccessCount(link.ID); err != nil {
+		log.Println(err)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"doc_id":         strDocId,
+		"doc_title":      doc.Title,
+		"doc_content":    docContent,
+		"doc_updated_at": doc.UpdatedAt,
+		"kb_name":        doc.KnowledgeBase.Name,
+		"permission":     link.Permission,
+	})
+}
+
+// GetSharedDocumentCommentsHandler 通过评论权限的分享链接查看文档已发布的顶级评论
+func (sc *ShareLinkController) GetSharedDocumentCommentsHandler(c *gin.Context) {
+	link, doc, ok := sc.resolveShareLink(c)
+	if !ok {
+		return
+	}
+	if link.Permission != models.SharePermissionComment {
+		c.JSON(http.StatusForbidden, gin.H{"error": "该分享链接不允许查看评论"})
+		return
+	}
+	page, pageSize := parsePage(c, 10)
+	comments, total, err := sc.commentDao.GetPublishedRootComments(doc.ID, page, pageSize)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，评论信息拉取失败"})
+		return
+	}
+	var commentList []map[string]interface{}
+	for _, comment := range comments {
+		commentList = append(commentList, publicCommentToMap(comment))
+	}
+	c.JSON(http.StatusOK, gin.H{"comment_list": commentList, "total": total})
+}
+
+// CreateSharedDocumentCommentHandler 通过评论权限的分享链接发表匿名评论
+func (sc *ShareLinkController) CreateSharedDocumentCommentHandler(c *gin.Context) {
+	var contextData struct {
+		CommentContent string `json:"comment_content" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "评论内容不能为空"})
+		return
+	}
+	link, doc, ok := sc.resolveShareLink(c)
+	if !ok {
+		return
+	}
+	if link.Permission != models.SharePermissionComment {
+		c.JSON(http.StatusForbidden, gin.H{"error": "该分享链接不允许发表评论"})
+		return
+	}
+	if !checkShareRateLimit(c, "shareComment", link, config.GetShareGuardConfig().CommentMaxPerHour, time.Hour, "评论过于频繁，请稍后再试") {
+		return
+	}
+	// 访客没有账号，评论挂在分享链接创建者名下并标记为匿名，以满足用户外键约束
+	comment := models.DocumentComment{
+		DocumentID:  doc.ID,
+		UserID:      link.OwnerID,
+		Content:     contextData.CommentContent,
+		Status:      models.CommentStatusPublished,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+		CreatedAtBy: c.ClientIP(),
+		IsAnonymous: true,
+	}
+	if err := sc.commentDao.CreateComment(&comment); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，评论创建失败"})
+		return
+	}
+	c.JSON(http.StatusOK, publicCommentToMap(comment))
+}
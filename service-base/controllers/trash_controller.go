@@ -0,0 +1,291 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"yuqueppbackend/service-base/config"
+	"yuqueppbackend/service-base/dao"
+	"yuqueppbackend/service-base/models"
+)
+
+type TrashController struct {
+	trashDao   *dao.TrashDAO
+	docDao     *dao.DocDao
+	kbDao      *dao.KBDAO
+	commentDao *dao.CommentDAO
+	quota      *QuotaController
+}
+
+func NewTrashController(trashDao *dao.TrashDAO, docDao *dao.DocDao, kbDao *dao.KBDAO, commentDao *dao.CommentDAO, quota *QuotaController) *TrashController {
+	return &TrashController{trashDao: trashDao, docDao: docDao, kbDao: kbDao, commentDao: commentDao, quota: quota}
+}
+
+// removeDocumentsFromES 文档进入回收站后不再出现在搜索结果中
+func removeDocumentsFromES(docDao *dao.DocDao, docIds []int64) {
+	for _, docId := range docIds {
+		if err := docDao.DeleteDocFromES(docId); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// purgeDocumentFiles 删除文档内容文件与历史版本文件
+func purgeDocumentFiles(docIds []int64) {
+	for _, docId := range docIds {
+		strDocId := strconv.FormatInt(docId, 10)
+		deleteDocumentFile(strDocId)
+		deleteDocumentVersionFiles(strDocId)
+	}
+}
+
+func trashItemToMap(item models.TrashItem) map[string]interface{} {
+	return map[string]interface{}{
+		"trash_id":   strconv.FormatInt(item.ID, 10),
+		"item_type":  item.ItemType,
+		"item_id":    strconv.FormatInt(item.ItemID, 10),
+		"title":      item.Title,
+		"kb_id":      strconv.FormatInt(item.KnowledgeBaseID, 10),
+		"deleted_at": item.DeletedAt,
+		"expire_at":  item.ExpireAt,
+	}
+}
+
+// getOwnTrashItem 解析 trash_id 并确认条目属于当前用户
+func (tc *TrashController) getOwnTrashItem(c *gin.Context) (*models.TrashItem, bool) {
+	userId, exists := c.Get("userid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未授权"})
+		return nil, false
+	}
+	trashId, err := strconv.ParseInt(c.Param("trash_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "错误的回收站条目ID"})
+		return nil, false
+	}
+	item, err := tc.trashDao.GetTrashItemByID(trashId)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，请稍后再试"})
+		return nil, false
+	}
+	if item == nil || item.OwnerID != userId.(int64) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "回收站条目不存在"})
+		return nil, false
+	}
+	return item, true
+}
+
+// GetTrashListHandler 获取当前用户回收站中的条目
+func (tc *TrashController) GetTrashListHandler(c *gin.Context) {
+	userId, exists := c.Get("userid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未授权"})
+		return
+	}
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if err != nil || pageSize <= 0 {
+		pageSize = 20
+	}
+	items, total, err := tc.trashDao.GetTrashItemsByOwner(userId.(int64), page, pageSize)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，获取回收站失败"})
+		return
+	}
+	var itemList []map[string]interface{}
+	for _, item := range items {
+		itemList = append(itemList, trashItemToMap(item))
+	}
+	c.JSON(http.StatusOK, gin.H{"trash_list": itemList, "total": total})
+}
+
+// RestoreTrashItemHandler 从回收站恢复文档或知识库，并重新写入 ES
+func (tc *TrashController) RestoreTrashItemHandler(c *gin.Context) {
+	item, ok := tc.getOwnTrashItem(c)
+	if !ok {
+		return
+	}
+
+	// 恢复同样受所有者套餐的知识库与文档数量配额限制，统计与恢复在同一个事务中完成
+	plan, quota, ok := tc.quota.ownerQuota(c, item.OwnerID)
+	if !ok {
+		return
+	}
+	var quotaErr *dao.QuotaExceededError
+	var restoredDocs []models.Document
+	switch item.ItemType {
+	case models.TrashItemDocument:
+		docs, err := tc.trashDao.RestoreDocument(item, quota.MaxDocumentsPerKB)
+		if errors.Is(err, dao.ErrTrashKnowledgeBaseDeleted) {
+			c.JSON(http.StatusConflict, gin.H{"error": "文档所属的知识库也在回收站中，请先恢复知识库"})
+			return
+		}
+		if errors.As(err, &quotaErr) {
+			documentQuotaExceeded(c, item.OwnerID, plan, quota, quotaErr.Used)
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，恢复失败"})
+			return
+		}
+		restoredDocs = docs
+	case models.TrashItemKnowledgeBase:
+		kb, docs, err := tc.trashDao.RestoreKnowledgeBase(item, quota.MaxKnowledgeBases)
+		if errors.As(err, &quotaErr) {
+			knowledgeBaseQuotaExceeded(c, item.OwnerID, plan, quota, quotaErr.Used)
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，恢复失败"})
+			return
+		}
+		if err := tc.kbDao.InsertKBToEs(*kb); err != nil {
+			log.Println(err)
+		}
+		restoredDocs = docs
+	}
+	recordAudit(c, models.AuditTrashRestore, models.AuditTargetTrash, item.ID, models.AuditResultSuccess, trashAuditDetail(item))
+
+	// 重新建立文档索引
+	for _, doc := range restoredDocs {
+		content, err := getDocumentContentById(strconv.FormatInt(doc.ID, 10))
+		if err != nil {
+			continue
+		}
+		if err := tc.docDao.InsertDocToES(doc, content); err != nil {
+			log.Println(err)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "恢复成功",
+		"item_type":      item.ItemType,
+		"item_id":        strconv.FormatInt(item.ItemID, 10),
+		"restored_count": len(restoredDocs),
+	})
+}
+
+// trashAuditDetail 回收站条目在审计日志中的说明
+func trashAuditDetail(item *models.TrashItem) string {
+	return "item_type=" + item.ItemType + " item_id=" + strconv.FormatInt(item.ItemID, 10)
+}
+
+// purgeTrashItem 彻底删除回收站条目及其内容文件、评论缓存与内容哈希
+func (tc *TrashController) purgeTrashItem(item *models.TrashItem) error {
+	var docIds, rootCommentIds []int64
+	var err error
+	switch item.ItemType {
+	case models.TrashItemDocument:
+		docIds, rootCommentIds, err = tc.trashDao.PurgeDocument(item)
+	case models.TrashItemKnowledgeBase:
+		docIds, rootCommentIds, err = tc.trashDao.PurgeKnowledgeBase(item)
+	}
+	if err != nil {
+		return err
+	}
+	purgeDocumentFiles(docIds)
+	// 数据库记录已删除，缓存清理失败只记录日志
+	if err := tc.commentDao.DeleteCommentCache(docIds, rootCommentIds); err != nil {
+		log.Println(err)
+	}
+	if err := tc.docDao.DeleteDocumentContentHashes(docIds); err != nil {
+		log.Println(err)
+	}
+	return nil
+}
+
+// PurgeTrashItemHandler 彻底删除回收站中的某个条目
+func (tc *TrashController) PurgeTrashItemHandler(c *gin.Context) {
+	item, ok := tc.getOwnTrashItem(c)
+	if !ok {
+		return
+	}
+	if err := tc.purgeTrashItem(item); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，删除失败"})
+		return
+	}
+	recordAudit(c, models.AuditTrashPurge, models.AuditTargetTrash, item.ID, models.AuditResultSuccess, trashAuditDetail(item))
+	c.JSON(http.StatusOK, gin.H{"message": "已彻底删除"})
+}
+
+// EmptyTrashHandler 清空当前用户的回收站
+func (tc *TrashController) EmptyTrashHandler(c *gin.Context) {
+	userId, exists := c.Get("userid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未授权"})
+		return
+	}
+	purged := 0
+	for {
+		items, _, err := tc.trashDao.GetTrashItemsByOwner(userId.(int64), 1, 100)
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，清空回收站失败"})
+			return
+		}
+		if len(items) == 0 {
+			break
+		}
+		for i := range items {
+			if err := tc.purgeTrashItem(&items[i]); err != nil {
+				log.Println(err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误，清空回收站失败"})
+				return
+			}
+			recordAudit(c, models.AuditTrashPurge, models.AuditTargetTrash, items[i].ID, models.AuditResultSuccess, trashAuditDetail(&items[i]))
+			purged++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "回收站已清空", "purged_count": purged})
+}
+
+// PurgeExpiredItems 彻底删除所有超过保留期限的回收站条目
+func (tc *TrashController) PurgeExpiredItems() {
+	// 本轮跳过失败的条目，下一轮再试，既不阻塞其他条目也不会死循环
+	var failed []int64
+	for {
+		items, err := tc.trashDao.GetExpiredTrashItems(time.Now(), 100, failed)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if len(items) == 0 {
+			return
+		}
+		purged := 0
+		for i := range items {
+			if err := tc.purgeTrashItem(&items[i]); err != nil {
+				log.Printf("清理回收站条目 %d 失败: %v", items[i].ID, err)
+				failed = append(failed, items[i].ID)
+				continue
+			}
+			purged++
+		}
+		log.Printf("已清理 %d 个过期的回收站条目", purged)
+	}
+}
+
+// RunTrashSweeper 后台定期清理过期的回收站条目，ctx 取消后在当前一轮结束后返回
+func (tc *TrashController) RunTrashSweeper(ctx context.Context) {
+	ticker := time.NewTicker(config.GetTrashSweepInterval())
+	defer ticker.Stop()
+	for {
+		tc.PurgeExpiredItems()
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"time"
+	"yuqueppbackend/service-base/config"
+	"yuqueppbackend/service-base/dao"
+	"yuqueppbackend/service-base/models"
+	"yuqueppbackend/service-base/util"
+)
+
+// 启用两步验证或重新生成时发放的恢复码数量
+const recoveryCodeCount = 10
+
+type TwoFactorController struct {
+	recoveryDao *dao.RecoveryCodeDAO
+}
+
+func NewTwoFactorController(recoveryDao *dao.RecoveryCodeDAO) *TwoFactorController {
+	return &TwoFactorController{recoveryDao: recoveryDao}
+}
+
+// secondFactor 已通过校验、尚未消耗的 TOTP 时间窗口或恢复码
+type secondFactor struct {
+	totpStep     int64
+	recoveryHash string // 非空表示使用的是恢复码
+}
+
+// checkSecondFactor 校验 TOTP 验证码或恢复码但不消耗，未通过时返回 nil。
+// 需要先完成其他一次性校验（挑战令牌、邮件令牌）的场景，在其成功后再调用 useSecondFactor
+func (tc *TwoFactorController) checkSecondFactor(user *models.User, code string) (*secondFactor, error) {
+	if step, ok := util.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		used, err := util.IsTOTPStepUsed(user.ID, step)
+		if err != nil || used {
+			return nil, err
+		}
+		return &secondFactor{totpStep: step}, nil
+	}
+	codeHash := util.HashContent([]byte(util.NormalizeRecoveryCode(code)))
+	exists, err := tc.recoveryDao.HasUnusedRecoveryCode(user.ID, codeHash)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return &secondFactor{recoveryHash: codeHash}, nil
+}
+
+// useSecondFactor 消耗已通过校验的第二因素，同一个验证码或恢复码只能使用一次，并发使用时只有一个请求返回 true
+func (tc *TwoFactorController) useSecondFactor(userId int64, factor *secondFactor) (bool, error) {
+	if factor.recoveryHash != "" {
+		return tc.recoveryDao.UseRecoveryCode(userId, factor.recoveryHash)
+	}
+	return util.MarkTOTPStepUsed(userId, factor.totpStep)
+}
+
+// verifySecondFactor 校验并消耗 TOTP 验证码或恢复码，返回是否通过以及是否使用了恢复码
+func (tc *TwoFactorController) verifySecondFactor(user *models.User, code string) (bool, bool, error) {
+	factor, err := tc.checkSecondFactor(user, code)
+	if err != nil || factor == nil {
+		return false, false, err
+	}
+	used, err := tc.useSecondFactor(user.ID, factor)
+	return used, used && factor.recoveryHash != "", err
+}
+
+// issueRecoveryCodes 生成并保存一组新的恢复码，旧的恢复码全部作废
+func (tc *TwoFactorController) issueRecoveryCodes(userId int64) ([]string, error) {
+	codes, err := util.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = util.HashContent([]byte(code))
+	}
+	if err := tc.recoveryDao.ReplaceRecoveryCodes(userId, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// currentUser 获取当前登录用户，失败时已写入响应
+func currentUser(c *gin.Context) (*models.User, bool) {
+	user, err := userDao.GetUserByID(c.GetInt64("userid"))
+	if err != nil || user == nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return nil, false
+	}
+	return user, true
+}
+
+// GetTOTPStatus 获取当前用户的两步验证状态
+func (tc *TwoFactorController) GetTOTPStatus(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	remaining, err := tc.recoveryDao.CountUnusedRecoveryCodes(user.ID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"totp_enabled":             user.TOTPEnabled,
+		"totp_enabled_at":          user.TOTPEnabledAt,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// EnrollTOTP 生成新的两步验证密钥，返回 provisioning URI 与二维码，需要调用 ConfirmTOTP 确认后才会启用
+func (tc *TwoFactorController) EnrollTOTP(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "已启用两步验证"})
+		return
+	}
+	secret, err := util.GenerateTOTPSecret()
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if err := userDao.SetTOTPSecret(user.ID, secret); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	uri := util.TOTPProvisioningURI(config.GetTOTPIssuer(), user.Email, secret)
+	qrCode, err := util.TOTPQRCode(uri)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"secret": secret, "provisioning_uri": uri, "qr_code": qrCode})
+}
+
+// ConfirmTOTP 使用验证器应用生成的验证码确认启用两步验证，成功后返回恢复码（只展示这一次）
+func (tc *TwoFactorController) ConfirmTOTP(c *gin.Context) {
+	var contextData struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入验证码"})
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "已启用两步验证"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请先获取两步验证密钥"})
+		return
+	}
+	step, valid := util.ValidateTOTP(user.TOTPSecret, contextData.Code, time.Now())
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "验证码错误"})
+		return
+	}
+	if _, err := util.MarkTOTPStepUsed(user.ID, step); err != nil {
+		log.Println(err)
+	}
+	codes, err := tc.issueRecoveryCodes(user.ID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if err := userDao.EnableTOTP(user.ID); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "两步验证已启用，请妥善保存恢复码", "recovery_codes": codes})
+}
+
+// SendDisableTOTPEmail 发送确认关闭两步验证的邮件，通过单点登录注册、不知道密码的用户使用邮件中的令牌关闭
+func (tc *TwoFactorController) SendDisableTOTPEmail(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "尚未启用两步验证"})
+		return
+	}
+	allowed, err := util.AllowEmailSend(util.EmailTokenDisableTOTP, user.ID, emailSendCooldown)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "发送过于频繁，请稍后再试"})
+		return
+	}
+	if err := sendDisableTOTPEmail(user); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "邮件发送失败，请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "确认邮件已发送，请通过邮件中的链接关闭两步验证"})
+}
+
+// DisableTOTP 关闭两步验证，需要提供验证码（或恢复码），以及当前密码或确认邮件中的令牌
+func (tc *TwoFactorController) DisableTOTP(c *gin.Context) {
+	var contextData struct {
+		Password string `json:"password"`
+		Token    string `json:"token"` // 确认邮件中的令牌，没有设置密码的用户使用
+		Code     string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil || (contextData.Password == "" && contextData.Token == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入密码与验证码，未设置密码时请通过确认邮件关闭两步验证"})
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "尚未启用两步验证"})
+		return
+	}
+	if contextData.Token == "" {
+		if valid, _ := util.VerifyStoredPassword(user.Password, contextData.Password); !valid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "密码错误"})
+			return
+		}
+	}
+	// 先校验验证码，通过后才消耗邮件令牌，输错验证码时不必重新发送邮件
+	factor, err := tc.checkSecondFactor(user, contextData.Code)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if factor == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "验证码错误"})
+		return
+	}
+	if contextData.Token != "" {
+		userId, err := util.ConsumeEmailToken(util.EmailTokenDisableTOTP, contextData.Token)
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+			return
+		}
+		if userId != user.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "确认链接无效或已过期"})
+			return
+		}
+	}
+	used, err := tc.useSecondFactor(user.ID, factor)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if !used {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "验证码错误"})
+		return
+	}
+	if err := userDao.DisableTOTP(user.ID); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if err := tc.recoveryDao.DeleteRecoveryCodes(user.ID); err != nil {
+		log.Println(err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "两步验证已关闭"})
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，原有恢复码全部失效
+func (tc *TwoFactorController) RegenerateRecoveryCodes(c *gin.Context) {
+	var contextData struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入验证码"})
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "尚未启用两步验证"})
+		return
+	}
+	valid, _, err := tc.verifySecondFactor(user, contextData.Code)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "验证码错误"})
+		return
+	}
+	codes, err := tc.issueRecoveryCodes(user.ID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// Login2FA 登录的第二步：使用登录返回的挑战令牌与 TOTP 验证码（或恢复码）换取访问令牌
+func (tc *TwoFactorController) Login2FA(c *gin.Context) {
+	var contextData struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		Code           string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入验证码"})
+		return
+	}
+	userId, err := util.AttemptLoginChallenge(contextData.ChallengeToken)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if userId == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "验证已过期，请重新登录"})
+		return
+	}
+	user, err := userDao.GetUserByID(userId)
+	if err != nil || user == nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if rejectDisabledUser(c, user) {
+		return
+	}
+	if !checkLoginAllowed(c, user.Email) {
+		return
+	}
+	// 先只校验不消耗，作废挑战令牌成功后再消耗：并发提交时只有赢得挑战的请求会用掉恢复码
+	factor, err := tc.checkSecondFactor(user, contextData.Code)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if factor == nil {
+		// 两步验证失败同样计入账号的连续失败次数
+		if recordLoginFailure(c, user.Email, loginFailureBad2FA, true) {
+			if _, err := util.ConsumeLoginChallenge(contextData.ChallengeToken); err != nil {
+				log.Println(err)
+			}
+			c.JSON(http.StatusLocked, gin.H{"error": "失败次数过多，账号已被临时锁定，请稍后再试"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "验证码错误"})
+		return
+	}
+	if consumed, err := util.ConsumeLoginChallenge(contextData.ChallengeToken); err != nil || !consumed {
+		log.Println(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "验证已过期，请重新登录"})
+		return
+	}
+	used, err := tc.useSecondFactor(user.ID, factor)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if !used {
+		// 校验之后验证码或恢复码已被其他请求使用，挑战令牌已作废
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "验证码已被使用，请重新登录"})
+		return
+	}
+	usedRecovery := factor.recoveryHash != ""
+	if err := util.ResetLoginFailures(user.Email); err != nil {
+		log.Println(err)
+	}
+	tokens, err := util.CreateSession(user.ID, user.Email, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	method := "totp"
+	if usedRecovery {
+		method = "recovery_code"
+	}
+	recordAuditAs(c, user.ID, user.Email, models.AuditLogin, models.AuditTargetUser, user.ID, models.AuditResultSuccess, method)
+	if usedRecovery {
+		remaining, err := tc.recoveryDao.CountUnusedRecoveryCodes(user.ID)
+		if err != nil {
+			log.Println(err)
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"access_token":             tokens.AccessToken,
+			"refresh_token":            tokens.RefreshToken,
+			"expires_in":               tokens.ExpiresIn,
+			"session_id":               tokens.SessionID,
+			"recovery_codes_remaining": remaining,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
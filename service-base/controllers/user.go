@@ -5,6 +5,8 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"time"
+	"yuqueppbackend/service-base/models"
 	"yuqueppbackend/service-base/util"
 )
 
@@ -22,21 +24,84 @@ func GetUserInfo(c *gin.Context) {
 		contextData.Email = email.(string) // 获取并赋值
 	}
 	user, err := userDao.GetUserByID(contextData.Id)
-	if err != nil {
+	if err != nil || user == nil {
 		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
 	}
-	c.JSON(http.StatusOK, gin.H{"id": strconv.FormatInt(user.ID, 10), "email": user.Email, "nickname": user.Nickname})
+	c.JSON(http.StatusOK, gin.H{
+		"id":                    strconv.FormatInt(user.ID, 10),
+		"email":                 user.Email,
+		"nickname":              user.Nickname,
+		"bio":                   user.Bio,
+		"avatar_url":            avatarURL(user),
+		"registered_at":         user.RegisteredAt,
+		"email_verified":        user.EmailVerified,
+		"deletion_scheduled_at": user.DeletionScheduledAt,
+		"plan":                  user.EffectivePlan(time.Now()),
+		"expiry_at":             user.ExpiryAt,
+	})
 }
 
 func Logout(c *gin.Context) {
-	// 从上下文中获取数据
-	if email, exists := c.Get("email"); exists {
-		err := util.DeleteJWT(email.(string))
+	// 只注销当前设备的会话，其他设备不受影响
+	if sessionId, exists := c.Get("session_id"); exists {
+		_, err := util.RevokeSession(c.GetInt64("userid"), sessionId.(string))
 		if err != nil {
+			log.Println(err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
 			return
 		}
 	}
-	c.JSON(http.StatusOK, gin.H{"error": "系统错误请稍后再试"})
+	recordAudit(c, models.AuditLogout, models.AuditTargetUser, c.GetInt64("userid"), models.AuditResultSuccess, "")
+	c.JSON(http.StatusOK, gin.H{"message": "已退出登录"})
+}
+
+// ChangePassword 修改密码，需要提供旧密码；修改成功后所有设备的登录状态失效，需要重新登录
+func ChangePassword(c *gin.Context) {
+	var contextData struct {
+		OldPassword string `json:"old_password" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&contextData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入旧密码与新密码"})
+		return
+	}
+	if len(contextData.NewPassword) < 8 || len(contextData.NewPassword) > 72 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "新密码长度需要在 8 到 72 个字节之间"})
+		return
+	}
+	userId, exists := c.Get("userid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未授权"})
+		return
+	}
+	user, err := userDao.GetUserByID(userId.(int64))
+	if err != nil || user == nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if ok, _ := util.VerifyStoredPassword(user.Password, contextData.OldPassword); !ok {
+		recordAudit(c, models.AuditChangePassword, models.AuditTargetUser, user.ID, models.AuditResultFailure, "bad_old_password")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "旧密码错误"})
+		return
+	}
+	hash, err := util.HashPassword(contextData.NewPassword)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	if err := userDao.UpdatePassword(user.ID, hash); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "系统错误请稍后再试"})
+		return
+	}
+	// 密码修改后撤销全部设备上的会话
+	if err := util.RevokeAllSessions(user.ID); err != nil {
+		log.Println(err)
+	}
+	recordAudit(c, models.AuditChangePassword, models.AuditTargetUser, user.ID, models.AuditResultSuccess, "")
+	c.JSON(http.StatusOK, gin.H{"message": "密码修改成功，请重新登录"})
 }
@@ -0,0 +1,164 @@
+package dao
+
+import (
+	"gorm.io/gorm"
+	"strconv"
+	"time"
+	"yuqueppbackend/service-base/models"
+)
+
+// AccountDAO 处理个人数据导出与账号注销相关的数据库操作
+type AccountDAO struct {
+	db *gorm.DB
+}
+
+// NewAccountDAO 创建一个新的 AccountDAO 实例
+func NewAccountDAO(db *gorm.DB) *AccountDAO {
+	return &AccountDAO{db: db}
+}
+
+// SetDeletionScheduledAt 设置计划注销的时间，为 nil 表示撤销注销申请
+func (dao *AccountDAO) SetDeletionScheduledAt(userID int64, scheduledAt *time.Time) error {
+	return dao.db.Model(&models.User{}).Where("id = ? AND account_deleted_at IS NULL", userID).
+		Update("deletion_scheduled_at", scheduledAt).Error
+}
+
+// GetUsersDueForDeletion 获取宽限期已满、等待注销的用户，excludeIDs 中的用户不返回
+func (dao *AccountDAO) GetUsersDueForDeletion(now time.Time, limit int, excludeIDs []int64) ([]models.User, error) {
+	var users []models.User
+	query := dao.db.Where("deletion_scheduled_at <= ? AND account_deleted_at IS NULL", now)
+	if len(excludeIDs) > 0 {
+		query = query.Where("id NOT IN ?", excludeIDs)
+	}
+	err := query.Order("deletion_scheduled_at ASC").Limit(limit).Find(&users).Error
+	return users, err
+}
+
+// GetCommentsByUserID 获取用户以自己名义发表的全部评论（不含通过其分享链接发表的匿名评论），按时间正序
+func (dao *AccountDAO) GetCommentsByUserID(userID int64) ([]models.DocumentComment, error) {
+	var comments []models.DocumentComment
+	err := dao.db.Where("user_id = ? AND is_anonymous = ?", userID, false).
+		Order("created_at ASC").Find(&comments).Error
+	return comments, err
+}
+
+// GetOwnedKnowledgeBaseIDs 获取用户拥有的全部知识库 ID，包括回收站中的知识库
+func (dao *AccountDAO) GetOwnedKnowledgeBaseIDs(userID int64) ([]int64, error) {
+	var ids []int64
+	err := dao.db.Unscoped().Model(&models.KnowledgeBase{}).Where("owner_id = ?", userID).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// GetDocumentIDsByKnowledgeBaseIDs 获取知识库中的全部文档 ID，包括回收站中的文档
+func (dao *AccountDAO) GetDocumentIDsByKnowledgeBaseIDs(kbIDs []int64) ([]int64, error) {
+	var ids []int64
+	if len(kbIDs) == 0 {
+		return ids, nil
+	}
+	err := dao.db.Unscoped().Model(&models.Document{}).Where("knowledge_base_id IN ?", kbIDs).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// GetRootCommentIDsByDocumentIDs 获取文档下全部顶级评论的 ID，用于清理回复缓存
+func (dao *AccountDAO) GetRootCommentIDsByDocumentIDs(docIDs []int64) ([]int64, error) {
+	var ids []int64
+	if len(docIDs) == 0 {
+		return ids, nil
+	}
+	err := dao.db.Model(&models.DocumentComment{}).Where("document_id IN ? AND root_id IS NULL", docIDs).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// PurgeAccount 在一个事务中删除用户拥有的知识库（kbIDs）及其文档（docIDs）、评论、历史版本、分享链接与回收站条目，
+// 删除用户的成员关系、访问令牌、恢复码、外部身份与登录失败记录。
+// 用户在他人知识库中留下的文档、历史版本与评论通过外键引用用户，因此用户记录不删除，而是匿名化后保留；
+// 这些评论的内容被清空并标记为已删除；用户的审计日志同样保留，其中的邮箱、IP 与设备信息被清除
+func (dao *AccountDAO) PurgeAccount(user *models.User, kbIDs, docIDs []int64, now time.Time) error {
+	return dao.db.Transaction(func(tx *gorm.DB) error {
+		if len(docIDs) > 0 {
+			// 先解除评论与文档的自引用，避免批量删除时触发外键约束
+			if err := tx.Model(&models.DocumentComment{}).Where("document_id IN ?", docIDs).
+				Updates(map[string]interface{}{"parent_id": nil, "root_id": nil}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("document_id IN ?", docIDs).Delete(&models.DocumentComment{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("document_id IN ?", docIDs).Delete(&models.DocumentVersion{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("document_id IN ?", docIDs).Delete(&models.DocumentShareLink{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("item_type = ? AND item_id IN ?", models.TrashItemDocument, docIDs).Delete(&models.TrashItem{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Model(&models.Document{}).Where("id IN ?", docIDs).Update("parent_id", nil).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Where("id IN ?", docIDs).Delete(&models.Document{}).Error; err != nil {
+				return err
+			}
+		}
+		if len(kbIDs) > 0 {
+			if err := tx.Where("knowledge_base_id IN ?", kbIDs).Delete(&models.KnowledgeBaseMember{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("item_type = ? AND item_id IN ?", models.TrashItemKnowledgeBase, kbIDs).Delete(&models.TrashItem{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Where("id IN ?", kbIDs).Delete(&models.KnowledgeBase{}).Error; err != nil {
+				return err
+			}
+		}
+
+		// 在他人文档下发表的评论保留楼层结构，只清空内容
+		if err := tx.Model(&models.DocumentComment{}).Where("user_id = ? AND is_anonymous = ?", user.ID, false).
+			Updates(map[string]interface{}{"content": "", "is_deleted": true}).Error; err != nil {
+			return err
+		}
+		for _, model := range []interface{}{
+			&models.KnowledgeBaseMember{},
+			&models.PersonalAccessToken{},
+			&models.UserRecoveryCode{},
+			&models.UserIdentity{},
+		} {
+			if err := tx.Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("owner_id = ?", user.ID).Delete(&models.DocumentShareLink{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? OR email = ?", user.ID, user.Email).Delete(&models.LoginAttempt{}).Error; err != nil {
+			return err
+		}
+
+		// 审计日志保留操作记录，但清除其中的邮箱、IP 与设备信息
+		anonymousEmail := "deleted-" + strconv.FormatInt(user.ID, 10) + "@deleted.invalid"
+		if err := tx.Model(&models.AuditLog{}).Where("actor_id = ? OR actor_email = ?", user.ID, user.Email).
+			Updates(map[string]interface{}{"actor_email": anonymousEmail, "ip": "", "user_agent": ""}).Error; err != nil {
+			return err
+		}
+
+		// 匿名化用户记录，原邮箱随即可以重新注册
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"email":                 anonymousEmail,
+			"nickname":              "已注销用户",
+			"password":              "",
+			"bio":                   "",
+			"avatar_updated_at":     nil,
+			"email_verified":        false,
+			"email_verified_at":     nil,
+			"totp_secret":           "",
+			"totp_enabled":          false,
+			"totp_enabled_at":       nil,
+			"plan":                  models.PlanFree,
+			"role":                  models.UserRoleUser,
+			"disabled_at":           now,
+			"disabled_reason":       "账号已注销",
+			"deletion_scheduled_at": nil,
+			"account_deleted_at":    now,
+		}).Error
+	})
+}
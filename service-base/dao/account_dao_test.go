@@ -0,0 +1,41 @@
+package dao
+
+import (
+	"testing"
+	"time"
+	"yuqueppbackend/service-base/models"
+)
+
+// 注销后审计日志保留，但不再包含用户的邮箱、IP 与设备信息
+func TestPurgeAccountAnonymizesAuditLogs(t *testing.T) {
+	db := useTestDB(t)
+	user := createTestUser(t, db)
+	logs := []models.AuditLog{
+		{ActorID: user.ID, ActorEmail: user.Email, Action: models.AuditLogin, IP: "10.0.0.1", UserAgent: "ua", Result: models.AuditResultSuccess},
+		// 登录失败时尚不知道用户 ID，只记录了邮箱
+		{ActorEmail: user.Email, Action: models.AuditLogin, IP: "10.0.0.2", UserAgent: "ua", Result: models.AuditResultFailure},
+		{ActorEmail: "other-" + user.Email, Action: models.AuditLogin, IP: "10.0.0.3", UserAgent: "ua", Result: models.AuditResultFailure},
+	}
+	if err := NewAuditLogDAO(db).CreateAuditLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, entry := range logs {
+			db.Delete(&models.AuditLog{}, entry.ID)
+		}
+	})
+
+	if err := NewAccountDAO(db).PurgeAccount(user, nil, nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	for i, entry := range logs {
+		var got models.AuditLog
+		if err := db.First(&got, entry.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		anonymized := got.ActorEmail != entry.ActorEmail && got.IP == "" && got.UserAgent == ""
+		if want := i < 2; anonymized != want {
+			t.Errorf("log %d: email=%q ip=%q, anonymized=%v want %v", i, got.ActorEmail, got.IP, anonymized, want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package dao
+
+import (
+	"gorm.io/gorm"
+	"time"
+	"yuqueppbackend/service-base/models"
+)
+
+// AdminDAO 管理后台的检索与统计
+type AdminDAO struct {
+	db *gorm.DB
+}
+
+// NewAdminDAO 创建一个新的 AdminDAO 实例
+func NewAdminDAO(db *gorm.DB) *AdminDAO {
+	return &AdminDAO{db: db}
+}
+
+// UserFilter 用户检索条件，为空的条件不参与过滤
+type UserFilter struct {
+	Keyword string // 匹配邮箱或昵称
+	Role    string
+	Status  string // active 或 disabled
+}
+
+// SearchUsers 按条件分页检索用户，按注册时间倒序
+func (dao *AdminDAO) SearchUsers(filter UserFilter, page, pageSize int) ([]models.User, int64, error) {
+	scope := func(db *gorm.DB) *gorm.DB {
+		if filter.Keyword != "" {
+			like := "%" + filter.Keyword + "%"
+			db = db.Where("email LIKE ? OR nickname LIKE ?", like, like)
+		}
+		if filter.Role != "" {
+			db = db.Where("role = ?", filter.Role)
+		}
+		switch filter.Status {
+		case "active":
+			db = db.Where("disabled_at IS NULL")
+		case "disabled":
+			db = db.Where("disabled_at IS NOT NULL")
+		}
+		return db
+	}
+	var users []models.User
+	var total int64
+	if err := dao.db.Model(&models.User{}).Scopes(scope).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := dao.db.Scopes(scope).Order("registered_at DESC").
+		Limit(pageSize).Offset((page - 1) * pageSize).Find(&users).Error
+	return users, total, err
+}
+
+// SearchKnowledgeBases 按名称与所有者分页检索知识库，按更新时间倒序
+func (dao *AdminDAO) SearchKnowledgeBases(keyword string, ownerID int64, page, pageSize int) ([]models.KnowledgeBase, int64, error) {
+	scope := func(db *gorm.DB) *gorm.DB {
+		if keyword != "" {
+			db = db.Where("name LIKE ?", "%"+keyword+"%")
+		}
+		if ownerID != 0 {
+			db = db.Where("owner_id = ?", ownerID)
+		}
+		return db
+	}
+	var kbs []models.KnowledgeBase
+	var total int64
+	if err := dao.db.Model(&models.KnowledgeBase{}).Scopes(scope).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := dao.db.Preload("User").Scopes(scope).Order("updated_at DESC").
+		Limit(pageSize).Offset((page - 1) * pageSize).Find(&kbs).Error
+	return kbs, total, err
+}
+
+// SearchComments 按文档与用户分页检索评论（包含已删除与已下架的评论），按创建时间倒序
+func (dao *AdminDAO) SearchComments(documentID, userID int64, page, pageSize int) ([]models.DocumentComment, int64, error) {
+	scope := func(db *gorm.DB) *gorm.DB {
+		if documentID != 0 {
+			db = db.Where("document_id = ?", documentID)
+		}
+		if userID != 0 {
+			db = db.Where("user_id = ?", userID)
+		}
+		return db
+	}
+	var comments []models.DocumentComment
+	var total int64
+	if err := dao.db.Model(&models.DocumentComment{}).Scopes(scope).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := dao.db.Preload("User").Scopes(scope).Order("created_at DESC").
+		Limit(pageSize).Offset((page - 1) * pageSize).Find(&comments).Error
+	return comments, total, err
+}
+
+// SystemStats 全站统计数据
+type SystemStats struct {
+	Users            int64            `json:"users"`
+	ActiveUsers      int64            `json:"active_users_30d"` // 近 30 天登录过的用户
+	NewUsers         int64            `json:"new_users_7d"`     // 近 7 天注册的用户
+	DisabledUsers    int64            `json:"disabled_users"`
+	Admins           int64            `json:"admins"`
+	UsersByPlan      map[string]int64 `json:"users_by_plan"` // 按当前生效的套餐统计
+	KnowledgeBases   int64            `json:"knowledge_bases"`
+	PublicKBs        int64            `json:"public_knowledge_bases"`
+	Documents        int64            `json:"documents"`
+	Comments         int64            `json:"comments"`
+	TakenDown        int64            `json:"taken_down_comments"`
+	DocumentVersions int64            `json:"document_versions"`
+	StorageBytes     int64            `json:"storage_bytes"`
+}
+
+// GetSystemStats 统计全站的用户、知识库、文档、评论数量与存储用量
+func (dao *AdminDAO) GetSystemStats() (*SystemStats, error) {
+	now := time.Now()
+	stats := &SystemStats{UsersByPlan: make(map[string]int64)}
+	counts := []struct {
+		model interface{}
+		query string
+		args  []interface{}
+		dest  *int64
+	}{
+		{&models.User{}, "", nil, &stats.Users},
+		{&models.User{}, "last_login_at >= ?", []interface{}{now.AddDate(0, 0, -30)}, &stats.ActiveUsers},
+		{&models.User{}, "registered_at >= ?", []interface{}{now.AddDate(0, 0, -7)}, &stats.NewUsers},
+		{&models.User{}, "disabled_at IS NOT NULL", nil, &stats.DisabledUsers},
+		{&models.User{}, "role = ?", []interface{}{models.UserRoleAdmin}, &stats.Admins},
+		{&models.KnowledgeBase{}, "", nil, &stats.KnowledgeBases},
+		{&models.KnowledgeBase{}, "is_public = ?", []interface{}{true}, &stats.PublicKBs},
+		{&models.Document{}, "", nil, &stats.Documents},
+		{&models.DocumentComment{}, "is_deleted = ? AND status <> ?", []interface{}{false, models.CommentStatusTakenDown}, &stats.Comments},
+		{&models.DocumentComment{}, "status = ?", []interface{}{models.CommentStatusTakenDown}, &stats.TakenDown},
+		{&models.DocumentVersion{}, "", nil, &stats.DocumentVersions},
+	}
+	for _, count := range counts {
+		db := dao.db.Model(count.model)
+		if count.query != "" {
+			db = db.Where(count.query, count.args...)
+		}
+		if err := db.Count(count.dest).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// 付费套餐到期后按 free 统计
+	var planCounts []struct {
+		Plan  string
+		Total int64
+	}
+	if err := dao.db.Model(&models.User{}).Select("plan, COUNT(*) AS total").
+		Where("plan <> ? AND expiry_at > ?", models.PlanFree, now).Group("plan").Scan(&planCounts).Error; err != nil {
+		return nil, err
+	}
+	paid := int64(0)
+	for _, planCount := range planCounts {
+		stats.UsersByPlan[planCount.Plan] = planCount.Total
+		paid += planCount.Total
+	}
+	stats.UsersByPlan[models.PlanFree] = stats.Users - paid
+
+	if err := dao.db.Model(&models.DocumentVersion{}).
+		Select("COALESCE(SUM(content_size), 0)").Scan(&stats.StorageBytes).Error; err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
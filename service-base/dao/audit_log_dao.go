@@ -0,0 +1,104 @@
+package dao
+
+import (
+	"gorm.io/gorm"
+	"time"
+	"yuqueppbackend/service-base/models"
+)
+
+// AuditLogDAO 审计日志的写入与查询，只提供追加写入，不提供修改与删除
+type AuditLogDAO struct {
+	db *gorm.DB
+}
+
+// NewAuditLogDAO 创建一个新的 AuditLogDAO 实例
+func NewAuditLogDAO(db *gorm.DB) *AuditLogDAO {
+	return &AuditLogDAO{db: db}
+}
+
+// AuditLogFilter 审计日志检索条件，为空的条件不参与过滤
+type AuditLogFilter struct {
+	ActorID    int64
+	Action     string
+	TargetType string
+	TargetID   string
+	Result     string
+	IP         string
+	Start      *time.Time
+	End        *time.Time
+}
+
+func (filter AuditLogFilter) scope(db *gorm.DB) *gorm.DB {
+	if filter.ActorID != 0 {
+		db = db.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Action != "" {
+		db = db.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		db = db.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		db = db.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.Result != "" {
+		db = db.Where("result = ?", filter.Result)
+	}
+	if filter.IP != "" {
+		db = db.Where("ip = ?", filter.IP)
+	}
+	if filter.Start != nil {
+		db = db.Where("created_at >= ?", *filter.Start)
+	}
+	if filter.End != nil {
+		db = db.Where("created_at < ?", *filter.End)
+	}
+	return db
+}
+
+// CreateAuditLogs 批量写入审计事件
+func (dao *AuditLogDAO) CreateAuditLogs(logs []models.AuditLog) error {
+	return dao.db.CreateInBatches(logs, 100).Error
+}
+
+// GetAuditLogs 按条件分页获取审计事件，按时间倒序
+func (dao *AuditLogDAO) GetAuditLogs(filter AuditLogFilter, page, pageSize int) ([]models.AuditLog, int64, error) {
+	var total int64
+	if err := dao.db.Model(&models.AuditLog{}).Scopes(filter.scope).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var logs []models.AuditLog
+	err := dao.db.Scopes(filter.scope).Order("created_at DESC, id DESC").
+		Offset((page - 1) * pageSize).Limit(pageSize).Find(&logs).Error
+	return logs, total, err
+}
+
+// EachAuditLogs 按时间正序分批遍历符合条件的审计事件，用于导出，避免一次性加载到内存。
+// fn 返回错误时停止遍历
+func (dao *AuditLogDAO) EachAuditLogs(filter AuditLogFilter, batchSize int, fn func([]models.AuditLog) error) error {
+	var batch []models.AuditLog
+	var lastCreatedAt time.Time
+	var lastID int64
+	for first := true; ; first = false {
+		query := dao.db.Scopes(filter.scope)
+		if !first {
+			// 按 (created_at, id) 做游标分页，数据量大时比 OFFSET 更快
+			query = query.Where("(created_at > ? OR (created_at = ? AND id > ?))", lastCreatedAt, lastCreatedAt, lastID)
+		}
+		batch = batch[:0]
+		if err := query.Order("created_at ASC, id ASC").Limit(batchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+		last := batch[len(batch)-1]
+		lastCreatedAt, lastID = last.CreatedAt, last.ID
+	}
+}
@@ -56,6 +56,7 @@ func (dao *CommentDAO) GetRootCommentsByDocumentID(documentID int64, page, pageS
 	if err := dao.db.Preload("User").
 		Where("document_id = ?", documentID).
 		Where("parent_id IS NULL").
+		Where("status <> ?", models.CommentStatusTakenDown).
 		Limit(pageSize).Offset(offset).
 		Order("created_at DESC").Find(&comments).Error; err != nil {
 		return nil, 0, err
@@ -63,6 +64,49 @@ func (dao *CommentDAO) GetRootCommentsByDocumentID(documentID int64, page, pageS
 	return comments, total, nil
 }
 
+// publishedComments 只查询已发布且未删除的评论
+func publishedComments(db *gorm.DB) *gorm.DB {
+	return db.Where("status = ? AND is_deleted = ?", models.CommentStatusPublished, false)
+}
+
+// GetPublishedRootComments 获取某文档下已发布且未删除的顶级评论（支持分页）
+func (dao *CommentDAO) GetPublishedRootComments(documentID int64, page, pageSize int) ([]models.DocumentComment, int64, error) {
+	var comments []models.DocumentComment
+	var total int64
+	if err := dao.db.Model(&models.DocumentComment{}).Scopes(publishedComments).
+		Where("document_id = ? AND parent_id IS NULL", documentID).
+		Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * pageSize
+	if err := dao.db.Preload("User").Scopes(publishedComments).
+		Where("document_id = ? AND parent_id IS NULL", documentID).
+		Limit(pageSize).Offset(offset).
+		Order("created_at DESC").Find(&comments).Error; err != nil {
+		return nil, 0, err
+	}
+	return comments, total, nil
+}
+
+// GetPublishedRepliesByRootID 获取某个顶级评论下已发布且未删除的回复（按时间正序，支持分页）
+func (dao *CommentDAO) GetPublishedRepliesByRootID(rootID int64, page, pageSize int) ([]models.DocumentComment, int64, error) {
+	var replies []models.DocumentComment
+	var total int64
+	if err := dao.db.Model(&models.DocumentComment{}).Scopes(publishedComments).
+		Where("root_id = ?", rootID).
+		Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * pageSize
+	if err := dao.db.Preload("User").Scopes(publishedComments).
+		Where("root_id = ?", rootID).
+		Limit(pageSize).Offset(offset).
+		Order("created_at ASC").Find(&replies).Error; err != nil {
+		return nil, 0, err
+	}
+	return replies, total, nil
+}
+
 // GetRootCommentsByDocumentID 获取某个顶级评论下的子评论（支持分页）
 func (dao *CommentDAO) GetChildrenCommentsByRootIdFromRedis(rootCommentId int64, page, pageSize int64) ([]map[string]interface{}, error) {
 	key := "rootComment:" + strconv.FormatInt(rootCommentId, 10)
@@ -101,6 +145,57 @@ func (dao *CommentDAO) DeleteCommentByID(commentID int64) error {
 	return nil
 }
 
+// TakeDownComment 下架评论，moderator 记录执行下架的管理员
+func (dao *CommentDAO) TakeDownComment(commentID int64, moderator string) error {
+	return dao.db.Model(&models.DocumentComment{}).Where("id = ?", commentID).
+		Updates(map[string]interface{}{"status": models.CommentStatusTakenDown, "edited_at_by": moderator}).Error
+}
+
+// RemoveCommentFromRedis 从 Redis 的评论缓存中移除评论，顶级评论与回复分别缓存在不同的有序集合中
+func (dao *CommentDAO) RemoveCommentFromRedis(comment models.DocumentComment) error {
+	key := "comment:" + strconv.FormatInt(comment.DocumentID, 10)
+	if comment.RootID != nil {
+		key = "rootComment:" + strconv.FormatInt(*comment.RootID, 10)
+	}
+	rdb := util.GetRedisClient()
+	ctx := context.Background()
+	// 缓存的成员是 JSON，只能按创建时间定位后逐个比较评论 ID
+	score := strconv.FormatInt(comment.CreatedAt.Unix(), 10)
+	members, err := rdb.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: score, Max: score}).Result()
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		var cached struct {
+			CommentID int64 `json:"comment_id"`
+		}
+		if err := json.Unmarshal([]byte(member), &cached); err != nil {
+			continue
+		}
+		if cached.CommentID == comment.ID {
+			if err := rdb.ZRem(ctx, key, member).Err(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DeleteCommentCache 删除文档的顶级评论缓存与顶级评论的回复缓存，用于文档被彻底删除后
+func (dao *CommentDAO) DeleteCommentCache(documentIDs, rootCommentIDs []int64) error {
+	keys := make([]string, 0, len(documentIDs)+len(rootCommentIDs))
+	for _, documentID := range documentIDs {
+		keys = append(keys, "comment:"+strconv.FormatInt(documentID, 10))
+	}
+	for _, rootID := range rootCommentIDs {
+		keys = append(keys, "rootComment:"+strconv.FormatInt(rootID, 10))
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return util.GetRedisClient().Del(context.Background(), keys...).Err()
+}
+
 // DeleteCommentsByDocumentID 根据文档 ID 逻辑删除所有评论
 func (dao *CommentDAO) DeleteCommentsByDocumentID(documentID int64) error {
 	if err := dao.db.Model(&models.DocumentComment{}).Where("document_id = ?", documentID).
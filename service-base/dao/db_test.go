@@ -0,0 +1,47 @@
+package dao
+
+import (
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"os"
+	"testing"
+	"yuqueppbackend/service-base/models"
+)
+
+// useTestDB 连接 TEST_MYSQL_DSN 指定的测试数据库并完成迁移，未配置或无法连接时跳过测试。
+// 测试会写入数据，不要指向开发或生产数据库
+func useTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("TEST_MYSQL_DSN not set")
+	}
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Skipf("mysql not available: %v", err)
+	}
+	if err := models.MigrateDB(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// createTestUser 创建一个测试用户，测试结束后删除
+func createTestUser(t *testing.T, db *gorm.DB) *models.User {
+	t.Helper()
+	user := &models.User{Nickname: "quota-test", Password: "x"}
+	user.Email = t.Name() + "@example.com"
+	db.Unscoped().Where("email = ?", user.Email).Delete(&models.User{})
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Where("author_id = ?", user.ID).Delete(&models.DocumentVersion{})
+		db.Unscoped().Where("knowledge_base_id IN (?)", db.Unscoped().Model(&models.KnowledgeBase{}).Select("id").Where("owner_id = ?", user.ID)).Delete(&models.Document{})
+		db.Unscoped().Where("owner_id = ?", user.ID).Delete(&models.KnowledgeBase{})
+		db.Where("owner_id = ?", user.ID).Delete(&models.TrashItem{})
+		db.Delete(user)
+	})
+	return user
+}
@@ -58,10 +58,132 @@ func (dao *DocDao) GetDocumentByID(id int64) (*models.Document, error) {
 // GetDocumentsByKnowledgeBaseID 获取某知识库下的所有文档
 func (dao *DocDao) GetDocumentsByKnowledgeBaseID(kbID int64) ([]models.Document, error) {
 	var docs []models.Document
-	err := dao.db.Where("knowledge_base_id = ?", kbID).Find(&docs).Error
+	err := dao.db.Where("knowledge_base_id = ?", kbID).Order("sort_order ASC, created_at ASC").Find(&docs).Error
 	return docs, err
 }
 
+// GetNextSortOrder 获取同级文档中下一个可用的排序值，parentID 为 nil 表示知识库的根目录
+func (dao *DocDao) GetNextSortOrder(kbID int64, parentID *int64) (int, error) {
+	var next int
+	query := dao.db.Model(&models.Document{}).Where("knowledge_base_id = ?", kbID)
+	if parentID == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *parentID)
+	}
+	err := query.Select("COALESCE(MAX(sort_order) + 1, 0)").Scan(&next).Error
+	return next, err
+}
+
+// GetDescendantIDs 获取文档所有后代文档的 ID（不包含文档自身）
+func (dao *DocDao) GetDescendantIDs(docID int64) ([]int64, error) {
+	var descendants []int64
+	frontier := []int64{docID}
+	for len(frontier) > 0 {
+		var children []int64
+		if err := dao.db.Model(&models.Document{}).Where("parent_id IN ?", frontier).Pluck("id", &children).Error; err != nil {
+			return nil, err
+		}
+		descendants = append(descendants, children...)
+		frontier = children
+	}
+	return descendants, nil
+}
+
+// MoveDocument 将文档及其子树移动到目标知识库的目标父文档下，并插入到同级文档的 position 位置。
+// 跨知识库移动时按目标知识库所有者的 docLimit 与 storageLimit 检查配额，超出时返回 QuotaExceededError 或 StorageQuotaExceededError
+func (dao *DocDao) MoveDocument(doc *models.Document, targetKbID int64, targetParentID *int64, position int, docLimit, storageLimit int64) error {
+	descendants, err := dao.GetDescendantIDs(doc.ID)
+	if err != nil {
+		return err
+	}
+	return dao.db.Transaction(func(tx *gorm.DB) error {
+		if targetKbID != doc.KnowledgeBaseID {
+			if err := checkMoveQuota(tx, doc, targetKbID, append([]int64{doc.ID}, descendants...), docLimit, storageLimit); err != nil {
+				return err
+			}
+		}
+		// 目标位置的同级文档（不包含被移动的文档）
+		var siblings []models.Document
+		query := tx.Where("knowledge_base_id = ? AND id <> ?", targetKbID, doc.ID)
+		if targetParentID == nil {
+			query = query.Where("parent_id IS NULL")
+		} else {
+			query = query.Where("parent_id = ?", *targetParentID)
+		}
+		if err := query.Order("sort_order ASC, created_at ASC").Find(&siblings).Error; err != nil {
+			return err
+		}
+		if position < 0 || position > len(siblings) {
+			position = len(siblings)
+		}
+
+		// 重新编排同级文档的顺序
+		order := 0
+		for i, sibling := range siblings {
+			if i == position {
+				order++
+			}
+			if sibling.SortOrder != order {
+				if err := tx.Model(&models.Document{}).Where("id = ?", sibling.ID).Update("sort_order", order).Error; err != nil {
+					return err
+				}
+			}
+			order++
+		}
+
+		if err := tx.Model(&models.Document{}).Where("id = ?", doc.ID).Updates(map[string]interface{}{
+			"knowledge_base_id": targetKbID,
+			"parent_id":         targetParentID,
+			"sort_order":        position,
+			"updated_at":        time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		// 跨知识库移动时，整棵子树一起迁移
+		if targetKbID != doc.KnowledgeBaseID && len(descendants) > 0 {
+			if err := tx.Model(&models.Document{}).Where("id IN ?", descendants).Update("knowledge_base_id", targetKbID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// checkMoveQuota 跨知识库移动前锁定目标知识库并统计文档数量；目标知识库属于其他用户时，
+// 被移动文档的历史版本会计入该用户的存储空间，同样锁定后统计。limit 为 0 表示不限制
+func checkMoveQuota(tx *gorm.DB, doc *models.Document, targetKbID int64, ids []int64, docLimit, storageLimit int64) error {
+	if err := lockForQuota(tx, &models.KnowledgeBase{}, targetKbID); err != nil {
+		return err
+	}
+	if err := countDocumentsByKB(tx, targetKbID, int64(len(ids)), docLimit); err != nil {
+		return err
+	}
+	if storageLimit <= 0 {
+		return nil
+	}
+	var kbs []models.KnowledgeBase
+	if err := tx.Select("id", "owner_id").Where("id IN ?", []int64{doc.KnowledgeBaseID, targetKbID}).Find(&kbs).Error; err != nil {
+		return err
+	}
+	owners := make(map[int64]int64, len(kbs))
+	for _, kb := range kbs {
+		owners[kb.ID] = kb.OwnerID
+	}
+	targetOwner := owners[targetKbID]
+	if targetOwner == owners[doc.KnowledgeBaseID] {
+		return nil
+	}
+	if err := lockForQuota(tx, &models.User{}, targetOwner); err != nil {
+		return err
+	}
+	moving, err := storageBytesOfDocuments(tx, ids)
+	if err != nil {
+		return err
+	}
+	return checkStorageByOwner(tx, targetOwner, moving, storageLimit)
+}
+
 // UpdateDocument 更新文档
 func (dao *DocDao) UpdateDocument(doc *models.Document) error {
 	doc.UpdatedAt = time.Now()
@@ -215,6 +337,52 @@ func (dao *DocDao) GetDocumentContentHashByDocumentId(documentId int64) (string,
 	return res.Result()
 }
 
+// DeleteRecentDocumentsOfUser 删除用户的最近浏览、编辑与评论记录
+func (dao *DocDao) DeleteRecentDocumentsOfUser(userId string) error {
+	return util.GetRedisClient().Del(context.Background(),
+		"user_recent_view_docs:"+userId, "user_recent_edit_docs:"+userId, "user_recent_comment_docs:"+userId).Err()
+}
+
+// DeleteDocumentContentHashes 删除已彻底删除的文档在 Redis 中的内容哈希
+func (dao *DocDao) DeleteDocumentContentHashes(documentIds []int64) error {
+	if len(documentIds) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(documentIds))
+	for _, documentId := range documentIds {
+		keys = append(keys, "documentContentHash:"+strconv.FormatInt(documentId, 10))
+	}
+	return util.GetRedisClient().Del(context.Background(), keys...).Err()
+}
+
+// unlockDocumentScript 只有锁的值仍是自己的令牌时才删除，避免释放已超时并被其他请求重新获取的锁
+var unlockDocumentScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// LockDocument 获取文档保存锁，防止并发保存时互相覆盖；锁在超时后自动释放。
+// 返回的令牌用于释放锁，为空表示锁已被占用
+func (dao *DocDao) LockDocument(documentId int64) (string, error) {
+	token, err := util.GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	ok, err := util.GetRedisClient().SetNX(context.Background(), "documentLock:"+strconv.FormatInt(documentId, 10), token, time.Second*10).Result()
+	if err != nil || !ok {
+		return "", err
+	}
+	return token, nil
+}
+
+// UnlockDocument 使用 LockDocument 返回的令牌释放文档保存锁
+func (dao *DocDao) UnlockDocument(documentId int64, token string) error {
+	return unlockDocumentScript.Run(context.Background(), util.GetRedisClient(),
+		[]string{"documentLock:" + strconv.FormatInt(documentId, 10)}, token).Err()
+}
+
 // 将文档数据插入到ES
 
 func (dao *DocDao) InsertDocToES(document models.Document, content string) error {
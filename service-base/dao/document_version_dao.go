@@ -0,0 +1,99 @@
+package dao
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"time"
+	"yuqueppbackend/service-base/models"
+)
+
+// DocVersionDao 处理与 DocumentVersion 表相关的数据库操作
+type DocVersionDao struct {
+	db *gorm.DB
+}
+
+// NewDocVersionDao 创建一个新的 DocVersionDao 实例
+func NewDocVersionDao(db *gorm.DB) *DocVersionDao {
+	return &DocVersionDao{db: db}
+}
+
+// CreateVersion 创建新版本，版本号在事务中取当前最大版本号加一。
+// writeContent 在版本记录提交前调用，用于写入版本内容；写入失败时回滚版本记录，避免版本指向不存在的内容。
+// storageLimit 大于 0 时先锁定知识库所有者 ownerID 并统计存储空间，新版本会超出时返回 StorageQuotaExceededError
+func (dao *DocVersionDao) CreateVersion(version *models.DocumentVersion, ownerID, storageLimit int64, writeContent func(*models.DocumentVersion) error) error {
+	return dao.db.Transaction(func(tx *gorm.DB) error {
+		if storageLimit > 0 {
+			if err := lockForQuota(tx, &models.User{}, ownerID); err != nil {
+				return err
+			}
+			if err := checkStorageByOwner(tx, ownerID, version.ContentSize, storageLimit); err != nil {
+				return err
+			}
+		}
+		var maxVersion int
+		if err := tx.Model(&models.DocumentVersion{}).
+			Where("document_id = ?", version.DocumentID).
+			Select("COALESCE(MAX(version), 0)").
+			Scan(&maxVersion).Error; err != nil {
+			return err
+		}
+		version.Version = maxVersion + 1
+		version.CreatedAt = time.Now()
+		if err := tx.Create(version).Error; err != nil {
+			return err
+		}
+		return writeContent(version)
+	})
+}
+
+// GetVersionByID 根据版本 ID 获取版本，不存在时返回 nil
+func (dao *DocVersionDao) GetVersionByID(versionID int64) (*models.DocumentVersion, error) {
+	var version models.DocumentVersion
+	err := dao.db.Preload("Author").First(&version, versionID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &version, nil
+}
+
+// GetLatestVersion 获取文档的最新版本，不存在时返回 nil
+func (dao *DocVersionDao) GetLatestVersion(documentID int64) (*models.DocumentVersion, error) {
+	var version models.DocumentVersion
+	err := dao.db.Where("document_id = ?", documentID).Order("version DESC").First(&version).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &version, nil
+}
+
+// GetVersionsByDocumentID 获取某文档的版本列表（按版本号倒序，支持分页）
+func (dao *DocVersionDao) GetVersionsByDocumentID(documentID int64, page, pageSize int) ([]models.DocumentVersion, int64, error) {
+	var versions []models.DocumentVersion
+	var total int64
+
+	if err := dao.db.Model(&models.DocumentVersion{}).
+		Where("document_id = ?", documentID).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := dao.db.Preload("Author").
+		Where("document_id = ?", documentID).
+		Order("version DESC").
+		Limit(pageSize).Offset(offset).
+		Find(&versions).Error; err != nil {
+		return nil, 0, err
+	}
+	return versions, total, nil
+}
+
+// DeleteVersionsByDocumentID 删除某文档的所有版本记录
+func (dao *DocVersionDao) DeleteVersionsByDocumentID(documentID int64) error {
+	return dao.db.Where("document_id = ?", documentID).Delete(&models.DocumentVersion{}).Error
+}
@@ -0,0 +1,113 @@
+package dao
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"time"
+	"yuqueppbackend/service-base/models"
+)
+
+// KBMemberDAO 处理知识库成员与权限相关的数据库操作
+type KBMemberDAO struct {
+	db *gorm.DB
+}
+
+// NewKBMemberDAO 创建一个新的 KBMemberDAO 实例
+func NewKBMemberDAO(db *gorm.DB) *KBMemberDAO {
+	return &KBMemberDAO{db: db}
+}
+
+// GetMember 获取用户在知识库中的成员记录，不是成员时返回 nil
+func (dao *KBMemberDAO) GetMember(kbID, userID int64) (*models.KnowledgeBaseMember, error) {
+	var member models.KnowledgeBaseMember
+	err := dao.db.Where("knowledge_base_id = ? AND user_id = ?", kbID, userID).First(&member).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &member, nil
+}
+
+// GetMembersByKBID 获取知识库的全部成员
+func (dao *KBMemberDAO) GetMembersByKBID(kbID int64) ([]models.KnowledgeBaseMember, error) {
+	var members []models.KnowledgeBaseMember
+	err := dao.db.Preload("User").Where("knowledge_base_id = ?", kbID).Order("created_at ASC").Find(&members).Error
+	return members, err
+}
+
+// GetMemberKBs 获取用户以成员身份加入的知识库及对应角色
+func (dao *KBMemberDAO) GetMemberKBs(userID int64) ([]models.KnowledgeBase, map[int64]string, error) {
+	var members []models.KnowledgeBaseMember
+	if err := dao.db.Where("user_id = ?", userID).Find(&members).Error; err != nil {
+		return nil, nil, err
+	}
+	roles := make(map[int64]string, len(members))
+	var kbIDs []int64
+	for _, member := range members {
+		roles[member.KnowledgeBaseID] = member.Role
+		kbIDs = append(kbIDs, member.KnowledgeBaseID)
+	}
+	var kbs []models.KnowledgeBase
+	if len(kbIDs) > 0 {
+		if err := dao.db.Where("id IN ?", kbIDs).Find(&kbs).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	return kbs, roles, nil
+}
+
+// SaveMember 添加成员，已是成员时更新其角色
+func (dao *KBMemberDAO) SaveMember(member *models.KnowledgeBaseMember) error {
+	existing, err := dao.GetMember(member.KnowledgeBaseID, member.UserID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		member.ID = existing.ID
+		member.CreatedAt = existing.CreatedAt
+		member.UpdatedAt = time.Now()
+		return dao.db.Model(existing).Updates(map[string]interface{}{"role": member.Role, "updated_at": member.UpdatedAt}).Error
+	}
+	member.CreatedAt = time.Now()
+	member.UpdatedAt = time.Now()
+	return dao.db.Create(member).Error
+}
+
+// RemoveMember 移除知识库成员
+func (dao *KBMemberDAO) RemoveMember(kbID, userID int64) error {
+	return dao.db.Where("knowledge_base_id = ? AND user_id = ?", kbID, userID).Delete(&models.KnowledgeBaseMember{}).Error
+}
+
+// GetKBByID 根据 ID 获取知识库，不存在时返回 nil
+func (dao *KBMemberDAO) GetKBByID(kbID int64) (*models.KnowledgeBase, error) {
+	var kb models.KnowledgeBase
+	if err := dao.db.First(&kb, kbID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &kb, nil
+}
+
+// GetAccessibleKBRoles 获取用户可以访问的全部知识库 ID 及对应角色（自己创建的与加入的）
+func (dao *KBMemberDAO) GetAccessibleKBRoles(userID int64) (map[int64]string, error) {
+	var members []models.KnowledgeBaseMember
+	if err := dao.db.Where("user_id = ?", userID).Find(&members).Error; err != nil {
+		return nil, err
+	}
+	roles := make(map[int64]string, len(members))
+	for _, member := range members {
+		roles[member.KnowledgeBaseID] = member.Role
+	}
+	var ownedIDs []int64
+	if err := dao.db.Model(&models.KnowledgeBase{}).Where("owner_id = ?", userID).Pluck("id", &ownedIDs).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range ownedIDs {
+		roles[id] = models.RoleOwner
+	}
+	return roles, nil
+}
@@ -32,6 +32,15 @@ func (dao *KBDAO) GetKBListByOwnerId(ownerId int64) ([]models.KnowledgeBase, err
 	return knowledgeBases, nil
 }
 
+// GetPublicKBListByOwnerId 获取用户的公开知识库，按更新时间倒序
+func (dao *KBDAO) GetPublicKBListByOwnerId(ownerId int64) ([]models.KnowledgeBase, error) {
+	var knowledgeBases []models.KnowledgeBase
+	if err := dao.DB.Where("owner_id = ? AND is_public = ?", ownerId, true).Order("updated_at DESC").Find(&knowledgeBases).Error; err != nil {
+		return nil, err
+	}
+	return knowledgeBases, nil
+}
+
 func (dao *KBDAO) DeleteKB(kb models.KnowledgeBase) error {
 	return dao.DB.Delete(&kb).Error
 }
@@ -70,8 +79,8 @@ func (dao *KBDAO) GetKnowledgeBaseById(kbId int64) (kb models.KnowledgeBase, err
 	return kb, nil
 }
 
-// UpdateKB 更新知识库信息，使用 ownerId 和 id 作为查询条件
-func (dao *KBDAO) UpdateKB(ownerId, id int64, updatedKB models.KnowledgeBase) (models.KnowledgeBase, error) {
+// UpdateKB 更新知识库信息，使用 ownerId 和 id 作为查询条件，updates 为需要更新的列
+func (dao *KBDAO) UpdateKB(ownerId, id int64, updates map[string]interface{}) (models.KnowledgeBase, error) {
 	var kb models.KnowledgeBase
 
 	// 查找指定 ownerId 和 id 的知识库
@@ -86,7 +95,7 @@ func (dao *KBDAO) UpdateKB(ownerId, id int64, updatedKB models.KnowledgeBase) (m
 	}
 
 	// 更新字段，只更新传入的字段
-	err = dao.DB.Model(&kb).Updates(updatedKB).Error
+	err = dao.DB.Model(&kb).Updates(updates).Error
 	if err != nil {
 		// 更新失败，返回错误
 		return kb, fmt.Errorf("failed to update knowledge base: %v", err)
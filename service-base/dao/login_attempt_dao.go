@@ -0,0 +1,41 @@
+package dao
+
+import (
+	"gorm.io/gorm"
+	"yuqueppbackend/service-base/models"
+)
+
+// LoginAttemptDAO 处理登录失败记录相关的数据库操作
+type LoginAttemptDAO struct {
+	db *gorm.DB
+}
+
+// NewLoginAttemptDAO 创建一个新的 LoginAttemptDAO 实例
+func NewLoginAttemptDAO(db *gorm.DB) *LoginAttemptDAO {
+	return &LoginAttemptDAO{db: db}
+}
+
+// CreateLoginAttempt 记录一次失败的登录尝试
+func (dao *LoginAttemptDAO) CreateLoginAttempt(attempt *models.LoginAttempt) error {
+	return dao.db.Create(attempt).Error
+}
+
+// GetLoginAttempts 按邮箱、IP 过滤并分页获取登录失败记录，按时间倒序
+func (dao *LoginAttemptDAO) GetLoginAttempts(email, ip string, page, pageSize int) ([]models.LoginAttempt, int64, error) {
+	filter := func(db *gorm.DB) *gorm.DB {
+		if email != "" {
+			db = db.Where("email = ?", email)
+		}
+		if ip != "" {
+			db = db.Where("ip = ?", ip)
+		}
+		return db
+	}
+	var total int64
+	if err := dao.db.Model(&models.LoginAttempt{}).Scopes(filter).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var attempts []models.LoginAttempt
+	err := dao.db.Scopes(filter).Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&attempts).Error
+	return attempts, total, err
+}
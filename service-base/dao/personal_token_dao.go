@@ -0,0 +1,56 @@
+package dao
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"time"
+	"yuqueppbackend/service-base/models"
+)
+
+// PersonalTokenDAO 处理个人访问令牌相关的数据库操作
+type PersonalTokenDAO struct {
+	db *gorm.DB
+}
+
+// NewPersonalTokenDAO 创建一个新的 PersonalTokenDAO 实例
+func NewPersonalTokenDAO(db *gorm.DB) *PersonalTokenDAO {
+	return &PersonalTokenDAO{db: db}
+}
+
+// CreateToken 创建个人访问令牌
+func (dao *PersonalTokenDAO) CreateToken(token *models.PersonalAccessToken) error {
+	return dao.db.Create(token).Error
+}
+
+// GetTokenByHash 根据令牌哈希获取令牌并预加载所属用户，不存在时返回 nil
+func (dao *PersonalTokenDAO) GetTokenByHash(tokenHash string) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	if err := dao.db.Preload("User").Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// GetTokensByUserID 获取用户创建的全部令牌，按创建时间倒序
+func (dao *PersonalTokenDAO) GetTokensByUserID(userID int64) ([]models.PersonalAccessToken, error) {
+	var tokens []models.PersonalAccessToken
+	err := dao.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// RevokeToken 撤销用户的令牌，令牌不存在、不属于该用户或已撤销时返回 false
+func (dao *PersonalTokenDAO) RevokeToken(userID, tokenID int64) (bool, error) {
+	result := dao.db.Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// TouchToken 记录令牌的最近使用时间与 IP
+func (dao *PersonalTokenDAO) TouchToken(tokenID int64, ip string) error {
+	return dao.db.Model(&models.PersonalAccessToken{}).Where("id = ?", tokenID).
+		Updates(map[string]interface{}{"last_used_at": time.Now(), "last_used_ip": ip}).Error
+}
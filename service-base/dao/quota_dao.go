@@ -0,0 +1,186 @@
+package dao
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+	"yuqueppbackend/service-base/models"
+)
+
+// QuotaDAO 统计会员配额相关的用量
+type QuotaDAO struct {
+	db *gorm.DB
+}
+
+// NewQuotaDAO 创建一个新的 QuotaDAO 实例
+func NewQuotaDAO(db *gorm.DB) *QuotaDAO {
+	return &QuotaDAO{db: db}
+}
+
+// QuotaExceededError 在事务中加锁重新统计后发现配额不足，Used 为当时的用量
+type QuotaExceededError struct {
+	Used int64
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded: %d used", e.Used)
+}
+
+// StorageQuotaExceededError 在事务中加锁重新统计后发现存储空间不足，Used 为当时已占用的字节数
+type StorageQuotaExceededError struct {
+	Used int64
+}
+
+func (e *StorageQuotaExceededError) Error() string {
+	return fmt.Sprintf("storage quota exceeded: %d bytes used", e.Used)
+}
+
+// KBUsage 单个知识库的用量
+type KBUsage struct {
+	KnowledgeBaseID int64
+	Name            string
+	Documents       int64
+	Collaborators   int64
+}
+
+// lockForQuota 锁定配额所属的记录（用户或知识库），同一所有者或同一知识库的并发写入会在行锁上排队，
+// 保证统计用量与写入之间不会被其他请求抢先
+func lockForQuota(tx *gorm.DB, model interface{}, id int64) error {
+	return tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", id).Take(model).Error
+}
+
+// countKBsByOwner 统计用户拥有的知识库数量，limit 大于 0 且 adding 个新知识库会超出时返回 QuotaExceededError
+func countKBsByOwner(tx *gorm.DB, ownerID, adding, limit int64) error {
+	var count int64
+	if err := tx.Model(&models.KnowledgeBase{}).Where("owner_id = ?", ownerID).Count(&count).Error; err != nil {
+		return err
+	}
+	if limit > 0 && count+adding > limit {
+		return &QuotaExceededError{Used: count}
+	}
+	return nil
+}
+
+// countDocumentsByKB 统计知识库中的文档数量，limit 大于 0 且 adding 篇新文档会超出时返回 QuotaExceededError
+func countDocumentsByKB(tx *gorm.DB, kbID, adding, limit int64) error {
+	var count int64
+	if err := tx.Model(&models.Document{}).Where("knowledge_base_id = ?", kbID).Count(&count).Error; err != nil {
+		return err
+	}
+	if limit > 0 && count+adding > limit {
+		return &QuotaExceededError{Used: count}
+	}
+	return nil
+}
+
+// storageBytesByOwner 按历史版本内容大小统计用户全部知识库占用的存储空间
+func storageBytesByOwner(tx *gorm.DB, ownerID int64) (int64, error) {
+	var total int64
+	err := tx.Table("document_versions").
+		Joins("JOIN documents ON documents.id = document_versions.document_id").
+		Joins("JOIN knowledge_bases ON knowledge_bases.id = documents.knowledge_base_id").
+		Where("knowledge_bases.owner_id = ?", ownerID).
+		Select("COALESCE(SUM(document_versions.content_size), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+// checkStorageByOwner 统计用户占用的存储空间，limit 大于 0 且再写入 adding 字节会超出时返回 StorageQuotaExceededError
+func checkStorageByOwner(tx *gorm.DB, ownerID, adding, limit int64) error {
+	if limit <= 0 {
+		return nil
+	}
+	used, err := storageBytesByOwner(tx, ownerID)
+	if err != nil {
+		return err
+	}
+	if used+adding > limit {
+		return &StorageQuotaExceededError{Used: used}
+	}
+	return nil
+}
+
+// storageBytesOfDocuments 统计一组文档的全部历史版本占用的存储空间
+func storageBytesOfDocuments(tx *gorm.DB, ids []int64) (int64, error) {
+	var total int64
+	err := tx.Model(&models.DocumentVersion{}).Where("document_id IN ?", ids).
+		Select("COALESCE(SUM(content_size), 0)").Scan(&total).Error
+	return total, err
+}
+
+// CreateKBWithinQuota 锁定所有者后统计知识库数量，不超过 limit 时创建知识库，limit 为 0 表示不限制
+func (dao *QuotaDAO) CreateKBWithinQuota(kb *models.KnowledgeBase, limit int64) error {
+	return dao.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockForQuota(tx, &models.User{}, kb.OwnerID); err != nil {
+			return err
+		}
+		if err := countKBsByOwner(tx, kb.OwnerID, 1, limit); err != nil {
+			return err
+		}
+		return tx.Create(kb).Error
+	})
+}
+
+// CreateDocumentWithinQuota 锁定知识库后统计文档数量，不超过 limit 时创建文档，limit 为 0 表示不限制
+func (dao *QuotaDAO) CreateDocumentWithinQuota(doc *models.Document, limit int64) error {
+	doc.CreatedAt = time.Now()
+	doc.UpdatedAt = time.Now()
+	return dao.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockForQuota(tx, &models.KnowledgeBase{}, doc.KnowledgeBaseID); err != nil {
+			return err
+		}
+		if err := countDocumentsByKB(tx, doc.KnowledgeBaseID, 1, limit); err != nil {
+			return err
+		}
+		return tx.Create(doc).Error
+	})
+}
+
+// CountKBsByOwner 统计用户拥有的知识库数量，回收站中的知识库不计入
+func (dao *QuotaDAO) CountKBsByOwner(ownerID int64) (int64, error) {
+	var count int64
+	err := dao.db.Model(&models.KnowledgeBase{}).Where("owner_id = ?", ownerID).Count(&count).Error
+	return count, err
+}
+
+// CountDocumentsByKB 统计知识库中的文档数量，回收站中的文档不计入
+func (dao *QuotaDAO) CountDocumentsByKB(kbID int64) (int64, error) {
+	var count int64
+	err := dao.db.Model(&models.Document{}).Where("knowledge_base_id = ?", kbID).Count(&count).Error
+	return count, err
+}
+
+// CountCollaboratorsByKB 统计知识库的协作者数量
+func (dao *QuotaDAO) CountCollaboratorsByKB(kbID int64) (int64, error) {
+	var count int64
+	err := dao.db.Model(&models.KnowledgeBaseMember{}).Where("knowledge_base_id = ?", kbID).Count(&count).Error
+	return count, err
+}
+
+// GetStorageBytesByOwner 统计用户全部知识库占用的存储空间。
+// 每次保存都会生成一个历史版本，因此按版本内容大小累加；回收站中的文档同样占用空间，彻底删除后才释放
+func (dao *QuotaDAO) GetStorageBytesByOwner(ownerID int64) (int64, error) {
+	return storageBytesByOwner(dao.db, ownerID)
+}
+
+// GetKBUsagesByOwner 获取用户每个知识库的文档数量与协作者数量
+func (dao *QuotaDAO) GetKBUsagesByOwner(ownerID int64) ([]KBUsage, error) {
+	var kbs []models.KnowledgeBase
+	if err := dao.db.Where("owner_id = ?", ownerID).Order("created_at ASC").Find(&kbs).Error; err != nil {
+		return nil, err
+	}
+	usages := make([]KBUsage, 0, len(kbs))
+	for _, kb := range kbs {
+		documents, err := dao.CountDocumentsByKB(kb.ID)
+		if err != nil {
+			return nil, err
+		}
+		collaborators, err := dao.CountCollaboratorsByKB(kb.ID)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, KBUsage{KnowledgeBaseID: kb.ID, Name: kb.Name, Documents: documents, Collaborators: collaborators})
+	}
+	return usages, nil
+}
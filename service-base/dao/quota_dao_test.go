@@ -0,0 +1,241 @@
+package dao
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+	"yuqueppbackend/service-base/models"
+)
+
+// 并发创建时加锁后的统计必须看到其他请求已经创建的记录，成功的数量不能超过配额
+func TestCreateKBWithinQuotaConcurrent(t *testing.T) {
+	db := useTestDB(t)
+	quotaDao := NewQuotaDAO(db)
+	user := createTestUser(t, db)
+
+	const limit, workers = 3, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- quotaDao.CreateKBWithinQuota(&models.KnowledgeBase{Name: "kb", OwnerID: user.ID}, limit)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		var quotaErr *QuotaExceededError
+		switch {
+		case err == nil:
+			created++
+		case errors.As(err, &quotaErr):
+			if quotaErr.Used != limit {
+				t.Errorf("used = %d, want %d", quotaErr.Used, limit)
+			}
+		default:
+			t.Fatalf("create: %v", err)
+		}
+	}
+	count, err := quotaDao.CountKBsByOwner(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created != limit || count != limit {
+		t.Fatalf("created %d, counted %d, want %d", created, count, limit)
+	}
+}
+
+func TestCreateDocumentWithinQuota(t *testing.T) {
+	db := useTestDB(t)
+	quotaDao := NewQuotaDAO(db)
+	user := createTestUser(t, db)
+	kb := &models.KnowledgeBase{Name: "kb", OwnerID: user.ID}
+	if err := quotaDao.CreateKBWithinQuota(kb, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = quotaDao.CreateDocumentWithinQuota(&models.Document{Title: "doc", KnowledgeBaseID: kb.ID, OwnerId: user.ID}, 2)
+		}()
+	}
+	wg.Wait()
+	count, err := quotaDao.CountDocumentsByKB(kb.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("documents = %d, want 2", count)
+	}
+	// 0 表示不限制
+	if err := quotaDao.CreateDocumentWithinQuota(&models.Document{Title: "doc", KnowledgeBaseID: kb.ID, OwnerId: user.ID}, 0); err != nil {
+		t.Fatalf("unlimited create: %v", err)
+	}
+}
+
+// 从回收站恢复同样受配额限制，恢复的子文档一并计入
+func TestRestoreWithinQuota(t *testing.T) {
+	db := useTestDB(t)
+	quotaDao := NewQuotaDAO(db)
+	trashDao := NewTrashDAO(db)
+	user := createTestUser(t, db)
+	kb := &models.KnowledgeBase{Name: "kb", OwnerID: user.ID}
+	if err := quotaDao.CreateKBWithinQuota(kb, 0); err != nil {
+		t.Fatal(err)
+	}
+	parent := &models.Document{Title: "parent", KnowledgeBaseID: kb.ID, OwnerId: user.ID}
+	if err := quotaDao.CreateDocumentWithinQuota(parent, 0); err != nil {
+		t.Fatal(err)
+	}
+	child := &models.Document{Title: "child", KnowledgeBaseID: kb.ID, OwnerId: user.ID, ParentID: &parent.ID}
+	if err := quotaDao.CreateDocumentWithinQuota(child, 0); err != nil {
+		t.Fatal(err)
+	}
+	parent.KnowledgeBase = *kb
+	item, _, err := trashDao.TrashDocument(parent, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 删除后知识库为空，再创建一篇文档后恢复两篇会超出 2 篇的配额
+	if err := quotaDao.CreateDocumentWithinQuota(&models.Document{Title: "new", KnowledgeBaseID: kb.ID, OwnerId: user.ID}, 2); err != nil {
+		t.Fatal(err)
+	}
+	var quotaErr *QuotaExceededError
+	if _, err := trashDao.RestoreDocument(item, 2); !errors.As(err, &quotaErr) || quotaErr.Used != 1 {
+		t.Fatalf("restore over quota: err = %v", err)
+	}
+	restored, err := trashDao.RestoreDocument(item, 3)
+	if err != nil {
+		t.Fatalf("restore within quota: %v", err)
+	}
+	if len(restored) != 2 {
+		t.Fatalf("restored %d documents, want 2", len(restored))
+	}
+
+	kbItem, _, err := trashDao.TrashKnowledgeBase(kb, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := quotaDao.CreateKBWithinQuota(&models.KnowledgeBase{Name: "other", OwnerID: user.ID}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := trashDao.RestoreKnowledgeBase(kbItem, 1); !errors.As(err, &quotaErr) {
+		t.Fatalf("restore knowledge base over quota: err = %v", err)
+	}
+	if _, _, err := trashDao.RestoreKnowledgeBase(kbItem, 2); err != nil {
+		t.Fatalf("restore knowledge base within quota: %v", err)
+	}
+}
+
+// 记录新版本时在同一个事务中统计存储空间，超出时不创建版本也不写入内容
+func TestCreateVersionWithinStorageQuota(t *testing.T) {
+	db := useTestDB(t)
+	quotaDao := NewQuotaDAO(db)
+	versionDao := NewDocVersionDao(db)
+	user := createTestUser(t, db)
+	kb := &models.KnowledgeBase{Name: "kb", OwnerID: user.ID}
+	if err := quotaDao.CreateKBWithinQuota(kb, 0); err != nil {
+		t.Fatal(err)
+	}
+	doc := &models.Document{Title: "doc", KnowledgeBaseID: kb.ID, OwnerId: user.ID}
+	if err := quotaDao.CreateDocumentWithinQuota(doc, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	const limit = 100
+	var mu sync.Mutex
+	written := 0
+	writeContent := func(*models.DocumentVersion) error {
+		mu.Lock()
+		written++
+		mu.Unlock()
+		return nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			version := &models.DocumentVersion{DocumentID: doc.ID, AuthorID: user.ID, ContentSize: 40}
+			_ = versionDao.CreateVersion(version, user.ID, limit, writeContent)
+		}()
+	}
+	wg.Wait()
+	used, err := quotaDao.GetStorageBytesByOwner(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used != 80 || written != 2 {
+		t.Fatalf("used = %d, written = %d, want 80 and 2", used, written)
+	}
+	var storageErr *StorageQuotaExceededError
+	err = versionDao.CreateVersion(&models.DocumentVersion{DocumentID: doc.ID, AuthorID: user.ID, ContentSize: 40}, user.ID, limit, writeContent)
+	if !errors.As(err, &storageErr) || storageErr.Used != 80 {
+		t.Fatalf("create over quota: err = %v", err)
+	}
+	// 0 表示不限制
+	if err := versionDao.CreateVersion(&models.DocumentVersion{DocumentID: doc.ID, AuthorID: user.ID, ContentSize: 40}, user.ID, 0, writeContent); err != nil {
+		t.Fatalf("unlimited create: %v", err)
+	}
+}
+
+// 跨知识库移动按目标知识库检查文档数量，目标属于其他用户时被移动文档的版本计入该用户的存储空间
+func TestMoveDocumentWithinQuota(t *testing.T) {
+	db := useTestDB(t)
+	quotaDao := NewQuotaDAO(db)
+	versionDao := NewDocVersionDao(db)
+	docDao := NewDocDao(db, nil)
+	user := createTestUser(t, db)
+	// createTestUser 按测试名生成邮箱，目标知识库的所有者在子测试中创建
+	t.Run("cross owner", func(t *testing.T) {
+		other := createTestUser(t, db)
+		source := &models.KnowledgeBase{Name: "source", OwnerID: user.ID}
+		target := &models.KnowledgeBase{Name: "target", OwnerID: other.ID}
+		for _, kb := range []*models.KnowledgeBase{source, target} {
+			if err := quotaDao.CreateKBWithinQuota(kb, 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+		parent := &models.Document{Title: "parent", KnowledgeBaseID: source.ID, OwnerId: user.ID}
+		if err := quotaDao.CreateDocumentWithinQuota(parent, 0); err != nil {
+			t.Fatal(err)
+		}
+		child := &models.Document{Title: "child", KnowledgeBaseID: source.ID, OwnerId: user.ID, ParentID: &parent.ID}
+		if err := quotaDao.CreateDocumentWithinQuota(child, 0); err != nil {
+			t.Fatal(err)
+		}
+		noop := func(*models.DocumentVersion) error { return nil }
+		for _, doc := range []*models.Document{parent, child} {
+			if err := versionDao.CreateVersion(&models.DocumentVersion{DocumentID: doc.ID, AuthorID: user.ID, ContentSize: 30}, user.ID, 0, noop); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var quotaErr *QuotaExceededError
+		if err := docDao.MoveDocument(parent, target.ID, nil, -1, 1, 0); !errors.As(err, &quotaErr) {
+			t.Fatalf("move over document quota: err = %v", err)
+		}
+		var storageErr *StorageQuotaExceededError
+		if err := docDao.MoveDocument(parent, target.ID, nil, -1, 0, 50); !errors.As(err, &storageErr) {
+			t.Fatalf("move over storage quota: err = %v", err)
+		}
+		if err := docDao.MoveDocument(parent, target.ID, nil, -1, 2, 60); err != nil {
+			t.Fatalf("move within quota: %v", err)
+		}
+		used, err := quotaDao.GetStorageBytesByOwner(other.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if used != 60 {
+			t.Fatalf("target owner storage = %d, want 60", used)
+		}
+	})
+}
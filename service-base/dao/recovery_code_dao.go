@@ -0,0 +1,64 @@
+package dao
+
+import (
+	"gorm.io/gorm"
+	"time"
+	"yuqueppbackend/service-base/models"
+)
+
+// RecoveryCodeDAO 处理两步验证恢复码相关的数据库操作
+type RecoveryCodeDAO struct {
+	db *gorm.DB
+}
+
+// NewRecoveryCodeDAO 创建一个新的 RecoveryCodeDAO 实例
+func NewRecoveryCodeDAO(db *gorm.DB) *RecoveryCodeDAO {
+	return &RecoveryCodeDAO{db: db}
+}
+
+// ReplaceRecoveryCodes 删除用户原有的恢复码并保存新的一组
+func (dao *RecoveryCodeDAO) ReplaceRecoveryCodes(userID int64, codeHashes []string) error {
+	return dao.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.UserRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		for _, hash := range codeHashes {
+			if err := tx.Create(&models.UserRecoveryCode{UserID: userID, CodeHash: hash}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UseRecoveryCode 使用一个未使用过的恢复码，返回是否成功。并发使用同一个恢复码时只有一个请求会成功
+func (dao *RecoveryCodeDAO) UseRecoveryCode(userID int64, codeHash string) (bool, error) {
+	result := dao.db.Model(&models.UserRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// HasUnusedRecoveryCode 判断恢复码是否存在且尚未使用，不会将其标记为已使用
+func (dao *RecoveryCodeDAO) HasUnusedRecoveryCode(userID int64, codeHash string) (bool, error) {
+	var count int64
+	err := dao.db.Model(&models.UserRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// CountUnusedRecoveryCodes 统计用户剩余可用的恢复码数量
+func (dao *RecoveryCodeDAO) CountUnusedRecoveryCodes(userID int64) (int64, error) {
+	var count int64
+	err := dao.db.Model(&models.UserRecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// DeleteRecoveryCodes 删除用户全部恢复码
+func (dao *RecoveryCodeDAO) DeleteRecoveryCodes(userID int64) error {
+	return dao.db.Where("user_id = ?", userID).Delete(&models.UserRecoveryCode{}).Error
+}
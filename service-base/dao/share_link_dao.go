@@ -0,0 +1,71 @@
+package dao
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"time"
+	"yuqueppbackend/service-base/models"
+)
+
+// ShareLinkDAO 处理文档分享链接相关的数据库操作
+type ShareLinkDAO struct {
+	db *gorm.DB
+}
+
+// NewShareLinkDAO 创建一个新的 ShareLinkDAO 实例
+func NewShareLinkDAO(db *gorm.DB) *ShareLinkDAO {
+	return &ShareLinkDAO{db: db}
+}
+
+// CreateShareLink 创建分享链接
+func (dao *ShareLinkDAO) CreateShareLink(link *models.DocumentShareLink) error {
+	return dao.db.Create(link).Error
+}
+
+// GetShareLinkByID 根据 ID 获取分享链接，不存在时返回 nil
+func (dao *ShareLinkDAO) GetShareLinkByID(id int64) (*models.DocumentShareLink, error) {
+	var link models.DocumentShareLink
+	if err := dao.db.First(&link, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &link, nil
+}
+
+// GetShareLinkByToken 根据 token 获取分享链接，不存在时返回 nil
+func (dao *ShareLinkDAO) GetShareLinkByToken(token string) (*models.DocumentShareLink, error) {
+	var link models.DocumentShareLink
+	if err := dao.db.Where("token = ?", token).First(&link).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &link, nil
+}
+
+// GetShareLinksByOwner 获取用户创建的分享链接，docID 不为 0 时只返回该文档的链接
+func (dao *ShareLinkDAO) GetShareLinksByOwner(ownerID, docID int64) ([]models.DocumentShareLink, error) {
+	var links []models.DocumentShareLink
+	query := dao.db.Preload("Document").Where("owner_id = ?", ownerID)
+	if docID != 0 {
+		query = query.Where("document_id = ?", docID)
+	}
+	err := query.Order("created_at DESC").Find(&links).Error
+	return links, err
+}
+
+// RevokeShareLink 撤销分享链接
+func (dao *ShareLinkDAO) RevokeShareLink(link *models.DocumentShareLink) error {
+	now := time.Now()
+	link.RevokedAt = &now
+	return dao.db.Model(link).Update("revoked_at", now).Error
+}
+
+// IncrementAccessCount 分享链接访问次数加一
+func (dao *ShareLinkDAO) IncrementAccessCount(id int64) error {
+	return dao.db.Model(&models.DocumentShareLink{}).Where("id = ?", id).
+		UpdateColumn("access_count", gorm.Expr("access_count + ?", 1)).Error
+}
@@ -0,0 +1,329 @@
+package dao
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"time"
+	"yuqueppbackend/service-base/models"
+)
+
+// ErrTrashKnowledgeBaseDeleted 文档所属的知识库也在回收站中，需先恢复知识库
+var ErrTrashKnowledgeBaseDeleted = errors.New("knowledge base of the document is in trash")
+
+// TrashDAO 处理回收站相关的数据库操作。文档与知识库使用软删除，
+// 随父文档或知识库一起被删除的文档不会单独生成回收站条目，恢复时随之一起恢复。
+type TrashDAO struct {
+	db *gorm.DB
+}
+
+// NewTrashDAO 创建一个新的 TrashDAO 实例
+func NewTrashDAO(db *gorm.DB) *TrashDAO {
+	return &TrashDAO{db: db}
+}
+
+// TrashDocument 将文档及其子树移入回收站，返回回收站条目与被删除的全部文档 ID。
+// 条目归知识库所有者管理，与删除知识库时一致；doc 需要预加载 KnowledgeBase
+func (dao *TrashDAO) TrashDocument(doc *models.Document, retention time.Duration) (*models.TrashItem, []int64, error) {
+	item := &models.TrashItem{
+		OwnerID:         doc.KnowledgeBase.OwnerID,
+		ItemType:        models.TrashItemDocument,
+		ItemID:          doc.ID,
+		Title:           doc.Title,
+		KnowledgeBaseID: doc.KnowledgeBaseID,
+		DeletedAt:       time.Now(),
+		ExpireAt:        time.Now().Add(retention),
+	}
+	var docIDs []int64
+	err := dao.db.Transaction(func(tx *gorm.DB) error {
+		// 收集仍未删除的子孙文档
+		docIDs = []int64{doc.ID}
+		frontier := []int64{doc.ID}
+		for len(frontier) > 0 {
+			var children []int64
+			if err := tx.Model(&models.Document{}).Where("parent_id IN ?", frontier).Pluck("id", &children).Error; err != nil {
+				return err
+			}
+			docIDs = append(docIDs, children...)
+			frontier = children
+		}
+		if err := tx.Create(item).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", docIDs).Delete(&models.Document{}).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return item, docIDs, nil
+}
+
+// TrashKnowledgeBase 将知识库及其下所有文档移入回收站，返回回收站条目与被删除的文档 ID
+func (dao *TrashDAO) TrashKnowledgeBase(kb *models.KnowledgeBase, retention time.Duration) (*models.TrashItem, []int64, error) {
+	item := &models.TrashItem{
+		OwnerID:         kb.OwnerID,
+		ItemType:        models.TrashItemKnowledgeBase,
+		ItemID:          kb.ID,
+		Title:           kb.Name,
+		KnowledgeBaseID: kb.ID,
+		DeletedAt:       time.Now(),
+		ExpireAt:        time.Now().Add(retention),
+	}
+	var docIDs []int64
+	err := dao.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Document{}).Where("knowledge_base_id = ?", kb.ID).Pluck("id", &docIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(item).Error; err != nil {
+			return err
+		}
+		if len(docIDs) > 0 {
+			if err := tx.Where("id IN ?", docIDs).Delete(&models.Document{}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(kb).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return item, docIDs, nil
+}
+
+// GetTrashItemsByOwner 获取用户回收站中的条目（按删除时间倒序，支持分页）
+func (dao *TrashDAO) GetTrashItemsByOwner(ownerID int64, page, pageSize int) ([]models.TrashItem, int64, error) {
+	var items []models.TrashItem
+	var total int64
+	if err := dao.db.Model(&models.TrashItem{}).Where("owner_id = ?", ownerID).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := (page - 1) * pageSize
+	if err := dao.db.Where("owner_id = ?", ownerID).
+		Order("deleted_at DESC").
+		Limit(pageSize).Offset(offset).
+		Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+// GetTrashItemByID 根据 ID 获取回收站条目，不存在时返回 nil
+func (dao *TrashDAO) GetTrashItemByID(id int64) (*models.TrashItem, error) {
+	var item models.TrashItem
+	if err := dao.db.First(&item, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetExpiredTrashItems 获取已超过保留期限的回收站条目，跳过 excludeIDs 中的条目
+func (dao *TrashDAO) GetExpiredTrashItems(now time.Time, limit int, excludeIDs []int64) ([]models.TrashItem, error) {
+	var items []models.TrashItem
+	query := dao.db.Where("expire_at < ?", now)
+	if len(excludeIDs) > 0 {
+		query = query.Where("id NOT IN ?", excludeIDs)
+	}
+	err := query.Order("expire_at ASC").Limit(limit).Find(&items).Error
+	return items, err
+}
+
+// purgeDocumentRows 彻底删除文档及其评论、历史版本与分享链接，返回被删除的顶级评论 ID 以便清理回复缓存
+func purgeDocumentRows(tx *gorm.DB, ids []int64) ([]int64, error) {
+	var rootCommentIDs []int64
+	if err := tx.Model(&models.DocumentComment{}).Where("document_id IN ? AND root_id IS NULL", ids).Pluck("id", &rootCommentIDs).Error; err != nil {
+		return nil, err
+	}
+	// 先解除评论的自引用，避免批量删除时触发外键约束
+	if err := tx.Model(&models.DocumentComment{}).Where("document_id IN ?", ids).
+		Updates(map[string]interface{}{"parent_id": nil, "root_id": nil}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("document_id IN ?", ids).Delete(&models.DocumentComment{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("document_id IN ?", ids).Delete(&models.DocumentVersion{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("document_id IN ?", ids).Delete(&models.DocumentShareLink{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Unscoped().Model(&models.Document{}).Where("id IN ?", ids).Update("parent_id", nil).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Unscoped().Where("id IN ?", ids).Delete(&models.Document{}).Error; err != nil {
+		return nil, err
+	}
+	return rootCommentIDs, nil
+}
+
+// collectTrashedSubtree 收集随 rootID 一起被删除的文档（不包含自身拥有回收站条目的子树）
+func collectTrashedSubtree(tx *gorm.DB, rootID int64) ([]int64, error) {
+	ids := []int64{rootID}
+	frontier := []int64{rootID}
+	for len(frontier) > 0 {
+		var children []int64
+		err := tx.Unscoped().Model(&models.Document{}).
+			Where("parent_id IN ? AND deleted_at IS NOT NULL", frontier).
+			Where("id NOT IN (?)", tx.Model(&models.TrashItem{}).Select("item_id").Where("item_type = ?", models.TrashItemDocument)).
+			Pluck("id", &children).Error
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, children...)
+		frontier = children
+	}
+	return ids, nil
+}
+
+// RestoreDocument 恢复回收站中的文档及随其一起删除的子文档，返回被恢复的文档。
+// 如果原父文档已不存在，文档恢复到知识库根目录。恢复后知识库的文档数量超过 docLimit 时返回 QuotaExceededError，
+// docLimit 为 0 表示不限制
+func (dao *TrashDAO) RestoreDocument(item *models.TrashItem, docLimit int64) ([]models.Document, error) {
+	var restored []models.Document
+	err := dao.db.Transaction(func(tx *gorm.DB) error {
+		var doc models.Document
+		if err := tx.Unscoped().First(&doc, item.ItemID).Error; err != nil {
+			return err
+		}
+		var kbCount int64
+		if err := tx.Model(&models.KnowledgeBase{}).Where("id = ?", doc.KnowledgeBaseID).Count(&kbCount).Error; err != nil {
+			return err
+		}
+		if kbCount == 0 {
+			return ErrTrashKnowledgeBaseDeleted
+		}
+
+		if err := lockForQuota(tx, &models.KnowledgeBase{}, doc.KnowledgeBaseID); err != nil {
+			return err
+		}
+		ids, err := collectTrashedSubtree(tx, doc.ID)
+		if err != nil {
+			return err
+		}
+		if err := countDocumentsByKB(tx, doc.KnowledgeBaseID, int64(len(ids)), docLimit); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.Document{}).Where("id IN ?", ids).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+
+		// 父文档仍在回收站中或已被彻底删除时，恢复到根目录末尾
+		if doc.ParentID != nil {
+			var parentCount int64
+			if err := tx.Model(&models.Document{}).Where("id = ?", *doc.ParentID).Count(&parentCount).Error; err != nil {
+				return err
+			}
+			if parentCount == 0 {
+				var next int
+				if err := tx.Model(&models.Document{}).
+					Where("knowledge_base_id = ? AND parent_id IS NULL", doc.KnowledgeBaseID).
+					Select("COALESCE(MAX(sort_order) + 1, 0)").Scan(&next).Error; err != nil {
+					return err
+				}
+				if err := tx.Model(&models.Document{}).Where("id = ?", doc.ID).
+					Updates(map[string]interface{}{"parent_id": nil, "sort_order": next}).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := tx.Delete(item).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Find(&restored).Error
+	})
+	return restored, err
+}
+
+// RestoreKnowledgeBase 恢复回收站中的知识库及随其一起删除的文档。所有者的知识库数量已达到 kbLimit 时
+// 返回 QuotaExceededError，kbLimit 为 0 表示不限制
+func (dao *TrashDAO) RestoreKnowledgeBase(item *models.TrashItem, kbLimit int64) (*models.KnowledgeBase, []models.Document, error) {
+	var kb models.KnowledgeBase
+	var restored []models.Document
+	err := dao.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().First(&kb, item.ItemID).Error; err != nil {
+			return err
+		}
+		if err := lockForQuota(tx, &models.User{}, kb.OwnerID); err != nil {
+			return err
+		}
+		if err := countKBsByOwner(tx, kb.OwnerID, 1, kbLimit); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.KnowledgeBase{}).Where("id = ?", item.ItemID).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&kb, item.ItemID).Error; err != nil {
+			return err
+		}
+		// 单独删除过的文档仍保留在回收站中
+		var ids []int64
+		if err := tx.Unscoped().Model(&models.Document{}).
+			Where("knowledge_base_id = ? AND deleted_at IS NOT NULL", kb.ID).
+			Where("id NOT IN (?)", tx.Model(&models.TrashItem{}).Select("item_id").Where("item_type = ?", models.TrashItemDocument)).
+			Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			if err := tx.Unscoped().Model(&models.Document{}).Where("id IN ?", ids).Update("deleted_at", nil).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("id IN ?", ids).Find(&restored).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(item).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &kb, restored, nil
+}
+
+// PurgeDocument 彻底删除回收站中的文档及随其一起删除的子文档，
+// 返回被删除的文档 ID 与顶级评论 ID 以便清理内容文件与缓存
+func (dao *TrashDAO) PurgeDocument(item *models.TrashItem) ([]int64, []int64, error) {
+	var ids, rootCommentIDs []int64
+	err := dao.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		ids, err = collectTrashedSubtree(tx, item.ItemID)
+		if err != nil {
+			return err
+		}
+		if rootCommentIDs, err = purgeDocumentRows(tx, ids); err != nil {
+			return err
+		}
+		return tx.Delete(item).Error
+	})
+	return ids, rootCommentIDs, err
+}
+
+// PurgeKnowledgeBase 彻底删除回收站中的知识库及其下所有文档，
+// 返回被删除的文档 ID 与顶级评论 ID 以便清理内容文件与缓存
+func (dao *TrashDAO) PurgeKnowledgeBase(item *models.TrashItem) ([]int64, []int64, error) {
+	var ids, rootCommentIDs []int64
+	err := dao.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.Document{}).Where("knowledge_base_id = ?", item.ItemID).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			if err := tx.Where("item_type = ? AND item_id IN ?", models.TrashItemDocument, ids).Delete(&models.TrashItem{}).Error; err != nil {
+				return err
+			}
+			var err error
+			if rootCommentIDs, err = purgeDocumentRows(tx, ids); err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("knowledge_base_id = ?", item.ItemID).Delete(&models.KnowledgeBaseMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&models.KnowledgeBase{}, item.ItemID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(item).Error
+	})
+	return ids, rootCommentIDs, err
+}
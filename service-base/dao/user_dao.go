@@ -3,26 +3,101 @@ package dao
 import (
 	"errors"
 	"gorm.io/gorm"
+	"log"
 	"time"
 	"yuqueppbackend/service-base/db"
 	"yuqueppbackend/service-base/models"
+	"yuqueppbackend/service-base/util"
 )
 
 type UserDAO struct {
 	DB *gorm.DB
 }
 
-// 校验密码是否匹配
+// 校验密码是否匹配。历史明文密码或 cost 过期的哈希在校验通过后会透明地升级为当前配置的哈希
 func (dao *UserDAO) CheckPassword(user models.User) (bool, error) {
 	tmpUser, err := dao.GetUserByEmail(user.Email)
 	if err != nil {
 		return false, err
 	}
-	if tmpUser.Password == user.Password {
-		return true, nil
-	} else {
+	if tmpUser == nil {
 		return false, nil
 	}
+	ok, needsRehash := util.VerifyStoredPassword(tmpUser.Password, user.Password)
+	if ok && needsRehash {
+		if hash, err := util.HashPassword(user.Password); err == nil {
+			if err := dao.UpdatePassword(tmpUser.ID, hash); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+	return ok, nil
+}
+
+// UpdatePassword 更新用户的密码哈希
+func (dao *UserDAO) UpdatePassword(userID int64, passwordHash string) error {
+	return dao.DB.Model(&models.User{}).Where("id = ?", userID).Update("password", passwordHash).Error
+}
+
+// MarkEmailVerified 将用户邮箱标记为已验证，已验证的用户保持原验证时间
+func (dao *UserDAO) MarkEmailVerified(userID int64) error {
+	return dao.DB.Model(&models.User{}).Where("id = ? AND email_verified = ?", userID, false).
+		Updates(map[string]interface{}{"email_verified": true, "email_verified_at": time.Now()}).Error
+}
+
+// SetTOTPSecret 保存待确认的两步验证密钥，仅在尚未启用两步验证时生效
+func (dao *UserDAO) SetTOTPSecret(userID int64, secret string) error {
+	return dao.DB.Model(&models.User{}).Where("id = ? AND totp_enabled = ?", userID, false).
+		Update("totp_secret", secret).Error
+}
+
+// EnableTOTP 启用两步验证
+func (dao *UserDAO) EnableTOTP(userID int64) error {
+	return dao.DB.Model(&models.User{}).Where("id = ?", userID).
+		Updates(map[string]interface{}{"totp_enabled": true, "totp_enabled_at": time.Now()}).Error
+}
+
+// DisableTOTP 关闭两步验证并清除密钥
+func (dao *UserDAO) DisableTOTP(userID int64) error {
+	return dao.DB.Model(&models.User{}).Where("id = ?", userID).
+		Updates(map[string]interface{}{"totp_enabled": false, "totp_enabled_at": nil, "totp_secret": ""}).Error
+}
+
+// UpdateProfile 更新用户资料中的指定字段，只允许昵称与简介
+func (dao *UserDAO) UpdateProfile(userID int64, updates map[string]interface{}) error {
+	return dao.DB.Model(&models.User{}).Where("id = ?", userID).Select("nickname", "bio").Updates(updates).Error
+}
+
+// SetAvatarUpdatedAt 记录头像更新时间，传入 nil 表示删除头像
+func (dao *UserDAO) SetAvatarUpdatedAt(userID int64, updatedAt *time.Time) error {
+	return dao.DB.Model(&models.User{}).Where("id = ?", userID).Update("avatar_updated_at", updatedAt).Error
+}
+
+// SetMembership 设置用户的会员套餐与到期时间
+func (dao *UserDAO) SetMembership(userID int64, plan string, expiryAt time.Time) error {
+	return dao.DB.Model(&models.User{}).Where("id = ?", userID).
+		Updates(map[string]interface{}{"plan": plan, "expiry_at": expiryAt}).Error
+}
+
+// SetDisabled 停用或启用账号，disabledAt 为 nil 表示启用
+func (dao *UserDAO) SetDisabled(userID int64, disabledAt *time.Time, reason string) error {
+	return dao.DB.Model(&models.User{}).Where("id = ?", userID).
+		Updates(map[string]interface{}{"disabled_at": disabledAt, "disabled_reason": reason}).Error
+}
+
+// SetRole 修改用户的系统角色
+func (dao *UserDAO) SetRole(userID int64, role string) error {
+	return dao.DB.Model(&models.User{}).Where("id = ?", userID).Update("role", role).Error
+}
+
+// PromoteAdmins 将指定邮箱的用户设为管理员，返回实际更新的数量
+func (dao *UserDAO) PromoteAdmins(emails []string) (int64, error) {
+	if len(emails) == 0 {
+		return 0, nil
+	}
+	result := dao.DB.Model(&models.User{}).Where("email IN ? AND role <> ?", emails, models.UserRoleAdmin).
+		Update("role", models.UserRoleAdmin)
+	return result.RowsAffected, result.Error
 }
 
 // NewUserDAO 创建一个新的 UserDAO 实例
@@ -30,8 +105,13 @@ func NewUserDAO() *UserDAO {
 	return &UserDAO{DB: db.GetDB()}
 }
 
-// CreateUser 创建一个新用户
+// CreateUser 创建一个新用户，密码以 bcrypt 哈希存储
 func (dao *UserDAO) CreateUser(user models.User) error {
+	hash, err := util.HashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+	user.Password = hash
 	user.RegisteredAt = time.Now()
 	user.ExpiryAt = time.Now()
 	user.LastLoginAt = time.Now()
@@ -50,6 +130,16 @@ func (dao *UserDAO) GetUserByID(id int64) (*models.User, error) {
 	return &user, nil
 }
 
+// GetUsersByIDs 批量获取用户，不存在的用户不出现在结果中
+func (dao *UserDAO) GetUsersByIDs(ids []int64) ([]models.User, error) {
+	var users []models.User
+	if len(ids) == 0 {
+		return users, nil
+	}
+	err := dao.DB.Where("id IN ?", ids).Find(&users).Error
+	return users, err
+}
+
 // GetUserByEmail 根据用户邮箱获取用户
 func (dao *UserDAO) GetUserByEmail(email string) (*models.User, error) {
 	var user models.User
@@ -0,0 +1,54 @@
+package dao
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"time"
+	"yuqueppbackend/service-base/models"
+)
+
+// UserIdentityDAO 处理外部登录身份相关的数据库操作
+type UserIdentityDAO struct {
+	db *gorm.DB
+}
+
+// NewUserIdentityDAO 创建一个新的 UserIdentityDAO 实例
+func NewUserIdentityDAO(db *gorm.DB) *UserIdentityDAO {
+	return &UserIdentityDAO{db: db}
+}
+
+// GetIdentity 根据身份提供方与 sub 获取关联的身份，不存在时返回 nil
+func (dao *UserIdentityDAO) GetIdentity(provider, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	if err := dao.db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// CreateIdentity 将外部身份关联到用户
+func (dao *UserIdentityDAO) CreateIdentity(identity *models.UserIdentity) error {
+	return dao.db.Create(identity).Error
+}
+
+// GetIdentitiesByUserID 获取用户关联的全部外部身份
+func (dao *UserIdentityDAO) GetIdentitiesByUserID(userID int64) ([]models.UserIdentity, error) {
+	var identities []models.UserIdentity
+	err := dao.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&identities).Error
+	return identities, err
+}
+
+// TouchIdentity 更新身份的最近登录时间与邮箱
+func (dao *UserIdentityDAO) TouchIdentity(identityID int64, email string) error {
+	return dao.db.Model(&models.UserIdentity{}).Where("id = ?", identityID).
+		Updates(map[string]interface{}{"last_login_at": time.Now(), "email": email}).Error
+}
+
+// DeleteIdentity 解除用户关联的外部身份，返回是否删除成功
+func (dao *UserIdentityDAO) DeleteIdentity(userID, identityID int64) (bool, error) {
+	result := dao.db.Where("id = ? AND user_id = ?", identityID, userID).Delete(&models.UserIdentity{})
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// 审计事件的操作类型
+const (
+	AuditLogin              = "auth.login"
+	AuditLogout             = "auth.logout"
+	AuditRevokeSession      = "auth.revoke_session"
+	AuditRevokeAllSessions  = "auth.revoke_all_sessions"
+	AuditChangePassword     = "auth.change_password"
+	AuditResetPassword      = "auth.reset_password"
+	AuditAccessDenied       = "access.denied"
+	AuditAccountExport      = "account.export"
+	AuditAccountDelete      = "account.delete_request"
+	AuditAccountCancel      = "account.delete_cancel"
+	AuditAccountPurge       = "account.purge"
+	AuditKBCreate           = "kb.create"
+	AuditKBUpdate           = "kb.update"
+	AuditKBDelete           = "kb.delete"
+	AuditKBExport           = "kb.export"
+	AuditDocCreate          = "doc.create"
+	AuditDocUpdate          = "doc.update"
+	AuditDocDelete          = "doc.delete"
+	AuditDocMove            = "doc.move"
+	AuditTrashRestore       = "trash.restore"
+	AuditTrashPurge         = "trash.purge"
+	AuditShareLinkCreate    = "share_link.create"
+	AuditShareLinkRevoke    = "share_link.revoke"
+	AuditShareLinkAccess    = "share_link.access"
+	AuditAdminDisableUser   = "admin.disable_user"
+	AuditAdminEnableUser    = "admin.enable_user"
+	AuditAdminSetRole       = "admin.set_role"
+	AuditAdminResetPassword = "admin.force_password_reset"
+	AuditAdminTakeDown      = "admin.take_down_comment"
+	AuditAdminGrantPlan     = "admin.grant_membership"
+	AuditAdminUnlock        = "admin.unlock_account"
+)
+
+// 审计事件的目标类型
+const (
+	AuditTargetUser      = "user"
+	AuditTargetKB        = "knowledge_base"
+	AuditTargetDocument  = "document"
+	AuditTargetShareLink = "share_link"
+	AuditTargetComment   = "comment"
+	AuditTargetTrash     = "trash_item"
+)
+
+// 审计事件的结果
+const (
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+	AuditResultDenied  = "denied"
+)
+
+// AuditLog 安全与内容相关的审计事件，只追加写入，不修改也不删除
+type AuditLog struct {
+	ID         int64     `json:"id" gorm:"primaryKey"`
+	ActorID    int64     `json:"actor_id" gorm:"index"` // 操作者，匿名访问（例如分享链接）时为 0
+	ActorEmail string    `json:"actor_email" gorm:"size:255"`
+	Action     string    `json:"action" gorm:"size:64;index"`
+	TargetType string    `json:"target_type" gorm:"size:32;index:idx_audit_target"`
+	TargetID   string    `json:"target_id" gorm:"size:64;index:idx_audit_target"`
+	IP         string    `json:"ip" gorm:"size:64;index"`
+	UserAgent  string    `json:"user_agent" gorm:"size:512"`
+	Result     string    `json:"result" gorm:"size:16;index"`
+	Detail     string    `json:"detail" gorm:"size:512"` // 补充说明，例如失败原因
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
+
+// 使用 BeforeCreate 钩子自动生成雪花 ID
+func (auditLog *AuditLog) BeforeCreate(tx *gorm.DB) (err error) {
+	auditLog.ID = node.Generate().Int64() // 使用雪花算法生成唯一 ID
+	return
+}
@@ -5,6 +5,12 @@ import (
 	"time"
 )
 
+// CommentStatusPublished 已发布的评论，公开接口只返回该状态的评论
+const CommentStatusPublished = "已发布"
+
+// CommentStatusTakenDown 被管理员下架的评论，任何接口都不再返回
+const CommentStatusTakenDown = "已下架"
+
 type DocumentComment struct {
 	ID           int64     `json:"comment_id" gorm:"primaryKey"`       // 评论 ID，主键
 	DocumentID   int64     `json:"document_id" gorm:"index"`           // 外键，关联文档，添加索引
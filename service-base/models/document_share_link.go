@@ -0,0 +1,43 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// 分享链接的权限
+const (
+	SharePermissionRead    = "read"    // 只读
+	SharePermissionComment = "comment" // 只读 + 查看与发表评论
+)
+
+// DocumentShareLink 文档分享链接，持有 token 的人无需登录即可访问单个文档
+type DocumentShareLink struct {
+	ID           int64      `json:"share_id" gorm:"primaryKey"`       // 使用 int64 存储雪花算法生成的 ID
+	Token        string     `json:"token" gorm:"size:64;uniqueIndex"` // 分享链接中的随机 token
+	DocumentID   int64      `json:"doc_id" gorm:"index"`              // 被分享的文档
+	OwnerID      int64      `json:"owner_id" gorm:"index"`            // 创建分享链接的用户
+	Permission   string     `json:"permission"`                       // read 或 comment
+	PasswordHash string     `json:"-"`                                // 访问密码的 bcrypt 哈希，为空表示无需密码
+	ExpireAt     *time.Time `json:"expire_at"`                        // 过期时间，为空表示永不过期
+	RevokedAt    *time.Time `json:"revoked_at"`                       // 撤销时间，撤销后链接立即失效
+	AccessCount  int64      `json:"access_count" gorm:"default:0"`    // 访问次数
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+
+	Document Document `json:"document" gorm:"foreignKey:DocumentID;references:ID"`
+}
+
+// 使用 BeforeCreate 钩子自动生成雪花 ID
+func (link *DocumentShareLink) BeforeCreate(tx *gorm.DB) (err error) {
+	link.ID = node.Generate().Int64() // 使用雪花算法生成唯一 ID
+	return
+}
+
+// IsActive 判断分享链接当前是否有效
+func (link *DocumentShareLink) IsActive(now time.Time) bool {
+	if link.RevokedAt != nil {
+		return false
+	}
+	return link.ExpireAt == nil || now.Before(*link.ExpireAt)
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// DocumentVersion 文档历史版本，每次保存文档都会生成一条不可变的版本记录
+type DocumentVersion struct {
+	ID          int64     `json:"version_id" gorm:"primaryKey"`                    // 使用 int64 存储雪花算法生成的 ID
+	DocumentID  int64     `json:"doc_id" gorm:"index;uniqueIndex:idx_doc_version"` // 外键，所属文档
+	Version     int       `json:"version" gorm:"uniqueIndex:idx_doc_version"`      // 文档内的递增版本号，从 1 开始
+	AuthorID    int64     `json:"author_id" gorm:"index"`                          // 保存该版本的用户
+	ContentHash string    `json:"content_hash"`                                    // 版本内容的 SHA256 哈希值
+	ContentSize int64     `json:"content_size"`                                    // 版本内容的字节数
+	Title       string    `json:"doc_title"`                                       // 保存时的文档标题
+	RestoredID  *int64    `json:"restored_from"`                                   // 如果该版本由恢复操作产生，记录来源版本 ID
+	CreatedAt   time.Time `json:"created_at" gorm:"index"`                         // 版本创建时间
+
+	// 关联的作者
+	Author User `json:"author" gorm:"foreignKey:AuthorID;references:ID"`
+}
+
+// 使用 BeforeCreate 钩子自动生成雪花 ID
+func (v *DocumentVersion) BeforeCreate(tx *gorm.DB) (err error) {
+	v.ID = node.Generate().Int64() // 使用雪花算法生成唯一 ID
+	return
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// 知识库成员角色，权限从低到高排列；owner 为知识库所有者，不单独存储在成员表中
+const (
+	RoleViewer    = "viewer"    // 只读
+	RoleCommenter = "commenter" // 只读 + 评论
+	RoleEditor    = "editor"    // 创建、编辑、移动、删除文档
+	RoleAdmin     = "admin"     // 管理知识库信息与成员
+	RoleOwner     = "owner"     // 知识库所有者
+)
+
+var roleRanks = map[string]int{
+	RoleViewer:    1,
+	RoleCommenter: 2,
+	RoleEditor:    3,
+	RoleAdmin:     4,
+	RoleOwner:     5,
+}
+
+// RoleRank 返回角色的权限等级，未知角色为 0
+func RoleRank(role string) int {
+	return roleRanks[role]
+}
+
+// IsAssignableRole 判断角色是否可以分配给成员（owner 不可分配）
+func IsAssignableRole(role string) bool {
+	return role != RoleOwner && RoleRank(role) > 0
+}
+
+// KnowledgeBaseMember 知识库成员
+type KnowledgeBaseMember struct {
+	ID              int64     `json:"member_id" gorm:"primaryKey"`                    // 使用 int64 存储雪花算法生成的 ID
+	KnowledgeBaseID int64     `json:"kb_id" gorm:"uniqueIndex:idx_kb_member"`         // 所属知识库
+	UserID          int64     `json:"user_id" gorm:"uniqueIndex:idx_kb_member;index"` // 成员用户
+	Role            string    `json:"role"`                                           // 成员角色
+	InvitedBy       int64     `json:"invited_by"`                                     // 邀请人
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+
+	User User `json:"user" gorm:"foreignKey:UserID;references:ID"`
+}
+
+// 使用 BeforeCreate 钩子自动生成雪花 ID
+func (member *KnowledgeBaseMember) BeforeCreate(tx *gorm.DB) (err error) {
+	member.ID = node.Generate().Int64() // 使用雪花算法生成唯一 ID
+	return
+}
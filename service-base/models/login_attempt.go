@@ -0,0 +1,23 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// LoginAttempt 失败的登录尝试，供管理员排查暴力破解
+type LoginAttempt struct {
+	ID        int64     `json:"id" gorm:"primaryKey"`
+	Email     string    `json:"email" gorm:"size:255;index"` // 尝试登录的邮箱，不一定是已注册的用户
+	UserID    *int64    `json:"user_id" gorm:"index"`        // 邮箱对应的用户，未注册时为空
+	IP        string    `json:"ip" gorm:"size:64;index"`
+	UserAgent string    `json:"user_agent"`
+	Reason    string    `json:"reason" gorm:"size:32"` // 失败原因，例如 bad_password、captcha、locked
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// 使用 BeforeCreate 钩子自动生成雪花 ID
+func (attempt *LoginAttempt) BeforeCreate(tx *gorm.DB) (err error) {
+	attempt.ID = node.Generate().Int64() // 使用雪花算法生成唯一 ID
+	return
+}
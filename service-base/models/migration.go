@@ -23,6 +23,15 @@ func MigrateDB(db *gorm.DB) error {
 		&KnowledgeBase{},
 		&Document{},
 		&DocumentComment{},
+		&DocumentVersion{},
+		&TrashItem{},
+		&KnowledgeBaseMember{},
+		&DocumentShareLink{},
+		&UserRecoveryCode{},
+		&PersonalAccessToken{},
+		&LoginAttempt{},
+		&UserIdentity{},
+		&AuditLog{},
 	); err != nil {
 		return err
 	}
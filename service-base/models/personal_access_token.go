@@ -0,0 +1,63 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// 个人访问令牌的权限范围
+const (
+	ScopeReadDocs  = "docs:read"  // 读取知识库、文档、评论与搜索
+	ScopeWriteDocs = "docs:write" // 创建、修改、移动、删除文档与知识库
+	ScopeComment   = "comment"    // 发表与回复评论
+	ScopeAdmin     = "admin"      // 管理知识库设置、成员与分享链接
+)
+
+// IsValidScope 判断是否为支持的权限范围
+func IsValidScope(scope string) bool {
+	switch scope {
+	case ScopeReadDocs, ScopeWriteDocs, ScopeComment, ScopeAdmin:
+		return true
+	}
+	return false
+}
+
+// PersonalAccessToken 个人访问令牌，供脚本与 CI 调用接口使用，只保存令牌的哈希
+type PersonalAccessToken struct {
+	ID          int64      `json:"id" gorm:"primaryKey"`
+	UserID      int64      `json:"user_id" gorm:"index"`
+	Name        string     `json:"name"`
+	TokenPrefix string     `json:"token_prefix"`                 // 令牌的前几位，便于用户辨认
+	TokenHash   string     `json:"-" gorm:"size:64;uniqueIndex"` // 令牌的 SHA256 哈希
+	Scopes      string     `json:"scopes"`                       // 逗号分隔的权限范围
+	ExpireAt    *time.Time `json:"expire_at"`                    // 过期时间，为空表示永不过期
+	LastUsedAt  *time.Time `json:"last_used_at"`                 // 最近使用时间
+	LastUsedIP  string     `json:"last_used_ip"`                 // 最近使用的 IP
+	RevokedAt   *time.Time `json:"revoked_at"`                   // 撤销时间，为空表示未撤销
+	CreatedAt   time.Time  `json:"created_at"`
+
+	User User `json:"-" gorm:"foreignKey:UserID;references:ID"`
+}
+
+// 使用 BeforeCreate 钩子自动生成雪花 ID
+func (token *PersonalAccessToken) BeforeCreate(tx *gorm.DB) (err error) {
+	token.ID = node.Generate().Int64() // 使用雪花算法生成唯一 ID
+	return
+}
+
+// ScopeList 返回令牌的权限范围列表
+func (token *PersonalAccessToken) ScopeList() []string {
+	if token.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(token.Scopes, ",")
+}
+
+// IsActive 令牌未被撤销且未过期
+func (token *PersonalAccessToken) IsActive(now time.Time) bool {
+	if token.RevokedAt != nil {
+		return false
+	}
+	return token.ExpireAt == nil || now.Before(*token.ExpireAt)
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// 会员套餐
+const (
+	PlanFree = "free" // 免费版，会员到期后自动回到该套餐
+	PlanPro  = "pro"  // 专业版
+	PlanTeam = "team" // 团队版
+)
+
+// IsValidPlan 是否为有效的套餐
+func IsValidPlan(plan string) bool {
+	return plan == PlanFree || plan == PlanPro || plan == PlanTeam
+}
+
+// EffectivePlan 用户当前生效的套餐，付费套餐在 ExpiryAt 之后失效
+func (user *User) EffectivePlan(now time.Time) string {
+	if user.Plan == "" || user.Plan == PlanFree || !user.ExpiryAt.After(now) {
+		return PlanFree
+	}
+	return user.Plan
+}
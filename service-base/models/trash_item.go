@@ -0,0 +1,30 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// 回收站条目类型
+const (
+	TrashItemDocument      = "document"
+	TrashItemKnowledgeBase = "knowledge_base"
+)
+
+// TrashItem 回收站条目，记录被用户删除、仍可恢复的文档或知识库
+type TrashItem struct {
+	ID              int64     `json:"trash_id" gorm:"primaryKey"`            // 使用 int64 存储雪花算法生成的 ID
+	OwnerID         int64     `json:"owner_id" gorm:"index"`                 // 回收站所属用户
+	ItemType        string    `json:"item_type" gorm:"index:idx_trash_item"` // document / knowledge_base
+	ItemID          int64     `json:"item_id" gorm:"index:idx_trash_item"`   // 被删除的文档或知识库 ID
+	Title           string    `json:"title"`                                 // 删除时的文档标题或知识库名称
+	KnowledgeBaseID int64     `json:"kb_id"`                                 // 文档所属的知识库，知识库条目为自身 ID
+	DeletedAt       time.Time `json:"deleted_at"`                            // 删除时间
+	ExpireAt        time.Time `json:"expire_at" gorm:"index"`                // 超过该时间后会被后台任务彻底删除
+}
+
+// 使用 BeforeCreate 钩子自动生成雪花 ID
+func (item *TrashItem) BeforeCreate(tx *gorm.DB) (err error) {
+	item.ID = node.Generate().Int64() // 使用雪花算法生成唯一 ID
+	return
+}
@@ -18,15 +18,39 @@ func init() {
 	}
 }
 
+// 用户的系统角色
+const (
+	UserRoleUser  = "user"  // 普通用户
+	UserRoleAdmin = "admin" // 管理员
+)
+
 // 用户模型
 type User struct {
 	ID           int64     `json:"id" gorm:"primaryKey"`                         // 主键，自动增长
 	Email        string    `json:"email" binding:"required" gorm:"unique;index"` // 唯一约束
 	Nickname     string    `json:"nickname" binding:"required"`
-	Password     string    `json:"password" binding:"required"`
+	Password     string    `json:"-" binding:"required"` // bcrypt 哈希，早期注册的用户在下次登录时由明文升级
 	RegisteredAt time.Time `json:"registered_at"`
 	LastLoginAt  time.Time `json:"last_login_at"`
-	ExpiryAt     time.Time `json:"expiry_at"` // 会员到期时间
+	ExpiryAt     time.Time `json:"expiry_at"`                        // 会员到期时间，到期后套餐回到 free
+	Plan         string    `json:"plan" gorm:"size:16;default:free"` // 会员套餐：free、pro 或 team
+
+	DisabledAt     *time.Time `json:"disabled_at" gorm:"index"`               // 账号停用时间，为空表示正常
+	DisabledReason string     `json:"disabled_reason" gorm:"size:255"`        // 停用原因，仅管理员可见
+	Role           string     `json:"role" gorm:"size:16;default:user;index"` // 系统角色：user 或 admin
+
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at" gorm:"index"` // 计划注销的时间，为空表示未申请注销，到期前可以撤销
+	AccountDeletedAt    *time.Time `json:"account_deleted_at"`                 // 注销完成的时间，注销后只保留匿名化的用户记录
+
+	Bio             string     `json:"bio" gorm:"size:512"` // 个人简介
+	AvatarUpdatedAt *time.Time `json:"avatar_updated_at"`   // 头像更新时间，为空表示未上传头像，同时作为头像地址的版本号
+
+	EmailVerified   bool       `json:"email_verified"`    // 是否已验证邮箱
+	EmailVerifiedAt *time.Time `json:"email_verified_at"` // 邮箱验证时间
+
+	TOTPSecret    string     `json:"-" gorm:"column:totp_secret"`                   // 两步验证密钥，启用前为待确认的密钥
+	TOTPEnabled   bool       `json:"totp_enabled" gorm:"column:totp_enabled"`       // 是否已启用两步验证
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at" gorm:"column:totp_enabled_at"` // 两步验证启用时间
 }
 
 // 使用 BeforeCreate 钩子自动生成雪花 ID
@@ -34,3 +58,18 @@ func (user *User) BeforeCreate(tx *gorm.DB) (err error) {
 	user.ID = node.Generate().Int64() // 使用雪花算法生成唯一 ID
 	return
 }
+
+// IsAdmin 是否为管理员
+func (user *User) IsAdmin() bool {
+	return user.Role == UserRoleAdmin
+}
+
+// IsPendingDeletion 是否已申请注销、正处于宽限期内
+func (user *User) IsPendingDeletion() bool {
+	return user.DeletionScheduledAt != nil && user.AccountDeletedAt == nil
+}
+
+// IsDisabled 账号是否已被管理员停用
+func (user *User) IsDisabled() bool {
+	return user.DisabledAt != nil
+}
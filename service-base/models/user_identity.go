@@ -0,0 +1,25 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// UserIdentity 用户在外部身份提供方（OIDC）的身份，同一用户可以关联多个身份
+type UserIdentity struct {
+	ID          int64      `json:"id" gorm:"primaryKey"`
+	UserID      int64      `json:"user_id" gorm:"index"`
+	Provider    string     `json:"provider" gorm:"size:64;uniqueIndex:idx_identity_provider_subject"` // 配置中的身份提供方标识
+	Subject     string     `json:"subject" gorm:"size:255;uniqueIndex:idx_identity_provider_subject"` // ID Token 中的 sub
+	Email       string     `json:"email"`                                                             // 关联时身份提供方返回的邮箱
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+
+	User User `json:"-" gorm:"foreignKey:UserID;references:ID"`
+}
+
+// 使用 BeforeCreate 钩子自动生成雪花 ID
+func (identity *UserIdentity) BeforeCreate(tx *gorm.DB) (err error) {
+	identity.ID = node.Generate().Int64() // 使用雪花算法生成唯一 ID
+	return
+}
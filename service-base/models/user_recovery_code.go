@@ -0,0 +1,23 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// UserRecoveryCode 两步验证的一次性恢复码，只保存哈希
+type UserRecoveryCode struct {
+	ID        int64      `json:"id" gorm:"primaryKey"`
+	UserID    int64      `json:"user_id" gorm:"index"`
+	CodeHash  string     `json:"-" gorm:"size:64;index"`
+	UsedAt    *time.Time `json:"used_at"` // 使用时间，为空表示未使用
+	CreatedAt time.Time  `json:"created_at"`
+
+	User User `json:"-" gorm:"foreignKey:UserID;references:ID"`
+}
+
+// 使用 BeforeCreate 钩子自动生成雪花 ID
+func (code *UserRecoveryCode) BeforeCreate(tx *gorm.DB) (err error) {
+	code.ID = node.Generate().Int64() // 使用雪花算法生成唯一 ID
+	return
+}
@@ -0,0 +1,37 @@
+package routes
+
+import (
+	"context"
+	"sync"
+	"yuqueppbackend/service-base/controllers"
+	"yuqueppbackend/service-base/dao"
+	"yuqueppbackend/service-base/db"
+	"yuqueppbackend/service-base/util"
+)
+
+// StartBackgroundJobs 启动后台任务：批量写入审计日志、清理过期的回收站条目、注销到期的账号、生成数据导出并清理过期的导出文件。
+// ctx 取消后各任务在当前一轮结束后退出，审计日志写完队列中剩余的事件后退出；返回的 WaitGroup 在全部任务退出后完成
+func StartBackgroundJobs(ctx context.Context) *sync.WaitGroup {
+	kbDao := dao.NewKBDAO(db.GetDB(), util.GetElasticSearchClient())
+	docDao := dao.NewDocDao(db.GetDB(), util.GetElasticSearchClient())
+	dcDao := dao.NewCommentDAO(db.GetDB())
+	quotaController := controllers.NewQuotaController(dao.NewQuotaDAO(db.GetDB()))
+	trashController := controllers.NewTrashController(dao.NewTrashDAO(db.GetDB()), docDao, kbDao, dcDao, quotaController)
+	accountController := controllers.NewAccountController(dao.NewAccountDAO(db.GetDB()), kbDao, docDao, dcDao, dao.NewUserIdentityDAO(db.GetDB()))
+
+	var wg sync.WaitGroup
+	jobs := []func(context.Context){
+		controllers.RunAuditLogWriter,
+		trashController.RunTrashSweeper,
+		accountController.RunAccountSweeper,
+		accountController.RunDataExportWorker,
+	}
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job func(context.Context)) {
+			defer wg.Done()
+			job(ctx)
+		}(job)
+	}
+	return &wg
+}
@@ -6,6 +6,7 @@ import (
 	"yuqueppbackend/service-base/controllers"
 	"yuqueppbackend/service-base/dao"
 	"yuqueppbackend/service-base/db"
+	"yuqueppbackend/service-base/models"
 	"yuqueppbackend/service-base/util"
 )
 
@@ -13,33 +14,104 @@ func SetupRouter() *gin.Engine {
 	r := gin.Default()
 	// 设置 CORS 配置
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"},                                       // 允许的跨域来源（可以是 *，但不推荐用于生产环境）
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}, // 允许的 HTTP 方法
-		AllowHeaders:     []string{"Content-Type", "Authorization"},           // 允许的请求头
-		AllowCredentials: true,                                                // 是否允许携带凭证（如 Cookies）
+		AllowOrigins:     []string{"*"},                                                                              // 允许的跨域来源（可以是 *，但不推荐用于生产环境）
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},                                        // 允许的 HTTP 方法
+		AllowHeaders:     []string{"Content-Type", "Authorization", "If-Match", "If-None-Match", "X-Share-Password"}, // 允许的请求头
+		ExposeHeaders:    []string{"ETag"},                                                                           // 允许前端读取的响应头
+		AllowCredentials: true,                                                                                       // 是否允许携带凭证（如 Cookies）
 	}))
 
 	// 初始化 DAO 和 Controller
 	kbDao := dao.NewKBDAO(db.GetDB(), util.GetElasticSearchClient())
-	kbController := controllers.NewKnowledgeBaseController(kbDao)
 	docDao := dao.NewDocDao(db.GetDB(), util.GetElasticSearchClient())
-	docController := controllers.NewDocumentController(docDao)
+	trashDao := dao.NewTrashDAO(db.GetDB())
+	kbMemberDao := dao.NewKBMemberDAO(db.GetDB())
+	// 文档、评论、搜索等接口统一通过 authz 校验知识库权限
+	authz := controllers.NewAuthorizer(kbMemberDao, docDao)
+	// 创建与保存接口按知识库所有者的会员套餐校验配额
+	quotaController := controllers.NewQuotaController(dao.NewQuotaDAO(db.GetDB()))
+	kbController := controllers.NewKnowledgeBaseController(kbDao, docDao, trashDao, kbMemberDao, authz, quotaController)
+	docVersionDao := dao.NewDocVersionDao(db.GetDB())
+	docController := controllers.NewDocumentController(docDao, docVersionDao, trashDao, authz, quotaController)
 	dcDao := dao.NewCommentDAO(db.GetDB())
-	dcController := controllers.NewCommentController(dcDao)
+	trashController := controllers.NewTrashController(trashDao, docDao, kbDao, dcDao, quotaController)
+	collabController := controllers.NewCollabController(docController)
+	dcController := controllers.NewCommentController(dcDao, authz)
 	scDao := dao.NewSearchDao(util.GetElasticSearchClient())
-	scController := controllers.NewSearchController(scDao)
+	scController := controllers.NewSearchController(scDao, authz)
+	publicController := controllers.NewPublicController(authz, docDao, dcDao)
+	shareLinkController := controllers.NewShareLinkController(dao.NewShareLinkDAO(db.GetDB()), dcDao, authz)
+	twoFactorController := controllers.NewTwoFactorController(dao.NewRecoveryCodeDAO(db.GetDB()))
+	personalTokenController := controllers.NewPersonalTokenController(dao.NewPersonalTokenDAO(db.GetDB()))
+	profileController := controllers.NewProfileController(kbDao)
+	oidcController := controllers.NewOIDCController(dao.NewUserIdentityDAO(db.GetDB()))
+	adminController := controllers.NewAdminController(dao.NewAdminDAO(db.GetDB()), kbDao, docDao, kbMemberDao, dcDao)
+	accountController := controllers.NewAccountController(dao.NewAccountDAO(db.GetDB()), kbDao, docDao, dcDao, dao.NewUserIdentityDAO(db.GetDB()))
+	// AuthMiddleware 通过该函数校验个人访问令牌
+	util.SetPersonalTokenValidator(personalTokenController.ValidatePersonalToken)
+
+	// 个人访问令牌需要拥有对应的权限范围，登录会话不受限制；
+	// 没有声明权限范围（或 sessionOnly）的路由一律拒绝个人访问令牌
+	readScope := util.RequireScope(models.ScopeReadDocs)
+	writeScope := util.RequireScope(models.ScopeWriteDocs)
+	commentScope := util.RequireScope(models.ScopeComment)
+	adminScope := util.RequireScope(models.ScopeAdmin)
+	sessionOnly := util.RequireSession()
+
+	// 发布 JWT 校验公钥，供其他服务校验本服务签发的 token
+	r.GET("/.well-known/jwks.json", controllers.GetJWKS)
 
 	authGroup := r.Group("/api/auth")
 	{
 		authGroup.POST("register", controllers.Register)
 		authGroup.POST("login", controllers.Login)
+		authGroup.POST("login2fa", twoFactorController.Login2FA)
+		authGroup.POST("refresh", controllers.RefreshToken)
+		authGroup.POST("verifyEmail", controllers.VerifyEmail)
+		authGroup.POST("forgotPassword", controllers.ForgotPassword)
+		authGroup.POST("resetPassword", controllers.ResetPassword)
+		// OpenID Connect 单点登录
+		authGroup.GET("oidc/providers", oidcController.GetOIDCProviderList)
+		authGroup.GET("oidc/:provider/login", oidcController.OIDCLogin)
+		authGroup.GET("oidc/:provider/callback", oidcController.OIDCCallback)
+		authGroup.POST("oidc/exchange", oidcController.OIDCExchange)
 	}
 
 	userGroup := r.Group("/api/user")
 	userGroup.Use(util.AuthMiddleware())
 	{
-		userGroup.GET("getUserInfo", controllers.GetUserInfo)
-		userGroup.POST("logout", controllers.Logout)
+		userGroup.GET("getUserInfo", readScope, controllers.GetUserInfo)
+		userGroup.GET("getUsage", readScope, quotaController.GetUsage)
+		userGroup.POST("logout", sessionOnly, controllers.Logout)
+		// 个人资料与头像
+		userGroup.POST("updateProfile", sessionOnly, profileController.UpdateProfile)
+		userGroup.POST("uploadAvatar", sessionOnly, profileController.UploadAvatar)
+		userGroup.POST("deleteAvatar", sessionOnly, profileController.DeleteAvatar)
+		userGroup.POST("changePassword", sessionOnly, controllers.ChangePassword)
+		userGroup.POST("sendVerificationEmail", sessionOnly, controllers.SendVerificationEmail)
+		userGroup.GET("getSessionList", sessionOnly, controllers.GetSessionList)
+		userGroup.GET("getTotpStatus", sessionOnly, twoFactorController.GetTOTPStatus)
+		userGroup.POST("enrollTotp", sessionOnly, twoFactorController.EnrollTOTP)
+		userGroup.POST("confirmTotp", sessionOnly, twoFactorController.ConfirmTOTP)
+		userGroup.POST("sendDisableTotpEmail", sessionOnly, twoFactorController.SendDisableTOTPEmail)
+		userGroup.POST("disableTotp", sessionOnly, twoFactorController.DisableTOTP)
+		userGroup.POST("regenerateRecoveryCodes", sessionOnly, twoFactorController.RegenerateRecoveryCodes)
+		userGroup.POST("revokeSession/:session_id", sessionOnly, controllers.RevokeSession)
+		userGroup.POST("revokeAllSessions", sessionOnly, controllers.RevokeAllSessions)
+		// 个人访问令牌相关路由
+		userGroup.GET("getAccessTokenList", sessionOnly, personalTokenController.GetPersonalTokenList)
+		userGroup.POST("createAccessToken", sessionOnly, personalTokenController.CreatePersonalToken)
+		userGroup.POST("revokeAccessToken/:token_id", sessionOnly, personalTokenController.RevokePersonalToken)
+		// 单点登录关联的外部身份
+		userGroup.GET("getIdentityList", sessionOnly, oidcController.GetIdentityList)
+		userGroup.POST("unlinkIdentity/:identity_id", sessionOnly, oidcController.UnlinkIdentity)
+		// 个人数据导出与账号注销
+		userGroup.POST("requestDataExport", sessionOnly, accountController.RequestDataExport)
+		userGroup.GET("getDataExport", sessionOnly, accountController.GetDataExport)
+		userGroup.GET("downloadDataExport", sessionOnly, accountController.DownloadDataExport)
+		userGroup.POST("sendAccountDeletionEmail", sessionOnly, accountController.SendAccountDeletionEmail)
+		userGroup.POST("deleteAccount", sessionOnly, accountController.DeleteAccount)
+		userGroup.POST("cancelAccountDeletion", sessionOnly, accountController.CancelAccountDeletion)
 	}
 
 	utilGroup := r.Group("/api/util")
@@ -51,41 +123,114 @@ func SetupRouter() *gin.Engine {
 	knowledgeGroup := r.Group("/api/knowledge")
 	knowledgeGroup.Use(util.AuthMiddleware()) // 使用认知中间件
 	{
-		knowledgeGroup.POST("/createKnowledgeBase", kbController.CreateKnowledgeBase)
-		knowledgeGroup.GET("/getKnowledgeBaseList", kbController.GetKnowledgeBaseList)
-		knowledgeGroup.GET("/:kb_id", kbController.GetKnowledgeBaseDetail)
-		knowledgeGroup.POST("/updateKnowledgeBase", kbController.UpdateKnowledgeBase)
-		knowledgeGroup.POST("/deleteKnowledgeBase", kbController.DeleteKnowledgeBase)
+		knowledgeGroup.POST("/createKnowledgeBase", writeScope, kbController.CreateKnowledgeBase)
+		knowledgeGroup.GET("/getKnowledgeBaseList", readScope, kbController.GetKnowledgeBaseList)
+		knowledgeGroup.GET("/:kb_id", readScope, kbController.GetKnowledgeBaseDetail)
+		knowledgeGroup.POST("/updateKnowledgeBase", adminScope, kbController.UpdateKnowledgeBase)
+		knowledgeGroup.POST("/deleteKnowledgeBase", adminScope, kbController.DeleteKnowledgeBase)
+		knowledgeGroup.GET("/exportKnowledgeBase/:kb_id", readScope, kbController.ExportKnowledgeBase)
+		// 知识库成员相关路由
+		knowledgeGroup.GET("/getMemberList/:kb_id", readScope, kbController.GetKnowledgeBaseMemberList)
+		knowledgeGroup.POST("/inviteMember", adminScope, kbController.InviteKnowledgeBaseMember)
+		knowledgeGroup.POST("/updateMemberRole", adminScope, kbController.UpdateKnowledgeBaseMemberRole)
+		knowledgeGroup.POST("/removeMember", adminScope, kbController.RemoveKnowledgeBaseMember)
 	}
 
 	documentGroup := r.Group("/api/document")
 	documentGroup.Use(util.AuthMiddleware())
 	{
 		// 文档相关路由
-		documentGroup.POST("/createDocument", docController.CreateDocumentHandler)
-		documentGroup.GET("/getDocument/:doc_id", docController.GetDocumentByIDHandler)
-		documentGroup.GET("/getDocumentListByKbId/:kb_id", docController.GetDocumentsByKnowledgeBaseIDHandler)
-		documentGroup.PUT("/updateDocument/:doc_id", docController.UpdateDocumentHandler)
-		documentGroup.DELETE("/deleteDocument/:doc_id", docController.DeleteDocumentByIDHandler)
-		documentGroup.POST("/documents/:doc_id/view", docController.IncrementViewCountHandler)
-		documentGroup.GET("/recentViewDocument", docController.GetRecentViewDocumentsHandler)
-		documentGroup.GET("/recentEditDocument", docController.GetRecentEditDocumentsHandler)
-		documentGroup.GET("/recentCommentDocument", docController.GetRecentCommentDocumentsHandler)
-		documentGroup.GET("/documentContentHash/:doc_id", docController.GetDocumenHashByIdHandler)
+		documentGroup.POST("/createDocument", writeScope, docController.CreateDocumentHandler)
+		documentGroup.GET("/getDocument/:doc_id", readScope, docController.GetDocumentByIDHandler)
+		documentGroup.GET("/getDocumentListByKbId/:kb_id", readScope, docController.GetDocumentsByKnowledgeBaseIDHandler)
+		documentGroup.GET("/getDocumentTree/:kb_id", readScope, docController.GetDocumentTreeHandler)
+		documentGroup.POST("/moveDocument", writeScope, docController.MoveDocumentHandler)
+		documentGroup.PUT("/updateDocument/:doc_id", writeScope, docController.UpdateDocumentHandler)
+		documentGroup.DELETE("/deleteDocument/:doc_id", writeScope, docController.DeleteDocumentByIDHandler)
+		documentGroup.POST("/documents/:doc_id/view", readScope, docController.IncrementViewCountHandler)
+		documentGroup.GET("/recentViewDocument", readScope, docController.GetRecentViewDocumentsHandler)
+		documentGroup.GET("/recentEditDocument", readScope, docController.GetRecentEditDocumentsHandler)
+		documentGroup.GET("/recentCommentDocument", readScope, docController.GetRecentCommentDocumentsHandler)
+		documentGroup.GET("/documentContentHash/:doc_id", readScope, docController.GetDocumenHashByIdHandler)
+		// 文档历史版本相关路由
+		documentGroup.GET("/getDocumentVersionList/:doc_id", readScope, docController.GetDocumentVersionListHandler)
+		documentGroup.GET("/getDocumentVersion/:doc_id/:version_id", readScope, docController.GetDocumentVersionHandler)
+		documentGroup.POST("/restoreDocumentVersion/:doc_id/:version_id", writeScope, docController.RestoreDocumentVersionHandler)
+		documentGroup.GET("/diffDocumentVersion/:doc_id", readScope, docController.DiffDocumentVersionHandler)
+		// 文档实时协同编辑（WebSocket）
+		documentGroup.GET("/collaborate/:doc_id", readScope, collabController.CollabDocumentHandler)
+		// 文档分享链接相关路由
+		documentGroup.POST("/createShareLink", adminScope, shareLinkController.CreateShareLinkHandler)
+		documentGroup.GET("/getShareLinkList", readScope, shareLinkController.GetShareLinkListHandler)
+		documentGroup.POST("/revokeShareLink/:share_id", adminScope, shareLinkController.RevokeShareLinkHandler)
 	}
 	documentCommentGroup := r.Group("/api/comment")
 	documentCommentGroup.Use(util.AuthMiddleware())
 	{
-		documentCommentGroup.POST("/createDocumentComment", dcController.CreateDocumentComment)
-		documentCommentGroup.POST("/replyDocumentComment", dcController.ReplyDocumentComment)
-		documentCommentGroup.GET("/getDocumentRootComment/:doc_id", dcController.GetDocumentRootComment)
-		documentCommentGroup.GET("/getChildrenComment/:root_id", dcController.GetDocumentChildComment)
+		documentCommentGroup.POST("/createDocumentComment", commentScope, dcController.CreateDocumentComment)
+		documentCommentGroup.POST("/replyDocumentComment", commentScope, dcController.ReplyDocumentComment)
+		documentCommentGroup.GET("/getDocumentRootComment/:doc_id", readScope, dcController.GetDocumentRootComment)
+		documentCommentGroup.GET("/getChildrenComment/:root_id", readScope, dcController.GetDocumentChildComment)
+	}
+	trashGroup := r.Group("/api/trash")
+	trashGroup.Use(util.AuthMiddleware())
+	{
+		trashGroup.GET("/getTrashList", readScope, trashController.GetTrashListHandler)
+		trashGroup.POST("/restore/:trash_id", writeScope, trashController.RestoreTrashItemHandler)
+		trashGroup.DELETE("/purge/:trash_id", writeScope, trashController.PurgeTrashItemHandler)
+		trashGroup.DELETE("/emptyTrash", writeScope, trashController.EmptyTrashHandler)
+	}
+	// 公开知识库的只读接口，无需登录
+	publicGroup := r.Group("/api/public")
+	{
+		publicGroup.GET("/knowledge/:kb_id", publicController.GetPublicKnowledgeBaseDetail)
+		publicGroup.GET("/document/getDocumentTree/:kb_id", publicController.GetPublicDocumentTree)
+		publicGroup.GET("/document/getDocument/:doc_id", publicController.GetPublicDocument)
+		publicGroup.GET("/comment/getDocumentRootComment/:doc_id", publicController.GetPublicDocumentRootComment)
+		publicGroup.GET("/comment/getChildrenComment/:root_id", publicController.GetPublicChildrenComment)
+		// 通过分享链接访问单个文档
+		publicGroup.GET("/share/:token", shareLinkController.GetSharedDocumentHandler)
+		publicGroup.GET("/share/:token/comments", shareLinkController.GetSharedDocumentCommentsHandler)
+		publicGroup.POST("/share/:token/comment", shareLinkController.CreateSharedDocumentCommentHandler)
+		// 用户公开主页与头像
+		publicGroup.GET("/user/:user_id", profileController.GetPublicProfile)
+		publicGroup.GET("/user/:user_id/avatar", profileController.GetUserAvatar)
 	}
 	searchGroup := r.Group("/api/search")
 	searchGroup.Use(util.AuthMiddleware())
 	{
-		searchGroup.GET("/personalKnowledgeSearch/:search_text", scController.PersonalSearchKnowledgeBaseHandler)
-		searchGroup.GET("/personalDocumentSearch/:search_text", scController.PersonalSearchDocumentTitleHandler)
+		searchGroup.GET("/personalKnowledgeSearch/:search_text", readScope, scController.PersonalSearchKnowledgeBaseHandler)
+		searchGroup.GET("/personalDocumentSearch/:search_text", readScope, scController.PersonalSearchDocumentTitleHandler)
+	}
+
+	// 管理员接口
+	adminGroup := r.Group("/api/admin")
+	adminGroup.Use(util.AuthMiddleware(), sessionOnly, controllers.RequireAdmin())
+	{
+		adminGroup.GET("/getLoginAttemptList", controllers.GetLoginAttemptList)
+		adminGroup.GET("/getLockedAccountList", controllers.GetLockedAccountList)
+		adminGroup.POST("/unlockAccount", controllers.UnlockAccount)
+		// 审计日志
+		adminGroup.GET("/getAuditLogList", controllers.GetAuditLogList)
+		adminGroup.GET("/exportAuditLogs", controllers.ExportAuditLogs)
+		// 会员套餐
+		adminGroup.GET("/getUserUsage/:user_id", quotaController.GetUserUsage)
+		adminGroup.POST("/grantMembership", quotaController.GrantMembership)
+		// 用户管理
+		adminGroup.GET("/getUserList", adminController.GetUserList)
+		adminGroup.GET("/getUser/:user_id", adminController.GetUserDetail)
+		adminGroup.POST("/disableUser", adminController.DisableUser)
+		adminGroup.POST("/enableUser", adminController.EnableUser)
+		adminGroup.POST("/forcePasswordReset", adminController.ForcePasswordReset)
+		adminGroup.POST("/setUserRole", adminController.SetUserRole)
+		// 内容查看与评论审核
+		adminGroup.GET("/getKnowledgeBaseList", adminController.GetKnowledgeBaseList)
+		adminGroup.GET("/getKnowledgeBase/:kb_id", adminController.GetKnowledgeBase)
+		adminGroup.GET("/getDocument/:doc_id", adminController.GetDocument)
+		adminGroup.GET("/getCommentList", adminController.GetCommentList)
+		adminGroup.POST("/takeDownComment/:comment_id", adminController.TakeDownComment)
+		// 全站统计
+		adminGroup.GET("/getStats", adminController.GetStats)
 	}
 
 	return r
@@ -0,0 +1,97 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"strconv"
+	"time"
+)
+
+// 个人数据导出任务的状态
+const (
+	DataExportPending = "pending"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+// DataExportTimeout 超过该时长仍未完成的导出任务视为失败（例如生成过程中服务重启），允许重新申请
+const DataExportTimeout = time.Hour
+
+// DataExport 个人数据导出任务，每个用户同时只保留最近一次，保存在 Redis 中并随导出文件一起过期
+type DataExport struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Size       int64      `json:"size"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+}
+
+func dataExportKey(userId int64) string {
+	return "dataExport:" + strconv.FormatInt(userId, 10)
+}
+
+// DataExportPrefix 用户导出文件在内容存储中的 key 前缀
+func DataExportPrefix(userId int64) string {
+	return "exports/" + strconv.FormatInt(userId, 10) + "/"
+}
+
+// DataExportFileKey 导出文件在内容存储中的 key
+func DataExportFileKey(userId int64, exportId string) string {
+	return DataExportPrefix(userId) + exportId + ".zip"
+}
+
+// SaveDataExport 保存导出任务，到 ExpiresAt 时自动过期
+func SaveDataExport(userId int64, export *DataExport) error {
+	data, err := json.Marshal(export)
+	if err != nil {
+		return err
+	}
+	ttl := time.Until(export.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	rdb := GetRedisClient()
+	return rdb.Set(rdb.Context(), dataExportKey(userId), data, ttl).Err()
+}
+
+// GetDataExport 获取用户最近一次的导出任务，没有或已过期时返回 nil
+func GetDataExport(userId int64) (*DataExport, error) {
+	rdb := GetRedisClient()
+	data, err := rdb.Get(rdb.Context(), dataExportKey(userId)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var export DataExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, err
+	}
+	if export.Status == DataExportPending && time.Since(export.CreatedAt) > DataExportTimeout {
+		export.Status = DataExportFailed
+	}
+	return &export, nil
+}
+
+// DeleteDataExport 删除用户的导出任务记录
+func DeleteDataExport(userId int64) error {
+	rdb := GetRedisClient()
+	return rdb.Del(rdb.Context(), dataExportKey(userId)).Err()
+}
+
+// PurgeUserRedisKeys 注销账号时清除 Redis 中与用户相关的登录会话、一次性令牌、登录失败计数与导出任务
+func PurgeUserRedisKeys(userId int64, email string) error {
+	if err := RevokeAllSessions(userId); err != nil {
+		return err
+	}
+	if err := RevokeEmailTokens(userId); err != nil {
+		return err
+	}
+	if _, err := UnlockAccount(email); err != nil {
+		return err
+	}
+	return DeleteDataExport(userId)
+}
@@ -0,0 +1,91 @@
+package util
+
+import (
+	"strconv"
+	"strings"
+	"yuqueppbackend/service-base/models"
+)
+
+// archiveNameMaxLength 归档中文件名与目录名的最大字符数
+const archiveNameMaxLength = 100
+
+// ArchiveDocument 知识库归档中的一篇文档及其在归档中的相对路径，例如 "父文档/子文档.md"
+type ArchiveDocument struct {
+	Doc  models.Document
+	Path string
+}
+
+var archiveNameReplacer = strings.NewReplacer(
+	"/", "_", "\\", "_", ":", "_", "*", "_", "?", "_", "\"", "_", "<", "_", ">", "_", "|", "_")
+
+// ArchiveName 将标题转换为可以在各个系统上使用的文件名
+func ArchiveName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, title)
+	name = archiveNameReplacer.Replace(name)
+	name = strings.Trim(strings.TrimSpace(name), ". ")
+	if runes := []rune(name); len(runes) > archiveNameMaxLength {
+		name = strings.TrimSpace(string(runes[:archiveNameMaxLength]))
+	}
+	if name == "" {
+		name = "无标题"
+	}
+	return name
+}
+
+// PlanArchive 按 ParentID 层级为文档分配归档路径：文档保存为 <标题>.md，子文档放在同名目录 <标题>/ 中。
+// 同级文档重名时在名称后追加文档 ID，仍然重名时再追加序号；父文档不在 docs 中（例如已进入回收站）
+// 或父子关系成环的文档放在根目录。docs 需要按同级排序顺序排列，返回结果按目录深度优先排列
+func PlanArchive(docs []models.Document) []ArchiveDocument {
+	exists := make(map[int64]bool, len(docs))
+	for _, doc := range docs {
+		exists[doc.ID] = true
+	}
+	children := make(map[int64][]models.Document)
+	var roots []models.Document
+	for _, doc := range docs {
+		if doc.ParentID == nil || !exists[*doc.ParentID] || *doc.ParentID == doc.ID {
+			roots = append(roots, doc)
+		} else {
+			children[*doc.ParentID] = append(children[*doc.ParentID], doc)
+		}
+	}
+
+	planned := make([]ArchiveDocument, 0, len(docs))
+	visited := make(map[int64]bool, len(docs))
+	// 已分配的路径，不区分大小写判断重名，避免在 Windows 与 macOS 上解压时互相覆盖
+	used := make(map[string]bool, len(docs))
+	var walk func(siblings []models.Document, dir string)
+	walk = func(siblings []models.Document, dir string) {
+		for _, doc := range siblings {
+			if visited[doc.ID] {
+				continue
+			}
+			visited[doc.ID] = true
+			name := ArchiveName(doc.Title)
+			if used[strings.ToLower(dir+name)] {
+				base := name + "-" + strconv.FormatInt(doc.ID, 10)
+				name = base
+				for i := 2; used[strings.ToLower(dir+name)]; i++ {
+					name = base + "-" + strconv.Itoa(i)
+				}
+			}
+			used[strings.ToLower(dir+name)] = true
+			planned = append(planned, ArchiveDocument{Doc: doc, Path: dir + name + ".md"})
+			if len(children[doc.ID]) > 0 {
+				walk(children[doc.ID], dir+name+"/")
+			}
+		}
+	}
+	walk(roots, "")
+	for _, doc := range docs {
+		if !visited[doc.ID] {
+			walk([]models.Document{doc}, "")
+		}
+	}
+	return planned
+}
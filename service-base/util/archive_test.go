@@ -0,0 +1,114 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"yuqueppbackend/service-base/models"
+)
+
+func archiveDoc(id int64, title string, parent int64) models.Document {
+	doc := models.Document{ID: id, Title: title}
+	if parent != 0 {
+		doc.ParentID = &parent
+	}
+	return doc
+}
+
+func archivePaths(planned []ArchiveDocument) map[int64]string {
+	paths := make(map[int64]string, len(planned))
+	for _, item := range planned {
+		paths[item.Doc.ID] = item.Path
+	}
+	return paths
+}
+
+func TestArchiveName(t *testing.T) {
+	cases := map[string]string{
+		"周报":                     "周报",
+		"a/b\\c:d*e?f\"g<h>i|j":  "a_b_c_d_e_f_g_h_i_j",
+		"  ..隐藏文件. ":             "隐藏文件",
+		"换行\n与\t制表符":             "换行与制表符",
+		"":                       "无标题",
+		"...":                    "无标题",
+		strings.Repeat("长", 150): strings.Repeat("长", archiveNameMaxLength),
+	}
+	for title, want := range cases {
+		if got := ArchiveName(title); got != want {
+			t.Errorf("ArchiveName(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
+
+func TestPlanArchiveHierarchy(t *testing.T) {
+	docs := []models.Document{
+		archiveDoc(1, "指南", 0),
+		archiveDoc(2, "安装", 1),
+		archiveDoc(3, "配置", 2),
+		archiveDoc(4, "FAQ", 0),
+		// 父文档在回收站中，放在根目录
+		archiveDoc(5, "孤儿", 99),
+		// 父文档是自身
+		archiveDoc(6, "自引用", 6),
+	}
+	planned := PlanArchive(docs)
+	want := []string{"指南.md", "指南/安装.md", "指南/安装/配置.md", "FAQ.md", "孤儿.md", "自引用.md"}
+	if len(planned) != len(want) {
+		t.Fatalf("planned %d documents, want %d", len(planned), len(want))
+	}
+	for i, item := range planned {
+		if item.Path != want[i] {
+			t.Errorf("planned[%d] = %q, want %q", i, item.Path, want[i])
+		}
+	}
+}
+
+func TestPlanArchiveDuplicateNames(t *testing.T) {
+	docs := []models.Document{
+		archiveDoc(1, "笔记-3", 0),
+		archiveDoc(2, "笔记", 0),
+		// 追加 ID 后与已有的 "笔记-3" 重名，继续追加序号
+		archiveDoc(3, "笔记", 0),
+		// 不区分大小写
+		archiveDoc(4, "Readme", 0),
+		archiveDoc(5, "README", 0),
+		// 不同目录下可以重名
+		archiveDoc(6, "笔记", 2),
+	}
+	paths := archivePaths(PlanArchive(docs))
+	want := map[int64]string{
+		1: "笔记-3.md",
+		2: "笔记.md",
+		3: "笔记-3-2.md",
+		4: "Readme.md",
+		5: "README-5.md",
+		6: "笔记/笔记.md",
+	}
+	for id, path := range want {
+		if paths[id] != path {
+			t.Errorf("doc %d path = %q, want %q", id, paths[id], path)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		if seen[strings.ToLower(path)] {
+			t.Fatalf("duplicate path %q", path)
+		}
+		seen[strings.ToLower(path)] = true
+	}
+}
+
+// 父子关系成环的文档无法从根目录到达，同样需要导出
+func TestPlanArchiveCycle(t *testing.T) {
+	docs := []models.Document{
+		archiveDoc(1, "根", 0),
+		archiveDoc(2, "甲", 3),
+		archiveDoc(3, "乙", 2),
+	}
+	paths := archivePaths(PlanArchive(docs))
+	if len(paths) != 3 {
+		t.Fatalf("planned %d documents, want 3: %v", len(paths), paths)
+	}
+	if paths[2] != "甲.md" || paths[3] != "甲/乙.md" {
+		t.Fatalf("cycle paths = %q, %q", paths[2], paths[3])
+	}
+}
@@ -0,0 +1,284 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"yuqueppbackend/service-base/config"
+)
+
+// 登录会话在 Redis 中的存储结构：
+//
+//	authSession:<sid>          会话详情（hash），过期时间与刷新令牌一致
+//	userSessions:<uid>         用户的全部会话 ID（set）
+//	refreshToken:<sha256>      刷新令牌 -> 会话 ID，使用过后改为 "used:<sid>" 用于检测重放
+const (
+	sessionKeyPrefix      = "authSession:"
+	userSessionsKeyPrefix = "userSessions:"
+	refreshTokenKeyPrefix = "refreshToken:"
+	usedRefreshPrefix     = "used:"
+
+	// 最近活跃时间的最小写入间隔，避免每个请求都写 Redis
+	sessionTouchInterval = time.Minute
+)
+
+var (
+	// ErrRefreshTokenInvalid 刷新令牌不存在或已过期
+	ErrRefreshTokenInvalid = errors.New("refresh token invalid or expired")
+	// ErrRefreshTokenReused 已使用过的刷新令牌被再次提交，对应会话已被撤销
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// AuthSession 一个设备上的登录会话
+type AuthSession struct {
+	ID          string
+	UserID      int64
+	Email       string
+	IP          string
+	UserAgent   string
+	CreatedAt   time.Time
+	LastSeen    time.Time
+	refreshHash string
+}
+
+// TokenPair 登录或刷新后返回给客户端的令牌
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // 访问令牌有效期（秒）
+	SessionID    string `json:"session_id"`
+}
+
+func sessionKey(sessionId string) string {
+	return sessionKeyPrefix + sessionId
+}
+
+func userSessionsKey(userId int64) string {
+	return userSessionsKeyPrefix + strconv.FormatInt(userId, 10)
+}
+
+func refreshTokenKey(refreshHash string) string {
+	return refreshTokenKeyPrefix + refreshHash
+}
+
+// issueTokens 为会话签发新的访问令牌与刷新令牌，并记录刷新令牌
+func issueTokens(session *AuthSession) (*TokenPair, error) {
+	refreshToken, err := GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := GenerateAccessToken(session.UserID, session.Email, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	session.refreshHash = HashContent([]byte(refreshToken))
+
+	rdb := GetRedisClient()
+	ctx := rdb.Context()
+	ttl := config.GetRefreshTokenTTL()
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, sessionKey(session.ID), map[string]interface{}{
+		"user_id":      session.UserID,
+		"email":        session.Email,
+		"ip":           session.IP,
+		"user_agent":   session.UserAgent,
+		"created_at":   session.CreatedAt.Unix(),
+		"last_seen":    session.LastSeen.Unix(),
+		"refresh_hash": session.refreshHash,
+	})
+	pipe.Expire(ctx, sessionKey(session.ID), ttl)
+	pipe.Set(ctx, refreshTokenKey(session.refreshHash), session.ID, ttl)
+	pipe.SAdd(ctx, userSessionsKey(session.UserID), session.ID)
+	pipe.Expire(ctx, userSessionsKey(session.UserID), ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(config.GetAccessTokenTTL() / time.Second),
+		SessionID:    session.ID,
+	}, nil
+}
+
+// CreateSession 登录成功后为当前设备创建会话
+func CreateSession(userId int64, email, ip, userAgent string) (*TokenPair, error) {
+	sessionId, err := GenerateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return issueTokens(&AuthSession{
+		ID:        sessionId,
+		UserID:    userId,
+		Email:     email,
+		IP:        ip,
+		UserAgent: userAgent,
+		CreatedAt: now,
+		LastSeen:  now,
+	})
+}
+
+// RefreshSession 使用刷新令牌换取新的令牌对，旧刷新令牌随即作废。
+// 已作废的刷新令牌被再次使用时说明令牌可能已泄露，会撤销整个会话并返回 ErrRefreshTokenReused
+func RefreshSession(refreshToken, ip, userAgent string) (*TokenPair, error) {
+	rdb := GetRedisClient()
+	ctx := rdb.Context()
+	refreshHash := HashContent([]byte(refreshToken))
+	key := refreshTokenKey(refreshHash)
+
+	// GETSET 保证同一个刷新令牌只有一个请求能够换到新令牌
+	value, err := rdb.GetSet(ctx, key, usedRefreshPrefix).Result()
+	if errors.Is(err, redis.Nil) {
+		rdb.Del(ctx, key)
+		return nil, ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(value, usedRefreshPrefix) {
+		// 恢复标记，保证之后的重放仍能被识别
+		rdb.Set(ctx, key, value, config.GetRefreshTokenTTL())
+		if sessionId := strings.TrimPrefix(value, usedRefreshPrefix); sessionId != "" {
+			if session, err := GetSession(sessionId); err == nil && session != nil {
+				if _, err := RevokeSession(session.UserID, sessionId); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	// 作废的令牌保留到原有效期结束，用于检测重放
+	rdb.Set(ctx, key, usedRefreshPrefix+value, config.GetRefreshTokenTTL())
+
+	session, err := GetSession(value)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.refreshHash != refreshHash {
+		return nil, ErrRefreshTokenInvalid
+	}
+	session.IP = ip
+	session.UserAgent = userAgent
+	session.LastSeen = time.Now()
+	return issueTokens(session)
+}
+
+// GetSession 获取会话详情，会话不存在或已过期时返回 nil
+func GetSession(sessionId string) (*AuthSession, error) {
+	rdb := GetRedisClient()
+	values, err := rdb.HGetAll(rdb.Context(), sessionKey(sessionId)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	userId, err := strconv.ParseInt(values["user_id"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session %s: %w", sessionId, err)
+	}
+	createdAt, _ := strconv.ParseInt(values["created_at"], 10, 64)
+	lastSeen, _ := strconv.ParseInt(values["last_seen"], 10, 64)
+	return &AuthSession{
+		ID:          sessionId,
+		UserID:      userId,
+		Email:       values["email"],
+		IP:          values["ip"],
+		UserAgent:   values["user_agent"],
+		CreatedAt:   time.Unix(createdAt, 0),
+		LastSeen:    time.Unix(lastSeen, 0),
+		refreshHash: values["refresh_hash"],
+	}, nil
+}
+
+// touchSessionScript 只有会话仍然存在时才更新最近活跃时间。
+// 直接 HSET 会在会话刚被撤销时重新创建一个没有过期时间的会话；HSET 已存在的键不影响其过期时间
+var touchSessionScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return redis.call("HSET", KEYS[1], "last_seen", ARGV[1])
+end
+return -1
+`)
+
+// TouchSession 更新会话的最近活跃时间，写入失败不影响当前请求
+func TouchSession(session *AuthSession) {
+	now := time.Now()
+	if now.Sub(session.LastSeen) < sessionTouchInterval {
+		return
+	}
+	rdb := GetRedisClient()
+	if err := touchSessionScript.Run(rdb.Context(), rdb, []string{sessionKey(session.ID)}, now.Unix()).Err(); err != nil {
+		return
+	}
+	session.LastSeen = now
+}
+
+// ListSessions 获取用户全部有效的会话，按最近活跃时间倒序排列
+func ListSessions(userId int64) ([]AuthSession, error) {
+	rdb := GetRedisClient()
+	ctx := rdb.Context()
+	sessionIds, err := rdb.SMembers(ctx, userSessionsKey(userId)).Result()
+	if err != nil {
+		return nil, err
+	}
+	var sessions []AuthSession
+	for _, sessionId := range sessionIds {
+		session, err := GetSession(sessionId)
+		if err != nil {
+			return nil, err
+		}
+		// 已过期的会话顺便从集合中清理
+		if session == nil || session.UserID != userId {
+			rdb.SRem(ctx, userSessionsKey(userId), sessionId)
+			continue
+		}
+		sessions = append(sessions, *session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+	return sessions, nil
+}
+
+// RevokeSession 撤销用户的某个会话，会话不存在或不属于该用户时返回 false
+func RevokeSession(userId int64, sessionId string) (bool, error) {
+	session, err := GetSession(sessionId)
+	if err != nil {
+		return false, err
+	}
+	if session == nil || session.UserID != userId {
+		return false, nil
+	}
+	rdb := GetRedisClient()
+	ctx := rdb.Context()
+	pipe := rdb.TxPipeline()
+	pipe.Del(ctx, sessionKey(sessionId))
+	if session.refreshHash != "" {
+		pipe.Del(ctx, refreshTokenKey(session.refreshHash))
+	}
+	pipe.SRem(ctx, userSessionsKey(userId), sessionId)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RevokeAllSessions 撤销用户的全部会话，用于修改密码或“退出所有设备”
+func RevokeAllSessions(userId int64) error {
+	rdb := GetRedisClient()
+	sessionIds, err := rdb.SMembers(rdb.Context(), userSessionsKey(userId)).Result()
+	if err != nil {
+		return err
+	}
+	for _, sessionId := range sessionIds {
+		if _, err := RevokeSession(userId, sessionId); err != nil {
+			return err
+		}
+	}
+	return rdb.Del(rdb.Context(), userSessionsKey(userId)).Err()
+}
@@ -0,0 +1,143 @@
+package util
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRefreshSessionRotatesToken(t *testing.T) {
+	useTestRedis(t)
+	useTestJWTKeys(t)
+	pair, err := CreateSession(101, "a@example.com", "127.0.0.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { RevokeAllSessions(101) })
+
+	rotated, err := RefreshSession(pair.RefreshToken, "127.0.0.2", "test")
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if rotated.SessionID != pair.SessionID || rotated.RefreshToken == pair.RefreshToken {
+		t.Fatalf("refresh should keep the session and rotate the token")
+	}
+	session, err := GetSession(pair.SessionID)
+	if err != nil || session == nil {
+		t.Fatalf("session missing after refresh: %v", err)
+	}
+	if session.IP != "127.0.0.2" {
+		t.Fatalf("ip = %q, want 127.0.0.2", session.IP)
+	}
+
+	// 新的刷新令牌可以继续使用
+	if _, err := RefreshSession(rotated.RefreshToken, "127.0.0.2", "test"); err != nil {
+		t.Fatalf("refresh with rotated token: %v", err)
+	}
+}
+
+func TestRefreshSessionReuseRevokesSession(t *testing.T) {
+	useTestRedis(t)
+	useTestJWTKeys(t)
+	pair, err := CreateSession(102, "b@example.com", "127.0.0.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { RevokeAllSessions(102) })
+
+	rotated, err := RefreshSession(pair.RefreshToken, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 旧令牌被重放，整个会话被撤销
+	if _, err := RefreshSession(pair.RefreshToken, "127.0.0.1", "test"); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("err = %v, want ErrRefreshTokenReused", err)
+	}
+	if session, _ := GetSession(pair.SessionID); session != nil {
+		t.Fatalf("session should be revoked after reuse")
+	}
+	if _, err := RefreshSession(rotated.RefreshToken, "127.0.0.1", "test"); err == nil {
+		t.Fatalf("rotated token should no longer work after the session is revoked")
+	}
+	// 之后的重放仍然能够被识别
+	if _, err := RefreshSession(pair.RefreshToken, "127.0.0.1", "test"); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("err = %v, want ErrRefreshTokenReused", err)
+	}
+}
+
+func TestRefreshSessionUnknownToken(t *testing.T) {
+	useTestRedis(t)
+	if _, err := RefreshSession("no-such-token", "127.0.0.1", "test"); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Fatalf("err = %v, want ErrRefreshTokenInvalid", err)
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	useTestRedis(t)
+	useTestJWTKeys(t)
+	first, err := CreateSession(103, "c@example.com", "127.0.0.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := CreateSession(103, "c@example.com", "127.0.0.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { RevokeAllSessions(103) })
+
+	// 不能撤销其他用户的会话
+	if revoked, err := RevokeSession(104, first.SessionID); err != nil || revoked {
+		t.Fatalf("revoke by another user = %v, %v", revoked, err)
+	}
+	if revoked, err := RevokeSession(103, first.SessionID); err != nil || !revoked {
+		t.Fatalf("revoke = %v, %v", revoked, err)
+	}
+	if _, err := RefreshSession(first.RefreshToken, "127.0.0.1", "test"); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Fatalf("err = %v, want ErrRefreshTokenInvalid", err)
+	}
+	sessions, err := ListSessions(103)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != second.SessionID {
+		t.Fatalf("sessions = %+v, want only %s", sessions, second.SessionID)
+	}
+
+	if err := RevokeAllSessions(103); err != nil {
+		t.Fatal(err)
+	}
+	if session, _ := GetSession(second.SessionID); session != nil {
+		t.Fatalf("all sessions should be revoked")
+	}
+}
+
+func TestTouchSessionDoesNotResurrectRevokedSession(t *testing.T) {
+	rdb := useTestRedis(t)
+	useTestJWTKeys(t)
+	pair, err := CreateSession(105, "d@example.com", "127.0.0.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { RevokeAllSessions(105) })
+	session, err := GetSession(pair.SessionID)
+	if err != nil || session == nil {
+		t.Fatalf("get session: %v", err)
+	}
+
+	// 更新活跃时间后过期时间保持不变
+	session.LastSeen = time.Now().Add(-2 * sessionTouchInterval)
+	TouchSession(session)
+	if ttl := rdb.TTL(rdb.Context(), sessionKey(session.ID)).Val(); ttl <= 0 {
+		t.Fatalf("ttl = %v after touch, want positive", ttl)
+	}
+
+	// 会话被撤销后，持有旧访问令牌的请求不会重新创建会话
+	if _, err := RevokeSession(105, session.ID); err != nil {
+		t.Fatal(err)
+	}
+	session.LastSeen = time.Now().Add(-2 * sessionTouchInterval)
+	TouchSession(session)
+	if exists := rdb.Exists(rdb.Context(), sessionKey(session.ID)).Val(); exists != 0 {
+		t.Fatalf("revoked session was recreated by touch")
+	}
+}
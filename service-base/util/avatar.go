@@ -0,0 +1,89 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"strconv"
+)
+
+// 头像上传的限制
+const (
+	AvatarMaxUploadSize = 5 << 20 // 上传文件最大 5MB
+	avatarMaxDimension  = 4096    // 解码前先检查尺寸，避免超大图片占满内存
+	avatarMinDimension  = 32
+)
+
+// AvatarSizes 头像统一缩放到的标准尺寸（正方形边长），最大的尺寸作为默认尺寸
+var AvatarSizes = []int{64, 128, 256}
+
+var (
+	ErrAvatarFormat    = errors.New("unsupported avatar format")
+	ErrAvatarDimension = errors.New("invalid avatar dimension")
+)
+
+// 允许上传的图片格式，对应 image.DecodeConfig 返回的格式名
+var avatarFormats = map[string]bool{"jpeg": true, "png": true, "gif": true, "webp": true}
+
+// AvatarKey 头像在内容存储中的 key
+func AvatarKey(userId int64, size int) string {
+	return "avatars/" + strconv.FormatInt(userId, 10) + "/" + strconv.Itoa(size) + ".png"
+}
+
+// AvatarPrefix 用户全部头像文件的 key 前缀
+func AvatarPrefix(userId int64) string {
+	return "avatars/" + strconv.FormatInt(userId, 10) + "/"
+}
+
+// IsAvatarSize 是否为标准头像尺寸
+func IsAvatarSize(size int) bool {
+	for _, s := range AvatarSizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
+
+// ProcessAvatar 校验上传的图片，居中裁剪为正方形后缩放到各个标准尺寸，统一编码为 PNG。
+// 重新编码会丢弃原图中的 EXIF 等元数据
+func ProcessAvatar(data []byte) (map[int][]byte, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || !avatarFormats[format] {
+		return nil, ErrAvatarFormat
+	}
+	if cfg.Width < avatarMinDimension || cfg.Height < avatarMinDimension ||
+		cfg.Width > avatarMaxDimension || cfg.Height > avatarMaxDimension {
+		return nil, ErrAvatarDimension
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrAvatarFormat
+	}
+
+	bounds := src.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	x0 := bounds.Min.X + (bounds.Dx()-side)/2
+	y0 := bounds.Min.Y + (bounds.Dy()-side)/2
+	crop := image.Rect(x0, y0, x0+side, y0+side)
+
+	result := make(map[int][]byte, len(AvatarSizes))
+	for _, size := range AvatarSizes {
+		dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Src, nil)
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, dst); err != nil {
+			return nil, err
+		}
+		result[size] = buf.Bytes()
+	}
+	return result, nil
+}
@@ -0,0 +1,105 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/mojocn/base64Captcha"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"yuqueppbackend/service-base/config"
+)
+
+const captchaKeyPrefix = "captcha:"
+
+// RedisCaptchaStore 基于 Redis 的验证码存储，多个实例之间共享，过期后由 Redis 自动清理
+type RedisCaptchaStore struct {
+	ttl time.Duration
+}
+
+func NewRedisCaptchaStore(ttl time.Duration) *RedisCaptchaStore {
+	return &RedisCaptchaStore{ttl: ttl}
+}
+
+func (s *RedisCaptchaStore) Set(id string, value string) error {
+	rdb := GetRedisClient()
+	return rdb.Set(rdb.Context(), captchaKeyPrefix+id, value, s.ttl).Err()
+}
+
+func (s *RedisCaptchaStore) Get(id string, clear bool) string {
+	rdb := GetRedisClient()
+	ctx := rdb.Context()
+	var value string
+	var err error
+	if clear {
+		value, err = rdb.GetDel(ctx, captchaKeyPrefix+id).Result()
+	} else {
+		value, err = rdb.Get(ctx, captchaKeyPrefix+id).Result()
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
+		log.Println(err)
+	}
+	return value
+}
+
+// Verify 校验答案，忽略首尾空白与大小写
+func (s *RedisCaptchaStore) Verify(id, answer string, clear bool) bool {
+	if id == "" {
+		return false
+	}
+	value := s.Get(id, clear)
+	return value != "" && strings.EqualFold(value, strings.TrimSpace(answer))
+}
+
+var (
+	captchaStore     base64Captcha.Store
+	captchaDriver    base64Captcha.Driver
+	captchaStoreOnce sync.Once
+)
+
+// GetCaptcha 获取配置中选择的验证码存储与驱动
+func GetCaptcha() (base64Captcha.Store, base64Captcha.Driver) {
+	captchaStoreOnce.Do(func() {
+		cfg := config.GetCaptchaConfig()
+		var err error
+		captchaStore, err = NewCaptchaStore(cfg)
+		if err != nil {
+			log.Fatalf("Error creating captcha store: %s", err)
+		}
+		captchaDriver, err = NewCaptchaDriver(cfg)
+		if err != nil {
+			log.Fatalf("Error creating captcha driver: %s", err)
+		}
+	})
+	return captchaStore, captchaDriver
+}
+
+// NewCaptchaStore 根据配置创建验证码存储：redis 或 memory
+func NewCaptchaStore(cfg config.CaptchaConfig) (base64Captcha.Store, error) {
+	switch cfg.Store {
+	case "redis":
+		return NewRedisCaptchaStore(cfg.TTL), nil
+	case "memory":
+		return base64Captcha.NewMemoryStore(base64Captcha.GCLimitNumber, cfg.TTL), nil
+	default:
+		return nil, fmt.Errorf("unknown captcha store: %s", cfg.Store)
+	}
+}
+
+// NewCaptchaDriver 根据配置创建验证码驱动：digit、string 或 math
+func NewCaptchaDriver(cfg config.CaptchaConfig) (base64Captcha.Driver, error) {
+	switch cfg.Driver {
+	case "digit":
+		return base64Captcha.NewDriverDigit(cfg.Height, cfg.Width, cfg.Length, cfg.MaxSkew, cfg.DotCount), nil
+	case "string":
+		return base64Captcha.NewDriverString(cfg.Height, cfg.Width, cfg.NoiseCount, cfg.ShowLineOptions, cfg.Length,
+			cfg.Source, nil, nil, nil).ConvertFonts(), nil
+	case "math":
+		return base64Captcha.NewDriverMath(cfg.Height, cfg.Width, cfg.NoiseCount, cfg.ShowLineOptions,
+			nil, nil, nil).ConvertFonts(), nil
+	default:
+		return nil, fmt.Errorf("unknown captcha driver: %s", cfg.Driver)
+	}
+}
@@ -0,0 +1,287 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"yuqueppbackend/service-base/config"
+)
+
+// ErrContentNotFound 内容不存在
+var ErrContentNotFound = errors.New("content not found")
+
+// ContentStore 文档内容存储。key 使用 "/" 分隔的相对路径，例如 "123.txt"、"versions/123/456.txt"
+type ContentStore interface {
+	// Get 读取内容，不存在时返回 ErrContentNotFound
+	Get(key string) ([]byte, error)
+	// Put 写入内容，已存在时覆盖
+	Put(key string, data []byte) error
+	// PutStream 从 r 读取 size 字节写入，用于不适合整体放入内存的大文件
+	PutStream(key string, r io.Reader, size int64) error
+	// Open 打开内容用于流式读取，同时返回内容大小；不存在时返回 ErrContentNotFound
+	Open(key string) (io.ReadCloser, int64, error)
+	// Delete 删除内容，不存在时不报错
+	Delete(key string) error
+	// DeletePrefix 删除所有以 prefix 开头的内容
+	DeletePrefix(prefix string) error
+	// List 遍历所有以 prefix 开头的 key
+	List(prefix string, fn func(key string) error) error
+}
+
+var (
+	contentStore     ContentStore
+	contentStoreOnce sync.Once
+)
+
+// GetContentStore 获取配置中选择的内容存储实例
+func GetContentStore() ContentStore {
+	contentStoreOnce.Do(func() {
+		store, err := NewContentStore(config.GetContentStoreBackend())
+		if err != nil {
+			log.Fatalf("Error creating content store: %s", err)
+		}
+		contentStore = store
+	})
+	return contentStore
+}
+
+// NewContentStore 根据后端名称（local 或 s3）创建内容存储
+func NewContentStore(backend string) (ContentStore, error) {
+	switch backend {
+	case "", "local":
+		return NewLocalContentStore(config.GetDocumentStoragePath()), nil
+	case "s3":
+		return NewS3ContentStore(config.GetS3Config())
+	default:
+		return nil, fmt.Errorf("unknown content store backend: %s", backend)
+	}
+}
+
+// LocalContentStore 将内容保存在本地文件系统中
+type LocalContentStore struct {
+	root string
+}
+
+func NewLocalContentStore(root string) *LocalContentStore {
+	return &LocalContentStore{root: root}
+}
+
+func (s *LocalContentStore) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(key))
+}
+
+func (s *LocalContentStore) Get(key string) ([]byte, error) {
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrContentNotFound
+	}
+	return data, err
+}
+
+func (s *LocalContentStore) Put(key string, data []byte) error {
+	return s.PutStream(key, bytes.NewReader(data), int64(len(data)))
+}
+
+func (s *LocalContentStore) PutStream(key string, r io.Reader, size int64) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	// 先写临时文件再重命名，避免读到写了一半的内容；每次写入使用独立的临时文件，
+	// 同一个键的并发写入不会互相截断。临时文件以 .tmp 结尾，List 会跳过
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	if _, err := io.CopyN(tmp, r, size); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	// CreateTemp 创建的文件权限为 0600，与直接写入时保持一致
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+func (s *LocalContentStore) Open(key string) (io.ReadCloser, int64, error) {
+	f, err := os.Open(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, 0, ErrContentNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+func (s *LocalContentStore) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalContentStore) DeletePrefix(prefix string) error {
+	// 以 "/" 结尾的前缀对应一个目录，直接整体删除
+	if strings.HasSuffix(prefix, "/") {
+		return os.RemoveAll(s.path(prefix))
+	}
+	return s.List(prefix, func(key string) error {
+		return s.Delete(key)
+	})
+}
+
+func (s *LocalContentStore) List(prefix string, fn func(key string) error) error {
+	return filepath.WalkDir(s.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		return fn(key)
+	})
+}
+
+// S3ContentStore 将内容保存在兼容 S3 协议的对象存储中（例如 MinIO）
+type S3ContentStore struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3ContentStore 创建 S3 内容存储，bucket 不存在时自动创建
+func NewS3ContentStore(cfg config.S3Config) (*S3ContentStore, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region}); err != nil {
+			return nil, err
+		}
+	}
+	prefix := strings.Trim(cfg.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &S3ContentStore{client: client, bucket: cfg.Bucket, prefix: prefix}, nil
+}
+
+func (s *S3ContentStore) Get(key string) ([]byte, error) {
+	obj, err := s.client.GetObject(context.Background(), s.bucket, s.prefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrContentNotFound
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *S3ContentStore) Put(key string, data []byte) error {
+	_, err := s.client.PutObject(context.Background(), s.bucket, s.prefix+key, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: http.DetectContentType(data)})
+	return err
+}
+
+func (s *S3ContentStore) PutStream(key string, r io.Reader, size int64) error {
+	_, err := s.client.PutObject(context.Background(), s.bucket, s.prefix+key, r, size, minio.PutObjectOptions{})
+	return err
+}
+
+func (s *S3ContentStore) Open(key string) (io.ReadCloser, int64, error) {
+	obj, err := s.client.GetObject(context.Background(), s.bucket, s.prefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, 0, err
+	}
+	// GetObject 不会立即请求对象，通过 Stat 确认对象存在并获取大小
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, 0, ErrContentNotFound
+		}
+		return nil, 0, err
+	}
+	return obj, info.Size, nil
+}
+
+func (s *S3ContentStore) Delete(key string) error {
+	// 删除不存在的对象不会返回错误
+	return s.client.RemoveObject(context.Background(), s.bucket, s.prefix+key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3ContentStore) DeletePrefix(prefix string) error {
+	return s.List(prefix, func(key string) error {
+		return s.Delete(key)
+	})
+}
+
+func (s *S3ContentStore) List(prefix string, fn func(key string) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix + prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		if err := fn(strings.TrimPrefix(obj.Key, s.prefix)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
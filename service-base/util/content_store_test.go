@@ -0,0 +1,89 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestLocalContentStoreConcurrentPut(t *testing.T) {
+	store := NewLocalContentStore(t.TempDir())
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- store.Put("doc/1.md", bytes.Repeat([]byte(strconv.Itoa(i%10)), 4096))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("put: %v", err)
+		}
+	}
+
+	// 最终内容必须是某一次完整的写入
+	data, err := store.Get("doc/1.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 4096 || !bytes.Equal(data, bytes.Repeat(data[:1], 4096)) {
+		t.Fatalf("content was interleaved or truncated")
+	}
+
+	// 临时文件不会出现在列表中
+	var keys []string
+	if err := store.List("", func(key string) error {
+		keys = append(keys, key)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "doc/1.md" {
+		t.Fatalf("keys = %q, want [doc/1.md]", keys)
+	}
+}
+
+func TestLocalContentStoreGetMissing(t *testing.T) {
+	store := NewLocalContentStore(t.TempDir())
+	if _, err := store.Get("missing"); !errors.Is(err, ErrContentNotFound) {
+		t.Fatalf("err = %v, want ErrContentNotFound", err)
+	}
+	if err := store.Delete("missing"); err != nil {
+		t.Fatalf("delete of missing key: %v", err)
+	}
+}
+
+func TestLocalContentStoreStream(t *testing.T) {
+	store := NewLocalContentStore(t.TempDir())
+	data := bytes.Repeat([]byte("语雀"), 100000)
+	if err := store.PutStream("exports/1/a.zip", bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	rc, size, err := store.Open("exports/1/a.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(data)) || !bytes.Equal(got, data) {
+		t.Fatalf("read back %d bytes (size %d), want %d", len(got), size, len(data))
+	}
+
+	// 读取到的数据少于 size 时写入失败，且不留下不完整的文件
+	if err := store.PutStream("exports/1/b.zip", bytes.NewReader(data[:10]), 20); err == nil {
+		t.Fatal("short stream should fail")
+	}
+	if _, _, err := store.Open("exports/1/b.zip"); !errors.Is(err, ErrContentNotFound) {
+		t.Fatalf("err = %v, want ErrContentNotFound", err)
+	}
+}
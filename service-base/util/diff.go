@@ -0,0 +1,390 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// 差异操作类型
+const (
+	DiffEqual  = "equal"
+	DiffAdd    = "add"
+	DiffDelete = "delete"
+)
+
+// DiffWord 行内的单词级差异片段
+type DiffWord struct {
+	Type string `json:"type"` // equal / add / delete
+	Text string `json:"text"`
+}
+
+// DiffLine 差异中的一行
+type DiffLine struct {
+	Type    string     `json:"type"`            // equal / add / delete
+	OldLine int        `json:"old_line"`        // 旧版本中的行号（从 1 开始），新增行为 0
+	NewLine int        `json:"new_line"`        // 新版本中的行号（从 1 开始），删除行为 0
+	Content string     `json:"content"`         // 行内容
+	Words   []DiffWord `json:"words,omitempty"` // 被修改行的单词级差异
+}
+
+// DiffHunk 一个差异块，对应统一格式中的一个 @@ 段
+type DiffHunk struct {
+	OldStart int        `json:"old_start"`
+	OldLines int        `json:"old_lines"`
+	NewStart int        `json:"new_start"`
+	NewLines int        `json:"new_lines"`
+	Header   string     `json:"header"`
+	Lines    []DiffLine `json:"lines"`
+}
+
+// TextDiff 两段文本之间的结构化统一差异
+type TextDiff struct {
+	Hunks   []DiffHunk `json:"hunks"`
+	Added   int        `json:"added"`   // 新增行数
+	Removed int        `json:"removed"` // 删除行数
+	Unified string     `json:"unified"` // 统一差异格式的文本
+}
+
+// DiffText 按行比较两段文本，contextLines 为每个差异块前后保留的上下文行数
+func DiffText(oldText, newText string, contextLines int) TextDiff {
+	if contextLines < 0 {
+		contextLines = 0
+	}
+	oldLines := splitLines(oldText)
+	newLines := splitLines(newText)
+	ops := myersDiff(oldLines, newLines)
+
+	// 将编辑脚本转换为带行号的差异行
+	var lines []DiffLine
+	oldNo, newNo := 0, 0
+	result := TextDiff{}
+	for _, op := range ops {
+		switch op.kind {
+		case DiffEqual:
+			oldNo++
+			newNo++
+			lines = append(lines, DiffLine{Type: DiffEqual, OldLine: oldNo, NewLine: newNo, Content: oldLines[op.oldIndex]})
+		case DiffDelete:
+			oldNo++
+			result.Removed++
+			lines = append(lines, DiffLine{Type: DiffDelete, OldLine: oldNo, Content: oldLines[op.oldIndex]})
+		case DiffAdd:
+			newNo++
+			result.Added++
+			lines = append(lines, DiffLine{Type: DiffAdd, NewLine: newNo, Content: newLines[op.newIndex]})
+		}
+	}
+	attachWordDiffs(lines)
+
+	result.Hunks = buildHunks(lines, contextLines)
+	var unified strings.Builder
+	for _, hunk := range result.Hunks {
+		unified.WriteString(hunk.Header)
+		unified.WriteString("\n")
+		for _, line := range hunk.Lines {
+			switch line.Type {
+			case DiffEqual:
+				unified.WriteString(" ")
+			case DiffDelete:
+				unified.WriteString("-")
+			case DiffAdd:
+				unified.WriteString("+")
+			}
+			unified.WriteString(line.Content)
+			unified.WriteString("\n")
+		}
+	}
+	result.Unified = unified.String()
+	return result
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// buildHunks 按上下文行数把差异行切分为多个差异块，相距较近的修改合并到同一块中
+func buildHunks(lines []DiffLine, contextLines int) []DiffHunk {
+	var hunks []DiffHunk
+	i := 0
+	for i < len(lines) {
+		// 找到下一处修改
+		for i < len(lines) && lines[i].Type == DiffEqual {
+			i++
+		}
+		if i >= len(lines) {
+			break
+		}
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+		// 向后扩展，直到连续的未修改行超过两倍上下文
+		end := i
+		for end < len(lines) {
+			if lines[end].Type != DiffEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(lines) && lines[run].Type == DiffEqual {
+				run++
+			}
+			if run >= len(lines) || run-end > 2*contextLines {
+				end += min(contextLines, run-end)
+				break
+			}
+			end = run
+		}
+
+		hunk := DiffHunk{Lines: lines[start:end]}
+		for _, line := range hunk.Lines {
+			if line.Type != DiffAdd {
+				hunk.OldLines++
+				if hunk.OldStart == 0 {
+					hunk.OldStart = line.OldLine
+				}
+			}
+			if line.Type != DiffDelete {
+				hunk.NewLines++
+				if hunk.NewStart == 0 {
+					hunk.NewStart = line.NewLine
+				}
+			}
+		}
+		// 与统一差异格式保持一致：空范围的起始行号为其前一行
+		if hunk.OldLines == 0 {
+			hunk.OldStart = precedingLine(lines, start, true)
+		}
+		if hunk.NewLines == 0 {
+			hunk.NewStart = precedingLine(lines, start, false)
+		}
+		hunk.Header = fmt.Sprintf("@@ -%d,%d +%d,%d @@", hunk.OldStart, hunk.OldLines, hunk.NewStart, hunk.NewLines)
+		hunks = append(hunks, hunk)
+		i = end
+	}
+	return hunks
+}
+
+func precedingLine(lines []DiffLine, index int, old bool) int {
+	for j := index - 1; j >= 0; j-- {
+		if old && lines[j].OldLine > 0 {
+			return lines[j].OldLine
+		}
+		if !old && lines[j].NewLine > 0 {
+			return lines[j].NewLine
+		}
+	}
+	return 0
+}
+
+// attachWordDiffs 将相邻的删除行与新增行逐行配对，视为被修改的行并计算单词级差异
+func attachWordDiffs(lines []DiffLine) {
+	i := 0
+	for i < len(lines) {
+		if lines[i].Type != DiffDelete {
+			i++
+			continue
+		}
+		delStart := i
+		for i < len(lines) && lines[i].Type == DiffDelete {
+			i++
+		}
+		addStart := i
+		for i < len(lines) && lines[i].Type == DiffAdd {
+			i++
+		}
+		pairs := min(addStart-delStart, i-addStart)
+		for k := 0; k < pairs; k++ {
+			oldWords, newWords := diffWords(lines[delStart+k].Content, lines[addStart+k].Content)
+			lines[delStart+k].Words = oldWords
+			lines[addStart+k].Words = newWords
+		}
+	}
+}
+
+// diffWords 计算一对被修改行的单词级差异，分别返回旧行与新行的片段
+func diffWords(oldLine, newLine string) ([]DiffWord, []DiffWord) {
+	oldTokens := tokenize(oldLine)
+	newTokens := tokenize(newLine)
+	var oldWords, newWords []DiffWord
+	appendWord := func(words []DiffWord, kind, text string) []DiffWord {
+		if n := len(words); n > 0 && words[n-1].Type == kind {
+			words[n-1].Text += text
+			return words
+		}
+		return append(words, DiffWord{Type: kind, Text: text})
+	}
+	for _, op := range myersDiff(oldTokens, newTokens) {
+		switch op.kind {
+		case DiffEqual:
+			oldWords = appendWord(oldWords, DiffEqual, oldTokens[op.oldIndex])
+			newWords = appendWord(newWords, DiffEqual, newTokens[op.newIndex])
+		case DiffDelete:
+			oldWords = appendWord(oldWords, DiffDelete, oldTokens[op.oldIndex])
+		case DiffAdd:
+			newWords = appendWord(newWords, DiffAdd, newTokens[op.newIndex])
+		}
+	}
+	return oldWords, newWords
+}
+
+// tokenize 将一行拆分为单词、空白与标点，中日韩字符按单字拆分
+func tokenize(line string) []string {
+	var tokens []string
+	runes := []rune(line)
+	class := func(r rune) int {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+			return 0
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			return 1
+		case unicode.IsSpace(r):
+			return 2
+		default:
+			return 3
+		}
+	}
+	for i := 0; i < len(runes); {
+		j := i + 1
+		c := class(runes[i])
+		if c == 1 || c == 2 {
+			for j < len(runes) && class(runes[j]) == c {
+				j++
+			}
+		}
+		tokens = append(tokens, string(runes[i:j]))
+		i = j
+	}
+	return tokens
+}
+
+type diffOp struct {
+	kind     string
+	oldIndex int
+	newIndex int
+}
+
+// diffMaxEdits Myers 算法允许的最大编辑距离，超过后中间部分退化为整段删除再整段新增。
+// 回溯需要保存每一轮的对角线，内存随编辑距离平方增长，限制后单次比较最多占用约 8MB
+const diffMaxEdits = 1000
+
+// myersDiff 计算从 a 到 b 的编辑脚本：先去掉公共前缀与后缀，中间部分使用 Myers 差分算法求最短编辑脚本，
+// 编辑距离超过 diffMaxEdits 时不再求最短脚本
+func myersDiff(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	ops := make([]diffOp, 0, len(a)+len(b)-prefix-suffix)
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, diffOp{kind: DiffEqual, oldIndex: i, newIndex: i})
+	}
+	mid, ok := myersEditScript(midA, midB, diffMaxEdits)
+	if !ok {
+		mid = mid[:0]
+		for i := range midA {
+			mid = append(mid, diffOp{kind: DiffDelete, oldIndex: i})
+		}
+		for j := range midB {
+			mid = append(mid, diffOp{kind: DiffAdd, newIndex: j})
+		}
+	}
+	for _, op := range mid {
+		op.oldIndex += prefix
+		op.newIndex += prefix
+		ops = append(ops, op)
+	}
+	for i := 0; i < suffix; i++ {
+		ops = append(ops, diffOp{kind: DiffEqual, oldIndex: len(a) - suffix + i, newIndex: len(b) - suffix + i})
+	}
+	return ops
+}
+
+// myersEditScript 使用 Myers 差分算法计算从 a 到 b 的最短编辑脚本，编辑距离超过 maxEdits 时返回 false
+func myersEditScript(a, b []string, maxEdits int) ([]diffOp, bool) {
+	n, m := len(a), len(b)
+	maxD := n + m
+	if maxD > maxEdits {
+		maxD = maxEdits
+	}
+	offset := maxD
+	v := make([]int, 2*maxD+2)
+	var trace [][]int
+
+	for d := 0; d <= maxD; d++ {
+		// 只保存本轮可能被回溯访问到的对角线 [-d, d]
+		snapshot := make([]int, 2*d+1)
+		copy(snapshot, v[offset-d:offset+d+1])
+		trace = append(trace, snapshot)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b, d), true
+			}
+		}
+	}
+	return nil, false
+}
+
+func backtrack(trace [][]int, a, b []string, d int) []diffOp {
+	x, y := len(a), len(b)
+	var ops []diffOp
+	for ; d > 0; d-- {
+		// trace[d] 保存的是第 d 轮开始前的对角线 [-d, d]
+		v := trace[d]
+		at := func(k int) int { return v[k+d] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, diffOp{kind: DiffEqual, oldIndex: x, newIndex: y})
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, diffOp{kind: DiffAdd, newIndex: y})
+		} else {
+			x--
+			ops = append(ops, diffOp{kind: DiffDelete, oldIndex: x})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		ops = append(ops, diffOp{kind: DiffEqual, oldIndex: x, newIndex: y})
+	}
+	// 回溯得到的是逆序的编辑脚本
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
@@ -0,0 +1,163 @@
+package util
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// checkEditScript 校验编辑脚本按顺序覆盖了 a 与 b 的每一个元素
+func checkEditScript(t *testing.T, a, b []string, ops []diffOp) {
+	t.Helper()
+	var gotA, gotB []string
+	for _, op := range ops {
+		switch op.kind {
+		case DiffEqual:
+			if a[op.oldIndex] != b[op.newIndex] {
+				t.Fatalf("equal op pairs %q with %q", a[op.oldIndex], b[op.newIndex])
+			}
+			gotA = append(gotA, a[op.oldIndex])
+			gotB = append(gotB, b[op.newIndex])
+		case DiffDelete:
+			gotA = append(gotA, a[op.oldIndex])
+		case DiffAdd:
+			gotB = append(gotB, b[op.newIndex])
+		}
+	}
+	if strings.Join(gotA, "\n") != strings.Join(a, "\n") {
+		t.Fatalf("script does not reproduce old text")
+	}
+	if strings.Join(gotB, "\n") != strings.Join(b, "\n") {
+		t.Fatalf("script does not reproduce new text")
+	}
+}
+
+func countEdits(ops []diffOp) int {
+	edits := 0
+	for _, op := range ops {
+		if op.kind != DiffEqual {
+			edits++
+		}
+	}
+	return edits
+}
+
+func TestMyersDiffShortestScript(t *testing.T) {
+	cases := []struct {
+		a, b  string
+		edits int
+	}{
+		{"", "", 0},
+		{"abc", "abc", 0},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"abcabba", "cbabac", 5},
+		{"kitten", "sitting", 5},
+	}
+	for _, tc := range cases {
+		a, b := strings.Split(tc.a, ""), strings.Split(tc.b, "")
+		ops := myersDiff(a, b)
+		checkEditScript(t, a, b, ops)
+		if got := countEdits(ops); got != tc.edits {
+			t.Errorf("myersDiff(%q, %q) edits = %d, want %d", tc.a, tc.b, got, tc.edits)
+		}
+	}
+}
+
+func TestMyersDiffRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomText := func() []string {
+		tokens := make([]string, rng.Intn(40))
+		for i := range tokens {
+			tokens[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return tokens
+	}
+	for i := 0; i < 200; i++ {
+		a, b := randomText(), randomText()
+		checkEditScript(t, a, b, myersDiff(a, b))
+	}
+}
+
+func TestMyersDiffFallsBackBeyondMaxEdits(t *testing.T) {
+	var a, b []string
+	for i := 0; i < diffMaxEdits; i++ {
+		a = append(a, "old "+strconv.Itoa(i))
+		b = append(b, "new "+strconv.Itoa(i))
+	}
+	// 公共前缀与后缀仍然按未修改处理
+	a = append([]string{"head"}, append(a, "tail")...)
+	b = append([]string{"head"}, append(b, "tail")...)
+
+	ops := myersDiff(a, b)
+	checkEditScript(t, a, b, ops)
+	if ops[0].kind != DiffEqual || ops[len(ops)-1].kind != DiffEqual {
+		t.Fatalf("common prefix and suffix should stay equal")
+	}
+	if got := countEdits(ops); got != 2*diffMaxEdits {
+		t.Fatalf("edits = %d, want %d", got, 2*diffMaxEdits)
+	}
+}
+
+func TestDiffTextHunks(t *testing.T) {
+	oldText := "line 1\nline 2\nline 3\nline 4\nline 5\n"
+	newText := "line 1\nline 2\nline three\nline 4\nline 5\nline 6\n"
+	diff := DiffText(oldText, newText, 1)
+	if diff.Added != 2 || diff.Removed != 1 {
+		t.Fatalf("added/removed = %d/%d, want 2/1", diff.Added, diff.Removed)
+	}
+	// 两处修改之间只隔两行，不超过两倍上下文，合并为一个差异块
+	if len(diff.Hunks) != 1 {
+		t.Fatalf("hunks = %d, want 1", len(diff.Hunks))
+	}
+	want := "@@ -2,4 +2,5 @@\n line 2\n-line 3\n+line three\n line 4\n line 5\n+line 6\n"
+	if diff.Unified != want {
+		t.Errorf("unified =\n%s\nwant\n%s", diff.Unified, want)
+	}
+
+	// 上下文为 0 时两处修改分为两个差异块
+	diff = DiffText(oldText, newText, 0)
+	if len(diff.Hunks) != 2 {
+		t.Fatalf("hunks = %d, want 2", len(diff.Hunks))
+	}
+	if diff.Hunks[0].Header != "@@ -3,1 +3,1 @@" || diff.Hunks[1].Header != "@@ -5,0 +6,1 @@" {
+		t.Errorf("headers = %q, %q", diff.Hunks[0].Header, diff.Hunks[1].Header)
+	}
+}
+
+func TestDiffTextWordLevel(t *testing.T) {
+	diff := DiffText("the quick brown fox\n", "the slow brown fox\n", 0)
+	if len(diff.Hunks) != 1 || len(diff.Hunks[0].Lines) != 2 {
+		t.Fatalf("unexpected hunks: %+v", diff.Hunks)
+	}
+	deleted, added := diff.Hunks[0].Lines[0], diff.Hunks[0].Lines[1]
+	wantOld := []DiffWord{{DiffEqual, "the "}, {DiffDelete, "quick"}, {DiffEqual, " brown fox"}}
+	wantNew := []DiffWord{{DiffEqual, "the "}, {DiffAdd, "slow"}, {DiffEqual, " brown fox"}}
+	if !equalWords(deleted.Words, wantOld) {
+		t.Errorf("old words = %+v, want %+v", deleted.Words, wantOld)
+	}
+	if !equalWords(added.Words, wantNew) {
+		t.Errorf("new words = %+v, want %+v", added.Words, wantNew)
+	}
+}
+
+func equalWords(a, b []DiffWord) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTokenizeSplitsCJKByCharacter(t *testing.T) {
+	got := tokenize("修改 hello_world!")
+	want := []string{"修", "改", " ", "hello_world", "!"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("tokenize = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,101 @@
+package util
+
+import (
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"strconv"
+	"time"
+)
+
+// 邮件中一次性令牌的用途
+const (
+	EmailTokenVerify        = "verify"
+	EmailTokenPasswordReset = "reset"
+	EmailTokenAccountDelete = "delete_account"
+	EmailTokenDisableTOTP   = "disable_totp"
+)
+
+// 一次性令牌在 Redis 中的存储结构：
+//
+//	emailToken:<purpose>:<sha256>      令牌 -> 用户 ID
+//	emailTokenUser:<purpose>:<uid>     用户当前有效的令牌哈希，签发新令牌时旧令牌随即失效
+func emailTokenKey(purpose, tokenHash string) string {
+	return "emailToken:" + purpose + ":" + tokenHash
+}
+
+func emailTokenUserKey(purpose string, userId int64) string {
+	return "emailTokenUser:" + purpose + ":" + strconv.FormatInt(userId, 10)
+}
+
+// IssueEmailToken 为用户签发一次性令牌，Redis 中只保存令牌的哈希
+func IssueEmailToken(purpose string, userId int64, ttl time.Duration) (string, error) {
+	token, err := GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	tokenHash := HashContent([]byte(token))
+
+	rdb := GetRedisClient()
+	ctx := rdb.Context()
+	previous, err := rdb.Get(ctx, emailTokenUserKey(purpose, userId)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return "", err
+	}
+	pipe := rdb.TxPipeline()
+	if previous != "" {
+		pipe.Del(ctx, emailTokenKey(purpose, previous))
+	}
+	pipe.Set(ctx, emailTokenKey(purpose, tokenHash), userId, ttl)
+	pipe.Set(ctx, emailTokenUserKey(purpose, userId), tokenHash, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeEmailToken 校验并作废一次性令牌，返回对应的用户 ID；令牌无效、过期或已使用时返回 0
+func ConsumeEmailToken(purpose, token string) (int64, error) {
+	rdb := GetRedisClient()
+	ctx := rdb.Context()
+	// GETDEL 保证同一个令牌只能成功使用一次
+	value, err := rdb.GetDel(ctx, emailTokenKey(purpose, HashContent([]byte(token)))).Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	userId, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	rdb.Del(ctx, emailTokenUserKey(purpose, userId))
+	return userId, nil
+}
+
+// AllowEmailSend 限制同一用途的邮件对同一用户的发送频率，冷却期内返回 false
+func AllowEmailSend(purpose string, userId int64, cooldown time.Duration) (bool, error) {
+	rdb := GetRedisClient()
+	key := "emailCooldown:" + purpose + ":" + strconv.FormatInt(userId, 10)
+	return rdb.SetNX(rdb.Context(), key, 1, cooldown).Result()
+}
+
+// RevokeEmailTokens 作废用户所有用途的一次性令牌并清除发送冷却，用于注销账号
+func RevokeEmailTokens(userId int64) error {
+	rdb := GetRedisClient()
+	ctx := rdb.Context()
+	for _, purpose := range []string{EmailTokenVerify, EmailTokenPasswordReset, EmailTokenAccountDelete, EmailTokenDisableTOTP} {
+		tokenHash, err := rdb.Get(ctx, emailTokenUserKey(purpose, userId)).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		keys := []string{emailTokenUserKey(purpose, userId), "emailCooldown:" + purpose + ":" + strconv.FormatInt(userId, 10)}
+		if tokenHash != "" {
+			keys = append(keys, emailTokenKey(purpose, tokenHash))
+		}
+		if err := rdb.Del(ctx, keys...).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
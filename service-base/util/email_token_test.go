@@ -0,0 +1,119 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConsumeEmailTokenOnlyOnce(t *testing.T) {
+	useTestRedis(t)
+	t.Cleanup(func() { RevokeEmailTokens(201) })
+	token, err := IssueEmailToken(EmailTokenVerify, 201, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 不同用途的令牌互不通用
+	if userId, err := ConsumeEmailToken(EmailTokenPasswordReset, token); err != nil || userId != 0 {
+		t.Fatalf("consume with wrong purpose = %d, %v", userId, err)
+	}
+	if userId, err := ConsumeEmailToken(EmailTokenVerify, token); err != nil || userId != 201 {
+		t.Fatalf("consume = %d, %v, want 201", userId, err)
+	}
+	if userId, err := ConsumeEmailToken(EmailTokenVerify, token); err != nil || userId != 0 {
+		t.Fatalf("second consume = %d, %v, want 0", userId, err)
+	}
+}
+
+func TestIssueEmailTokenInvalidatesPrevious(t *testing.T) {
+	useTestRedis(t)
+	t.Cleanup(func() { RevokeEmailTokens(202) })
+	first, err := IssueEmailToken(EmailTokenPasswordReset, 202, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := IssueEmailToken(EmailTokenPasswordReset, 202, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userId, _ := ConsumeEmailToken(EmailTokenPasswordReset, first); userId != 0 {
+		t.Fatalf("previous token should be invalid after a new one is issued")
+	}
+	if userId, _ := ConsumeEmailToken(EmailTokenPasswordReset, second); userId != 202 {
+		t.Fatalf("latest token should be valid")
+	}
+}
+
+func TestConsumeEmailTokenExpired(t *testing.T) {
+	useTestRedis(t)
+	t.Cleanup(func() { RevokeEmailTokens(203) })
+	token, err := IssueEmailToken(EmailTokenVerify, 203, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if userId, err := ConsumeEmailToken(EmailTokenVerify, token); err != nil || userId != 0 {
+		t.Fatalf("expired token consume = %d, %v, want 0", userId, err)
+	}
+}
+
+func TestRevokeEmailTokens(t *testing.T) {
+	useTestRedis(t)
+	token, err := IssueEmailToken(EmailTokenVerify, 204, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allowed, err := AllowEmailSend(EmailTokenVerify, 204, time.Minute); err != nil || !allowed {
+		t.Fatalf("first send should be allowed: %v, %v", allowed, err)
+	}
+	if allowed, _ := AllowEmailSend(EmailTokenVerify, 204, time.Minute); allowed {
+		t.Fatalf("second send within cooldown should be rejected")
+	}
+	if err := RevokeEmailTokens(204); err != nil {
+		t.Fatal(err)
+	}
+	if userId, _ := ConsumeEmailToken(EmailTokenVerify, token); userId != 0 {
+		t.Fatalf("revoked token should be invalid")
+	}
+	if allowed, _ := AllowEmailSend(EmailTokenVerify, 204, time.Minute); !allowed {
+		t.Fatalf("cooldown should be cleared after revoke")
+	}
+	RevokeEmailTokens(204)
+}
+
+// 确认注销的令牌与其他用途互不通用，注销账号时同样被作废
+func TestAccountDeleteToken(t *testing.T) {
+	useTestRedis(t)
+	t.Cleanup(func() { RevokeEmailTokens(205) })
+	token, err := IssueEmailToken(EmailTokenAccountDelete, 205, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userId, _ := ConsumeEmailToken(EmailTokenPasswordReset, token); userId != 0 {
+		t.Fatalf("account deletion token accepted as password reset token")
+	}
+	if err := RevokeEmailTokens(205); err != nil {
+		t.Fatal(err)
+	}
+	if userId, _ := ConsumeEmailToken(EmailTokenAccountDelete, token); userId != 0 {
+		t.Fatalf("revoked account deletion token should be invalid")
+	}
+}
+
+// 确认关闭两步验证的令牌只能用于关闭两步验证，注销账号时同样被作废
+func TestDisableTOTPToken(t *testing.T) {
+	useTestRedis(t)
+	t.Cleanup(func() { RevokeEmailTokens(206) })
+	token, err := IssueEmailToken(EmailTokenDisableTOTP, 206, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userId, _ := ConsumeEmailToken(EmailTokenAccountDelete, token); userId != 0 {
+		t.Fatalf("disable 2FA token accepted as account deletion token")
+	}
+	if err := RevokeEmailTokens(206); err != nil {
+		t.Fatal(err)
+	}
+	if userId, _ := ConsumeEmailToken(EmailTokenDisableTOTP, token); userId != 0 {
+		t.Fatalf("revoked disable 2FA token should be invalid")
+	}
+}
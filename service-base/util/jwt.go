@@ -1,76 +1,77 @@
 package util
 
 import (
-	"context"
 	"fmt"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v4"
 	"log"
 	"net/http"
 	"strings"
 	"time"
+	"yuqueppbackend/service-base/config"
 )
 
-var (
-	jwtSecretKey = []byte("your_jwt_secret")
-)
-
-const TokenExpireDuration = time.Hour * 24 * 7
-
 // 用于 JWT 的 Claims 结构体
 type Claims struct {
-	ID    int64  `json:"userid"`
-	Email string `json:"email"`
+	ID        int64  `json:"userid"`
+	Email     string `json:"email"`
+	SessionID string `json:"sid"` // 所属登录会话，会话被撤销后 token 立即失效
 	jwt.StandardClaims
 }
 
-// 生成 JWT 的函数
-func GenerateJWT(id int64, email string) (string, error) {
+// GenerateAccessToken 为登录会话签发短期有效的访问令牌
+func GenerateAccessToken(id int64, email, sessionId string) (string, error) {
+	keySet := GetJWTKeySet()
 	claims := &Claims{
-		ID:    id,
-		Email: email,
+		ID:        id,
+		Email:     email,
+		SessionID: sessionId,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(TokenExpireDuration).Unix(), // 设置过期时间
-			IssuedAt:  time.Now().Unix(),                          // 签发时间
-			Issuer:    "your_app_name",                            // 签发者
+			ExpiresAt: time.Now().Add(config.GetAccessTokenTTL()).Unix(), // 设置过期时间
+			IssuedAt:  time.Now().Unix(),                                 // 签发时间
+			Issuer:    keySet.Issuer(),                                   // 签发者
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	// 获取签名后的 token 字符串
-	tokenString, err := token.SignedString(jwtSecretKey)
-	if err != nil {
-		return "", err
-	}
+	// 使用当前签名密钥签名，头部带上 kid 以便轮换后仍能校验旧 token
+	return keySet.Sign(claims)
+}
 
-	// 保存 token 到 Redis（过期时间与 JWT 相同）
-	err = GetRedisClient().Set(context.Background(), tokenString, email, TokenExpireDuration).Err()
-	err = GetRedisClient().Set(context.Background(), email, tokenString, TokenExpireDuration).Err()
-	if err != nil {
-		return "", err
+// ValidateToken 校验访问令牌的签名与有效期，并确认所属会话仍然有效，返回 JWT 中的声明与登录邮箱
+func ValidateToken(tokenString string) (*Claims, string, int, error) {
+	// 解析 JWT，按头部的 kid 选择校验密钥
+	keySet := GetJWTKeySet()
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, keySet.Keyfunc)
+
+	if err != nil || !token.Valid {
+		return nil, "", http.StatusUnauthorized, fmt.Errorf("Invalid or expired token")
 	}
 
-	return tokenString, nil
-}
+	claims, ok := token.Claims.(*Claims)
+	if !ok || claims.SessionID == "" || !claims.VerifyIssuer(keySet.Issuer(), true) {
+		return nil, "", http.StatusUnauthorized, fmt.Errorf("Invalid token claims")
+	}
 
-func DeleteJWT(email string) error {
-	jwtToken := GetRedisClient().Get(context.Background(), email).Val()
-	err := GetRedisClient().Del(context.Background(), jwtToken).Err()
+	// 检查会话是否仍然有效
+	session, err := GetSession(claims.SessionID)
 	if err != nil {
-		return err
+		return nil, "", http.StatusInternalServerError, fmt.Errorf("Redis error")
 	}
-	err = GetRedisClient().Del(context.Background(), email).Err()
-	if err != nil {
-		return err
+	if session == nil || session.UserID != claims.ID {
+		return nil, "", http.StatusUnauthorized, fmt.Errorf("Token is not valid or expired")
 	}
-	return nil
+	TouchSession(session)
+	return claims, session.Email, http.StatusOK, nil
 }
 
 // 验证 Token 的中间件
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
+		// 浏览器的 WebSocket 握手无法携带自定义请求头，允许通过 access_token 查询参数传递
+		if authHeader == "" && strings.EqualFold(c.GetHeader("Upgrade"), "websocket") && c.Query("access_token") != "" {
+			authHeader = "Bearer " + c.Query("access_token")
+		}
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"message": "Authorization header missing"})
 			c.Abort()
@@ -84,43 +85,48 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// 检查 token 是否存在于 Redis 中
-		email, err := GetRedisClient().Get(context.Background(), tokenString).Result()
-		if err == redis.Nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"message": "Token is not valid or expired"})
-			c.Abort()
-			return
-		}
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Redis error"})
-			c.Abort()
-			return
-		}
-
-		// 解析 JWT
-		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			// 只验证签名部分，不验证 JWT 的其他部分
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		// 个人访问令牌
+		if strings.HasPrefix(tokenString, PersonalTokenPrefix) {
+			if !routeDeclaresScope(c) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "该接口不支持使用访问令牌调用"})
+				c.Abort()
+				return
 			}
-			return jwtSecretKey, nil
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid or expired token"})
-			c.Abort()
+			if personalTokenValidator == nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"message": "Personal access token not supported"})
+				c.Abort()
+				return
+			}
+			auth, err := personalTokenValidator(tokenString, c.ClientIP())
+			if err != nil {
+				log.Println(err)
+				c.JSON(http.StatusInternalServerError, gin.H{"message": "Internal error"})
+				c.Abort()
+				return
+			}
+			if auth == nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"message": "Token is not valid or expired"})
+				c.Abort()
+				return
+			}
+			c.Set("userid", auth.UserID)
+			c.Set("email", auth.Email)
+			c.Set("token_id", auth.TokenID)
+			c.Set("token_scopes", auth.Scopes)
+			c.Next()
 			return
 		}
 
-		claims, ok := token.Claims.(*Claims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid token claims"})
+		claims, email, status, err := ValidateToken(tokenString)
+		if err != nil {
+			c.JSON(status, gin.H{"message": err.Error()})
 			c.Abort()
 			return
 		}
 
 		c.Set("userid", claims.ID)
 		c.Set("email", email)
+		c.Set("session_id", claims.SessionID)
 		log.Printf("User ID: %d, Email: %s", claims.ID, claims.Email)
 		// 如果 JWT 有效，可以继续处理请求
 		c.Next()
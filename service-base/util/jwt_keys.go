@@ -0,0 +1,227 @@
+package util
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+	"yuqueppbackend/service-base/config"
+)
+
+// jwtPlaceholderSecret 早期示例配置中的占位密钥，已公开，不能用于签发 token
+const jwtPlaceholderSecret = "dev-only-secret-change-me"
+
+// jwtKey 一把已加载的签名密钥，signKey 为空时只用于校验
+type jwtKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// JWTKeySet 全部可用的 JWT 密钥，按 kid 查找
+type JWTKeySet struct {
+	issuer  string
+	signing *jwtKey
+	keys    map[string]*jwtKey
+}
+
+var (
+	jwtKeySet     *JWTKeySet
+	jwtKeySetOnce sync.Once
+)
+
+// GetJWTKeySet 获取配置中的 JWT 密钥，配置错误时直接退出
+func GetJWTKeySet() *JWTKeySet {
+	jwtKeySetOnce.Do(func() {
+		cfg, err := config.GetJWTConfig()
+		if err != nil {
+			log.Fatalf("Error reading jwt config: %s", err)
+		}
+		keySet, err := NewJWTKeySet(cfg)
+		if err != nil {
+			log.Fatalf("Error loading jwt keys: %s", err)
+		}
+		jwtKeySet = keySet
+	})
+	return jwtKeySet
+}
+
+// NewJWTKeySet 根据配置加载密钥，signing_kid 必须指向一把带私钥的密钥
+func NewJWTKeySet(cfg config.JWTConfig) (*JWTKeySet, error) {
+	keySet := &JWTKeySet{issuer: cfg.Issuer, keys: make(map[string]*jwtKey)}
+	for _, keyCfg := range cfg.Keys {
+		if keyCfg.Kid == "" {
+			return nil, fmt.Errorf("jwt key without kid")
+		}
+		if _, exists := keySet.keys[keyCfg.Kid]; exists {
+			return nil, fmt.Errorf("duplicate jwt kid %s", keyCfg.Kid)
+		}
+		key, err := loadJWTKey(keyCfg)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %s: %w", keyCfg.Kid, err)
+		}
+		keySet.keys[key.kid] = key
+	}
+	signing, ok := keySet.keys[cfg.SigningKid]
+	if !ok {
+		return nil, fmt.Errorf("signing kid %q not found", cfg.SigningKid)
+	}
+	if signing.signKey == nil {
+		return nil, fmt.Errorf("signing key %s has no private key", signing.kid)
+	}
+	keySet.signing = signing
+	return keySet, nil
+}
+
+// readKeyMaterial 依次从配置值、环境变量、文件读取密钥内容
+func readKeyMaterial(value, env, file string) ([]byte, error) {
+	if value != "" {
+		return []byte(value), nil
+	}
+	if env != "" {
+		if v := os.Getenv(env); v != "" {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("environment variable %s is empty", env)
+	}
+	if file != "" {
+		return os.ReadFile(file)
+	}
+	return nil, nil
+}
+
+func loadJWTKey(cfg config.JWTKeyConfig) (*jwtKey, error) {
+	key := &jwtKey{kid: cfg.Kid}
+	switch cfg.Alg {
+	case "HS256":
+		secret, err := readKeyMaterial(cfg.Secret, cfg.SecretEnv, "")
+		if err != nil {
+			return nil, err
+		}
+		if len(secret) < 16 {
+			return nil, fmt.Errorf("HS256 secret must be at least 16 bytes")
+		}
+		if string(secret) == jwtPlaceholderSecret {
+			return nil, fmt.Errorf("HS256 secret is the public placeholder, set a random secret")
+		}
+		key.method = jwt.SigningMethodHS256
+		key.signKey = secret
+		key.verifyKey = secret
+		return key, nil
+	case "RS256", "EdDSA":
+	default:
+		return nil, fmt.Errorf("unsupported alg %q", cfg.Alg)
+	}
+
+	privatePEM, err := readKeyMaterial("", cfg.PrivateKeyEnv, cfg.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	publicPEM, err := readKeyMaterial("", "", cfg.PublicKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if privatePEM == nil && publicPEM == nil {
+		return nil, fmt.Errorf("no key material configured")
+	}
+
+	if cfg.Alg == "RS256" {
+		key.method = jwt.SigningMethodRS256
+		if privatePEM != nil {
+			privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey = privateKey
+			key.verifyKey = &privateKey.PublicKey
+		} else {
+			publicKey, err := jwt.ParseRSAPublicKeyFromPEM(publicPEM)
+			if err != nil {
+				return nil, err
+			}
+			key.verifyKey = publicKey
+		}
+		return key, nil
+	}
+
+	key.method = jwt.SigningMethodEdDSA
+	if privatePEM != nil {
+		privateKey, err := jwt.ParseEdPrivateKeyFromPEM(privatePEM)
+		if err != nil {
+			return nil, err
+		}
+		key.signKey = privateKey
+		key.verifyKey = privateKey.(crypto.Signer).Public()
+	} else {
+		publicKey, err := jwt.ParseEdPublicKeyFromPEM(publicPEM)
+		if err != nil {
+			return nil, err
+		}
+		key.verifyKey = publicKey
+	}
+	return key, nil
+}
+
+// Sign 使用当前签名密钥签发 token，并在头部写入 kid
+func (ks *JWTKeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.method, claims)
+	token.Header["kid"] = ks.signing.kid
+	return token.SignedString(ks.signing.signKey)
+}
+
+// Keyfunc 根据 token 头部的 kid 选择校验密钥，算法必须与密钥一致，防止算法混淆攻击
+func (ks *JWTKeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.verifyKey, nil
+}
+
+// Issuer 签发者
+func (ks *JWTKeySet) Issuer() string {
+	return ks.issuer
+}
+
+// JWKS 返回全部非对称密钥的公钥（RFC 7517），对称密钥不会对外发布
+func (ks *JWTKeySet) JWKS() map[string]interface{} {
+	keys := []map[string]interface{}{}
+	for _, key := range ks.keys {
+		switch publicKey := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, map[string]interface{}{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": key.method.Alg(),
+				"kid": key.kid,
+				"n":   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			keys = append(keys, map[string]interface{}{
+				"kty": "OKP",
+				"crv": "Ed25519",
+				"use": "sig",
+				"alg": key.method.Alg(),
+				"kid": key.kid,
+				"x":   base64.RawURLEncoding.EncodeToString(publicKey),
+			})
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i]["kid"].(string) < keys[j]["kid"].(string)
+	})
+	return map[string]interface{}{"keys": keys}
+}
@@ -0,0 +1,36 @@
+package util
+
+import (
+	"testing"
+	"yuqueppbackend/service-base/config"
+)
+
+func TestNewJWTKeySetRejectsWeakSecrets(t *testing.T) {
+	t.Setenv("TEST_JWT_SECRET_EMPTY", "")
+	cases := map[string]config.JWTKeyConfig{
+		"empty env":   {Kid: "k", Alg: "HS256", SecretEnv: "TEST_JWT_SECRET_EMPTY"},
+		"no material": {Kid: "k", Alg: "HS256"},
+		"too short":   {Kid: "k", Alg: "HS256", Secret: "short"},
+		"placeholder": {Kid: "k", Alg: "HS256", Secret: jwtPlaceholderSecret},
+	}
+	for name, keyCfg := range cases {
+		_, err := NewJWTKeySet(config.JWTConfig{SigningKid: "k", Keys: []config.JWTKeyConfig{keyCfg}})
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestNewJWTKeySetReadsSecretFromEnv(t *testing.T) {
+	t.Setenv("TEST_JWT_SECRET", "0123456789abcdef0123")
+	keySet, err := NewJWTKeySet(config.JWTConfig{
+		SigningKid: "k",
+		Keys:       []config.JWTKeyConfig{{Kid: "k", Alg: "HS256", SecretEnv: "TEST_JWT_SECRET"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(keySet.signing.signKey.([]byte)) != "0123456789abcdef0123" {
+		t.Fatalf("secret not read from environment")
+	}
+}
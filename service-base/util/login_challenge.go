@@ -0,0 +1,86 @@
+package util
+
+import (
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"strconv"
+	"time"
+)
+
+const (
+	// LoginChallengeTTL 两步验证挑战令牌的有效期
+	LoginChallengeTTL = 5 * time.Minute
+	// 每个挑战令牌允许尝试的验证码次数，超过后需要重新登录
+	loginChallengeMaxAttempts = 5
+)
+
+func loginChallengeKey(token string) string {
+	return "loginChallenge:" + HashContent([]byte(token))
+}
+
+// CreateLoginChallenge 密码校验通过但需要两步验证时，签发一个短期有效的挑战令牌
+func CreateLoginChallenge(userId int64) (string, error) {
+	token, err := GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	rdb := GetRedisClient()
+	key := loginChallengeKey(token)
+	pipe := rdb.TxPipeline()
+	pipe.HSet(rdb.Context(), key, "user_id", userId, "attempts", 0)
+	pipe.Expire(rdb.Context(), key, LoginChallengeTTL)
+	if _, err := pipe.Exec(rdb.Context()); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// AttemptLoginChallenge 记录一次验证尝试并返回挑战对应的用户 ID；
+// 挑战不存在、已过期或尝试次数用尽时返回 0
+func AttemptLoginChallenge(token string) (int64, error) {
+	rdb := GetRedisClient()
+	ctx := rdb.Context()
+	key := loginChallengeKey(token)
+	attempts, err := rdb.HIncrBy(ctx, key, "attempts", 1).Result()
+	if err != nil {
+		return 0, err
+	}
+	value, err := rdb.HGet(ctx, key, "user_id").Result()
+	if errors.Is(err, redis.Nil) {
+		// HINCRBY 会创建不存在的 key，需要清理
+		rdb.Del(ctx, key)
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if attempts > loginChallengeMaxAttempts {
+		rdb.Del(ctx, key)
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// ConsumeLoginChallenge 验证成功后作废挑战令牌，并发请求中只有一个会返回 true
+func ConsumeLoginChallenge(token string) (bool, error) {
+	rdb := GetRedisClient()
+	deleted, err := rdb.Del(rdb.Context(), loginChallengeKey(token)).Result()
+	return deleted > 0, err
+}
+
+func totpUsedKey(userId int64, step int64) string {
+	return "totpUsed:" + strconv.FormatInt(userId, 10) + ":" + strconv.FormatInt(step, 10)
+}
+
+// IsTOTPStepUsed 判断用户的 TOTP 时间窗口是否已经使用过，不做记录
+func IsTOTPStepUsed(userId int64, step int64) (bool, error) {
+	rdb := GetRedisClient()
+	count, err := rdb.Exists(rdb.Context(), totpUsedKey(userId, step)).Result()
+	return count > 0, err
+}
+
+// MarkTOTPStepUsed 记录用户已使用过的 TOTP 时间窗口，同一窗口的验证码只能使用一次
+func MarkTOTPStepUsed(userId int64, step int64) (bool, error) {
+	rdb := GetRedisClient()
+	return rdb.SetNX(rdb.Context(), totpUsedKey(userId, step), 1, (2*totpSkew+1)*totpPeriod*time.Second).Result()
+}
@@ -0,0 +1,197 @@
+package util
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"yuqueppbackend/service-base/config"
+)
+
+// 登录防暴力破解在 Redis 中的存储结构：
+//
+//	loginRate:<ip>:<分钟>        每个 IP 每分钟的登录请求数
+//	loginEmailRate:<email>:<分钟> 每个邮箱每分钟的登录请求数
+//	loginFailures:<email>        统计窗口内的连续失败次数
+//	loginDelay:<email>           存在时需要等待其过期后才能再次尝试
+//	loginLock:<email>            存在时账号处于临时锁定状态
+const (
+	loginRateKeyPrefix      = "loginRate:"
+	loginEmailRateKeyPrefix = "loginEmailRate:"
+	loginFailuresKeyPrefix  = "loginFailures:"
+	loginDelayKeyPrefix     = "loginDelay:"
+	loginLockKeyPrefix      = "loginLock:"
+)
+
+// 登录被拒绝的原因，同时作为登录尝试记录中的失败原因
+const (
+	LoginBlockedRateLimit = "rate_limited"
+	LoginBlockedDelay     = "too_frequent"
+	LoginBlockedLocked    = "locked"
+)
+
+// LoginBlock 登录请求被拦截的原因与需要等待的时间
+type LoginBlock struct {
+	Reason     string
+	Status     int
+	RetryAfter time.Duration
+}
+
+// LockedAccount 处于锁定状态的账号
+type LockedAccount struct {
+	Email     string
+	Remaining time.Duration
+}
+
+func normalizeLoginEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// rateLimitedUntilNextMinute 超过每分钟请求数时的拦截结果，等待到下一分钟
+func rateLimitedUntilNextMinute(now time.Time) *LoginBlock {
+	return &LoginBlock{
+		Reason:     LoginBlockedRateLimit,
+		Status:     http.StatusTooManyRequests,
+		RetryAfter: time.Duration(60-now.Unix()%60) * time.Second,
+	}
+}
+
+// CheckLoginAllowed 在校验密码之前检查 IP 与邮箱的请求频率、账号锁定与失败后的等待时间，允许登录时返回 nil。
+// 邮箱的请求频率统计每一次尝试，避免攻击者分散到大量 IP 上绕过限制
+func CheckLoginAllowed(ip, email string) (*LoginBlock, error) {
+	cfg := config.GetLoginGuardConfig()
+	rdb := GetRedisClient()
+	ctx := rdb.Context()
+	email = normalizeLoginEmail(email)
+
+	now := time.Now()
+	minute := ":" + strconv.FormatInt(now.Unix()/60, 10)
+	pipe := rdb.TxPipeline()
+	ipCount := pipe.Incr(ctx, loginRateKeyPrefix+ip+minute)
+	pipe.Expire(ctx, loginRateKeyPrefix+ip+minute, time.Minute)
+	emailCount := pipe.Incr(ctx, loginEmailRateKeyPrefix+email+minute)
+	pipe.Expire(ctx, loginEmailRateKeyPrefix+email+minute, time.Minute)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	if ipCount.Val() > int64(cfg.IPMaxPerMinute) || emailCount.Val() > int64(cfg.EmailMaxPerMinute) {
+		return rateLimitedUntilNextMinute(now), nil
+	}
+
+	if ttl, err := rdb.TTL(ctx, loginLockKeyPrefix+email).Result(); err != nil {
+		return nil, err
+	} else if ttl > 0 {
+		return &LoginBlock{Reason: LoginBlockedLocked, Status: http.StatusLocked, RetryAfter: ttl}, nil
+	}
+	if ttl, err := rdb.TTL(ctx, loginDelayKeyPrefix+email).Result(); err != nil {
+		return nil, err
+	} else if ttl > 0 {
+		return &LoginBlock{Reason: LoginBlockedDelay, Status: http.StatusTooManyRequests, RetryAfter: ttl}, nil
+	}
+	return nil, nil
+}
+
+// 进程内的备用限流，Redis 不可用时使用。各实例单独计数且无法锁定账号，因此阈值比 Redis 限流更严格
+const (
+	localLoginIPMaxPerMinute    = 5
+	localLoginEmailMaxPerMinute = 3
+)
+
+var localLoginLimiter = struct {
+	sync.Mutex
+	minute int64
+	counts map[string]int
+}{counts: make(map[string]int)}
+
+// CheckLoginAllowedLocally 在 CheckLoginAllowed 因 Redis 故障返回错误时使用，按进程内计数限制登录频率，允许登录时返回 nil
+func CheckLoginAllowedLocally(ip, email string, now time.Time) *LoginBlock {
+	email = normalizeLoginEmail(email)
+	localLoginLimiter.Lock()
+	defer localLoginLimiter.Unlock()
+	// 进入新的一分钟时清空计数，内存占用不会随时间增长
+	if minute := now.Unix() / 60; minute != localLoginLimiter.minute {
+		localLoginLimiter.minute = minute
+		localLoginLimiter.counts = make(map[string]int)
+	}
+	localLoginLimiter.counts["ip:"+ip]++
+	localLoginLimiter.counts["email:"+email]++
+	if localLoginLimiter.counts["ip:"+ip] > localLoginIPMaxPerMinute ||
+		localLoginLimiter.counts["email:"+email] > localLoginEmailMaxPerMinute {
+		return rateLimitedUntilNextMinute(now)
+	}
+	return nil
+}
+
+// RecordLoginFailure 记录一次密码或两步验证失败。连续失败达到阈值后要求逐次翻倍的等待时间，
+// 超过上限后临时锁定账号，返回账号是否因此被锁定
+func RecordLoginFailure(email string) (bool, error) {
+	cfg := config.GetLoginGuardConfig()
+	rdb := GetRedisClient()
+	ctx := rdb.Context()
+	email = normalizeLoginEmail(email)
+
+	failuresKey := loginFailuresKeyPrefix + email
+	failures, err := rdb.Incr(ctx, failuresKey).Result()
+	if err != nil {
+		return false, err
+	}
+	if failures == 1 {
+		rdb.Expire(ctx, failuresKey, cfg.FailureWindow)
+	}
+	if failures >= int64(cfg.MaxFailures) {
+		pipe := rdb.TxPipeline()
+		pipe.Set(ctx, loginLockKeyPrefix+email, time.Now().Unix(), cfg.LockoutDuration)
+		pipe.Del(ctx, failuresKey, loginDelayKeyPrefix+email)
+		_, err := pipe.Exec(ctx)
+		return err == nil, err
+	}
+	if failures >= int64(cfg.DelayAfterFailures) {
+		delay := cfg.MaxDelay
+		if shift := failures - int64(cfg.DelayAfterFailures); shift < 16 && time.Second<<shift < delay {
+			delay = time.Second << shift
+		}
+		if err := rdb.Set(ctx, loginDelayKeyPrefix+email, 1, delay).Err(); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// ResetLoginFailures 登录成功后清除失败计数
+func ResetLoginFailures(email string) error {
+	rdb := GetRedisClient()
+	email = normalizeLoginEmail(email)
+	return rdb.Del(rdb.Context(), loginFailuresKeyPrefix+email, loginDelayKeyPrefix+email).Err()
+}
+
+// UnlockAccount 解除账号锁定并清除失败计数，返回账号此前是否处于锁定状态
+func UnlockAccount(email string) (bool, error) {
+	rdb := GetRedisClient()
+	email = normalizeLoginEmail(email)
+	deleted, err := rdb.Del(rdb.Context(), loginLockKeyPrefix+email).Result()
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, ResetLoginFailures(email)
+}
+
+// ListLockedAccounts 列出当前处于锁定状态的账号
+func ListLockedAccounts() ([]LockedAccount, error) {
+	rdb := GetRedisClient()
+	ctx := rdb.Context()
+	var accounts []LockedAccount
+	iter := rdb.Scan(ctx, 0, loginLockKeyPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		ttl, err := rdb.TTL(ctx, key).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ttl <= 0 {
+			continue
+		}
+		accounts = append(accounts, LockedAccount{Email: strings.TrimPrefix(key, loginLockKeyPrefix), Remaining: ttl})
+	}
+	return accounts, iter.Err()
+}
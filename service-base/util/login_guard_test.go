@@ -0,0 +1,72 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func resetLocalLoginLimiter() {
+	localLoginLimiter.Lock()
+	localLoginLimiter.minute = 0
+	localLoginLimiter.counts = make(map[string]int)
+	localLoginLimiter.Unlock()
+}
+
+func TestCheckLoginAllowedLocallyLimitsEmailAcrossIPs(t *testing.T) {
+	resetLocalLoginLimiter()
+	now := time.Unix(6000, 0)
+	for i := 0; i < localLoginEmailMaxPerMinute; i++ {
+		if block := CheckLoginAllowedLocally("10.0.0."+string(rune('1'+i)), "A@example.com", now); block != nil {
+			t.Fatalf("attempt %d blocked", i+1)
+		}
+	}
+	// 同一邮箱换 IP、改变大小写仍然计入同一个计数
+	block := CheckLoginAllowedLocally("10.0.1.1", " a@example.com", now.Add(10*time.Second))
+	if block == nil || block.Reason != LoginBlockedRateLimit {
+		t.Fatalf("attempt beyond the email limit should be blocked, got %+v", block)
+	}
+	if block.RetryAfter != 50*time.Second {
+		t.Fatalf("retry after = %v, want 50s", block.RetryAfter)
+	}
+	// 下一分钟重新计数
+	if block := CheckLoginAllowedLocally("10.0.1.1", "a@example.com", now.Add(time.Minute)); block != nil {
+		t.Fatalf("attempt in the next minute blocked")
+	}
+}
+
+func TestCheckLoginAllowedLocallyLimitsIP(t *testing.T) {
+	resetLocalLoginLimiter()
+	now := time.Unix(6000, 0)
+	for i := 0; i < localLoginIPMaxPerMinute; i++ {
+		if block := CheckLoginAllowedLocally("10.0.0.1", "user"+string(rune('a'+i))+"@example.com", now); block != nil {
+			t.Fatalf("attempt %d blocked", i+1)
+		}
+	}
+	if block := CheckLoginAllowedLocally("10.0.0.1", "other@example.com", now); block == nil {
+		t.Fatalf("attempt beyond the ip limit should be blocked")
+	}
+}
+
+func TestCheckLoginAllowedCountsEveryAttemptPerEmail(t *testing.T) {
+	rdb := useTestRedis(t)
+	email := "guard-test@example.com"
+	t.Cleanup(func() {
+		keys, _ := rdb.Keys(rdb.Context(), "login*"+email+"*").Result()
+		keys = append(keys, rdb.Keys(rdb.Context(), loginRateKeyPrefix+"10.9.*").Val()...)
+		if len(keys) > 0 {
+			rdb.Del(rdb.Context(), keys...)
+		}
+	})
+	limit := 5 // 未配置时的默认值
+	blocked := false
+	for i := 0; i <= limit; i++ {
+		block, err := CheckLoginAllowed("10.9.0."+string(rune('1'+i)), email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocked = block != nil
+	}
+	if !blocked {
+		t.Fatalf("attempt beyond the per-email limit should be blocked even from different IPs")
+	}
+}
@@ -0,0 +1,116 @@
+package util
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"sync"
+	"time"
+	"yuqueppbackend/service-base/config"
+)
+
+// MailMessage 一封纯文本邮件
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer 邮件发送接口
+type Mailer interface {
+	Send(msg MailMessage) error
+}
+
+var (
+	mailer     Mailer
+	mailerOnce sync.Once
+)
+
+// GetMailer 获取配置中选择的邮件发送实现
+func GetMailer() Mailer {
+	mailerOnce.Do(func() {
+		m, err := NewMailer(config.GetMailConfig())
+		if err != nil {
+			log.Fatalf("Error creating mailer: %s", err)
+		}
+		mailer = m
+	})
+	return mailer
+}
+
+// NewMailer 根据 driver 创建邮件发送实现：smtp 或 log（默认）
+func NewMailer(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case "", "log":
+		return &LogMailer{}, nil
+	case "smtp":
+		return NewSMTPMailer(cfg)
+	default:
+		return nil, fmt.Errorf("unknown mail driver: %s", cfg.Driver)
+	}
+}
+
+// LogMailer 只把邮件内容打印到日志，不真正发送，用于本地开发
+type LogMailer struct{}
+
+func (m *LogMailer) Send(msg MailMessage) error {
+	log.Printf("[mail] to=%s subject=%s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// SMTPMailer 通过 SMTP 服务器发送邮件。服务器支持 STARTTLS 时自动加密；
+// 未配置用户名时不进行认证，可以直接对接 MailHog 等本地收件箱
+type SMTPMailer struct {
+	addr string
+	host string
+	from *mail.Address
+	auth smtp.Auth
+}
+
+func NewSMTPMailer(cfg config.MailConfig) (*SMTPMailer, error) {
+	if cfg.SMTPHost == "" {
+		return nil, fmt.Errorf("smtp host is empty")
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mail from %q: %w", cfg.From, err)
+	}
+	m := &SMTPMailer{
+		addr: net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
+		host: cfg.SMTPHost,
+		from: from,
+	}
+	if cfg.SMTPUser != "" {
+		m.auth = smtp.PlainAuth("", cfg.SMTPUser, cfg.SMTPPass, cfg.SMTPHost)
+	}
+	return m, nil
+}
+
+func (m *SMTPMailer) Send(msg MailMessage) error {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", m.from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	// 正文按 76 个字符换行
+	body := base64.StdEncoding.EncodeToString([]byte(msg.Body))
+	for len(body) > 76 {
+		buf.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	buf.WriteString(body + "\r\n")
+	return smtp.SendMail(m.addr, m.auth, m.from.Address, []string{to.Address}, buf.Bytes())
+}
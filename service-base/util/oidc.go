@@ -0,0 +1,321 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/oauth2"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"yuqueppbackend/service-base/config"
+)
+
+const (
+	// OIDCStateTTL 登录发起到回调之间 state 的有效期，state Cookie 的有效期与之一致
+	OIDCStateTTL = 10 * time.Minute
+	// 回调完成后前端用一次性登录码换取令牌的有效期
+	oidcLoginCodeTTL = time.Minute
+	// 请求身份提供方的超时时间
+	oidcHTTPTimeout = 10 * time.Second
+)
+
+// ErrOIDCProviderNotFound 未配置该身份提供方
+var ErrOIDCProviderNotFound = errors.New("oidc provider not found")
+
+var oidcHTTPClient = &http.Client{Timeout: oidcHTTPTimeout}
+
+// OIDCIdentity 身份提供方返回的用户身份
+type OIDCIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// OIDCProvider 一个已配置的身份提供方。端点通过发现文档获取，首次使用时才加载，
+// 身份提供方暂时不可用不会影响服务启动
+type OIDCProvider struct {
+	cfg config.OIDCProviderConfig
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+var (
+	oidcProviders     map[string]*OIDCProvider
+	oidcProvidersOnce sync.Once
+)
+
+// GetOIDCProvider 根据标识获取身份提供方，未配置时返回 ErrOIDCProviderNotFound
+func GetOIDCProvider(name string) (*OIDCProvider, error) {
+	loadOIDCProviders()
+	provider, ok := oidcProviders[name]
+	if !ok {
+		return nil, ErrOIDCProviderNotFound
+	}
+	return provider, nil
+}
+
+// ListOIDCProviders 获取全部已配置的身份提供方，按标识排序
+func ListOIDCProviders() []*OIDCProvider {
+	loadOIDCProviders()
+	providers := make([]*OIDCProvider, 0, len(oidcProviders))
+	for _, provider := range oidcProviders {
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].cfg.Name < providers[j].cfg.Name })
+	return providers
+}
+
+func loadOIDCProviders() {
+	oidcProvidersOnce.Do(func() {
+		oidcProviders = make(map[string]*OIDCProvider)
+		cfg, err := config.GetOIDCConfig()
+		if err != nil {
+			log.Println("读取单点登录配置失败:", err)
+			return
+		}
+		for _, providerCfg := range cfg.Providers {
+			if providerCfg.Name == "" || providerCfg.Issuer == "" || providerCfg.ClientID == "" || providerCfg.RedirectURL == "" {
+				log.Printf("单点登录身份提供方 %q 缺少 name、issuer、client_id 或 redirect_url，已忽略", providerCfg.Name)
+				continue
+			}
+			oidcProviders[providerCfg.Name] = &OIDCProvider{cfg: providerCfg}
+		}
+	})
+}
+
+// Name 身份提供方标识
+func (p *OIDCProvider) Name() string {
+	return p.cfg.Name
+}
+
+// DisplayName 登录页显示的名称，未配置时使用标识
+func (p *OIDCProvider) DisplayName() string {
+	if p.cfg.DisplayName != "" {
+		return p.cfg.DisplayName
+	}
+	return p.cfg.Name
+}
+
+// AllowSignup 是否允许为没有对应账号的用户自动注册
+func (p *OIDCProvider) AllowSignup() bool {
+	return !p.cfg.DisableSignup
+}
+
+func (p *OIDCProvider) context(ctx context.Context) context.Context {
+	return oidc.ClientContext(ctx, oidcHTTPClient)
+}
+
+// discover 加载发现文档，失败时下次调用会重试
+func (p *OIDCProvider) discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider != nil {
+		return p.provider, nil
+	}
+	provider, err := oidc.NewProvider(p.context(ctx), p.cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery for %s: %w", p.cfg.Name, err)
+	}
+	p.provider = provider
+	return provider, nil
+}
+
+func (p *OIDCProvider) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	scopes := []string{oidc.ScopeOpenID}
+	for _, scope := range p.cfg.Scopes {
+		if scope != oidc.ScopeOpenID {
+			scopes = append(scopes, scope)
+		}
+	}
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+}
+
+// AuthCodeURL 生成跳转到身份提供方的授权地址，使用 PKCE（S256）
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return p.oauth2Config(provider).AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// oidcClaims ID Token 与 UserInfo 中用到的声明。部分身份提供方的 email_verified 是字符串
+type oidcClaims struct {
+	Subject           string      `json:"sub"`
+	Nonce             string      `json:"nonce"`
+	Email             string      `json:"email"`
+	EmailVerified     interface{} `json:"email_verified"`
+	Name              string      `json:"name"`
+	PreferredUsername string      `json:"preferred_username"`
+}
+
+func (claims *oidcClaims) emailVerified() (verified bool, present bool) {
+	switch value := claims.EmailVerified.(type) {
+	case bool:
+		return value, true
+	case string:
+		parsed, err := strconv.ParseBool(value)
+		return err == nil && parsed, true
+	}
+	return false, false
+}
+
+// Exchange 使用授权码与 PKCE verifier 换取令牌，校验 ID Token 的签名、签发者、受众与 nonce，返回用户身份。
+// ID Token 中没有邮箱时会再请求 UserInfo 端点
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*OIDCIdentity, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx = p.context(ctx)
+	token, err := p.oauth2Config(provider).Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("oidc code exchange: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("oidc: token response has no id_token")
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("oidc id_token: %w", err)
+	}
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("oidc: nonce mismatch")
+	}
+
+	if claims.Email == "" && provider.UserInfoEndpoint() != "" {
+		userInfo, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(token))
+		if err != nil {
+			return nil, fmt.Errorf("oidc userinfo: %w", err)
+		}
+		// UserInfo 的 sub 必须与 ID Token 一致（OIDC Core 5.3.2）
+		if userInfo.Subject != idToken.Subject {
+			return nil, errors.New("oidc: userinfo subject mismatch")
+		}
+		var infoClaims oidcClaims
+		if err := userInfo.Claims(&infoClaims); err != nil {
+			return nil, err
+		}
+		claims.Email = infoClaims.Email
+		claims.EmailVerified = infoClaims.EmailVerified
+		if claims.Name == "" {
+			claims.Name = infoClaims.Name
+		}
+		if claims.PreferredUsername == "" {
+			claims.PreferredUsername = infoClaims.PreferredUsername
+		}
+	}
+
+	identity := &OIDCIdentity{
+		Subject: idToken.Subject,
+		Email:   strings.TrimSpace(claims.Email),
+		Name:    strings.TrimSpace(claims.Name),
+	}
+	if identity.Name == "" {
+		identity.Name = strings.TrimSpace(claims.PreferredUsername)
+	}
+	verified, present := claims.emailVerified()
+	identity.EmailVerified = identity.Email != "" && (verified || (!present && p.cfg.TrustEmail))
+	return identity, nil
+}
+
+// OIDCLoginState 发起登录时保存的状态，回调时用于校验并完成 PKCE
+type OIDCLoginState struct {
+	Provider string
+	Nonce    string
+	Verifier string
+}
+
+func oidcStateKey(state string) string {
+	return "oidcState:" + HashContent([]byte(state))
+}
+
+// CreateOIDCLoginState 生成 state、nonce 与 PKCE verifier 并保存到 Redis，返回 state 与保存的内容
+func CreateOIDCLoginState(provider string) (string, *OIDCLoginState, error) {
+	state, err := GenerateRandomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	nonce, err := GenerateRandomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	loginState := &OIDCLoginState{Provider: provider, Nonce: nonce, Verifier: oauth2.GenerateVerifier()}
+	rdb := GetRedisClient()
+	key := oidcStateKey(state)
+	pipe := rdb.TxPipeline()
+	pipe.HSet(rdb.Context(), key, "provider", loginState.Provider, "nonce", loginState.Nonce, "verifier", loginState.Verifier)
+	pipe.Expire(rdb.Context(), key, OIDCStateTTL)
+	if _, err := pipe.Exec(rdb.Context()); err != nil {
+		return "", nil, err
+	}
+	return state, loginState, nil
+}
+
+// ConsumeOIDCLoginState 取出并作废 state，不存在或已过期时返回 nil
+func ConsumeOIDCLoginState(state string) (*OIDCLoginState, error) {
+	rdb := GetRedisClient()
+	ctx := rdb.Context()
+	key := oidcStateKey(state)
+	pipe := rdb.TxPipeline()
+	getCmd := pipe.HGetAll(ctx, key)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	values := getCmd.Val()
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return &OIDCLoginState{Provider: values["provider"], Nonce: values["nonce"], Verifier: values["verifier"]}, nil
+}
+
+func oidcLoginCodeKey(code string) string {
+	return "oidcLoginCode:" + HashContent([]byte(code))
+}
+
+// IssueOIDCLoginCode 回调完成后签发一次性登录码，前端通过 exchange 接口换取令牌，避免令牌出现在地址栏中
+func IssueOIDCLoginCode(userId int64) (string, error) {
+	code, err := GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	rdb := GetRedisClient()
+	if err := rdb.Set(rdb.Context(), oidcLoginCodeKey(code), userId, oidcLoginCodeTTL).Err(); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ConsumeOIDCLoginCode 校验并作废一次性登录码，返回对应的用户 ID；无效或已使用时返回 0
+func ConsumeOIDCLoginCode(code string) (int64, error) {
+	rdb := GetRedisClient()
+	value, err := rdb.GetDel(rdb.Context(), oidcLoginCodeKey(code)).Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
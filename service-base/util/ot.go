@@ -0,0 +1,265 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// TextOperation 纯文本的操作变换（OT）操作，格式与 ot.js 保持一致：
+// JSON 数组中正整数表示保留 n 个字符，负整数表示删除 n 个字符，字符串表示插入文本。
+// 所有长度与位置均以 Unicode 码点计算。
+type TextOperation struct {
+	ops          []otComponent
+	BaseLength   int // 操作可以作用的文档长度
+	TargetLength int // 操作作用后的文档长度
+}
+
+type otComponent struct {
+	retain int
+	delete int
+	insert string
+}
+
+func (c otComponent) isRetain() bool { return c.retain > 0 }
+func (c otComponent) isDelete() bool { return c.delete > 0 }
+func (c otComponent) isInsert() bool { return c.insert != "" }
+
+// Retain 保留 n 个字符
+func (op *TextOperation) Retain(n int) *TextOperation {
+	if n <= 0 {
+		return op
+	}
+	op.BaseLength += n
+	op.TargetLength += n
+	if last := len(op.ops) - 1; last >= 0 && op.ops[last].isRetain() {
+		op.ops[last].retain += n
+		return op
+	}
+	op.ops = append(op.ops, otComponent{retain: n})
+	return op
+}
+
+// Insert 在当前位置插入文本
+func (op *TextOperation) Insert(s string) *TextOperation {
+	if s == "" {
+		return op
+	}
+	op.TargetLength += utf8.RuneCountInString(s)
+	last := len(op.ops) - 1
+	switch {
+	case last >= 0 && op.ops[last].isInsert():
+		op.ops[last].insert += s
+	case last >= 0 && op.ops[last].isDelete():
+		// 插入总是放在删除之前，保证同一操作只有一种规范形式
+		if last > 0 && op.ops[last-1].isInsert() {
+			op.ops[last-1].insert += s
+		} else {
+			op.ops = append(op.ops, op.ops[last])
+			op.ops[last] = otComponent{insert: s}
+		}
+	default:
+		op.ops = append(op.ops, otComponent{insert: s})
+	}
+	return op
+}
+
+// Delete 删除 n 个字符
+func (op *TextOperation) Delete(n int) *TextOperation {
+	if n <= 0 {
+		return op
+	}
+	op.BaseLength += n
+	if last := len(op.ops) - 1; last >= 0 && op.ops[last].isDelete() {
+		op.ops[last].delete += n
+		return op
+	}
+	op.ops = append(op.ops, otComponent{delete: n})
+	return op
+}
+
+// IsNoop 判断操作是否不会修改文档
+func (op *TextOperation) IsNoop() bool {
+	return len(op.ops) == 0 || (len(op.ops) == 1 && op.ops[0].isRetain())
+}
+
+// MarshalJSON 序列化为 ot.js 格式
+func (op TextOperation) MarshalJSON() ([]byte, error) {
+	items := make([]interface{}, 0, len(op.ops))
+	for _, c := range op.ops {
+		switch {
+		case c.isRetain():
+			items = append(items, c.retain)
+		case c.isDelete():
+			items = append(items, -c.delete)
+		default:
+			items = append(items, c.insert)
+		}
+	}
+	return json.Marshal(items)
+}
+
+// UnmarshalJSON 从 ot.js 格式解析操作
+func (op *TextOperation) UnmarshalJSON(data []byte) error {
+	var items []interface{}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+	*op = TextOperation{}
+	for _, item := range items {
+		switch v := item.(type) {
+		case float64:
+			if v != float64(int(v)) {
+				return fmt.Errorf("invalid operation component: %v", v)
+			}
+			if v > 0 {
+				op.Retain(int(v))
+			} else if v < 0 {
+				op.Delete(int(-v))
+			}
+		case string:
+			op.Insert(v)
+		default:
+			return fmt.Errorf("invalid operation component: %v", v)
+		}
+	}
+	return nil
+}
+
+// Apply 将操作作用于文本，返回新的文本
+func (op *TextOperation) Apply(text string) (string, error) {
+	runes := []rune(text)
+	if len(runes) != op.BaseLength {
+		return "", fmt.Errorf("operation base length %d does not match document length %d", op.BaseLength, len(runes))
+	}
+	var result strings.Builder
+	index := 0
+	for _, c := range op.ops {
+		switch {
+		case c.isRetain():
+			result.WriteString(string(runes[index : index+c.retain]))
+			index += c.retain
+		case c.isDelete():
+			index += c.delete
+		default:
+			result.WriteString(c.insert)
+		}
+	}
+	return result.String(), nil
+}
+
+// TransformIndex 计算光标位置在操作作用后的新位置，插入发生在光标处时光标后移
+func (op *TextOperation) TransformIndex(index int) int {
+	newIndex := index
+	pos := 0
+	for _, c := range op.ops {
+		if pos > index {
+			break
+		}
+		switch {
+		case c.isRetain():
+			pos += c.retain
+		case c.isInsert():
+			newIndex += utf8.RuneCountInString(c.insert)
+		default:
+			newIndex -= min(c.delete, index-pos)
+			pos += c.delete
+		}
+	}
+	return newIndex
+}
+
+// TransformOperation 对两个基于同一文档状态的并发操作进行变换，返回 (a', b')，
+// 满足 apply(apply(S, a), b') == apply(apply(S, b), a')。同一位置的插入 a 排在前面。
+func TransformOperation(a, b *TextOperation) (*TextOperation, *TextOperation, error) {
+	if a.BaseLength != b.BaseLength {
+		return nil, nil, errors.New("both operations have to have the same base length")
+	}
+	aPrime, bPrime := &TextOperation{}, &TextOperation{}
+	ops1, ops2 := a.ops, b.ops
+	i1, i2 := 0, 0
+	next := func(ops []otComponent, i *int) *otComponent {
+		if *i >= len(ops) {
+			return nil
+		}
+		c := ops[*i]
+		*i++
+		return &c
+	}
+	op1, op2 := next(ops1, &i1), next(ops2, &i2)
+	for op1 != nil || op2 != nil {
+		if op1 != nil && op1.isInsert() {
+			aPrime.Insert(op1.insert)
+			bPrime.Retain(utf8.RuneCountInString(op1.insert))
+			op1 = next(ops1, &i1)
+			continue
+		}
+		if op2 != nil && op2.isInsert() {
+			aPrime.Retain(utf8.RuneCountInString(op2.insert))
+			bPrime.Insert(op2.insert)
+			op2 = next(ops2, &i2)
+			continue
+		}
+		if op1 == nil || op2 == nil {
+			return nil, nil, errors.New("cannot transform operations: first operation is too short or too long")
+		}
+
+		switch {
+		case op1.isRetain() && op2.isRetain():
+			n := min(op1.retain, op2.retain)
+			aPrime.Retain(n)
+			bPrime.Retain(n)
+			op1.retain -= n
+			op2.retain -= n
+		case op1.isDelete() && op2.isDelete():
+			// 双方删除了同一段文本，变换后都无需再删除
+			n := min(op1.delete, op2.delete)
+			op1.delete -= n
+			op2.delete -= n
+		case op1.isDelete() && op2.isRetain():
+			n := min(op1.delete, op2.retain)
+			aPrime.Delete(n)
+			op1.delete -= n
+			op2.retain -= n
+		case op1.isRetain() && op2.isDelete():
+			n := min(op1.retain, op2.delete)
+			bPrime.Delete(n)
+			op1.retain -= n
+			op2.delete -= n
+		}
+		if op1.retain == 0 && op1.delete == 0 {
+			op1 = next(ops1, &i1)
+		}
+		if op2.retain == 0 && op2.delete == 0 {
+			op2 = next(ops2, &i2)
+		}
+	}
+	return aPrime, bPrime, nil
+}
+
+// NewTextOperationFromDiff 根据两段文本的差异构造一个从 oldText 变换到 newText 的操作
+func NewTextOperationFromDiff(oldText, newText string) *TextOperation {
+	split := func(text string) []string {
+		runes := []rune(text)
+		chars := make([]string, len(runes))
+		for i, r := range runes {
+			chars[i] = string(r)
+		}
+		return chars
+	}
+	oldChars, newChars := split(oldText), split(newText)
+	op := &TextOperation{}
+	for _, d := range myersDiff(oldChars, newChars) {
+		switch d.kind {
+		case DiffEqual:
+			op.Retain(1)
+		case DiffDelete:
+			op.Delete(1)
+		case DiffAdd:
+			op.Insert(newChars[d.newIndex])
+		}
+	}
+	return op
+}
@@ -0,0 +1,170 @@
+package util
+
+import (
+	"encoding/json"
+	"math/rand"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// randomOperation 随机生成一个可以作用于 text 的操作
+func randomOperation(rng *rand.Rand, text string) *TextOperation {
+	alphabet := []string{"a", "b", "语", "雀", "\n"}
+	op := &TextOperation{}
+	left := utf8.RuneCountInString(text)
+	for left > 0 {
+		n := 1 + rng.Intn(left)
+		switch rng.Intn(3) {
+		case 0:
+			op.Retain(n)
+			left -= n
+		case 1:
+			op.Delete(n)
+			left -= n
+		default:
+			op.Insert(alphabet[rng.Intn(len(alphabet))])
+		}
+	}
+	if rng.Intn(2) == 0 {
+		op.Insert(alphabet[rng.Intn(len(alphabet))])
+	}
+	return op
+}
+
+func mustApply(t *testing.T, op *TextOperation, text string) string {
+	t.Helper()
+	result, err := op.Apply(text)
+	if err != nil {
+		t.Fatalf("apply %v to %q: %v", op, text, err)
+	}
+	return result
+}
+
+func TestTextOperationApply(t *testing.T) {
+	op := (&TextOperation{}).Retain(2).Insert("语雀").Delete(1).Retain(1)
+	if got := mustApply(t, op, "abcd"); got != "ab语雀d" {
+		t.Fatalf("apply = %q, want %q", got, "ab语雀d")
+	}
+	if _, err := op.Apply("abc"); err == nil {
+		t.Fatalf("apply to text of wrong length should fail")
+	}
+}
+
+func TestTextOperationJSONRoundTrip(t *testing.T) {
+	op := (&TextOperation{}).Retain(3).Insert("x").Delete(2)
+	data, err := json.Marshal(op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `[3,"x",-2]` {
+		t.Fatalf("marshal = %s", data)
+	}
+	var decoded TextOperation
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.BaseLength != 5 || decoded.TargetLength != 4 {
+		t.Fatalf("lengths = %d/%d, want 5/4", decoded.BaseLength, decoded.TargetLength)
+	}
+}
+
+func TestTransformOperationConverges(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		text := strings.Repeat("ab语", rng.Intn(6))
+		a, b := randomOperation(rng, text), randomOperation(rng, text)
+		aPrime, bPrime, err := TransformOperation(a, b)
+		if err != nil {
+			t.Fatalf("transform: %v", err)
+		}
+		left := mustApply(t, bPrime, mustApply(t, a, text))
+		right := mustApply(t, aPrime, mustApply(t, b, text))
+		if left != right {
+			t.Fatalf("diverged on %q: %q != %q", text, left, right)
+		}
+	}
+}
+
+func TestTransformOperationInsertTieBreak(t *testing.T) {
+	a := (&TextOperation{}).Retain(1).Insert("A").Retain(1)
+	b := (&TextOperation{}).Retain(1).Insert("B").Retain(1)
+	aPrime, bPrime, err := TransformOperation(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同一位置的插入，a 排在前面
+	if got := mustApply(t, bPrime, mustApply(t, a, "xy")); got != "xABy" {
+		t.Fatalf("got %q, want %q", got, "xABy")
+	}
+	if got := mustApply(t, aPrime, mustApply(t, b, "xy")); got != "xABy" {
+		t.Fatalf("got %q, want %q", got, "xABy")
+	}
+}
+
+func TestTransformOperationRejectsDifferentBase(t *testing.T) {
+	a := (&TextOperation{}).Retain(2)
+	b := (&TextOperation{}).Retain(3)
+	if _, _, err := TransformOperation(a, b); err == nil {
+		t.Fatalf("transform of operations with different base length should fail")
+	}
+}
+
+// 依次变换多个并发操作，与服务端将操作变换过历史记录的方式一致
+func TestTransformOperationAgainstHistory(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 200; i++ {
+		text := strings.Repeat("语ab", 1+rng.Intn(5))
+		current := text
+		var history []*TextOperation
+		for j := 0; j < 3; j++ {
+			op := randomOperation(rng, current)
+			history = append(history, op)
+			current = mustApply(t, op, current)
+		}
+		// 客户端基于最初的 text 提交操作
+		client := randomOperation(rng, text)
+		clientSide := mustApply(t, client, text)
+		for _, concurrent := range history {
+			var concurrentPrime *TextOperation
+			var err error
+			client, concurrentPrime, err = TransformOperation(client, concurrent)
+			if err != nil {
+				t.Fatalf("transform: %v", err)
+			}
+			clientSide = mustApply(t, concurrentPrime, clientSide)
+		}
+		if server := mustApply(t, client, current); server != clientSide {
+			t.Fatalf("diverged: server %q, client %q", server, clientSide)
+		}
+	}
+}
+
+// 被删除区间内的光标移到删除处，插入处的光标后移
+func TestTransformIndex(t *testing.T) {
+	op := (&TextOperation{}).Retain(2).Insert("xyz").Delete(2).Retain(2)
+	cases := []struct{ index, want int }{
+		{0, 0}, {1, 1}, {2, 5}, {3, 5}, {4, 5}, {5, 6}, {6, 7},
+	}
+	for _, tc := range cases {
+		if got := op.TransformIndex(tc.index); got != tc.want {
+			t.Errorf("TransformIndex(%d) = %d, want %d", tc.index, got, tc.want)
+		}
+	}
+}
+
+func TestNewTextOperationFromDiff(t *testing.T) {
+	cases := [][2]string{
+		{"", ""},
+		{"", "语雀"},
+		{"hello world", "hello, 语雀 world!"},
+		{"abc", ""},
+		{strings.Repeat("旧内容\n", 3000), strings.Repeat("新内容\n", 3000)},
+	}
+	for _, tc := range cases {
+		op := NewTextOperationFromDiff(tc[0], tc[1])
+		if got := mustApply(t, op, tc[0]); got != tc[1] {
+			t.Fatalf("diff op does not reproduce new text for %.20q", tc[1])
+		}
+	}
+}
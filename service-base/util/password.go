@@ -0,0 +1,48 @@
+package util
+
+import (
+	"crypto/subtle"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"yuqueppbackend/service-base/config"
+)
+
+// ErrPasswordTooLong bcrypt 最多只使用密码的前 72 个字节
+var ErrPasswordTooLong = errors.New("password exceeds 72 bytes")
+
+// HashPassword 使用 bcrypt 计算密码哈希，cost 由配置 security.bcrypt_cost 决定
+func HashPassword(password string) (string, error) {
+	if len(password) > 72 {
+		return "", ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), config.GetBcryptCost())
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword 校验密码与 bcrypt 哈希是否匹配
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// IsPasswordHash 判断存储的密码是否已经是 bcrypt 哈希（早期版本以明文存储）
+func IsPasswordHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$")
+}
+
+// VerifyStoredPassword 校验用户输入的密码与数据库中存储的密码是否匹配，兼容历史明文密码。
+// needsRehash 为 true 表示校验通过但存储格式需要升级（明文或 cost 与当前配置不一致）。
+func VerifyStoredPassword(stored, password string) (ok bool, needsRehash bool) {
+	if !IsPasswordHash(stored) {
+		ok = subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return ok, ok
+	}
+	if !CheckPassword(stored, password) {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(stored))
+	return true, err != nil || cost != config.GetBcryptCost()
+}
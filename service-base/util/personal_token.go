@@ -0,0 +1,98 @@
+package util
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"reflect"
+	"runtime"
+)
+
+// PersonalTokenPrefix 个人访问令牌的固定前缀，AuthMiddleware 据此区分令牌与 JWT
+const PersonalTokenPrefix = "yqp_"
+
+// PersonalTokenAuth 个人访问令牌校验通过后的身份信息
+type PersonalTokenAuth struct {
+	TokenID int64
+	UserID  int64
+	Email   string
+	Scopes  []string
+}
+
+// PersonalTokenValidator 校验个人访问令牌，令牌无效时返回 nil。
+// 令牌保存在数据库中，由上层在启动时通过 SetPersonalTokenValidator 注册实现
+type PersonalTokenValidator func(token, ip string) (*PersonalTokenAuth, error)
+
+var personalTokenValidator PersonalTokenValidator
+
+// SetPersonalTokenValidator 注册个人访问令牌的校验实现
+func SetPersonalTokenValidator(validator PersonalTokenValidator) {
+	personalTokenValidator = validator
+}
+
+// GeneratePersonalToken 生成新的个人访问令牌
+func GeneratePersonalToken() (string, error) {
+	token, err := GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	return PersonalTokenPrefix + token, nil
+}
+
+// HasScope 判断当前请求是否拥有指定权限范围，通过登录会话访问时拥有全部权限
+func HasScope(c *gin.Context, scope string) bool {
+	value, exists := c.Get("token_scopes")
+	if !exists {
+		return true
+	}
+	for _, s := range value.([]string) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope 要求个人访问令牌拥有指定权限范围
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasScope(c, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "访问令牌缺少 " + scope + " 权限"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// scopeDeclarationNames RequireScope 与 RequireSession 返回的中间件在 gin 中的函数名。
+// 个人访问令牌只能调用声明了其中之一的路由，新增路由忘记声明权限范围时默认拒绝
+var scopeDeclarationNames = map[string]bool{
+	handlerName(RequireScope("")): true,
+	handlerName(RequireSession()): true,
+}
+
+func handlerName(handler gin.HandlerFunc) string {
+	return runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+}
+
+// routeDeclaresScope 判断当前路由的处理链中是否声明了个人访问令牌的权限范围
+func routeDeclaresScope(c *gin.Context) bool {
+	for _, name := range c.HandlerNames() {
+		if scopeDeclarationNames[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireSession 只允许通过登录会话访问，用于密码、两步验证、令牌管理等账号安全相关接口
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, exists := c.Get("token_scopes"); exists {
+			c.JSON(http.StatusForbidden, gin.H{"error": "该接口不支持使用访问令牌调用"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
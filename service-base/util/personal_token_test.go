@@ -0,0 +1,54 @@
+package util
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newScopeTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	previous := personalTokenValidator
+	SetPersonalTokenValidator(func(token, ip string) (*PersonalTokenAuth, error) {
+		if token != PersonalTokenPrefix+"valid" {
+			return nil, nil
+		}
+		return &PersonalTokenAuth{TokenID: 1, UserID: 2, Email: "a@example.com", Scopes: []string{"docs:read"}}, nil
+	})
+	t.Cleanup(func() { personalTokenValidator = previous })
+
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r := gin.New()
+	group := r.Group("/", AuthMiddleware())
+	group.GET("/undeclared", ok)
+	group.GET("/read", RequireScope("docs:read"), ok)
+	group.GET("/write", RequireScope("docs:write"), ok)
+	group.GET("/session", RequireSession(), ok)
+	return r
+}
+
+func TestAuthMiddlewarePersonalTokenScopes(t *testing.T) {
+	r := newScopeTestRouter(t)
+	cases := []struct {
+		path, token string
+		want        int
+	}{
+		// 没有声明权限范围的路由默认拒绝个人访问令牌
+		{"/undeclared", "valid", http.StatusForbidden},
+		{"/read", "valid", http.StatusOK},
+		{"/write", "valid", http.StatusForbidden},
+		{"/session", "valid", http.StatusForbidden},
+		{"/read", "invalid", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Header.Set("Authorization", "Bearer "+PersonalTokenPrefix+tc.token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s with %s token: status = %d, want %d", tc.path, tc.token, w.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package util
+
+import (
+	"github.com/go-redis/redis/v8"
+	"time"
+)
+
+// rateLimitKeyPrefix 通用频率限制计数在 Redis 中的键前缀，完整键为 rateLimit:<场景>:<标识>
+const rateLimitKeyPrefix = "rateLimit:"
+
+// rateLimitScript 固定窗口计数：窗口内第一次计数时设置过期时间，返回计数与窗口剩余毫秒数
+var rateLimitScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return {count, redis.call("PTTL", KEYS[1])}
+`)
+
+// CheckRateLimit 在 window 窗口内为 key 计数一次，超过 limit 次时返回 false 与需要等待的时间
+func CheckRateLimit(key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	rdb := GetRedisClient()
+	result, err := rateLimitScript.Run(rdb.Context(), rdb, []string{rateLimitKeyPrefix + key}, window.Milliseconds()).Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	count, _ := result[0].(int64)
+	ttl, _ := result[1].(int64)
+	if count > int64(limit) {
+		return false, time.Duration(ttl) * time.Millisecond, nil
+	}
+	return true, 0, nil
+}
@@ -0,0 +1,47 @@
+package util
+
+import (
+	"github.com/go-redis/redis/v8"
+	"os"
+	"testing"
+	"time"
+	"yuqueppbackend/service-base/config"
+)
+
+// useTestRedis 让 GetRedisClient 返回测试用的 Redis 连接，地址通过 TEST_REDIS_ADDR 指定（默认 localhost:6379），
+// 使用 15 号库；连接不上时跳过测试
+func useTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr, DB: 15, DialTimeout: 200 * time.Millisecond})
+	if err := client.Ping(client.Context()).Err(); err != nil {
+		client.Close()
+		t.Skipf("redis not available at %s: %v", addr, err)
+	}
+	once.Do(func() {})
+	previous := redisClient
+	redisClient = client
+	t.Cleanup(func() {
+		redisClient = previous
+		client.Close()
+	})
+	return client
+}
+
+// useTestJWTKeys 使用固定的 HS256 测试密钥签发访问令牌
+func useTestJWTKeys(t *testing.T) {
+	t.Helper()
+	keySet, err := NewJWTKeySet(config.JWTConfig{
+		Issuer:     "yuquepp-test",
+		SigningKid: "test",
+		Keys:       []config.JWTKeyConfig{{Kid: "test", Alg: "HS256", Secret: "test-secret-0123456789"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtKeySetOnce.Do(func() {})
+	jwtKeySet = keySet
+}
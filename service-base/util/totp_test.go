@@ -0,0 +1,111 @@
+package util
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录 B 中 SHA1 的测试密钥 "12345678901234567890"
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestValidateTOTPRFC6238Vectors(t *testing.T) {
+	// RFC 给出的是 8 位验证码，6 位验证码取其后 6 位
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tc := range cases {
+		step, ok := ValidateTOTP(rfc6238Secret, tc.code, time.Unix(tc.unix, 0))
+		if !ok {
+			t.Errorf("code %s at %d rejected", tc.code, tc.unix)
+			continue
+		}
+		if step != tc.unix/totpPeriod {
+			t.Errorf("step = %d, want %d", step, tc.unix/totpPeriod)
+		}
+	}
+}
+
+func TestValidateTOTPSkewWindow(t *testing.T) {
+	// 验证码 287082 属于第 1 个时间窗口（30-59 秒）
+	if step, ok := ValidateTOTP(rfc6238Secret, "287082", time.Unix(89, 0)); !ok || step != 1 {
+		t.Fatalf("code from the previous window should be accepted, got %d, %v", step, ok)
+	}
+	if step, ok := ValidateTOTP(rfc6238Secret, "287082", time.Unix(0, 0)); !ok || step != 1 {
+		t.Fatalf("code from the next window should be accepted, got %d, %v", step, ok)
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, "287082", time.Unix(119, 0)); ok {
+		t.Fatalf("code two windows old should be rejected")
+	}
+}
+
+func TestValidateTOTPRejectsMalformedInput(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870821", "abcdef"} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, now); ok {
+			t.Errorf("code %q accepted", code)
+		}
+	}
+	if _, ok := ValidateTOTP("not base32!", "287082", now); ok {
+		t.Errorf("invalid secret accepted")
+	}
+	// 密钥大小写与验证码首尾空白不影响校验
+	if _, ok := ValidateTOTP(strings.ToLower(rfc6238Secret), " 287082 ", now); !ok {
+		t.Errorf("lowercase secret or padded code rejected")
+	}
+}
+
+func TestMarkTOTPStepUsedRejectsReplay(t *testing.T) {
+	rdb := useTestRedis(t)
+	step, ok := ValidateTOTP(rfc6238Secret, "287082", time.Unix(59, 0))
+	if !ok {
+		t.Fatal("code rejected")
+	}
+	t.Cleanup(func() { rdb.Del(rdb.Context(), "totpUsed:301:1") })
+	if used, err := IsTOTPStepUsed(301, step); err != nil || used {
+		t.Fatalf("unused window reported as used = %v, %v", used, err)
+	}
+	if fresh, err := MarkTOTPStepUsed(301, step); err != nil || !fresh {
+		t.Fatalf("first use = %v, %v", fresh, err)
+	}
+	if fresh, err := MarkTOTPStepUsed(301, step); err != nil || fresh {
+		t.Fatalf("replay in the same window = %v, %v, want rejected", fresh, err)
+	}
+	if used, err := IsTOTPStepUsed(301, step); err != nil || !used {
+		t.Fatalf("used window = %v, %v, want used", used, err)
+	}
+	// 其他用户不受影响
+	t.Cleanup(func() { rdb.Del(rdb.Context(), "totpUsed:302:1") })
+	if fresh, _ := MarkTOTPStepUsed(302, step); !fresh {
+		t.Fatalf("another user's use of the same window should be allowed")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	format := regexp.MustCompile(`^[a-hj-km-np-z02-9]{5}-[a-hj-km-np-z02-9]{5}$`)
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if !format.MatchString(code) {
+			t.Errorf("code %q has unexpected format", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+		if got := NormalizeRecoveryCode(" " + strings.ToUpper(strings.ReplaceAll(code, "-", "")) + " "); got != code {
+			t.Errorf("normalize = %q, want %q", got, code)
+		}
+	}
+}